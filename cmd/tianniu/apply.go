@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+func applyCommand() *command {
+	return &command{
+		name:    "apply",
+		usage:   "apply -f <file|dir> [--dry-run] [--prune -l selector [--yes]]",
+		summary: "Create or update deployments to match manifest files",
+		run:     runApply,
+	}
+}
+
+func runApply(a *app, cmd *command, args []string) error {
+	var file string
+	var yes bool
+	var opts tianniu.ApplyOptions
+	fs := a.flagSet(cmd)
+	fs.StringVar(&file, "f", "", "Manifest file, or directory of JSON and YAML manifests")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "Show what would change without changing anything")
+	fs.BoolVar(&opts.Prune, "prune", false, "Delete deployments matching -l in the manifests' environments that no manifest declares")
+	fs.StringVar(&opts.PruneSelector, "l", "", "Label selector of the deployments the manifests manage, required with --prune")
+	fs.BoolVar(&yes, "yes", false, "Prune without asking for confirmation")
+	if err := a.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if file == "" {
+		return usageErrorf("manifest file or directory required (-f)")
+	}
+	if opts.Prune && opts.PruneSelector == "" {
+		return usageErrorf("--prune requires a label selector (-l) scoping the deployments to delete")
+	}
+	if opts.PruneSelector != "" {
+		if !opts.Prune {
+			return usageErrorf("-l can only be used with --prune")
+		}
+		if _, err := tianniu.ParseSelector(opts.PruneSelector); err != nil {
+			return usageErrorf("invalid selector: %v", err)
+		}
+	}
+
+	manifests, err := readManifests(file)
+	if err != nil {
+		return err
+	}
+	env, err := a.environment()
+	if err != nil {
+		return err
+	}
+	for _, m := range manifests {
+		if m.Environment == "" {
+			m.Environment = env.Name
+		}
+	}
+
+	if err := a.checkDeployments(manifests); err != nil {
+		return err
+	}
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	if opts.Prune && !opts.DryRun && !yes {
+		ok, err := a.confirmPrune(client, manifests, opts)
+		if err != nil || !ok {
+			return err
+		}
+	}
+	results, applyErr := client.Deployments.Apply(a.ctx, manifests, opts)
+	if err := a.print(results, func(w io.Writer) { writeApplyResults(w, results, opts.DryRun) }); err != nil {
+		return err
+	}
+	return applyErr
+}
+
+// confirmPrune lists the deployments an apply would prune, found by a dry
+// run, and asks whether to delete them. It is true when there are none.
+func (a *app) confirmPrune(client *tianniu.Client, manifests []*tianniu.Deployment, opts tianniu.ApplyOptions) (bool, error) {
+	opts.DryRun = true
+	preview, err := client.Deployments.Apply(a.ctx, manifests, opts)
+	if err != nil {
+		return false, err
+	}
+	var pruned []string
+	for _, r := range preview {
+		if r.Action == tianniu.ApplyPruned {
+			pruned = append(pruned, fmt.Sprintf("deployment/%s (%s)", r.Name, r.Environment))
+		}
+	}
+	if len(pruned) == 0 {
+		return true, nil
+	}
+	fmt.Fprintln(a.stderr, "The following deployments are not declared in the manifests and will be deleted:")
+	for _, name := range pruned {
+		fmt.Fprintf(a.stderr, "    %s\n", name)
+	}
+	ok, err := a.confirm(fmt.Sprintf("Delete %d deployments?", len(pruned)))
+	if err == nil && !ok {
+		fmt.Fprintln(a.stderr, "Aborted")
+	}
+	return ok, err
+}
+
+// readManifests reads the deployments of a manifest file, or of every
+// *.json, *.yaml and *.yml file of a directory in name order. Documents of
+// other kinds, such as the Container and ResourceQuota manifests of
+// examples/manifests, are skipped.
+func readManifests(path string) ([]*tianniu.Deployment, error) {
+	files, err := manifestFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	var manifests []*tianniu.Deployment
+	for _, f := range files {
+		deployments, err := readDeploymentsFile(f)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, deployments...)
+	}
+	if len(manifests) == 0 {
+		return nil, usageErrorf("no Deployment manifests in %s", path)
+	}
+	return manifests, nil
+}
+
+// manifestFiles returns path, or the *.json, *.yaml and *.yml files of a
+// directory in name order
+func manifestFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifests: %v", err)
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	var files []string
+	for _, pattern := range []string{"*.json", "*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(path, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	if len(files) == 0 {
+		return nil, usageErrorf("no manifests in %s", path)
+	}
+	return files, nil
+}
+
+// isYAML reports whether path names a YAML manifest file
+func isYAML(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// readDeploymentsFile reads the deployments of a file: the Deployment
+// manifests of a YAML file, skipping documents of other kinds, or a
+// deployment JSON body such as examples/go/sample-deployment.json
+func readDeploymentsFile(path string) ([]*tianniu.Deployment, error) {
+	if isYAML(path) {
+		manifests, err := tianniu.LoadManifests(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifests: %v", err)
+		}
+		deployments := make([]*tianniu.Deployment, 0, len(manifests))
+		for _, m := range manifests {
+			if m.Deployment != nil {
+				deployments = append(deployments, m.Deployment.Deployment())
+			}
+		}
+		return deployments, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read deployment file: %v", err)
+	}
+	var d tianniu.Deployment
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("failed to parse deployment JSON %s: %v", path, err)
+	}
+	if d.Name == "" {
+		return nil, fmt.Errorf("deployment %s has no name", path)
+	}
+	return []*tianniu.Deployment{&d}, nil
+}
+
+// writeApplyResults prints one line per deployment followed by its changed
+// fields
+func writeApplyResults(w io.Writer, results []tianniu.ApplyResult, dryRun bool) {
+	suffix := ""
+	if dryRun {
+		suffix = " (dry run)"
+	}
+	for _, r := range results {
+		fmt.Fprintf(w, "deployment/%s (%s) %s%s\n", r.Name, r.Environment, r.Action, suffix)
+		for _, c := range r.Changes {
+			fmt.Fprintf(w, "    %s: %s -> %s\n", c.Path, diffValue(c.Old), diffValue(c.New))
+		}
+	}
+}
+
+// diffValue formats one side of a field change
+func diffValue(v interface{}) string {
+	if v == nil {
+		return "<unset>"
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+func authCommand() *command {
+	return &command{
+		name:    "auth",
+		usage:   "<subcommand> [flags] [args]",
+		summary: "Check credentials and manage the local keystore",
+		commands: []*command{
+			{name: "status", usage: "status", summary: "Resolve the API key and check it against the API", run: runAuthStatus},
+			{
+				name:    "keystore",
+				usage:   "keystore <list|set|delete> [flags] [args]",
+				summary: "Manage the encrypted local keystore",
+				commands: []*command{
+					{name: "list", usage: "list [--keystore path]", summary: "List keystore entries", run: runKeystoreList},
+					{name: "set", usage: "set <name> [--keystore path] < value", summary: "Store a secret read from standard input", run: runKeystoreSet},
+					{name: "delete", usage: "delete <name> [--keystore path]", summary: "Delete a keystore entry", run: runKeystoreDelete},
+				},
+			},
+		},
+	}
+}
+
+// authStatus is the result of "auth status"
+type authStatus struct {
+	Environment string `json:"environment"`
+	Endpoint    string `json:"endpoint"`
+	APIKeyRef   string `json:"api_key_ref"`
+	Valid       bool   `json:"valid"`
+	Error       string `json:"error,omitempty"`
+}
+
+func runAuthStatus(a *app, cmd *command, args []string) error {
+	fs := a.flagSet(cmd)
+	if err := a.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	env, err := a.environment()
+	if err != nil {
+		return err
+	}
+	status := authStatus{Environment: env.Name, Endpoint: env.APIEndpoint, APIKeyRef: apiKeyRef(env)}
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	err = client.Get(a.ctx, "/deployments", url.Values{"limit": {"1"}}, nil)
+	status.Valid = err == nil
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	if perr := a.print(status, func(w io.Writer) {
+		fmt.Fprintf(w, "Environment: %s\nEndpoint: %s\nAPI key: %s\n", status.Environment, status.Endpoint, status.APIKeyRef)
+		if status.Valid {
+			fmt.Fprintln(w, "Status: authenticated")
+		} else {
+			fmt.Fprintf(w, "Status: failed (%s)\n", status.Error)
+		}
+	}); perr != nil {
+		return perr
+	}
+	var apiErr *tianniu.APIError
+	if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden) {
+		return configError(fmt.Errorf("API key for environment %s was not accepted", env.Name))
+	}
+	return err
+}
+
+// apiKeyRef describes where the API key of env comes from, without the key
+func apiKeyRef(env *tianniu.Environment) string {
+	switch {
+	case env.Auth.APIKey != "":
+		return tianniu.RedactSecretRef(env.Auth.APIKey)
+	case env.Auth.APIKeyEnv != "":
+		return "env:" + env.Auth.APIKeyEnv
+	}
+	return "env:TIANNIU_API_KEY"
+}
+
+// openKeystore opens the keystore at path, creating an empty one when create
+// is set and the file does not exist
+func openKeystore(path string, create bool) (*tianniu.Keystore, error) {
+	passphrase, err := tianniu.KeystorePassphrase()
+	if err != nil {
+		return nil, configError(err)
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) && create {
+		return tianniu.NewKeystore(path, passphrase)
+	}
+	ks, err := tianniu.OpenKeystore(path, passphrase)
+	if err != nil {
+		return nil, configError(err)
+	}
+	return ks, nil
+}
+
+// keystoreEntry is one row of "auth keystore list"; secrets are never shown
+type keystoreEntry struct {
+	Name string `json:"name"`
+	Ref  string `json:"ref"`
+}
+
+var keystoreTable = &table{
+	columns: []column{{header: "NAME"}, {header: "REF"}},
+	row: func(obj interface{}) []string {
+		e := obj.(*keystoreEntry)
+		return []string{e.Name, e.Ref}
+	},
+	name: func(obj interface{}) string {
+		return obj.(*keystoreEntry).Ref
+	},
+}
+
+func runKeystoreList(a *app, cmd *command, args []string) error {
+	path := tianniu.DefaultKeystorePath()
+	fs := a.flagSet(cmd)
+	fs.StringVar(&path, "keystore", path, "Path to the keystore")
+	if err := a.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	ks, err := openKeystore(path, false)
+	if err != nil {
+		return err
+	}
+	entries := make([]keystoreEntry, 0)
+	for _, name := range ks.Names() {
+		entries = append(entries, keystoreEntry{Name: name, Ref: "keystore:" + name})
+	}
+	return a.printList(keystoreTable, entries, entries, "")
+}
+
+func runKeystoreSet(a *app, cmd *command, args []string) error {
+	path := tianniu.DefaultKeystorePath()
+	fs := a.flagSet(cmd)
+	fs.StringVar(&path, "keystore", path, "Path to the keystore")
+	if err := a.parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	value, err := bufio.NewReader(a.stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read secret: %w", err)
+	}
+	value = strings.TrimRight(value, "\r\n")
+	if value == "" {
+		return usageErrorf("no secret given on standard input")
+	}
+
+	ks, err := openKeystore(path, true)
+	if err != nil {
+		return err
+	}
+	if err := ks.Set(fs.Arg(0), value); err != nil {
+		return err
+	}
+	if err := ks.Save(); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stdout, "Stored keystore:%s in %s\n", fs.Arg(0), path)
+	return nil
+}
+
+func runKeystoreDelete(a *app, cmd *command, args []string) error {
+	path := tianniu.DefaultKeystorePath()
+	fs := a.flagSet(cmd)
+	fs.StringVar(&path, "keystore", path, "Path to the keystore")
+	if err := a.parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	ks, err := openKeystore(path, false)
+	if err != nil {
+		return err
+	}
+	if err := ks.Delete(fs.Arg(0)); err != nil {
+		return &cliError{code: exitNotFound, err: err}
+	}
+	if err := ks.Save(); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stdout, "Deleted keystore:%s from %s\n", fs.Arg(0), path)
+	return nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+func clusterCommand() *command {
+	return &command{
+		name:    "cluster",
+		usage:   "<subcommand> [flags] [args]",
+		summary: "Inspect the Kubernetes cluster of an environment directly (read-only)",
+		commands: []*command{
+			{name: "contexts", usage: "contexts [--kubeconfig file]", summary: "List the contexts of the environment's kubeconfig", run: runClusterContexts},
+			{
+				name:    "inspect",
+				usage:   "inspect <deployment-name> [--context ctx] [--namespace ns] [-l selector]",
+				summary: "Show the pods, services and events of a deployment",
+				run:     runClusterInspect,
+			},
+		},
+	}
+}
+
+// clusterOptions are the flags shared by the cluster commands
+type clusterOptions struct {
+	kubeconfig string
+	context    string
+}
+
+func (o *clusterOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.kubeconfig, "kubeconfig", "", "Path to the kubeconfig (defaults to the environment's kubeconfig)")
+	fs.StringVar(&o.context, "context", "", "Kubeconfig context (defaults to current-context)")
+}
+
+// kubeconfig loads --kubeconfig, or the kubeconfig of the selected
+// environment
+func (a *app) kubeconfig(opts clusterOptions) (*tianniu.Kubeconfig, error) {
+	path := opts.kubeconfig
+	if path == "" {
+		env, err := a.environment()
+		if err != nil {
+			return nil, err
+		}
+		if path = env.KubeconfigPath(a.global.config); path == "" {
+			return nil, configError(fmt.Errorf("environment %s has no kubeconfig (use --kubeconfig)", env.Name))
+		}
+	}
+	k, err := tianniu.LoadKubeconfig(path)
+	if err != nil {
+		return nil, configError(fmt.Errorf("failed to load kubeconfig: %v", err))
+	}
+	return k, nil
+}
+
+// clusterClient creates a read-only client for the selected context
+func (a *app) clusterClient(opts clusterOptions) (*tianniu.ClusterClient, error) {
+	k, err := a.kubeconfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	config, err := k.ClusterConfig(opts.context)
+	if err != nil {
+		return nil, configError(fmt.Errorf("invalid kubeconfig: %v", err))
+	}
+	return tianniu.NewClusterClient(config), nil
+}
+
+// kubeContext is a row of cluster contexts
+type kubeContext struct {
+	Current   bool   `json:"current"`
+	Name      string `json:"name"`
+	Cluster   string `json:"cluster"`
+	Server    string `json:"server"`
+	Namespace string `json:"namespace"`
+	User      string `json:"user"`
+}
+
+var kubeContextTable = &table{
+	columns: []column{
+		{header: "CURRENT", blank: true},
+		{header: "NAME"},
+		{header: "CLUSTER"},
+		{header: "SERVER"},
+		{header: "NAMESPACE"},
+		{header: "USER", wide: true},
+	},
+	row: func(obj interface{}) []string {
+		c := obj.(*kubeContext)
+		current := ""
+		if c.Current {
+			current = "*"
+		}
+		return []string{current, c.Name, c.Cluster, c.Server, c.Namespace, c.User}
+	},
+	name: func(obj interface{}) string {
+		return "context/" + obj.(*kubeContext).Name
+	},
+}
+
+func runClusterContexts(a *app, cmd *command, args []string) error {
+	var opts clusterOptions
+	fs := a.flagSet(cmd)
+	fs.StringVar(&opts.kubeconfig, "kubeconfig", "", "Path to the kubeconfig (defaults to the environment's kubeconfig)")
+	if err := a.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	k, err := a.kubeconfig(opts)
+	if err != nil {
+		return err
+	}
+	contexts := make([]kubeContext, len(k.Contexts))
+	for i, c := range k.Contexts {
+		contexts[i] = kubeContext{
+			Current:   c.Name == k.CurrentContext,
+			Name:      c.Name,
+			Cluster:   c.Context.Cluster,
+			Namespace: c.Context.Namespace,
+			User:      c.Context.User,
+		}
+		for _, cluster := range k.Clusters {
+			if cluster.Name == c.Context.Cluster {
+				contexts[i].Server = cluster.Cluster.Server
+			}
+		}
+	}
+	return a.printList(kubeContextTable, contexts, contexts, "")
+}
+
+func runClusterInspect(a *app, cmd *command, args []string) error {
+	var opts clusterOptions
+	var inspect tianniu.ClusterInspectOptions
+	fs := a.flagSet(cmd)
+	opts.register(fs)
+	fs.StringVar(&inspect.Namespace, "namespace", "", "Namespace (defaults to the context's namespace)")
+	fs.StringVar(&inspect.Selector, "l", "", "Pod label selector (defaults to the deployment's selector)")
+	if err := a.parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+	client, err := a.clusterClient(opts)
+	if err != nil {
+		return err
+	}
+	in, err := client.InspectDeployment(a.ctx, fs.Arg(0), inspect)
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s in context %s: %v", fs.Arg(0), client.Context, err)
+	}
+	return a.print(in, func(w io.Writer) { writeClusterInspection(w, fs.Arg(0), in) })
+}
+
+// writeClusterInspection prints the summary of a deployment followed by
+// tables of its pods, services and events
+func writeClusterInspection(w io.Writer, name string, in *tianniu.ClusterInspection) {
+	fmt.Fprintf(w, "Context:    %s\n", in.Context)
+	fmt.Fprintf(w, "Namespace:  %s\n", in.Namespace)
+	fmt.Fprintf(w, "Selector:   %s\n", in.Selector)
+	if d := in.Deployment; d != nil && d.Status != nil {
+		fmt.Fprintf(w, "Deployment: %s %d/%d ready, %d up-to-date, %d available\n",
+			name, d.Status.ReadyReplicas, d.Spec.Replicas, d.Status.UpdatedReplicas, d.Status.AvailableReplicas)
+	} else if d != nil {
+		fmt.Fprintf(w, "Deployment: %s (no status)\n", name)
+	} else {
+		fmt.Fprintf(w, "Deployment: %s not found in the cluster\n", name)
+	}
+
+	fmt.Fprintln(w, "\nPods:")
+	pods := &table{
+		columns: []column{{header: "NAME"}, {header: "READY"}, {header: "STATUS"}, {header: "RESTARTS"}, {header: "AGE"}, {header: "IP"}, {header: "NODE"}},
+		row: func(obj interface{}) []string {
+			p := obj.(*tianniu.K8sPod)
+			ready, total := p.Ready()
+			return []string{
+				p.Metadata.Name, fmt.Sprintf("%d/%d", ready, total), p.State(), strconv.Itoa(p.Restarts()),
+				age(timeOf(p.Metadata.CreationTimestamp)), p.Status.PodIP, p.Spec.NodeName,
+			}
+		},
+	}
+	writeSection(w, pods, objects(in.Pods))
+
+	fmt.Fprintln(w, "\nServices:")
+	services := &table{
+		columns: []column{{header: "NAME"}, {header: "TYPE"}, {header: "CLUSTER-IP"}, {header: "PORTS"}},
+		row: func(obj interface{}) []string {
+			svc := obj.(*tianniu.K8sService)
+			ports := make([]string, len(svc.Spec.Ports))
+			for i, p := range svc.Spec.Ports {
+				ports[i] = strconv.Itoa(p.Port)
+				if p.NodePort != 0 {
+					ports[i] += ":" + strconv.Itoa(p.NodePort)
+				}
+				if p.Protocol != "" {
+					ports[i] += "/" + p.Protocol
+				}
+			}
+			return []string{svc.Metadata.Name, svc.Spec.Type, svc.Spec.ClusterIP, strings.Join(ports, ",")}
+		},
+	}
+	writeSection(w, services, objects(in.Services))
+
+	fmt.Fprintln(w, "\nEvents:")
+	events := &table{
+		columns: []column{{header: "LAST SEEN"}, {header: "TYPE"}, {header: "REASON"}, {header: "OBJECT"}, {header: "MESSAGE"}},
+		row: func(obj interface{}) []string {
+			e := obj.(*tianniu.K8sEvent)
+			object := strings.ToLower(e.InvolvedObject.Kind) + "/" + e.InvolvedObject.Name
+			return []string{age(e.Time()), e.Type, e.Reason, object, e.Message}
+		},
+	}
+	writeSection(w, events, objects(in.Events))
+}
+
+// writeSection writes a table, or "<none>" when it has no rows
+func writeSection(w io.Writer, t *table, objs []interface{}) {
+	if len(objs) == 0 {
+		fmt.Fprintln(w, "  <none>")
+		return
+	}
+	t.write(w, objs, false)
+}
+
+func timeOf(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+func configCommand() *command {
+	return &command{
+		name:    "config",
+		usage:   "<subcommand> [flags]",
+		summary: "Inspect the CLI configuration",
+		commands: []*command{
+			{name: "view", usage: "view", summary: "Print the configuration", run: runConfigView},
+			{name: "environments", usage: "environments", summary: "List the configured environments", run: runConfigEnvironments},
+			{name: "validate", usage: "validate", summary: "Check the configuration without contacting the API", run: runConfigValidate},
+		},
+	}
+}
+
+func runConfigView(a *app, cmd *command, args []string) error {
+	fs := a.flagSet(cmd)
+	if err := a.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	config, err := a.loadConfig()
+	if err != nil {
+		return err
+	}
+	// The configuration only holds secret references, never secrets, and is
+	// always shown in its native YAML form
+	return encodeYAML(a.stdout, config)
+}
+
+// environmentSummary is one row of "config environments"
+type environmentSummary struct {
+	Name        string `json:"name"`
+	Endpoint    string `json:"endpoint"`
+	Default     bool   `json:"default"`
+	Current     bool   `json:"current"`
+	AuthType    string `json:"auth_type,omitempty"`
+	MySQLConfig string `json:"mysql_config,omitempty"`
+}
+
+var environmentTable = &table{
+	columns: []column{
+		{header: "CURRENT", blank: true},
+		{header: "NAME"},
+		{header: "ENDPOINT"},
+		{header: "DEFAULT"},
+		{header: "AUTH", wide: true},
+		{header: "MYSQL CONFIG", wide: true},
+	},
+	row: func(obj interface{}) []string {
+		env := obj.(*environmentSummary)
+		current := ""
+		if env.Current {
+			current = "*"
+		}
+		return []string{current, env.Name, env.Endpoint, strconv.FormatBool(env.Default), env.AuthType, env.MySQLConfig}
+	},
+	name: func(obj interface{}) string {
+		return "environment/" + obj.(*environmentSummary).Name
+	},
+}
+
+func runConfigEnvironments(a *app, cmd *command, args []string) error {
+	fs := a.flagSet(cmd)
+	if err := a.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	config, err := a.loadConfig()
+	if err != nil {
+		return err
+	}
+	current, _ := config.Environment(a.global.env)
+
+	envs := make([]environmentSummary, 0, len(config.Environments))
+	for _, env := range config.Environments {
+		envs = append(envs, environmentSummary{
+			Name:        env.Name,
+			Endpoint:    env.APIEndpoint,
+			Default:     env.Default,
+			Current:     current != nil && current.Name == env.Name,
+			AuthType:    env.Auth.Type,
+			MySQLConfig: env.MySQLConfig,
+		})
+	}
+	return a.printList(environmentTable, envs, envs, "")
+}
+
+func runConfigValidate(a *app, cmd *command, args []string) error {
+	fs := a.flagSet(cmd)
+	if err := a.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	config, err := a.loadConfig()
+	if err != nil {
+		return err
+	}
+	if err := config.Validate(); err != nil {
+		return configError(err)
+	}
+	if _, err := config.Environment(a.global.env); err != nil {
+		return configError(err)
+	}
+	fmt.Fprintf(a.stdout, "Configuration %s is valid\n", a.global.config)
+	return nil
+}
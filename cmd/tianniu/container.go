@@ -0,0 +1,387 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+func containerCommand() *command {
+	return &command{
+		name:    "container",
+		usage:   "<subcommand> [flags] [args]",
+		summary: "Manage containers",
+		commands: []*command{
+			{name: "list", usage: "list [flags]", summary: "List containers", run: runContainerList},
+			{name: "get", usage: "get <container-id>", summary: "Show a container", run: runContainerGet},
+			{name: "create", usage: "create -f <file>", summary: "Create a container from a JSON or YAML manifest file", run: runContainerCreate},
+			{name: "start", usage: "start <container-id>... [-l selector] [--concurrency 10]", summary: "Start containers", run: runContainerStart},
+			{name: "stop", usage: "stop <container-id>... [-l selector] [--timeout 10s] [--concurrency 10]", summary: "Stop containers", run: runContainerStop},
+			{name: "restart", usage: "restart <container-id>... [-l selector] [--timeout 10s] [--concurrency 10]", summary: "Restart containers", run: runContainerRestart},
+			{name: "pause", usage: "pause <container-id>", summary: "Pause a running container", run: runContainerPause},
+			{name: "unpause", usage: "unpause <container-id>", summary: "Resume a paused container", run: runContainerUnpause},
+			{name: "delete", usage: "delete <container-id> [--force] [--volumes]", summary: "Delete a container", run: runContainerDelete},
+			{name: "logs", usage: "logs <container-id>... [-f] [--tail 100] [--since 1h] [--timestamps]", summary: "Show the log of containers (same as tianniu logs)", run: runLogs},
+			{name: "stats", usage: "stats <container-id>", summary: "Show the resource usage of a container", run: runContainerStats},
+			{
+				name:    "exec",
+				usage:   "exec [-it] <container-id> [-e NAME=value] [-w dir] [-u user] -- <command> [args...]",
+				summary: "Run a command in a running container (same as tianniu exec)",
+				run:     runExec,
+			},
+		},
+	}
+}
+
+// containerTable shows containers of the API and of the database
+var containerTable = &table{
+	columns: []column{
+		{header: "ID"},
+		{header: "NAME"},
+		{header: "IMAGE"},
+		{header: "STATUS"},
+		{header: "AGE"},
+		{header: "PORTS", wide: true},
+		{header: "IP", wide: true},
+		{header: "LABELS", wide: true},
+		{header: "CREATED", wide: true},
+	},
+	row: func(obj interface{}) []string {
+		c := obj.(*tianniu.Container)
+		ports := make([]string, 0, len(c.Ports))
+		for _, p := range c.Ports {
+			port := strconv.Itoa(p.External) + "->" + strconv.Itoa(p.Internal)
+			if p.Protocol != "" {
+				port += "/" + p.Protocol
+			}
+			ports = append(ports, port)
+		}
+		return []string{
+			c.ID, c.Name, c.Image, c.Status, age(c.CreatedAt),
+			strings.Join(ports, ","), c.Network.IPAddress, formatLabels(c.Labels), formatTime(c.CreatedAt),
+		}
+	},
+	name: func(obj interface{}) string {
+		return "container/" + obj.(*tianniu.Container).ID
+	},
+}
+
+func runContainerList(a *app, cmd *command, args []string) error {
+	var opts tianniu.ContainerListOptions
+	fs := a.flagSet(cmd)
+	fs.StringVar(&opts.Status, "status", "", "Filter by status (running, stopped, paused)")
+	fs.StringVar(&opts.LabelSelector, "l", "", "Label selector, e.g. 'app=web,team in (backend,data),!canary'")
+	fs.IntVar(&opts.Limit, "limit", 20, "Limit number of results")
+	fs.IntVar(&opts.Offset, "offset", 0, "Offset for pagination")
+	if err := a.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	list, err := client.Containers.List(a.ctx, opts)
+	if err != nil {
+		return fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	return a.printList(containerTable, list, list.Containers, listFooter(len(list.Containers), list.Offset, list.Total))
+}
+
+func runContainerGet(a *app, cmd *command, args []string) error {
+	fs := a.flagSet(cmd)
+	if err := a.parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	container, err := client.Containers.Get(a.ctx, fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to get container: %w", err)
+	}
+	return a.printObject(containerTable, container)
+}
+
+func runContainerCreate(a *app, cmd *command, args []string) error {
+	var file string
+	fs := a.flagSet(cmd)
+	fs.StringVar(&file, "f", "", "Path to a container JSON or YAML manifest file")
+	if err := a.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if file == "" {
+		return usageErrorf("container file required (-f)")
+	}
+
+	opts, err := readContainerFile(file)
+	if err != nil {
+		return err
+	}
+	if err := a.checkContainer(&opts); err != nil {
+		return err
+	}
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	container, err := client.Containers.Create(a.ctx, opts)
+	if err != nil {
+		return fmt.Errorf("failed to create container: %w", err)
+	}
+	return a.printResult(containerTable, container, "Container created successfully")
+}
+
+// batchTable shows the per-container results of a batch operation
+var batchTable = &table{
+	columns: []column{
+		{header: "ID"},
+		{header: "STATUS"},
+		{header: "MESSAGE", blank: true},
+	},
+	row: func(obj interface{}) []string {
+		r := obj.(*tianniu.BatchResult)
+		if r.Error != "" {
+			return []string{r.ID, "failed", r.Error}
+		}
+		return []string{r.ID, r.Status, r.Message}
+	},
+	name: func(obj interface{}) string {
+		return "container/" + obj.(*tianniu.BatchResult).ID
+	},
+}
+
+// containerAction is a lifecycle operation run on one container or, with
+// several IDs or a selector, on a batch
+type containerAction struct {
+	verb   string
+	single func(client *tianniu.Client, id string, opts tianniu.BatchOptions) (*tianniu.Container, error)
+	batch  func(client *tianniu.Client, opts tianniu.BatchOptions) (*tianniu.BatchResults, error)
+}
+
+func runContainerStart(a *app, cmd *command, args []string) error {
+	return a.runContainerAction(cmd, args, false, containerAction{
+		verb: "start",
+		single: func(client *tianniu.Client, id string, opts tianniu.BatchOptions) (*tianniu.Container, error) {
+			return client.Containers.Start(a.ctx, id)
+		},
+		batch: func(client *tianniu.Client, opts tianniu.BatchOptions) (*tianniu.BatchResults, error) {
+			return client.Containers.StartBatch(a.ctx, opts)
+		},
+	})
+}
+
+func runContainerStop(a *app, cmd *command, args []string) error {
+	return a.runContainerAction(cmd, args, true, containerAction{
+		verb: "stop",
+		single: func(client *tianniu.Client, id string, opts tianniu.BatchOptions) (*tianniu.Container, error) {
+			return client.Containers.Stop(a.ctx, id, opts.Timeout)
+		},
+		batch: func(client *tianniu.Client, opts tianniu.BatchOptions) (*tianniu.BatchResults, error) {
+			return client.Containers.StopBatch(a.ctx, opts)
+		},
+	})
+}
+
+func runContainerRestart(a *app, cmd *command, args []string) error {
+	return a.runContainerAction(cmd, args, true, containerAction{
+		verb: "restart",
+		single: func(client *tianniu.Client, id string, opts tianniu.BatchOptions) (*tianniu.Container, error) {
+			return client.Containers.Restart(a.ctx, id, opts.Timeout)
+		},
+		batch: func(client *tianniu.Client, opts tianniu.BatchOptions) (*tianniu.BatchResults, error) {
+			return client.Containers.RestartBatch(a.ctx, opts)
+		},
+	})
+}
+
+// runContainerAction runs action on the containers named by args or
+// matching -l. A batch prints one result per container and fails when any
+// container failed.
+func (a *app) runContainerAction(cmd *command, args []string, timeout bool, action containerAction) error {
+	var opts tianniu.BatchOptions
+	fs := a.flagSet(cmd)
+	fs.StringVar(&opts.LabelSelector, "l", "", "Act on all containers matching this label selector")
+	if timeout {
+		fs.DurationVar(&opts.Timeout, "timeout", 0, "Time to wait for a graceful stop (server default 10s)")
+	}
+	fs.IntVar(&opts.Concurrency, "concurrency", tianniu.DefaultBatchConcurrency, "Maximum requests in flight when the server has no batch endpoint")
+	if err := a.parse(fs, args, 0, -1); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 && opts.LabelSelector == "" {
+		return usageErrorf("container ID or label selector (-l) required")
+	}
+	if opts.Concurrency < 1 {
+		return usageErrorf("--concurrency must be at least 1")
+	}
+	opts.IDs = fs.Args()
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	if len(opts.IDs) == 1 && opts.LabelSelector == "" {
+		container, err := action.single(client, opts.IDs[0], opts)
+		if err != nil {
+			return fmt.Errorf("failed to %s container: %w", action.verb, err)
+		}
+		return a.printResult(containerTable, container, "Container "+container.Status)
+	}
+
+	results, err := action.batch(client, opts)
+	if err != nil {
+		return fmt.Errorf("failed to %s containers: %w", action.verb, err)
+	}
+	if len(results.Results) == 0 {
+		return fmt.Errorf("no containers match %q", opts.LabelSelector)
+	}
+	if err := a.printList(batchTable, results, results.Results, ""); err != nil {
+		return err
+	}
+	if failed := len(results.Failed()); failed > 0 {
+		return fmt.Errorf("failed to %s %d of %d containers", action.verb, failed, len(results.Results))
+	}
+	return nil
+}
+
+func runContainerPause(a *app, cmd *command, args []string) error {
+	fs := a.flagSet(cmd)
+	if err := a.parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	container, err := client.Containers.Pause(a.ctx, fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to pause container: %w", err)
+	}
+	return a.printResult(containerTable, container, "Container "+container.Status)
+}
+
+func runContainerUnpause(a *app, cmd *command, args []string) error {
+	fs := a.flagSet(cmd)
+	if err := a.parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	container, err := client.Containers.Unpause(a.ctx, fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to unpause container: %w", err)
+	}
+	return a.printResult(containerTable, container, "Container "+container.Status)
+}
+
+func runContainerDelete(a *app, cmd *command, args []string) error {
+	var force, volumes bool
+	fs := a.flagSet(cmd)
+	fs.BoolVar(&force, "force", false, "Delete even if the container is running")
+	fs.BoolVar(&volumes, "volumes", false, "Also remove the container's volumes")
+	if err := a.parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	if _, err := client.Containers.Delete(a.ctx, fs.Arg(0), force, volumes); err != nil {
+		return fmt.Errorf("failed to delete container: %w", err)
+	}
+	fmt.Fprintln(a.stdout, "Container deleted successfully")
+	return nil
+}
+
+func runContainerStats(a *app, cmd *command, args []string) error {
+	fs := a.flagSet(cmd)
+	if err := a.parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	stats, err := client.Containers.Stats(a.ctx, fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to get container stats: %w", err)
+	}
+	return a.print(stats, func(w io.Writer) { writeContainerStats(w, stats) })
+}
+
+// writeContainerStats prints a stats sample as one row in the style of
+// docker stats
+func writeContainerStats(w io.Writer, s *tianniu.ContainerStats) {
+	t := &table{
+		columns: []column{{header: "CONTAINER"}, {header: "CPU %"}, {header: "MEM USAGE / LIMIT"}, {header: "MEM %"}, {header: "NET I/O"}, {header: "BLOCK I/O"}},
+		row: func(obj interface{}) []string {
+			s := obj.(*tianniu.ContainerStats)
+			return []string{
+				s.ContainerID,
+				fmt.Sprintf("%.2f%%", s.CPU.UsagePercent),
+				formatBytes(s.Memory.Usage) + " / " + formatBytes(s.Memory.Limit),
+				fmt.Sprintf("%.2f%%", s.Memory.UsagePercent),
+				formatBytes(s.Network.RxBytes) + " / " + formatBytes(s.Network.TxBytes),
+				formatBytes(s.IO.ReadBytes) + " / " + formatBytes(s.IO.WriteBytes),
+			}
+		},
+	}
+	t.write(w, []interface{}{s}, false)
+}
+
+// formatBytes renders a byte count with a binary suffix, e.g. "244.1Mi"
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return strconv.FormatInt(n, 10) + "B"
+	}
+	value, suffix := float64(n), ""
+	for _, s := range []string{"Ki", "Mi", "Gi", "Ti", "Pi"} {
+		if value < unit {
+			break
+		}
+		value, suffix = value/unit, s
+	}
+	return strconv.FormatFloat(value, 'f', 1, 64) + suffix
+}
+
+// readContainerFile reads a container create request from a JSON body or
+// a YAML file with a single Container manifest
+func readContainerFile(file string) (tianniu.ContainerCreateOptions, error) {
+	var opts tianniu.ContainerCreateOptions
+	if isYAML(file) {
+		manifests, err := tianniu.LoadManifests(file)
+		if err != nil {
+			return opts, fmt.Errorf("failed to read manifests: %w", err)
+		}
+		if len(manifests) != 1 || manifests[0].Container == nil {
+			return opts, usageErrorf("%s must hold exactly one Container manifest", file)
+		}
+		return manifests[0].Container.CreateOptions(), nil
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return opts, fmt.Errorf("failed to read container file: %w", err)
+	}
+	if err := json.Unmarshal(data, &opts); err != nil {
+		return opts, fmt.Errorf("failed to parse container JSON: %w", err)
+	}
+	return opts, nil
+}
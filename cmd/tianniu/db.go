@@ -0,0 +1,249 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+func dbCommand() *command {
+	return &command{
+		name:    "db",
+		usage:   "<subcommand> [flags] [args]",
+		summary: "Query the platform database directly",
+		commands: []*command{
+			{
+				name:    "containers",
+				usage:   "containers <list|get> [flags] [args]",
+				summary: "Container rows",
+				commands: []*command{
+					{name: "list", usage: "list [flags]", summary: "List container rows", run: runDBContainerList},
+					{name: "get", usage: "get <container-id>", summary: "Show a container row", run: runDBContainerGet},
+				},
+			},
+			{
+				name:    "deployments",
+				usage:   "deployments <list|get> [flags] [args]",
+				summary: "Deployment rows",
+				commands: []*command{
+					{name: "list", usage: "list [flags]", summary: "List deployment rows", run: runDBDeploymentList},
+					{name: "get", usage: "get <deployment-id>", summary: "Show a deployment row", run: runDBDeploymentGet},
+				},
+			},
+			{name: "validate-config", usage: "validate-config", summary: "Check the MySQL configuration without connecting", run: runDBValidateConfig},
+		},
+	}
+}
+
+// dbOptions are the flags shared by the db commands
+type dbOptions struct {
+	mysqlConfig string
+}
+
+func (o *dbOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.mysqlConfig, "mysql-config", "", "Path to the MySQL configuration (defaults to the environment's mysql_config, $TIANNIU_MYSQL_CONFIG or ~/.tianniu/mysql-config.yaml)")
+}
+
+// mysqlTarget returns the MySQL configuration path and environment name. The
+// environment is --env, or the default environment of the TianNiu
+// configuration.
+func (a *app) mysqlTarget(opts dbOptions) (string, string, error) {
+	path := opts.mysqlConfig
+	envName := a.global.env
+
+	if env, err := a.environment(); err == nil {
+		envName = env.Name
+		if path == "" {
+			path = env.MySQLConfigPath(a.global.config)
+		}
+	} else if envName == "" {
+		return "", "", configError(fmt.Errorf("no environment selected (use --env): %v", err))
+	}
+
+	if path == "" {
+		path = os.Getenv("TIANNIU_MYSQL_CONFIG")
+	}
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", configError(err)
+		}
+		path = filepath.Join(home, ".tianniu", "mysql-config.yaml")
+	}
+	return path, envName, nil
+}
+
+// dbClient connects to the database of the selected environment
+func (a *app) dbClient(opts dbOptions) (*tianniu.DBClient, error) {
+	path, envName, err := a.mysqlTarget(opts)
+	if err != nil {
+		return nil, err
+	}
+	client, err := tianniu.NewDBClient(path, envName)
+	if err != nil {
+		if _, ok := err.(tianniu.ConfigErrors); ok {
+			return nil, configError(err)
+		}
+		return nil, fmt.Errorf("failed to create database client: %w", err)
+	}
+	return client, nil
+}
+
+// listFilterFlags registers the filter flags shared by the db list commands
+func listFilterFlags(fs *flag.FlagSet, filter *tianniu.ListFilter, createdAfter, createdBefore *string) {
+	fs.StringVar(&filter.Status, "status", "", "Filter by status")
+	fs.StringVar(&filter.Environment, "environment", "", "Filter by environment")
+	fs.StringVar(&filter.NamePrefix, "name-prefix", "", "Filter by name prefix")
+	fs.StringVar(&filter.LabelSelector, "l", "", "Filter by label selector, e.g. 'app=web,team in (backend,data),!canary'")
+	fs.StringVar(createdAfter, "created-after", "", "Only rows created at or after this RFC3339 time")
+	fs.StringVar(createdBefore, "created-before", "", "Only rows created before this RFC3339 time")
+	fs.IntVar(&filter.Limit, "limit", 10, "Page size")
+	fs.StringVar(&filter.Cursor, "cursor", "", "Cursor returned by the previous page")
+}
+
+// parseCreatedRange fills the created_at bounds of a filter
+func parseCreatedRange(filter *tianniu.ListFilter, createdAfter, createdBefore string) error {
+	var err error
+	if createdAfter != "" {
+		if filter.CreatedAfter, err = time.Parse(time.RFC3339, createdAfter); err != nil {
+			return usageErrorf("invalid --created-after: %v", err)
+		}
+	}
+	if createdBefore != "" {
+		if filter.CreatedBefore, err = time.Parse(time.RFC3339, createdBefore); err != nil {
+			return usageErrorf("invalid --created-before: %v", err)
+		}
+	}
+	return nil
+}
+
+// cursorFooter notes the cursor of the next page of a keyset-paginated list
+func cursorFooter(next string) string {
+	if next == "" {
+		return ""
+	}
+	return "Next page: --cursor " + next
+}
+
+func runDBContainerList(a *app, cmd *command, args []string) error {
+	var opts dbOptions
+	var filter tianniu.ListFilter
+	var createdAfter, createdBefore string
+	fs := a.flagSet(cmd)
+	opts.register(fs)
+	listFilterFlags(fs, &filter, &createdAfter, &createdBefore)
+	if err := a.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if err := parseCreatedRange(&filter, createdAfter, createdBefore); err != nil {
+		return err
+	}
+
+	client, err := a.dbClient(opts)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	page, err := client.ListContainers(filter)
+	if err != nil {
+		return fmt.Errorf("failed to get containers: %w", err)
+	}
+	return a.printList(containerTable, page, page.Containers, cursorFooter(page.NextCursor))
+}
+
+func runDBContainerGet(a *app, cmd *command, args []string) error {
+	var opts dbOptions
+	fs := a.flagSet(cmd)
+	opts.register(fs)
+	if err := a.parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	client, err := a.dbClient(opts)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	container, err := client.GetContainerByID(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to get container: %w", err)
+	}
+	return a.printObject(containerTable, container)
+}
+
+func runDBDeploymentList(a *app, cmd *command, args []string) error {
+	var opts dbOptions
+	var filter tianniu.ListFilter
+	var createdAfter, createdBefore string
+	fs := a.flagSet(cmd)
+	opts.register(fs)
+	listFilterFlags(fs, &filter, &createdAfter, &createdBefore)
+	if err := a.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if err := parseCreatedRange(&filter, createdAfter, createdBefore); err != nil {
+		return err
+	}
+
+	client, err := a.dbClient(opts)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	page, err := client.ListDeployments(filter)
+	if err != nil {
+		return fmt.Errorf("failed to get deployments: %w", err)
+	}
+	return a.printList(deploymentTable, page, page.Deployments, cursorFooter(page.NextCursor))
+}
+
+func runDBDeploymentGet(a *app, cmd *command, args []string) error {
+	var opts dbOptions
+	fs := a.flagSet(cmd)
+	opts.register(fs)
+	if err := a.parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	client, err := a.dbClient(opts)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	d, err := client.GetDeploymentByID(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to get deployment: %w", err)
+	}
+	return a.printObject(deploymentTable, d)
+}
+
+func runDBValidateConfig(a *app, cmd *command, args []string) error {
+	var opts dbOptions
+	fs := a.flagSet(cmd)
+	opts.register(fs)
+	if err := a.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	path, envName, err := a.mysqlTarget(opts)
+	if err != nil {
+		return err
+	}
+	config, err := tianniu.LoadMySQLConfig(path)
+	if err != nil {
+		return configError(fmt.Errorf("failed to load %s: %v", path, err))
+	}
+	if err := config.Validate(envName); err != nil {
+		return configError(err)
+	}
+	fmt.Fprintf(a.stdout, "Configuration %s is valid for environment %s\n", path, envName)
+	return nil
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+func deployCommand() *command {
+	return &command{
+		name:    "deploy",
+		usage:   "<subcommand> [flags] [args]",
+		summary: "Manage deployments",
+		commands: []*command{
+			{name: "list", usage: "list [flags]", summary: "List deployments", run: runDeployList},
+			{name: "get", usage: "get <deployment-id>", summary: "Show a deployment", run: runDeployGet},
+			{name: "create", usage: "create -f <file>", summary: "Create a deployment from a JSON or YAML manifest file", run: runDeployCreate},
+			{name: "update", usage: "update <deployment-id> -f <file>", summary: "Replace a deployment from a JSON or YAML manifest file", run: runDeployUpdate},
+			{name: "validate", usage: "validate -f <file|dir>", summary: "Check deployment manifests without contacting the API", run: runDeployValidate},
+			{name: "probe", usage: "probe -f <file> [--host localhost] [--container name] [--skip-delay]", summary: "Run the HTTP and TCP health checks of a manifest against a running instance", run: runDeployProbe},
+			{name: "scale", usage: "scale <deployment-id> --replicas <n>", summary: "Scale a deployment", run: runDeployScale},
+			{name: "delete", usage: "delete <deployment-id> [--force]", summary: "Delete a deployment", run: runDeployDelete},
+		},
+	}
+}
+
+// deploymentTable shows deployments of the API and of the database
+var deploymentTable = &table{
+	columns: []column{
+		{header: "ID"},
+		{header: "NAME"},
+		{header: "ENVIRONMENT"},
+		{header: "STATUS"},
+		{header: "REPLICAS"},
+		{header: "VERSION"},
+		{header: "AGE"},
+		{header: "STRATEGY", wide: true},
+		{header: "IMAGES", wide: true},
+		{header: "CREATED", wide: true},
+	},
+	row: func(obj interface{}) []string {
+		d := obj.(*tianniu.Deployment)
+		images := make([]string, 0, len(d.Containers))
+		for _, c := range d.Containers {
+			images = append(images, c.Image)
+		}
+		return []string{
+			d.ID, d.Name, d.Environment, d.Status, strconv.Itoa(d.Replicas), d.Version, age(d.CreatedAt),
+			d.Strategy.Type, strings.Join(images, ","), formatTime(d.CreatedAt),
+		}
+	},
+	name: func(obj interface{}) string {
+		return "deployment/" + obj.(*tianniu.Deployment).ID
+	},
+}
+
+func runDeployList(a *app, cmd *command, args []string) error {
+	var opts tianniu.DeploymentListOptions
+	var allEnvironments bool
+	fs := a.flagSet(cmd)
+	fs.StringVar(&opts.Status, "status", "", "Filter by status (active, failed, pending)")
+	fs.StringVar(&opts.LabelSelector, "l", "", "Label selector, e.g. 'app=web,team in (backend,data),!canary'")
+	fs.IntVar(&opts.Limit, "limit", 20, "Limit number of results")
+	fs.IntVar(&opts.Offset, "offset", 0, "Offset for pagination")
+	fs.BoolVar(&allEnvironments, "all-environments", false, "List deployments of every environment")
+	if err := a.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	env, err := a.environment()
+	if err != nil {
+		return err
+	}
+	if !allEnvironments {
+		opts.Environment = env.Name
+	}
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	list, err := client.Deployments.List(a.ctx, opts)
+	if err != nil {
+		return fmt.Errorf("failed to list deployments: %v", err)
+	}
+
+	return a.printList(deploymentTable, list, list.Deployments, listFooter(len(list.Deployments), list.Offset, list.Total))
+}
+
+func runDeployGet(a *app, cmd *command, args []string) error {
+	fs := a.flagSet(cmd)
+	if err := a.parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	deployment, err := client.Deployments.Get(a.ctx, fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to get deployment: %w", err)
+	}
+	return a.printObject(deploymentTable, deployment)
+}
+
+func runDeployCreate(a *app, cmd *command, args []string) error {
+	var file string
+	fs := a.flagSet(cmd)
+	fs.StringVar(&file, "f", "", "Path to a deployment JSON or YAML manifest file")
+	if err := a.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	deployment, err := readDeploymentFile(file)
+	if err != nil {
+		return err
+	}
+	if err := a.checkDeployments([]*tianniu.Deployment{deployment}); err != nil {
+		return err
+	}
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	created, err := client.Deployments.Create(a.ctx, deployment)
+	if err != nil {
+		return fmt.Errorf("failed to create deployment: %v", err)
+	}
+	return a.printResult(deploymentTable, created, "Deployment created successfully")
+}
+
+func runDeployUpdate(a *app, cmd *command, args []string) error {
+	var file string
+	fs := a.flagSet(cmd)
+	fs.StringVar(&file, "f", "", "Path to a deployment JSON or YAML manifest file")
+	if err := a.parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	deployment, err := readDeploymentFile(file)
+	if err != nil {
+		return err
+	}
+	if err := a.checkDeployments([]*tianniu.Deployment{deployment}); err != nil {
+		return err
+	}
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	updated, err := client.Deployments.Update(a.ctx, fs.Arg(0), deployment)
+	if err != nil {
+		return fmt.Errorf("failed to update deployment: %w", err)
+	}
+	return a.printResult(deploymentTable, updated, "Deployment updated successfully")
+}
+
+func runDeployValidate(a *app, cmd *command, args []string) error {
+	var file string
+	fs := a.flagSet(cmd)
+	fs.StringVar(&file, "f", "", "Manifest file, or directory of JSON and YAML manifests")
+	if err := a.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if file == "" {
+		return usageErrorf("manifest file or directory required (-f)")
+	}
+
+	deployments, err := readManifests(file)
+	if err != nil {
+		return err
+	}
+	invalid := 0
+	for _, d := range deployments {
+		if err := d.Validate(); err != nil {
+			invalid++
+			fmt.Fprintf(a.stdout, "deployment/%s: %v\n", d.Name, err)
+			continue
+		}
+		fmt.Fprintf(a.stdout, "deployment/%s: valid\n", d.Name)
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d deployments are invalid", invalid, len(deployments))
+	}
+	return nil
+}
+
+// probeReport is the outcome of the health check of one container
+type probeReport struct {
+	Container string `json:"container"`
+	Type      string `json:"type"`
+	*tianniu.ProbeReport
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// probeTable shows the outcome of deploy probe
+var probeTable = &table{
+	columns: []column{
+		{header: "CONTAINER"},
+		{header: "TYPE"},
+		{header: "TARGET"},
+		{header: "RESULT"},
+		{header: "ATTEMPTS"},
+		{header: "MESSAGE", blank: true},
+	},
+	row: func(obj interface{}) []string {
+		r := obj.(*probeReport)
+		if r.Skipped != "" {
+			return []string{r.Container, r.Type, r.Target, "skipped", "0", r.Skipped}
+		}
+		result, message := "unhealthy", ""
+		if r.Healthy {
+			result = "healthy"
+		}
+		if n := len(r.Attempts); n > 0 {
+			message = r.Attempts[n-1].Message
+		}
+		return []string{r.Container, r.Type, r.Target, result, strconv.Itoa(len(r.Attempts)), message}
+	},
+	name: func(obj interface{}) string {
+		return "container/" + obj.(*probeReport).Container
+	},
+}
+
+func runDeployProbe(a *app, cmd *command, args []string) error {
+	var file, only string
+	var prober tianniu.Prober
+	fs := a.flagSet(cmd)
+	fs.StringVar(&file, "f", "", "Deployment manifest file")
+	fs.StringVar(&prober.Host, "host", "localhost", "Host where the instance under test listens")
+	fs.StringVar(&only, "container", "", "Only probe this container")
+	fs.BoolVar(&prober.SkipInitialDelay, "skip-delay", false, "Probe at once instead of after initial_delay_seconds")
+	fs.BoolVar(&prober.InsecureSkipVerify, "insecure", false, "Accept any certificate of HTTPS health checks")
+	if err := a.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	d, err := readDeploymentFile(file)
+	if err != nil {
+		return err
+	}
+
+	var reports []probeReport
+	unhealthy := 0
+	for _, c := range d.Containers {
+		if c.HealthCheck == nil || (only != "" && c.Name != only) {
+			continue
+		}
+		probe, err := c.HealthCheck.Probe()
+		if err != nil {
+			return fmt.Errorf("container %s: %w", c.Name, err)
+		}
+		report := probeReport{Container: c.Name, Type: probe.Type}
+		if probe.Type == tianniu.ProbeExec {
+			report.ProbeReport = &tianniu.ProbeReport{Target: probe.Target()}
+			report.Skipped = "exec checks run in the container"
+		} else if report.ProbeReport, err = prober.Run(a.ctx, probe); err != nil {
+			return fmt.Errorf("container %s: %w", c.Name, err)
+		} else if !report.Healthy {
+			unhealthy++
+		}
+		reports = append(reports, report)
+	}
+	if len(reports) == 0 {
+		return fmt.Errorf("deployment %s has no health check to probe", d.Name)
+	}
+	if err := a.printList(probeTable, reports, reports, ""); err != nil {
+		return err
+	}
+	if unhealthy > 0 {
+		return fmt.Errorf("%d of %d health checks failed", unhealthy, len(reports))
+	}
+	return nil
+}
+
+func runDeployScale(a *app, cmd *command, args []string) error {
+	var replicas int
+	fs := a.flagSet(cmd)
+	fs.IntVar(&replicas, "replicas", -1, "Number of replicas")
+	if err := a.parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+	if replicas < 0 {
+		return usageErrorf("--replicas is required")
+	}
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	if err := a.checkScale(client, fs.Arg(0), replicas); err != nil {
+		return err
+	}
+	scaled, err := client.Deployments.Scale(a.ctx, fs.Arg(0), replicas)
+	if err != nil {
+		return fmt.Errorf("failed to scale deployment: %w", err)
+	}
+	return a.printResult(deploymentTable, scaled, "Deployment scaled successfully")
+}
+
+func runDeployDelete(a *app, cmd *command, args []string) error {
+	var force bool
+	fs := a.flagSet(cmd)
+	fs.BoolVar(&force, "force", false, "Force deletion")
+	if err := a.parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	if err := client.Deployments.Delete(a.ctx, fs.Arg(0), force); err != nil {
+		return fmt.Errorf("failed to delete deployment: %w", err)
+	}
+	fmt.Fprintln(a.stdout, "Deployment deleted successfully")
+	return nil
+}
+
+// readDeploymentFile reads the single deployment of a JSON body or YAML
+// manifest file
+func readDeploymentFile(file string) (*tianniu.Deployment, error) {
+	if file == "" {
+		return nil, usageErrorf("deployment file required (-f)")
+	}
+	deployments, err := readDeploymentsFile(file)
+	if err != nil {
+		return nil, err
+	}
+	switch len(deployments) {
+	case 0:
+		return nil, usageErrorf("%s declares no Deployment", file)
+	case 1:
+		return deployments[0], nil
+	}
+	return nil, usageErrorf("%s declares %d deployments, use apply for several", file, len(deployments))
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+func execCommand() *command {
+	return &command{
+		name:    "exec",
+		usage:   "exec [-it] <container-id> [-e NAME=value] [-w dir] [-u user] -- <command> [args...]",
+		summary: "Run a command in a running container, interactively with -i and -t",
+		run:     runExec,
+	}
+}
+
+// envFlag collects repeated NAME=value flags
+type envFlag []tianniu.EnvVar
+
+func (e *envFlag) String() string {
+	return ""
+}
+
+func (e *envFlag) Set(value string) error {
+	name, val, ok := strings.Cut(value, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("want NAME=value, got %q", value)
+	}
+	*e = append(*e, tianniu.EnvVar{Name: name, Value: val})
+	return nil
+}
+
+// splitShortFlags expands combined boolean flags such as -it before the
+// "--" that starts the command
+func splitShortFlags(args []string, combined ...string) []string {
+	out := make([]string, 0, len(args))
+	for i, arg := range args {
+		if arg == "--" {
+			return append(out, args[i:]...)
+		}
+		if containsFlag(combined, arg) {
+			for _, c := range arg[1:] {
+				out = append(out, "-"+string(c))
+			}
+			continue
+		}
+		out = append(out, arg)
+	}
+	return out
+}
+
+func containsFlag(flags []string, arg string) bool {
+	for _, f := range flags {
+		if arg == f {
+			return true
+		}
+	}
+	return false
+}
+
+func runExec(a *app, cmd *command, args []string) error {
+	var env envFlag
+	var interactive, tty bool
+	var opts tianniu.ExecOptions
+	fs := a.flagSet(cmd)
+	fs.BoolVar(&interactive, "i", false, "Keep stdin attached to the command")
+	fs.BoolVar(&tty, "t", false, "Allocate a TTY and put the local terminal in raw mode")
+	fs.Var(&env, "e", "Environment variable NAME=value (repeatable)")
+	fs.StringVar(&opts.WorkingDir, "w", "", "Working directory of the command")
+	fs.StringVar(&opts.User, "u", "", "User to run the command as")
+	if err := a.parse(fs, splitShortFlags(args, "-it", "-ti"), 2, -1); err != nil {
+		return err
+	}
+	opts.Command = fs.Args()[1:]
+	opts.Env = env
+	opts.TTY = tty
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	if interactive || tty {
+		return a.execStream(client, fs.Arg(0), opts, interactive)
+	}
+
+	opts.AttachStdout, opts.AttachStderr = true, true
+	result, err := client.Containers.Exec(a.ctx, fs.Arg(0), opts)
+	if err != nil {
+		return fmt.Errorf("failed to exec in container: %w", err)
+	}
+	if a.output.structured() {
+		return a.writeStructured(result)
+	}
+	io.WriteString(a.stdout, result.Stdout)
+	io.WriteString(a.stderr, result.Stderr)
+	if result.ExitCode != 0 {
+		return fmt.Errorf("command exited with code %d", result.ExitCode)
+	}
+	return nil
+}
+
+// execStream runs an interactive session. With a TTY and a terminal on
+// stdin, the terminal is in raw mode for the session and its size follows
+// the local window.
+func (a *app) execStream(client *tianniu.Client, id string, opts tianniu.ExecOptions, interactive bool) error {
+	streams := tianniu.ExecStreams{Stdout: a.stdout, Stderr: a.stderr}
+	if interactive {
+		streams.Stdin = a.stdin
+	}
+	if in, ok := a.stdin.(*os.File); ok && opts.TTY && isTerminal(in) {
+		restore, err := makeRaw(in)
+		if err != nil {
+			return fmt.Errorf("failed to put the terminal in raw mode: %w", err)
+		}
+		defer restore()
+		stop := make(chan struct{})
+		defer close(stop)
+		streams.Resize = watchResize(in, stop)
+	}
+
+	code, err := client.Containers.ExecStream(a.ctx, id, opts, streams)
+	if err != nil {
+		return fmt.Errorf("failed to exec in container: %w", err)
+	}
+	if code != 0 {
+		return fmt.Errorf("command exited with code %d", code)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+func exportCommand() *command {
+	return &command{
+		name:    "export",
+		usage:   "<subcommand> [flags] [args]",
+		summary: "Export deployments to other formats",
+		commands: []*command{
+			{
+				name:    "k8s",
+				usage:   "k8s [<deployment-id>...] [--all] [-f <file|dir>] [--namespace ns]",
+				summary: "Render deployments as Kubernetes Deployment, Service, ConfigMap and Secret YAML",
+				run:     runExportK8s,
+			},
+		},
+	}
+}
+
+func runExportK8s(a *app, cmd *command, args []string) error {
+	var file string
+	var all bool
+	var opts tianniu.K8sExportOptions
+	fs := a.flagSet(cmd)
+	fs.StringVar(&file, "f", "", "Export the deployments of a manifest file or directory instead of the API")
+	fs.BoolVar(&all, "all", false, "Export every deployment of the environment")
+	fs.StringVar(&opts.Namespace, "namespace", "", "Kubernetes namespace (defaults to the deployment's environment)")
+	if err := a.parse(fs, args, 0, -1); err != nil {
+		return err
+	}
+	switch a.output.name {
+	case "table", "yaml", "json":
+	default:
+		return usageErrorf("output format %s is not supported by %s (use yaml or json)", a.output.name, a.name)
+	}
+	sources := 0
+	for _, set := range []bool{file != "", all, fs.NArg() > 0} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return usageErrorf("give deployment IDs, --all or -f")
+	}
+
+	var deployments []*tianniu.Deployment
+	if file != "" {
+		manifests, err := readManifests(file)
+		if err != nil {
+			return err
+		}
+		deployments = manifests
+	} else {
+		client, err := a.client()
+		if err != nil {
+			return err
+		}
+		ids := fs.Args()
+		if all {
+			env, err := a.environment()
+			if err != nil {
+				return err
+			}
+			list, err := client.Deployments.ListAll(a.ctx, env.Name)
+			if err != nil {
+				return fmt.Errorf("failed to list deployments: %v", err)
+			}
+			// List entries leave out containers, services and strategy
+			var listed []string
+			for _, d := range list {
+				listed = append(listed, d.ID)
+			}
+			ids = append(listed, ids...)
+		}
+		for _, id := range ids {
+			d, err := client.Deployments.Get(a.ctx, id)
+			if err != nil {
+				return fmt.Errorf("failed to get deployment %s: %w", id, err)
+			}
+			deployments = append(deployments, d)
+		}
+	}
+
+	var items []interface{}
+	for _, d := range deployments {
+		items = append(items, tianniu.ExportKubernetes(d, opts).Items()...)
+	}
+	if a.output.name == "json" {
+		return writeJSON(a.stdout, map[string]interface{}{"apiVersion": "v1", "kind": "List", "items": items})
+	}
+	return tianniu.EncodeManifests(a.stdout, items...)
+}
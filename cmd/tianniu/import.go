@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+func importCommand() *command {
+	return &command{
+		name:    "import",
+		usage:   "<subcommand> [flags] [args]",
+		summary: "Convert Kubernetes and docker-compose files to deployment manifests",
+		commands: []*command{
+			{
+				name:    "k8s",
+				usage:   "k8s -f <file> [--environment env] [--strict]",
+				summary: "Convert apps/v1 Deployments and their Services, ConfigMaps and Secrets",
+				run:     runImport(tianniu.ImportKubernetes),
+			},
+			{
+				name:    "compose",
+				usage:   "compose -f <file> [--environment env] [--strict]",
+				summary: "Convert the services of a docker-compose file",
+				run:     runImport(tianniu.ImportCompose),
+			},
+		},
+	}
+}
+
+// runImport runs an importer on a file and writes the deployments as
+// manifests. Dropped fields and problems that would fail validation are
+// printed as warnings on stderr.
+func runImport(importer func(io.Reader, tianniu.ImportOptions) (*tianniu.ImportResult, error)) func(*app, *command, []string) error {
+	return func(a *app, cmd *command, args []string) error {
+		var file string
+		var strict bool
+		var opts tianniu.ImportOptions
+		fs := a.flagSet(cmd)
+		fs.StringVar(&file, "f", "", "File to import")
+		fs.StringVar(&opts.Environment, "environment", "", "Environment of the deployments")
+		fs.BoolVar(&strict, "strict", false, "Fail when any field cannot be imported exactly")
+		if err := a.parse(fs, args, 0, 0); err != nil {
+			return err
+		}
+		if file == "" {
+			return usageErrorf("file required (-f)")
+		}
+		switch a.output.name {
+		case "table", "yaml", "json":
+		default:
+			return usageErrorf("output format %s is not supported by %s (use yaml or json)", a.output.name, a.name)
+		}
+
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		result, err := importer(f, opts)
+		if err != nil {
+			return fmt.Errorf("failed to import %s: %v", file, err)
+		}
+		warnings := len(result.Warnings)
+		for _, w := range result.Warnings {
+			fmt.Fprintf(a.stderr, "Warning: %s\n", w)
+		}
+		for _, d := range result.Deployments {
+			errs, _ := d.Validate().(tianniu.ValidationErrors)
+			for _, fe := range errs {
+				// apply fills in the selected environment
+				if fe.Field == "environment" && d.Environment == "" {
+					continue
+				}
+				fmt.Fprintf(a.stderr, "Warning: deployment/%s is not valid: %s\n", d.Name, fe)
+				warnings++
+			}
+		}
+
+		if a.output.name == "json" {
+			err = writeJSON(a.stdout, result)
+		} else {
+			manifests := make([]interface{}, len(result.Deployments))
+			for i, d := range result.Deployments {
+				manifests[i] = tianniu.NewDeploymentManifest(d)
+			}
+			err = tianniu.EncodeManifests(a.stdout, manifests...)
+		}
+		if err != nil {
+			return err
+		}
+		if strict && warnings > 0 {
+			return fmt.Errorf("%d fields could not be imported exactly", warnings)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a compiled -o jsonpath template. It supports the subset of
+// the kubectl syntax that scripts need:
+//
+//	{.deployments[*].name}                       fields, [n], [-n], [*], .*
+//	{range .deployments[*]}{.id}{"\n"}{end}      iteration
+//	{$.total} {@.name}                           root and current object
+//
+// Text outside braces is copied as is. A template without braces is treated
+// as a single expression. Several results of one expression are separated
+// by spaces, missing fields print nothing, and like kubectl no newline is
+// added at the end.
+type jsonPath struct {
+	nodes []jpNode
+}
+
+// jpNode is literal text, an expression, or a range block
+type jpNode struct {
+	text    string
+	isText  bool
+	expr    *jpExpr
+	isRange bool
+	body    []jpNode
+}
+
+// jpExpr is a path of steps starting at the root ($) or current (@) object
+type jpExpr struct {
+	fromRoot bool
+	steps    []jpStep
+}
+
+// jpStep selects a field, an index, or all children
+type jpStep struct {
+	field   string
+	index   int
+	isIndex bool
+	all     bool
+}
+
+func parseJSONPath(template string) (*jsonPath, error) {
+	if template == "" {
+		return nil, fmt.Errorf("empty template")
+	}
+	if !strings.Contains(template, "{") {
+		template = "{" + template + "}"
+	}
+
+	// stack holds the node lists being filled; the innermost is last
+	root := &jpNode{}
+	stack := []*jpNode{root}
+	rest := template
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			stack[len(stack)-1].body = append(stack[len(stack)-1].body, jpNode{text: rest, isText: true})
+			break
+		}
+		if open > 0 {
+			stack[len(stack)-1].body = append(stack[len(stack)-1].body, jpNode{text: rest[:open], isText: true})
+		}
+		end := closingBrace(rest[open:])
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed action in %q", template)
+		}
+		action := strings.TrimSpace(rest[open+1 : open+end])
+		rest = rest[open+end+1:]
+
+		current := stack[len(stack)-1]
+		switch {
+		case action == "end":
+			if len(stack) == 1 {
+				return nil, fmt.Errorf("{end} without {range}")
+			}
+			stack = stack[:len(stack)-1]
+		case strings.HasPrefix(action, "range "):
+			expr, err := parseJPExpr(strings.TrimSpace(strings.TrimPrefix(action, "range ")))
+			if err != nil {
+				return nil, err
+			}
+			current.body = append(current.body, jpNode{expr: expr, isRange: true})
+			stack = append(stack, &current.body[len(current.body)-1])
+		case strings.HasPrefix(action, `"`):
+			text, err := strconv.Unquote(action)
+			if err != nil {
+				return nil, fmt.Errorf("invalid string literal %s", action)
+			}
+			current.body = append(current.body, jpNode{text: text, isText: true})
+		default:
+			expr, err := parseJPExpr(action)
+			if err != nil {
+				return nil, err
+			}
+			current.body = append(current.body, jpNode{expr: expr})
+		}
+	}
+	if len(stack) > 1 {
+		return nil, fmt.Errorf("{range} without {end}")
+	}
+	return &jsonPath{nodes: root.body}, nil
+}
+
+// closingBrace returns the index of the brace closing s[0], skipping quoted
+// strings
+func closingBrace(s string) int {
+	inQuote := false
+	for i := 1; i < len(s); i++ {
+		switch {
+		case inQuote && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			inQuote = !inQuote
+		case !inQuote && s[i] == '}':
+			return i
+		}
+	}
+	return -1
+}
+
+func parseJPExpr(s string) (*jpExpr, error) {
+	expr := &jpExpr{}
+	switch {
+	case strings.HasPrefix(s, "$"):
+		expr.fromRoot = true
+		s = s[1:]
+	case strings.HasPrefix(s, "@"):
+		s = s[1:]
+	}
+
+	for s != "" {
+		switch {
+		case strings.HasPrefix(s, ".."):
+			return nil, fmt.Errorf("recursive descent is not supported")
+		case s[0] == '.':
+			s = s[1:]
+			n := strings.IndexAny(s, ".[")
+			if n < 0 {
+				n = len(s)
+			}
+			name := s[:n]
+			s = s[n:]
+			if name == "*" {
+				expr.steps = append(expr.steps, jpStep{all: true})
+			} else if name != "" {
+				expr.steps = append(expr.steps, jpStep{field: name})
+			}
+		case s[0] == '[':
+			n := strings.IndexByte(s, ']')
+			if n < 0 {
+				return nil, fmt.Errorf("unclosed [ in %q", s)
+			}
+			sel := strings.TrimSpace(s[1:n])
+			s = s[n+1:]
+			switch {
+			case sel == "*":
+				expr.steps = append(expr.steps, jpStep{all: true})
+			case strings.HasPrefix(sel, "'") && strings.HasSuffix(sel, "'") && len(sel) >= 2:
+				expr.steps = append(expr.steps, jpStep{field: sel[1 : len(sel)-1]})
+			default:
+				index, err := strconv.Atoi(sel)
+				if err != nil {
+					return nil, fmt.Errorf("unsupported selector [%s]", sel)
+				}
+				expr.steps = append(expr.steps, jpStep{index: index, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("unexpected %q in expression", s)
+		}
+	}
+	return expr, nil
+}
+
+// execute renders the template for data, the generic JSON form of an object
+func (jp *jsonPath) execute(w io.Writer, data interface{}) error {
+	return executeJP(w, jp.nodes, data, data)
+}
+
+func executeJP(w io.Writer, nodes []jpNode, root, current interface{}) error {
+	for _, node := range nodes {
+		if node.isText {
+			if _, err := io.WriteString(w, node.text); err != nil {
+				return err
+			}
+			continue
+		}
+
+		results := node.expr.eval(root, current)
+		if node.isRange {
+			for _, item := range results {
+				if err := executeJP(w, node.body, root, item); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		values := make([]string, 0, len(results))
+		for _, v := range results {
+			s, err := formatJPValue(v)
+			if err != nil {
+				return err
+			}
+			values = append(values, s)
+		}
+		if _, err := io.WriteString(w, strings.Join(values, " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *jpExpr) eval(root, current interface{}) []interface{} {
+	values := []interface{}{current}
+	if e.fromRoot {
+		values = []interface{}{root}
+	}
+
+	for _, step := range e.steps {
+		var next []interface{}
+		for _, v := range values {
+			switch v := v.(type) {
+			case map[string]interface{}:
+				if step.all {
+					for _, key := range sortedKeys(v) {
+						next = append(next, v[key])
+					}
+				} else if child, ok := v[step.field]; ok && !step.isIndex {
+					next = append(next, child)
+				}
+			case []interface{}:
+				switch {
+				case step.all:
+					next = append(next, v...)
+				case step.isIndex:
+					i := step.index
+					if i < 0 {
+						i += len(v)
+					}
+					if i >= 0 && i < len(v) {
+						next = append(next, v[i])
+					}
+				}
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatJPValue prints scalars as they are and objects and arrays as JSON
+func formatJPValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		return string(data), err
+	}
+	return fmt.Sprint(v), nil
+}
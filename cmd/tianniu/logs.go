@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+func logsCommand() *command {
+	return &command{
+		name:    "logs",
+		usage:   "logs [<container-id>...] [-l selector] [-f] [--tail 100] [--since 1h] [--timestamps]",
+		summary: "Show or follow the logs of containers, merging several containers into one stream",
+		run:     runLogs,
+	}
+}
+
+// logColors are the ANSI colors of the container prefixes
+var logColors = []string{"36", "33", "32", "35", "34", "31"}
+
+func runLogs(a *app, cmd *command, args []string) error {
+	var opts tianniu.ContainerLogsOptions
+	var since, until, selector string
+	var prefix, noColor bool
+	fs := a.flagSet(cmd)
+	fs.StringVar(&selector, "l", "", "Show the logs of all containers matching this label selector")
+	fs.BoolVar(&opts.Follow, "f", false, "Follow the logs as lines are written")
+	fs.IntVar(&opts.Tail, "tail", 0, "Number of lines to show from the end of each log (server default 100)")
+	fs.StringVar(&since, "since", "", "Only lines after this RFC3339 time or within this duration, e.g. 1h")
+	fs.StringVar(&until, "until", "", "Only lines before this RFC3339 time or this duration ago")
+	fs.BoolVar(&opts.Timestamps, "timestamps", false, "Prefix each line with its timestamp")
+	fs.BoolVar(&prefix, "prefix", false, "Prefix each line with the container name (default with several containers)")
+	fs.BoolVar(&noColor, "no-color", false, "Do not color the container prefixes")
+	if err := a.parse(fs, args, 0, -1); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 && selector == "" {
+		return usageErrorf("container ID or label selector (-l) required")
+	}
+	if (a.output.structured() && a.output.name != "json") || a.output.name == "name" {
+		return usageErrorf("output format %s is not supported by %s (use json)", a.output.name, a.name)
+	}
+	var err error
+	if opts.Since, err = parseTimeFlag("since", since); err != nil {
+		return err
+	}
+	if opts.Until, err = parseTimeFlag("until", until); err != nil {
+		return err
+	}
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	ids := fs.Args()
+	names := make(map[string]string)
+	for _, id := range ids {
+		names[id] = id
+	}
+	if selector != "" {
+		list, err := client.Containers.List(a.ctx, tianniu.ContainerListOptions{LabelSelector: selector, Limit: 100})
+		if err != nil {
+			return fmt.Errorf("failed to list containers: %w", err)
+		}
+		for _, c := range list.Containers {
+			if _, ok := names[c.ID]; !ok {
+				ids = append(ids, c.ID)
+			}
+			names[c.ID] = c.Name
+		}
+		if len(ids) == 0 {
+			return fmt.Errorf("no containers match %q", selector)
+		}
+	}
+
+	streams := make([]*tianniu.LogStream, 0, len(ids))
+	for _, id := range ids {
+		l, err := client.Containers.Logs(a.ctx, id, opts)
+		if err != nil {
+			for _, l := range streams {
+				l.Close()
+			}
+			return fmt.Errorf("failed to get logs of container %s: %w", id, err)
+		}
+		streams = append(streams, l)
+	}
+	logs := tianniu.MergeLogStreams(streams)
+	defer logs.Close()
+
+	w := &logWriter{
+		w:          a.stdout,
+		json:       a.output.name == "json",
+		timestamps: opts.Timestamps,
+		color:      !noColor && isTerminal(a.stdout) && os.Getenv("NO_COLOR") == "",
+		colors:     make(map[string]string),
+	}
+	if prefix || len(ids) > 1 {
+		w.prefixes = make(map[string]string)
+		width := 0
+		for _, id := range ids {
+			if len(names[id]) > width {
+				width = len(names[id])
+			}
+		}
+		for i, id := range ids {
+			w.prefixes[id] = fmt.Sprintf("%-*s |", width, names[id])
+			w.colors[id] = logColors[i%len(logColors)]
+		}
+	}
+	for logs.Next() {
+		w.write(logs.Entry())
+	}
+	if a.ctx.Err() != nil {
+		// Interrupted while following
+		return nil
+	}
+	if err := logs.Err(); err != nil {
+		return fmt.Errorf("log stream failed: %w", err)
+	}
+	return nil
+}
+
+// logWriter writes log lines as text with optional container prefixes, or
+// as one JSON object per line
+type logWriter struct {
+	w          io.Writer
+	json       bool
+	timestamps bool
+	color      bool
+	prefixes   map[string]string
+	colors     map[string]string
+}
+
+func (w *logWriter) write(e tianniu.LogEntry) {
+	if w.json {
+		json.NewEncoder(w.w).Encode(e)
+		return
+	}
+	line := e.Message
+	if w.timestamps {
+		line = e.Timestamp.Format(time.RFC3339) + " " + line
+	}
+	if prefix, ok := w.prefixes[e.ContainerID]; ok {
+		if w.color {
+			prefix = "\x1b[" + w.colors[e.ContainerID] + "m" + prefix + "\x1b[0m"
+		}
+		line = prefix + " " + line
+	}
+	fmt.Fprintln(w.w, line)
+}
+
+// isTerminal reports whether w is a character device such as a terminal
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// parseTimeFlag parses an RFC3339 time, or a duration counted back from now
+func parseTimeFlag(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	// Durations in days, e.g. 30d, for monthly reports
+	if days, err := strconv.Atoi(strings.TrimSuffix(value, "d")); err == nil && strings.HasSuffix(value, "d") && days >= 0 {
+		return time.Now().AddDate(0, 0, -days), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, usageErrorf("invalid --%s %q: want an RFC3339 time or a duration", name, value)
+	}
+	return t, nil
+}
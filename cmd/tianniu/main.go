@@ -0,0 +1,361 @@
+// Command tianniu is the command line interface of the TianNiu platform.
+//
+// Usage:
+//
+//	tianniu [global flags] <command> [subcommand] [flags] [args]
+//
+// Global flags may also be given after the subcommand. Exit codes:
+//
+//	0  success
+//	1  API or runtime failure
+//	2  invalid command line
+//	3  configuration or credential problem
+//	4  the requested object does not exist
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitUsage    = 2
+	exitConfig   = 3
+	exitNotFound = 4
+)
+
+// command is a node of the command tree. Groups have subcommands, leaves
+// have run.
+type command struct {
+	name     string
+	usage    string
+	summary  string
+	run      func(a *app, cmd *command, args []string) error
+	commands []*command
+}
+
+// path is the full command name, e.g. "tianniu deploy list"
+func (c *command) path(parents []*command) string {
+	names := make([]string, 0, len(parents)+1)
+	for _, p := range parents {
+		names = append(names, p.name)
+	}
+	return strings.Join(append(names, c.name), " ")
+}
+
+func (c *command) find(name string) *command {
+	for _, sub := range c.commands {
+		if sub.name == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+// globalOptions are the flags accepted by every command
+type globalOptions struct {
+	env    string
+	config string
+	output string
+}
+
+func (g *globalOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&g.env, "env", g.env, "Environment to use (defaults to the default environment in the config)")
+	fs.StringVar(&g.config, "config", g.config, "Path to the TianNiu configuration file")
+	fs.StringVar(&g.output, "output", g.output, "Output format: "+strings.Join(outputFormats, "|"))
+	fs.StringVar(&g.output, "o", g.output, "Shorthand for --output")
+}
+
+// app carries the state shared by all commands of one invocation
+type app struct {
+	ctx    context.Context
+	global globalOptions
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	// name is the full name of the running command, for messages
+	name   string
+	output outputFormat
+	config *tianniu.Config
+}
+
+// cliError carries the exit code of a failure
+type cliError struct {
+	code int
+	err  error
+}
+
+func (e *cliError) Error() string {
+	return e.err.Error()
+}
+
+func usageErrorf(format string, args ...interface{}) error {
+	return &cliError{code: exitUsage, err: fmt.Errorf(format, args...)}
+}
+
+func configError(err error) error {
+	return &cliError{code: exitConfig, err: err}
+}
+
+// exitCode maps an error returned by a command to the process exit code
+func exitCode(err error) int {
+	var cerr *cliError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &cerr):
+		return cerr.code
+	case tianniu.IsNotFound(err):
+		return exitNotFound
+	}
+	return exitError
+}
+
+// flagSet returns the flag set of a leaf command with the global flags
+// registered, so they may appear after the subcommand
+func (a *app) flagSet(cmd *command) *flag.FlagSet {
+	fs := flag.NewFlagSet(a.name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	a.global.register(fs)
+	fs.Usage = func() {
+		parent := strings.TrimSuffix(a.name, " "+cmd.name)
+		fmt.Fprintf(a.stderr, "Usage: %s %s\n\n%s\n\nFlags:\n", parent, cmd.usage, cmd.summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses the flags of a leaf command and checks the number of
+// positional arguments. Flags may follow the arguments, as in
+// "deploy get ID -o yaml"; everything after "--" is an argument.
+func (a *app) parse(fs *flag.FlagSet, args []string, minArgs, maxArgs int) error {
+	var positional []string
+	for len(args) > 0 {
+		if err := fs.Parse(args); err != nil {
+			if err == flag.ErrHelp {
+				return err
+			}
+			return &cliError{code: exitUsage, err: err}
+		}
+		rest := fs.Args()
+		if consumed := args[:len(args)-len(rest)]; len(consumed) > 0 && consumed[len(consumed)-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+		if len(rest) == 0 {
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+	// Leave only the positional arguments in fs.Args
+	fs.Parse(append([]string{"--"}, positional...))
+
+	output, err := parseOutput(a.global.output)
+	if err != nil {
+		return err
+	}
+	a.output = output
+	if fs.NArg() < minArgs || (maxArgs >= 0 && fs.NArg() > maxArgs) {
+		fs.Usage()
+		return usageErrorf("wrong number of arguments")
+	}
+	return nil
+}
+
+// loadConfig loads the TianNiu configuration once
+func (a *app) loadConfig() (*tianniu.Config, error) {
+	if a.config != nil {
+		return a.config, nil
+	}
+	config, err := tianniu.LoadConfig(a.global.config)
+	if err != nil {
+		return nil, configError(fmt.Errorf("failed to load configuration %s: %v", a.global.config, err))
+	}
+	a.config = config
+	return config, nil
+}
+
+// environment returns the environment selected by --env
+func (a *app) environment() (*tianniu.Environment, error) {
+	config, err := a.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	env, err := config.Environment(a.global.env)
+	if err != nil {
+		return nil, configError(err)
+	}
+	return env, nil
+}
+
+// client creates an API client for the selected environment
+func (a *app) client() (*tianniu.Client, error) {
+	env, err := a.environment()
+	if err != nil {
+		return nil, err
+	}
+	client, err := env.NewClient(a.ctx)
+	if err != nil {
+		return nil, configError(err)
+	}
+	return client, nil
+}
+
+// confirm asks a yes/no question on stderr and reads the answer from
+// stdin. Anything but y or yes, including no input, declines.
+func (a *app) confirm(question string) (bool, error) {
+	fmt.Fprintf(a.stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(a.stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, fmt.Errorf("failed to read confirmation: %w", err)
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// run executes one invocation and returns its exit code
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	a := &app{
+		ctx:    ctx,
+		global: globalOptions{config: tianniu.DefaultConfigPath()},
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+		name:   "tianniu",
+	}
+	root := rootCommand()
+
+	fs := flag.NewFlagSet("tianniu", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	a.global.register(fs)
+	fs.Usage = func() { printHelp(a, root, nil, fs) }
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	// Walk down the tree to the leaf command
+	cmd, parents, rest := root, []*command(nil), fs.Args()
+	for cmd.run == nil {
+		if len(rest) == 0 || rest[0] == "-h" || rest[0] == "--help" {
+			printHelp(a, cmd, parents, fs)
+			if len(rest) == 0 && cmd != root {
+				return exitUsage
+			}
+			return exitOK
+		}
+		if cmd == root && rest[0] == "help" {
+			return runHelp(a, root, rest[1:], fs)
+		}
+		sub := cmd.find(rest[0])
+		if sub == nil {
+			fmt.Fprintf(stderr, "Error: unknown command %q for %q\n\n", rest[0], cmd.path(parents))
+			printHelp(a, cmd, parents, fs)
+			return exitUsage
+		}
+		parents = append(parents, cmd)
+		cmd, rest = sub, rest[1:]
+	}
+
+	a.name = cmd.path(parents)
+	err := cmd.run(a, cmd, rest)
+	if err == flag.ErrHelp {
+		return exitOK
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+	}
+	return exitCode(err)
+}
+
+// runHelp implements "tianniu help [command...]"
+func runHelp(a *app, root *command, names []string, fs *flag.FlagSet) int {
+	cmd, parents := root, []*command(nil)
+	for _, name := range names {
+		sub := cmd.find(name)
+		if sub == nil {
+			fmt.Fprintf(a.stderr, "Error: unknown command %q for %q\n", name, cmd.path(parents))
+			return exitUsage
+		}
+		parents = append(parents, cmd)
+		cmd = sub
+	}
+	if cmd.run != nil {
+		a.name = cmd.path(parents)
+		a.flagSet(cmd).Usage()
+		return exitOK
+	}
+	printHelp(a, cmd, parents, fs)
+	return exitOK
+}
+
+// printHelp prints the help of a command group
+func printHelp(a *app, cmd *command, parents []*command, global *flag.FlagSet) {
+	w := a.stderr
+	if cmd.summary != "" {
+		fmt.Fprintf(w, "%s\n\n", cmd.summary)
+	}
+	fmt.Fprintf(w, "Usage: %s %s\n\nCommands:\n", cmd.path(parents), cmd.usage)
+
+	subs := append([]*command(nil), cmd.commands...)
+	sort.Slice(subs, func(i, j int) bool { return subs[i].name < subs[j].name })
+	for _, sub := range subs {
+		fmt.Fprintf(w, "  %-14s %s\n", sub.name, sub.summary)
+	}
+
+	fmt.Fprintln(w, "\nGlobal flags:")
+	global.PrintDefaults()
+	fmt.Fprintf(w, "\nRun '%s <command> -h' for help on a command.\n", cmd.path(parents))
+}
+
+func rootCommand() *command {
+	return &command{
+		name:    "tianniu",
+		usage:   "[global flags] <command> [subcommand] [flags] [args]",
+		summary: "tianniu manages deployments, containers and resources on the TianNiu platform.",
+		commands: []*command{
+			applyCommand(),
+			exportCommand(),
+			importCommand(),
+			deployCommand(),
+			containerCommand(),
+			logsCommand(),
+			execCommand(),
+			topCommand(),
+			statsCommand(),
+			quotaCommand(),
+			nodeCommand(),
+			usageCommand(),
+			recommendationCommand(),
+			resourceCommand(),
+			policyCommand(),
+			clusterCommand(),
+			dbCommand(),
+			authCommand(),
+			configCommand(),
+		},
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+func nodeCommand() *command {
+	return &command{
+		name:    "node",
+		usage:   "<subcommand> [flags] [args]",
+		summary: "Inspect and maintain cluster nodes",
+		commands: []*command{
+			{name: "list", usage: "list [--status ready] [--role worker]", summary: "List nodes", run: runNodeList},
+			{name: "get", usage: "get <node-id>", summary: "Show a node with its conditions, system info and pods", run: runNodeGet},
+			{name: "cordon", usage: "cordon <node-id>...", summary: "Mark nodes unschedulable", run: runNodeCordon},
+			{name: "uncordon", usage: "uncordon <node-id>...", summary: "Mark nodes schedulable again", run: runNodeUncordon},
+			{
+				name:    "drain",
+				usage:   "drain <node-id> [--grace-period 30s] [--force] [--timeout 10m] [--interval 2s]",
+				summary: "Evict the pods of a node and wait until it is empty",
+				run:     runNodeDrain,
+			},
+		},
+	}
+}
+
+// nodeTable shows the nodes of the cluster
+var nodeTable = &table{
+	columns: []column{
+		{header: "ID"},
+		{header: "NAME"},
+		{header: "STATUS"},
+		{header: "ROLE"},
+		{header: "CPU"},
+		{header: "MEMORY"},
+		{header: "PODS"},
+		{header: "AGE"},
+		{header: "IP", wide: true},
+		{header: "REGION", wide: true},
+		{header: "ZONE", wide: true},
+		{header: "INSTANCE-TYPE", wide: true},
+	},
+	row: func(obj interface{}) []string {
+		n := obj.(*tianniu.Node)
+		return []string{
+			n.ID, n.Name, n.Status, n.Role,
+			formatAllocation(n.Resources.CPU), formatAllocation(n.Resources.Memory), formatAllocation(n.Resources.Pods),
+			age(n.CreatedAt), n.IPAddress, n.Region(), n.Zone(), n.InstanceType(),
+		}
+	},
+	name: nodeName,
+}
+
+// nodeStatusTable shows the answer of a node operation, which carries no
+// resources
+var nodeStatusTable = &table{
+	columns: []column{
+		{header: "ID"},
+		{header: "NAME"},
+		{header: "STATUS"},
+		{header: "MESSAGE", blank: true},
+	},
+	row: func(obj interface{}) []string {
+		n := obj.(*tianniu.Node)
+		return []string{n.ID, n.Name, n.Status, n.Message}
+	},
+	name: nodeName,
+}
+
+func nodeName(obj interface{}) string {
+	return "node/" + obj.(*tianniu.Node).ID
+}
+
+// formatAllocation writes the allocated and allocatable amounts of a node
+// resource, e.g. "25/30 (83%)"
+func formatAllocation(r tianniu.NodeResource) string {
+	if r.Allocatable == 0 && r.Allocated == 0 {
+		return ""
+	}
+	s := formatAmount(r.Allocated) + "/" + formatAmount(r.Allocatable)
+	if r.Unit != "" {
+		s += r.Unit
+	}
+	return s + " (" + strconv.FormatFloat(r.AllocatedPercent(), 'f', 0, 64) + "%)"
+}
+
+func runNodeList(a *app, cmd *command, args []string) error {
+	var opts tianniu.NodeListOptions
+	fs := a.flagSet(cmd)
+	fs.StringVar(&opts.Status, "status", "", "Filter by status (ready, not_ready, cordoned)")
+	fs.StringVar(&opts.Role, "role", "", "Filter by role (master, worker)")
+	fs.IntVar(&opts.Limit, "limit", 20, "Limit number of results")
+	fs.IntVar(&opts.Offset, "offset", 0, "Offset for pagination")
+	if err := a.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	list, err := client.Nodes.List(a.ctx, opts)
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+	return a.printList(nodeTable, list, list.Nodes, listFooter(len(list.Nodes), list.Offset, list.Total))
+}
+
+func runNodeGet(a *app, cmd *command, args []string) error {
+	fs := a.flagSet(cmd)
+	if err := a.parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	node, err := client.Nodes.Get(a.ctx, fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to get node: %w", err)
+	}
+	return a.print(node, func(w io.Writer) { writeNodeDetails(w, node) })
+}
+
+// writeNodeDetails prints the row of a node followed by its conditions,
+// system info, taints and pods
+func writeNodeDetails(w io.Writer, n *tianniu.Node) {
+	nodeTable.write(w, []interface{}{n}, true)
+
+	fmt.Fprintln(w, "\nConditions:")
+	conditions := &table{
+		columns: []column{{header: "TYPE"}, {header: "STATUS"}, {header: "SINCE"}, {header: "REASON"}, {header: "MESSAGE"}},
+		row: func(obj interface{}) []string {
+			c := obj.(*tianniu.NodeCondition)
+			return []string{c.Type, c.Status, age(c.LastTransitionTime), c.Reason, c.Message}
+		},
+	}
+	writeSection(w, conditions, objects(n.Conditions))
+
+	if info := n.SystemInfo; info != nil {
+		fmt.Fprintln(w, "\nSystem Info:")
+		fmt.Fprintf(w, "  OS Image:          %s\n", info.OSImage)
+		fmt.Fprintf(w, "  Kernel Version:    %s\n", info.KernelVersion)
+		fmt.Fprintf(w, "  Architecture:      %s\n", info.Architecture)
+		fmt.Fprintf(w, "  Container Runtime: %s\n", info.ContainerRuntimeVersion)
+		fmt.Fprintf(w, "  Kubelet Version:   %s\n", info.KubeletVersion)
+	}
+
+	fmt.Fprintln(w, "\nTaints:")
+	if len(n.Taints) == 0 {
+		fmt.Fprintln(w, "  <none>")
+	}
+	for _, taint := range n.Taints {
+		s := taint.Key
+		if taint.Value != "" {
+			s += "=" + taint.Value
+		}
+		fmt.Fprintf(w, "  %s:%s\n", s, taint.Effect)
+	}
+
+	fmt.Fprintln(w, "\nPods:")
+	pods := &table{
+		columns: []column{{header: "NAMESPACE"}, {header: "NAME"}, {header: "STATUS"}, {header: "CPU REQUEST/LIMIT"}, {header: "MEMORY REQUEST/LIMIT"}},
+		row: func(obj interface{}) []string {
+			p := obj.(*tianniu.NodePod)
+			return []string{
+				p.Namespace, p.Name, p.Status,
+				p.CPURequest.String() + "/" + p.CPULimit.String(),
+				p.MemoryRequest.String() + "/" + p.MemoryLimit.String(),
+			}
+		},
+	}
+	writeSection(w, pods, objects(n.Pods))
+}
+
+func runNodeCordon(a *app, cmd *command, args []string) error {
+	return a.runNodeAction(cmd, args, "cordon", func(c *tianniu.Client, id string) (*tianniu.Node, error) {
+		return c.Nodes.Cordon(a.ctx, id)
+	})
+}
+
+func runNodeUncordon(a *app, cmd *command, args []string) error {
+	return a.runNodeAction(cmd, args, "uncordon", func(c *tianniu.Client, id string) (*tianniu.Node, error) {
+		return c.Nodes.Uncordon(a.ctx, id)
+	})
+}
+
+// runNodeAction applies an operation to each node named on the command
+// line. Every node is attempted; failures are reported on stderr.
+func (a *app) runNodeAction(cmd *command, args []string, verb string, action func(*tianniu.Client, string) (*tianniu.Node, error)) error {
+	fs := a.flagSet(cmd)
+	if err := a.parse(fs, args, 1, -1); err != nil {
+		return err
+	}
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 1 {
+		node, err := action(client, fs.Arg(0))
+		if err != nil {
+			return fmt.Errorf("failed to %s node: %w", verb, err)
+		}
+		return a.printResult(nodeStatusTable, node, "Node "+node.Status)
+	}
+
+	var nodes []tianniu.Node
+	for _, id := range fs.Args() {
+		node, err := action(client, id)
+		if err != nil {
+			fmt.Fprintf(a.stderr, "Error: failed to %s node %s: %v\n", verb, id, err)
+			continue
+		}
+		nodes = append(nodes, *node)
+	}
+	if len(nodes) > 0 {
+		if err := a.printList(nodeStatusTable, nodes, nodes, ""); err != nil {
+			return err
+		}
+	}
+	if failed := fs.NArg() - len(nodes); failed > 0 {
+		return fmt.Errorf("failed to %s %d of %d nodes", verb, failed, fs.NArg())
+	}
+	return nil
+}
+
+func runNodeDrain(a *app, cmd *command, args []string) error {
+	var opts tianniu.DrainOptions
+	fs := a.flagSet(cmd)
+	fs.DurationVar(&opts.GracePeriod, "grace-period", 0, "Time the pods are given to terminate (default the server's 30s)")
+	fs.BoolVar(&opts.Force, "force", false, "Evict pods that would otherwise block the drain")
+	fs.DurationVar(&opts.Timeout, "timeout", 10*time.Minute, "Give up waiting for the pods to be evicted after this long")
+	fs.DurationVar(&opts.PollInterval, "interval", 2*time.Second, "Time between checks of the pods left on the node")
+	if err := a.parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+	if opts.GracePeriod < 0 {
+		return usageErrorf("--grace-period must not be negative")
+	}
+	if opts.Timeout <= 0 {
+		return usageErrorf("--timeout must be positive")
+	}
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	opts.Progress = func(p tianniu.DrainProgress) {
+		for _, pod := range p.Evicted {
+			fmt.Fprintf(a.stderr, "Evicted %s/%s (%d remaining)\n", pod.Namespace, pod.Name, len(p.Remaining))
+		}
+	}
+	result, err := client.Nodes.Drain(a.ctx, fs.Arg(0), opts)
+	if err != nil {
+		if result != nil {
+			return fmt.Errorf("drain of node %s incomplete after evicting %d pods: %w", fs.Arg(0), len(result.Evicted), err)
+		}
+		return fmt.Errorf("failed to drain node: %w", err)
+	}
+	if a.output.structured() {
+		return a.writeStructured(result)
+	}
+	for _, pod := range result.Remaining {
+		fmt.Fprintf(a.stderr, "Not evicted %s/%s\n", pod.Namespace, pod.Name)
+	}
+	return a.printResult(nodeStatusTable, result.Node, fmt.Sprintf("Node drained, pods evicted: %d", len(result.Evicted)))
+}
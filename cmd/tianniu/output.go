@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// outputFormats lists the values accepted by --output. The empty default is
+// the same as table.
+var outputFormats = []string{"table", "wide", "json", "yaml", "jsonpath=<template>", "go-template=<template>", "name"}
+
+// outputFormat is a parsed --output value
+type outputFormat struct {
+	name     string
+	jsonPath *jsonPath
+	template *template.Template
+}
+
+// structured reports whether the format renders the object data rather than
+// a human-readable view
+func (f outputFormat) structured() bool {
+	switch f.name {
+	case "json", "yaml", "jsonpath", "go-template":
+		return true
+	}
+	return false
+}
+
+// parseOutput parses and compiles an --output value
+func parseOutput(value string) (outputFormat, error) {
+	name, arg, hasArg := strings.Cut(value, "=")
+	switch name {
+	case "":
+		return outputFormat{name: "table"}, nil
+	case "table", "wide", "json", "yaml", "name":
+		if hasArg {
+			return outputFormat{}, usageErrorf("output format %q takes no argument", name)
+		}
+		return outputFormat{name: name}, nil
+	case "jsonpath":
+		jp, err := parseJSONPath(arg)
+		if err != nil {
+			return outputFormat{}, usageErrorf("invalid jsonpath template: %v", err)
+		}
+		return outputFormat{name: name, jsonPath: jp}, nil
+	case "go-template":
+		tmpl, err := template.New("output").Parse(arg)
+		if err != nil {
+			return outputFormat{}, usageErrorf("invalid go-template: %v", err)
+		}
+		return outputFormat{name: name, template: tmpl}, nil
+	}
+	return outputFormat{}, usageErrorf("unsupported output format %q (use %s)", value, strings.Join(outputFormats, "|"))
+}
+
+// column is one column of a resource table
+type column struct {
+	header string
+	// wide columns are only shown with -o wide
+	wide bool
+	// blank columns show nothing instead of <none> for empty values
+	blank bool
+}
+
+// table describes how the objects of one resource are shown. row returns
+// one value per column for an object; name returns the -o name form.
+type table struct {
+	columns []column
+	row     func(obj interface{}) []string
+	name    func(obj interface{}) string
+}
+
+// write renders objs as an aligned table
+func (t *table) write(w io.Writer, objs []interface{}, wide bool) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	var headers []string
+	for _, col := range t.columns {
+		if wide || !col.wide {
+			headers = append(headers, col.header)
+		}
+	}
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+
+	for _, obj := range objs {
+		values := t.row(obj)
+		cells := make([]string, 0, len(headers))
+		for i, col := range t.columns {
+			if !wide && col.wide {
+				continue
+			}
+			cell := ""
+			if i < len(values) {
+				cell = values[i]
+			}
+			if cell == "" && !col.blank {
+				cell = "<none>"
+			}
+			cells = append(cells, cell)
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+// printList writes a list returned by a list command. list is rendered by
+// the structured formats; items, a slice of the objects of t, by the others.
+// footer, if any, is written to stderr after a table so that standard output
+// stays parseable.
+func (a *app) printList(t *table, list interface{}, items interface{}, footer string) error {
+	if a.output.structured() {
+		return a.writeStructured(list)
+	}
+
+	objs := objects(items)
+	switch a.output.name {
+	case "name":
+		for _, obj := range objs {
+			fmt.Fprintln(a.stdout, t.name(obj))
+		}
+		return nil
+	}
+	if len(objs) == 0 {
+		fmt.Fprintln(a.stderr, "No resources found")
+	} else if err := t.write(a.stdout, objs, a.output.name == "wide"); err != nil {
+		return err
+	}
+	if footer != "" {
+		fmt.Fprintln(a.stderr, footer)
+	}
+	return nil
+}
+
+// printObject writes a single object of t
+func (a *app) printObject(t *table, obj interface{}) error {
+	return a.printList(t, obj, []interface{}{obj}, "")
+}
+
+// printResult writes the object returned by a command that changed it. The
+// table formats are preceded by message.
+func (a *app) printResult(t *table, obj interface{}, message string) error {
+	if !a.output.structured() && a.output.name != "name" {
+		fmt.Fprintln(a.stdout, message)
+	}
+	return a.printObject(t, obj)
+}
+
+// print writes v, which is not a resource, in the selected format. text
+// renders the table formats; -o name is not supported.
+func (a *app) print(v interface{}, text func(w io.Writer)) error {
+	if a.output.structured() {
+		return a.writeStructured(v)
+	}
+	if a.output.name == "name" {
+		return usageErrorf("output format name is not supported by %s", a.name)
+	}
+	text(a.stdout)
+	return nil
+}
+
+// writeStructured renders v as json, yaml, jsonpath or go-template. All of
+// them see the JSON field names of v.
+func (a *app) writeStructured(v interface{}) error {
+	switch a.output.name {
+	case "json":
+		return writeJSON(a.stdout, v)
+	case "yaml":
+		return writeYAML(a.stdout, v)
+	}
+
+	data, err := genericValue(v)
+	if err != nil {
+		return err
+	}
+	if a.output.name == "jsonpath" {
+		return a.output.jsonPath.execute(a.stdout, data)
+	}
+	if err := a.output.template.Execute(a.stdout, data); err != nil {
+		return fmt.Errorf("failed to execute go-template: %v", err)
+	}
+	return nil
+}
+
+// objects returns the elements of a slice as pointers, so that row functions
+// see the same types for list and get
+func objects(items interface{}) []interface{} {
+	if objs, ok := items.([]interface{}); ok {
+		return objs
+	}
+	v := reflect.ValueOf(items)
+	objs := make([]interface{}, v.Len())
+	for i := range objs {
+		objs[i] = v.Index(i).Addr().Interface()
+	}
+	return objs
+}
+
+// genericValue converts v to the maps, slices and scalars of its JSON form.
+// Integers become int64 so templates can compare them.
+func genericValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return convertNumbers(generic), nil
+}
+
+func convertNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = convertNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = convertNumbers(e)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// writeYAML renders v as YAML with the same field names as its JSON form
+func writeYAML(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var generic yaml.MapSlice
+	if err := yaml.Unmarshal(data, &generic); err != nil {
+		// Not an object: fall back to a plain value
+		var value interface{}
+		if err := yaml.Unmarshal(data, &value); err != nil {
+			return err
+		}
+		return encodeYAML(w, value)
+	}
+	return encodeYAML(w, generic)
+}
+
+func encodeYAML(w io.Writer, v interface{}) error {
+	out, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// age formats the time since t like "45s", "12m", "5h" or "3d"
+func age(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	d := time.Since(t)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
+
+// formatTime formats t for the wide tables
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// formatLabels formats labels as a sorted "k=v,k=v" list
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// listFooter notes that an offset-paginated list has more items
+func listFooter(count, offset, total int) string {
+	if offset+count >= total {
+		return ""
+	}
+	return fmt.Sprintf("Showing %d-%d of %d, use --offset %d for more", offset+1, offset+count, total, offset+count)
+}
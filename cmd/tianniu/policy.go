@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+func policyCommand() *command {
+	return &command{
+		name:    "policy",
+		usage:   "<subcommand> [flags] [args]",
+		summary: "Check specs against admission policies",
+		commands: []*command{
+			{name: "check", usage: "check -f <file|dir> [--policy file]", summary: "Check deployment and container manifests against the policies", run: runPolicyCheck},
+		},
+	}
+}
+
+// policyCheck is the outcome of checking one manifest
+type policyCheck struct {
+	Object      string                `json:"object"`
+	Environment string                `json:"environment"`
+	Results     tianniu.PolicyResults `json:"results"`
+}
+
+func runPolicyCheck(a *app, cmd *command, args []string) error {
+	var file, policyFile string
+	fs := a.flagSet(cmd)
+	fs.StringVar(&file, "f", "", "Manifest file, or directory of JSON and YAML manifests")
+	fs.StringVar(&policyFile, "policy", "", "Policy file (defaults to policy_file of the environment)")
+	if err := a.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if file == "" {
+		return usageErrorf("manifest file or directory required (-f)")
+	}
+
+	policies, err := a.loadPolicies(policyFile)
+	if err != nil {
+		return err
+	}
+	if policies == nil {
+		return usageErrorf("no policy file (use --policy or set policy_file in the environment)")
+	}
+	envName := a.global.env
+	if env, err := a.environment(); err == nil {
+		envName = env.Name
+	}
+
+	files, err := manifestFiles(file)
+	if err != nil {
+		return err
+	}
+	var checks []policyCheck
+	for _, f := range files {
+		if !isYAML(f) {
+			deployments, err := readDeploymentsFile(f)
+			if err != nil {
+				return err
+			}
+			for _, d := range deployments {
+				checks = append(checks, checkDeployment(policies, d, envName))
+			}
+			continue
+		}
+		manifests, err := tianniu.LoadManifests(f)
+		if err != nil {
+			return fmt.Errorf("failed to read manifests: %v", err)
+		}
+		for _, m := range manifests {
+			switch {
+			case m.Deployment != nil:
+				checks = append(checks, checkDeployment(policies, m.Deployment.Deployment(), envName))
+			case m.Container != nil:
+				opts := m.Container.CreateOptions()
+				checks = append(checks, policyCheck{
+					Object:      "container/" + opts.Name,
+					Environment: envName,
+					Results:     policies.CheckContainer(envName, &opts),
+				})
+			}
+		}
+	}
+
+	if err := a.print(checks, func(w io.Writer) { writePolicyChecks(w, checks) }); err != nil {
+		return err
+	}
+	denied := 0
+	for _, c := range checks {
+		if len(c.Results.Denials()) > 0 {
+			denied++
+		}
+	}
+	if denied > 0 {
+		return fmt.Errorf("%d of %d objects are denied by policy", denied, len(checks))
+	}
+	return nil
+}
+
+// checkDeployment checks a deployment in its environment, or in envName when
+// it names none
+func checkDeployment(policies tianniu.Policies, d *tianniu.Deployment, envName string) policyCheck {
+	if d.Environment == "" {
+		withEnv := *d
+		withEnv.Environment = envName
+		d = &withEnv
+	}
+	return policyCheck{
+		Object:      "deployment/" + d.Name,
+		Environment: d.Environment,
+		Results:     policies.CheckDeployment(d),
+	}
+}
+
+// writePolicyChecks prints one line per object followed by its violations
+func writePolicyChecks(w io.Writer, checks []policyCheck) {
+	for _, c := range checks {
+		if len(c.Results) == 0 {
+			fmt.Fprintf(w, "%s (%s): ok\n", c.Object, c.Environment)
+			continue
+		}
+		fmt.Fprintf(w, "%s (%s):\n", c.Object, c.Environment)
+		for _, r := range c.Results {
+			fmt.Fprintf(w, "    %s %s\n", r.Action, r)
+		}
+	}
+}
+
+// loadPolicies loads path, or the policy file of the selected environment
+// when path is empty. It returns nil when there is no policy file.
+func (a *app) loadPolicies(path string) (tianniu.Policies, error) {
+	if path == "" {
+		env, err := a.environment()
+		if err != nil {
+			return nil, err
+		}
+		if env.PolicyFile == "" {
+			return nil, nil
+		}
+		path = env.PolicyFile
+	}
+	policies, err := tianniu.LoadPolicies(path)
+	if err != nil {
+		return nil, configError(fmt.Errorf("failed to load policies: %v", err))
+	}
+	return policies, nil
+}
+
+// checkDeployments enforces the policies of the selected environment before
+// deployments are submitted
+func (a *app) checkDeployments(deployments []*tianniu.Deployment) error {
+	policies, err := a.loadPolicies("")
+	if err != nil || policies == nil {
+		return err
+	}
+	env, err := a.environment()
+	if err != nil {
+		return err
+	}
+	checks := make([]policyCheck, len(deployments))
+	for i, d := range deployments {
+		checks[i] = checkDeployment(policies, d, env.Name)
+	}
+	return a.enforcePolicies(checks)
+}
+
+// checkScale enforces the replicas rules of the policies of the selected
+// environment before a deployment is scaled. The rules are those of the
+// deployment's environment, which is looked up only when there are policies.
+func (a *app) checkScale(client *tianniu.Client, id string, replicas int) error {
+	policies, err := a.loadPolicies("")
+	if err != nil || policies == nil {
+		return err
+	}
+	d, err := client.Deployments.Get(a.ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to get deployment: %w", err)
+	}
+	if d.Environment == "" {
+		env, err := a.environment()
+		if err != nil {
+			return err
+		}
+		d.Environment = env.Name
+	}
+	return a.enforcePolicies([]policyCheck{{
+		Object:      "deployment/" + d.Name,
+		Environment: d.Environment,
+		Results:     policies.CheckScale(d.Environment, replicas),
+	}})
+}
+
+// checkContainer enforces the policies of the selected environment before a
+// container is created
+func (a *app) checkContainer(opts *tianniu.ContainerCreateOptions) error {
+	policies, err := a.loadPolicies("")
+	if err != nil || policies == nil {
+		return err
+	}
+	env, err := a.environment()
+	if err != nil {
+		return err
+	}
+	return a.enforcePolicies([]policyCheck{{
+		Object:      "container/" + opts.Name,
+		Environment: env.Name,
+		Results:     policies.CheckContainer(env.Name, opts),
+	}})
+}
+
+// enforcePolicies prints the warnings of checks on stderr and fails when any
+// object is denied
+func (a *app) enforcePolicies(checks []policyCheck) error {
+	var denials []string
+	for _, c := range checks {
+		for _, w := range c.Results.Warnings() {
+			fmt.Fprintf(a.stderr, "Warning: %s: %s\n", c.Object, w)
+		}
+		if err := c.Results.Err(); err != nil {
+			denials = append(denials, c.Object+" "+err.Error())
+		}
+	}
+	if len(denials) > 0 {
+		return fmt.Errorf("%s", strings.Join(denials, "\n"))
+	}
+	return nil
+}
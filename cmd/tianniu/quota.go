@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+func quotaCommand() *command {
+	return &command{
+		name:    "quota",
+		usage:   "<subcommand> [flags] [args]",
+		summary: "Show and set the resource quotas of a namespace",
+		commands: []*command{
+			{
+				name:    "get",
+				usage:   "get [namespace] [--type cpu]",
+				summary: "Show the quotas of a namespace (default the environment's) and how much of them is used",
+				run:     runQuotaGet,
+			},
+			{
+				name:    "set",
+				usage:   "set [namespace] <type>=<limit>... | set -f <manifest>",
+				summary: "Set quota limits, e.g. cpu=150 memory=512, or from a ResourceQuota manifest",
+				run:     runQuotaSet,
+			},
+		},
+	}
+}
+
+// quotaTable shows the quotas of a namespace
+var quotaTable = &table{
+	columns: []column{
+		{header: "RESOURCE"},
+		{header: "USED"},
+		{header: "LIMIT"},
+		{header: "AVAILABLE"},
+		{header: "UNIT", blank: true},
+		{header: "USAGE"},
+	},
+	row: func(obj interface{}) []string {
+		q := obj.(*tianniu.ResourceQuota)
+		return []string{
+			q.ResourceType,
+			formatAmount(q.Used),
+			formatAmount(q.Limit),
+			formatAmount(q.Available),
+			q.Unit,
+			strconv.FormatFloat(q.UsagePercent(), 'f', 1, 64) + "%",
+		}
+	},
+	name: func(obj interface{}) string {
+		return "quota/" + obj.(*tianniu.ResourceQuota).ResourceType
+	},
+}
+
+// formatAmount writes a quota amount without trailing zeros
+func formatAmount(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// quotaNamespace returns the namespace argument, or the name of the
+// selected environment
+func (a *app) quotaNamespace(args []string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+	env, err := a.environment()
+	if err != nil {
+		return "", err
+	}
+	return env.Name, nil
+}
+
+func runQuotaGet(a *app, cmd *command, args []string) error {
+	var opts tianniu.QuotaOptions
+	fs := a.flagSet(cmd)
+	fs.StringVar(&opts.ResourceType, "type", "", "Only this resource type (cpu, memory, storage, network)")
+	if err := a.parse(fs, args, 0, 1); err != nil {
+		return err
+	}
+	namespace, err := a.quotaNamespace(fs.Args())
+	if err != nil {
+		return err
+	}
+	opts.Namespace = namespace
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	quotas, err := client.Resources.Quotas(a.ctx, opts)
+	if err != nil {
+		return fmt.Errorf("failed to get quotas: %w", err)
+	}
+	return a.printList(quotaTable, quotas, quotas.Quotas, "")
+}
+
+func runQuotaSet(a *app, cmd *command, args []string) error {
+	var file string
+	fs := a.flagSet(cmd)
+	fs.StringVar(&file, "f", "", "ResourceQuota manifest file")
+	if err := a.parse(fs, args, 0, -1); err != nil {
+		return err
+	}
+
+	var quotas *tianniu.NamespaceQuotas
+	if file != "" {
+		if fs.NArg() > 0 {
+			return usageErrorf("limits cannot be combined with -f")
+		}
+		q, err := readQuotaFile(file)
+		if err != nil {
+			return err
+		}
+		quotas = q
+	} else {
+		limits := fs.Args()
+		var names []string
+		if len(limits) > 0 && !strings.Contains(limits[0], "=") {
+			names, limits = limits[:1], limits[1:]
+		}
+		if len(limits) == 0 {
+			return usageErrorf("at least one <type>=<limit> or -f is required")
+		}
+		namespace, err := a.quotaNamespace(names)
+		if err != nil {
+			return err
+		}
+		quotas = &tianniu.NamespaceQuotas{Namespace: namespace}
+		for _, arg := range limits {
+			quota, err := parseQuotaLimit(arg)
+			if err != nil {
+				return err
+			}
+			quotas.Quotas = append(quotas.Quotas, quota)
+		}
+	}
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	updated, err := client.Resources.UpdateQuotas(a.ctx, quotas)
+	if err != nil {
+		return fmt.Errorf("failed to update quotas: %w", err)
+	}
+	if !a.output.structured() && a.output.name != "name" {
+		fmt.Fprintf(a.stdout, "Quotas of %s updated successfully\n", updated.Namespace)
+	}
+	return a.printList(quotaTable, updated, updated.Quotas, "")
+}
+
+// parseQuotaLimit parses a <type>=<limit> argument of quota set
+func parseQuotaLimit(arg string) (tianniu.ResourceQuota, error) {
+	i := strings.Index(arg, "=")
+	if i <= 0 {
+		return tianniu.ResourceQuota{}, usageErrorf("invalid limit %q (use <type>=<limit>, e.g. cpu=150)", arg)
+	}
+	limit, err := strconv.ParseFloat(arg[i+1:], 64)
+	if err != nil || limit < 0 {
+		return tianniu.ResourceQuota{}, usageErrorf("invalid limit %q for %s", arg[i+1:], arg[:i])
+	}
+	return tianniu.ResourceQuota{ResourceType: arg[:i], Limit: limit}, nil
+}
+
+// readQuotaFile reads the single ResourceQuota manifest of a YAML file
+func readQuotaFile(file string) (*tianniu.NamespaceQuotas, error) {
+	manifests, err := tianniu.LoadManifests(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifests: %w", err)
+	}
+	if len(manifests) != 1 || manifests[0].ResourceQuota == nil {
+		return nil, usageErrorf("%s must declare exactly one ResourceQuota", file)
+	}
+	return manifests[0].ResourceQuota.Quotas(), nil
+}
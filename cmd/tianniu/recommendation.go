@@ -0,0 +1,395 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+func recommendationCommand() *command {
+	return &command{
+		name:    "recommendation",
+		usage:   "<subcommand> [flags] [args]",
+		summary: "Review and apply resource optimization recommendations",
+		commands: []*command{
+			{
+				name:    "list",
+				usage:   "list [--namespace ns] [--type cpu] [--recommendation-type resize]",
+				summary: "List recommendations with their estimated savings",
+				run:     runRecommendationList,
+			},
+			{
+				name:    "diff",
+				usage:   "diff <id>... [--namespace ns]",
+				summary: "Show the changes recommendations make to the resources of their deployments",
+				run:     runRecommendationDiff,
+			},
+			{
+				name:    "apply",
+				usage:   "apply <id>... | --all [--type cpu] [--min-confidence high] [--min-savings 100] [--yes] [--dry-run]",
+				summary: "Apply recommendations after confirmation, or in bulk by policy",
+				run:     runRecommendationApply,
+			},
+		},
+	}
+}
+
+// recommendationTable shows recommendations with their savings
+var recommendationTable = &table{
+	columns: []column{
+		{header: "ID"},
+		{header: "TARGET"},
+		{header: "RESOURCE"},
+		{header: "TYPE"},
+		{header: "CURRENT"},
+		{header: "RECOMMENDED"},
+		{header: "SAVINGS", blank: true},
+		{header: "CONFIDENCE"},
+		{header: "REASON", wide: true},
+	},
+	row: func(obj interface{}) []string {
+		r := obj.(*tianniu.Recommendation)
+		return []string{
+			r.ID, r.Target.String(), r.ResourceType, r.RecommendationType,
+			formatRecommendationValue(r.CurrentValue), formatRecommendationValue(r.RecommendedValue),
+			r.PotentialSavings.String("cost"), r.Confidence, r.Reason,
+		}
+	},
+	name: func(obj interface{}) string {
+		return "recommendation/" + obj.(*tianniu.Recommendation).ID
+	},
+}
+
+// recommendationResultTable shows the answers to applied recommendations
+var recommendationResultTable = &table{
+	columns: []column{
+		{header: "ID"},
+		{header: "STATUS"},
+		{header: "MESSAGE", blank: true},
+		{header: "ESTIMATED COMPLETION", blank: true},
+	},
+	row: func(obj interface{}) []string {
+		r := obj.(*tianniu.RecommendationApplyResult)
+		return []string{r.ID, r.Status, r.Message, formatTime(r.EstimatedCompletionTime)}
+	},
+	name: func(obj interface{}) string {
+		return "recommendation/" + obj.(*tianniu.RecommendationApplyResult).ID
+	},
+}
+
+// formatRecommendationValue writes the values of a recommendation as
+// key=value pairs sorted by key, e.g. "limit=4 request=2"
+func formatRecommendationValue(v tianniu.RecommendationValue) string {
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + v.String(key)
+	}
+	return strings.Join(pairs, " ")
+}
+
+// totalSavings sums the monthly savings of recommendations, e.g.
+// "¥1300/month". It is empty when they have none or mix currencies.
+func totalSavings(recommendations []tianniu.Recommendation) string {
+	total, currency, found := 0.0, "", false
+	for i := range recommendations {
+		amount, c, ok := recommendations[i].MonthlySavings()
+		if !ok {
+			continue
+		}
+		if found && c != currency {
+			return ""
+		}
+		total, currency, found = total+amount, c, true
+	}
+	if !found {
+		return ""
+	}
+	return currency + formatAmount(total) + "/month"
+}
+
+func runRecommendationList(a *app, cmd *command, args []string) error {
+	var opts tianniu.RecommendationListOptions
+	fs := a.flagSet(cmd)
+	fs.StringVar(&opts.Namespace, "namespace", "", "Filter by namespace")
+	fs.StringVar(&opts.ResourceType, "type", "", "Filter by resource type (cpu, memory, storage, network)")
+	fs.StringVar(&opts.RecommendationType, "recommendation-type", "", "Filter by recommendation type (resize, consolidate, distribute)")
+	if err := a.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	list, err := client.Resources.Recommendations(a.ctx, opts)
+	if err != nil {
+		return fmt.Errorf("failed to list recommendations: %w", err)
+	}
+	footer := ""
+	if total := totalSavings(list.Recommendations); total != "" {
+		footer = "Potential savings: " + total
+	}
+	return a.printList(recommendationTable, list, list.Recommendations, footer)
+}
+
+func runRecommendationDiff(a *app, cmd *command, args []string) error {
+	var namespace string
+	fs := a.flagSet(cmd)
+	fs.StringVar(&namespace, "namespace", "", "Namespace of the recommendations")
+	if err := a.parse(fs, args, 1, -1); err != nil {
+		return err
+	}
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	recommendations, err := a.findRecommendations(client, namespace, fs.Args())
+	if err != nil {
+		return err
+	}
+	reviews, err := a.reviewRecommendations(client, recommendations, false)
+	if err != nil {
+		return err
+	}
+	return a.print(reviews, func(w io.Writer) {
+		for i, review := range reviews {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			writeRecommendationReview(w, review)
+		}
+	})
+}
+
+// findRecommendations returns the recommendations with the given IDs, in
+// that order; the API has no endpoint for a single recommendation
+func (a *app) findRecommendations(client *tianniu.Client, namespace string, ids []string) ([]tianniu.Recommendation, error) {
+	list, err := client.Resources.Recommendations(a.ctx, tianniu.RecommendationListOptions{Namespace: namespace})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recommendations: %w", err)
+	}
+	byID := make(map[string]tianniu.Recommendation, len(list.Recommendations))
+	for _, r := range list.Recommendations {
+		byID[r.ID] = r
+	}
+	found := make([]tianniu.Recommendation, 0, len(ids))
+	for _, id := range ids {
+		r, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("recommendation %s not found", id)
+		}
+		found = append(found, r)
+	}
+	return found, nil
+}
+
+// reviewRecommendations fetches the deployments the recommendations target.
+// In bulk, recommendations that cannot be reviewed are skipped.
+func (a *app) reviewRecommendations(client *tianniu.Client, recommendations []tianniu.Recommendation, bulk bool) ([]*tianniu.RecommendationReview, error) {
+	reviews := make([]*tianniu.RecommendationReview, 0, len(recommendations))
+	for i := range recommendations {
+		review, err := client.Resources.Review(a.ctx, &recommendations[i])
+		if err != nil && bulk {
+			fmt.Fprintf(a.stderr, "Skipping %s: %v\n", recommendations[i].ID, err)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to review recommendation %s: %w", recommendations[i].ID, err)
+		}
+		reviews = append(reviews, review)
+	}
+	return reviews, nil
+}
+
+// writeRecommendationReview prints a recommendation followed by the changes
+// it makes to its deployment, or by its values for other targets
+func writeRecommendationReview(w io.Writer, review *tianniu.RecommendationReview) {
+	r := review.Recommendation
+	fmt.Fprintf(w, "%s: %s %s of %s", r.ID, r.RecommendationType, r.ResourceType, r.Target)
+	details := []string{}
+	if r.Confidence != "" {
+		details = append(details, r.Confidence+" confidence")
+	}
+	if cost := r.PotentialSavings.String("cost"); cost != "" {
+		details = append(details, "saves "+cost)
+	}
+	if len(details) > 0 {
+		fmt.Fprintf(w, " (%s)", strings.Join(details, ", "))
+	}
+	fmt.Fprintln(w)
+	if r.Reason != "" {
+		fmt.Fprintf(w, "  %s\n", r.Reason)
+	}
+
+	if review.Deployment == nil {
+		fmt.Fprintf(w, "  current:     %s\n", formatRecommendationValue(r.CurrentValue))
+		fmt.Fprintf(w, "  recommended: %s\n", formatRecommendationValue(r.RecommendedValue))
+		return
+	}
+	if len(review.Changes) == 0 {
+		fmt.Fprintln(w, "  no changes, the deployment already has the recommended resources")
+	}
+	for _, c := range review.Changes {
+		fmt.Fprintf(w, "  %s", c)
+		if c.Stale {
+			fmt.Fprint(w, " (changed since the recommendation was made)")
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// stale reports whether the deployment of a review no longer has the
+// resources its recommendation was computed from
+func stale(review *tianniu.RecommendationReview) bool {
+	for _, c := range review.Changes {
+		if c.Stale {
+			return true
+		}
+	}
+	return false
+}
+
+func runRecommendationApply(a *app, cmd *command, args []string) error {
+	var namespace, resourceType, recommendationType string
+	var all, yes, dryRun bool
+	var policy tianniu.RecommendationPolicy
+	fs := a.flagSet(cmd)
+	fs.StringVar(&namespace, "namespace", "", "Namespace of the recommendations")
+	fs.BoolVar(&all, "all", false, "Apply every recommendation matching the policy flags")
+	fs.StringVar(&resourceType, "type", "", "With --all, only apply recommendations of this resource type")
+	fs.StringVar(&recommendationType, "recommendation-type", "", "With --all, only apply recommendations of this type, e.g. resize")
+	fs.StringVar(&policy.MinConfidence, "min-confidence", "", "With --all, skip recommendations below this confidence (low, medium, high)")
+	fs.Float64Var(&policy.MinMonthlySavings, "min-savings", 0, "With --all, skip recommendations saving less per month")
+	fs.BoolVar(&yes, "yes", false, "Apply without asking for confirmation")
+	fs.BoolVar(&dryRun, "dry-run", false, "Show the changes without applying them")
+	if err := a.parse(fs, args, 0, -1); err != nil {
+		return err
+	}
+	if all == (fs.NArg() > 0) {
+		return usageErrorf("recommendation IDs or --all required, but not both")
+	}
+	if !all && (resourceType != "" || recommendationType != "" || policy.MinConfidence != "" || policy.MinMonthlySavings != 0) {
+		return usageErrorf("policy flags can only be used with --all")
+	}
+	if resourceType != "" {
+		policy.ResourceTypes = []string{resourceType}
+	}
+	if recommendationType != "" {
+		policy.RecommendationTypes = []string{recommendationType}
+	}
+	if err := policy.Validate(); err != nil {
+		return usageErrorf("invalid policy: %v", err)
+	}
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	var recommendations []tianniu.Recommendation
+	if all {
+		list, err := client.Resources.Recommendations(a.ctx, tianniu.RecommendationListOptions{Namespace: namespace})
+		if err != nil {
+			return fmt.Errorf("failed to list recommendations: %w", err)
+		}
+		recommendations = policy.Select(list.Recommendations)
+	} else if recommendations, err = a.findRecommendations(client, namespace, fs.Args()); err != nil {
+		return err
+	}
+	reviews, err := a.reviewRecommendations(client, recommendations, all)
+	if err != nil {
+		return err
+	}
+	reviews, err = a.admitRecommendations(reviews, all)
+	if err != nil {
+		return err
+	}
+	if len(reviews) == 0 {
+		fmt.Fprintln(a.stderr, "No recommendations to apply")
+		return nil
+	}
+
+	// The review goes to stderr when stdout carries structured results
+	w := a.stdout
+	if a.output.structured() {
+		w = a.stderr
+	}
+	for i, review := range reviews {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		writeRecommendationReview(w, review)
+	}
+	if dryRun {
+		fmt.Fprintf(w, "\n%d recommendations would be applied (dry run)\n", len(reviews))
+		return nil
+	}
+	if !yes {
+		fmt.Fprintln(a.stderr)
+		ok, err := a.confirm(fmt.Sprintf("Apply %d recommendations?", len(reviews)))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Fprintln(a.stderr, "Aborted")
+			return nil
+		}
+	}
+
+	var results []tianniu.RecommendationApplyResult
+	for _, review := range reviews {
+		result, err := client.Resources.ApplyRecommendation(a.ctx, review.Recommendation.ID)
+		if err != nil {
+			fmt.Fprintf(a.stderr, "Error: failed to apply recommendation %s: %v\n", review.Recommendation.ID, err)
+			continue
+		}
+		results = append(results, *result)
+	}
+	if len(results) > 0 {
+		if !a.output.structured() {
+			fmt.Fprintln(a.stdout)
+		}
+		if err := a.printList(recommendationResultTable, results, results, ""); err != nil {
+			return err
+		}
+	}
+	if failed := len(reviews) - len(results); failed > 0 {
+		return fmt.Errorf("failed to apply %d of %d recommendations", failed, len(reviews))
+	}
+	return nil
+}
+
+// admitRecommendations drops the recommendations whose resized deployment
+// the admission policies of the environment deny. In bulk, recommendations
+// whose deployment changed since they were made are dropped too.
+func (a *app) admitRecommendations(reviews []*tianniu.RecommendationReview, bulk bool) ([]*tianniu.RecommendationReview, error) {
+	policies, err := a.loadPolicies("")
+	if err != nil {
+		return nil, err
+	}
+	var admitted []*tianniu.RecommendationReview
+	for _, review := range reviews {
+		id := review.Recommendation.ID
+		if bulk && stale(review) {
+			fmt.Fprintf(a.stderr, "Skipping %s: deployment %s changed since the recommendation was made\n", id, review.Deployment.Name)
+			continue
+		}
+		if policies != nil && review.Proposed != nil {
+			check := checkDeployment(policies, review.Proposed, review.Recommendation.Target.Namespace)
+			if err := a.enforcePolicies([]policyCheck{check}); err != nil {
+				fmt.Fprintf(a.stderr, "Skipping %s: %v\n", id, err)
+				continue
+			}
+		}
+		admitted = append(admitted, review)
+	}
+	return admitted, nil
+}
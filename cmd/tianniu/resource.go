@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+)
+
+// resourceCommand groups the resource commands under one name. quotas,
+// nodes and recommendations are the commands of the first CLI, kept for
+// existing scripts and forwarded to their replacements.
+func resourceCommand() *command {
+	return &command{
+		name:    "resource",
+		usage:   "<subcommand> [flags] [args]",
+		summary: "Inspect and manage cluster resources (quota, node, usage and recommendation)",
+		commands: []*command{
+			quotaCommand(),
+			nodeCommand(),
+			usageCommand(),
+			recommendationCommand(),
+			{
+				name:    "quotas",
+				usage:   "quotas [--namespace ns] [--type cpu]",
+				summary: "Show resource quotas (deprecated, use quota get)",
+				run:     deprecated("quota get", runResourceQuotas),
+			},
+			{
+				name:    "nodes",
+				usage:   "nodes [--status ready] [--role worker]",
+				summary: "List nodes (deprecated, use node list)",
+				run:     deprecated("node list", runNodeList),
+			},
+			{
+				name:    "recommendations",
+				usage:   "recommendations [--namespace ns] [--type cpu]",
+				summary: "Show resource recommendations (deprecated, use recommendation list)",
+				run:     deprecated("recommendation list", runRecommendationList),
+			},
+		},
+	}
+}
+
+// deprecated wraps the run function of a command kept under its old name,
+// warning on stderr of the command that replaces it
+func deprecated(replacement string, run func(a *app, cmd *command, args []string) error) func(a *app, cmd *command, args []string) error {
+	return func(a *app, cmd *command, args []string) error {
+		fmt.Fprintf(a.stderr, "Warning: %s is deprecated, use tianniu %s\n", a.name, replacement)
+		return run(a, cmd, args)
+	}
+}
+
+// runResourceQuotas takes the namespace as a flag, as the first CLI did
+func runResourceQuotas(a *app, cmd *command, args []string) error {
+	var namespace, resourceType string
+	fs := a.flagSet(cmd)
+	fs.StringVar(&namespace, "namespace", "", "Namespace (default the environment's)")
+	fs.StringVar(&resourceType, "type", "", "Only this resource type (cpu, memory, storage, network)")
+	if err := a.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	forwarded := []string{"--type", resourceType}
+	if namespace != "" {
+		forwarded = append(forwarded, namespace)
+	}
+	return runQuotaGet(a, cmd, forwarded)
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+func topCommand() *command {
+	return &command{
+		name:    "top",
+		usage:   "top [<container-id>...] [-l selector] [--interval 2s] [--sort cpu|memory|name] [-n count]",
+		summary: "Show a live view of the resource usage of containers",
+		run:     runTop,
+	}
+}
+
+func statsCommand() *command {
+	return &command{
+		name:    "stats",
+		usage:   "<subcommand> [flags] [args]",
+		summary: "Sample container resource usage over time",
+		commands: []*command{
+			{
+				name:    "collect",
+				usage:   "collect [<container-id>...] [-l selector] [--interval 10s] [--listen :9105] [--file stats.ndjson] [-n count]",
+				summary: "Sample containers on an interval, serving Prometheus metrics and/or appending to a time-series file",
+				run:     runStatsCollect,
+			},
+			{
+				name:    "history",
+				usage:   "history --file stats.ndjson [<container-id>...] [--since 1h] [--until time]",
+				summary: "Show the samples of a time-series file",
+				run:     runStatsHistory,
+			},
+		},
+	}
+}
+
+// sampleColumns are the usage columns of top and stats history
+var sampleColumns = []column{
+	{header: "ID"},
+	{header: "NAME"},
+	{header: "CPU %"},
+	{header: "MEM USAGE / LIMIT"},
+	{header: "MEM %"},
+	{header: "NET RX/s"},
+	{header: "NET TX/s"},
+}
+
+func sampleRow(s *tianniu.StatsSample) []string {
+	memory := formatBytes(s.MemoryBytes)
+	if s.MemoryLimitBytes > 0 {
+		memory += " / " + formatBytes(s.MemoryLimitBytes)
+	}
+	memoryPercent := ""
+	if s.MemoryLimitBytes > 0 {
+		memoryPercent = strconv.FormatFloat(s.MemoryPercent, 'f', 2, 64) + "%"
+	}
+	return []string{
+		s.ContainerID, s.Name,
+		strconv.FormatFloat(s.CPUPercent, 'f', 2, 64) + "%",
+		memory, memoryPercent,
+		formatBytes(int64(s.NetworkRxRate)) + "/s",
+		formatBytes(int64(s.NetworkTxRate)) + "/s",
+	}
+}
+
+func sampleName(obj interface{}) string {
+	return "container/" + obj.(*tianniu.StatsSample).ContainerID
+}
+
+// topTable shows the latest sample of each container
+var topTable = &table{
+	columns: sampleColumns,
+	row: func(obj interface{}) []string {
+		return sampleRow(obj.(*tianniu.StatsSample))
+	},
+	name: sampleName,
+}
+
+// historyTable shows the samples of a time-series file
+var historyTable = &table{
+	columns: append([]column{{header: "TIME"}}, sampleColumns...),
+	row: func(obj interface{}) []string {
+		s := obj.(*tianniu.StatsSample)
+		return append([]string{formatTime(s.Timestamp)}, sampleRow(s)...)
+	},
+	name: sampleName,
+}
+
+// sampleSorts order the rows of top
+var sampleSorts = map[string]func(a, b *tianniu.StatsSample) bool{
+	"cpu":    func(a, b *tianniu.StatsSample) bool { return a.CPUPercent > b.CPUPercent },
+	"memory": func(a, b *tianniu.StatsSample) bool { return a.MemoryBytes > b.MemoryBytes },
+	"name":   func(a, b *tianniu.StatsSample) bool { return a.Name < b.Name },
+}
+
+func runTop(a *app, cmd *command, args []string) error {
+	var opts tianniu.StatsCollectorOptions
+	var sortBy string
+	var count int
+	fs := a.flagSet(cmd)
+	fs.StringVar(&opts.LabelSelector, "l", "", "Show the containers matching this label selector (default all running containers)")
+	fs.DurationVar(&opts.Interval, "interval", 2*time.Second, "Time between refreshes")
+	fs.StringVar(&sortBy, "sort", "cpu", "Sort by cpu, memory or name")
+	fs.IntVar(&count, "n", 0, "Stop after this many refreshes (default until interrupted)")
+	if err := a.parse(fs, args, 0, -1); err != nil {
+		return err
+	}
+	less, ok := sampleSorts[sortBy]
+	if !ok {
+		return usageErrorf("invalid --sort %q (use cpu, memory or name)", sortBy)
+	}
+	if opts.Interval <= 0 {
+		return usageErrorf("--interval must be positive")
+	}
+	opts.IDs = fs.Args()
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	clear := isTerminal(a.stdout) && !a.output.structured()
+	return a.collectStats(tianniu.NewStatsCollector(client, opts), count, func(samples []tianniu.StatsSample) error {
+		sort.SliceStable(samples, func(i, j int) bool { return less(&samples[i], &samples[j]) })
+		if clear {
+			fmt.Fprint(a.stdout, "\x1b[H\x1b[2J")
+			fmt.Fprintf(a.stdout, "tianniu top - %s, %d containers\n\n", time.Now().Format("15:04:05"), len(samples))
+		}
+		return a.printList(topTable, samples, samples, "")
+	})
+}
+
+// collectStats runs collector until the command is interrupted or count
+// rounds are done, passing each round to fn. Sampling errors are warnings,
+// except in the first round when nothing could be sampled. An error of fn
+// stops the collector and is returned.
+func (a *app) collectStats(collector *tianniu.StatsCollector, count int, fn func([]tianniu.StatsSample) error) error {
+	ctx, cancel := context.WithCancel(a.ctx)
+	defer cancel()
+	rounds := 0
+	var failure error
+	collector.Run(ctx, func(samples []tianniu.StatsSample, err error) {
+		rounds++
+		if err != nil && rounds == 1 && len(samples) == 0 {
+			failure = fmt.Errorf("failed to collect stats: %w", err)
+			cancel()
+			return
+		}
+		if err != nil {
+			fmt.Fprintf(a.stderr, "Warning: %v\n", err)
+		}
+		if failure = fn(samples); failure != nil || (count > 0 && rounds >= count) {
+			cancel()
+		}
+	})
+	return failure
+}
+
+func runStatsCollect(a *app, cmd *command, args []string) error {
+	var opts tianniu.StatsCollectorOptions
+	var listen, file string
+	var count int
+	fs := a.flagSet(cmd)
+	fs.StringVar(&opts.LabelSelector, "l", "", "Sample the containers matching this label selector (default all running containers)")
+	fs.DurationVar(&opts.Interval, "interval", 10*time.Second, "Time between samples")
+	fs.StringVar(&listen, "listen", "", "Serve Prometheus metrics on this address at /metrics")
+	fs.StringVar(&file, "file", "", "Append the samples to this time-series file, one JSON object per line")
+	fs.IntVar(&count, "n", 0, "Stop after this many samples (default until interrupted)")
+	if err := a.parse(fs, args, 0, -1); err != nil {
+		return err
+	}
+	if listen == "" && file == "" {
+		return usageErrorf("--listen or --file required")
+	}
+	if opts.Interval <= 0 {
+		return usageErrorf("--interval must be positive")
+	}
+	opts.IDs = fs.Args()
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	collector := tianniu.NewStatsCollector(client, opts)
+
+	var out *os.File
+	if file != "" {
+		out, err = os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open time-series file: %w", err)
+		}
+		defer out.Close()
+	}
+	if listen != "" {
+		listener, err := net.Listen("tcp", listen)
+		if err != nil {
+			return fmt.Errorf("failed to listen: %w", err)
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", collector)
+		server := &http.Server{Handler: mux}
+		go server.Serve(listener)
+		defer server.Close()
+		fmt.Fprintf(a.stderr, "Serving metrics on http://%s/metrics\n", listener.Addr())
+	}
+
+	return a.collectStats(collector, count, func(samples []tianniu.StatsSample) error {
+		if out != nil {
+			if err := tianniu.WriteSamples(out, samples); err != nil {
+				return fmt.Errorf("failed to write samples: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+func runStatsHistory(a *app, cmd *command, args []string) error {
+	var file, since, until string
+	fs := a.flagSet(cmd)
+	fs.StringVar(&file, "file", "", "Time-series file written by stats collect")
+	fs.StringVar(&since, "since", "", "Only samples after this RFC3339 time or within this duration, e.g. 1h")
+	fs.StringVar(&until, "until", "", "Only samples before this RFC3339 time or this duration ago")
+	if err := a.parse(fs, args, 0, -1); err != nil {
+		return err
+	}
+	if file == "" {
+		return usageErrorf("time-series file required (--file)")
+	}
+	from, err := parseTimeFlag("since", since)
+	if err != nil {
+		return err
+	}
+	to, err := parseTimeFlag("until", until)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("failed to open time-series file: %w", err)
+	}
+	defer f.Close()
+	ids := make(map[string]bool)
+	for _, id := range fs.Args() {
+		ids[id] = true
+	}
+	samples, err := tianniu.ReadSamples(f, func(s *tianniu.StatsSample) bool {
+		if len(ids) > 0 && !ids[s.ContainerID] {
+			return false
+		}
+		return (from.IsZero() || !s.Timestamp.Before(from)) && (to.IsZero() || !s.Timestamp.After(to))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	if samples == nil {
+		samples = []tianniu.StatsSample{}
+	}
+	return a.printList(historyTable, samples, samples, "")
+}
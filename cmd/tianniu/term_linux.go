@@ -0,0 +1,76 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+func ioctl(fd uintptr, request uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// makeRaw puts the terminal f in raw mode, as cfmakeraw does, and returns
+// the function restoring its previous mode
+func makeRaw(f *os.File) (func(), error) {
+	fd := f.Fd()
+	var old syscall.Termios
+	if err := ioctl(fd, syscall.TCGETS, unsafe.Pointer(&old)); err != nil {
+		return nil, err
+	}
+	raw := old
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Oflag &^= syscall.OPOST
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctl(fd, syscall.TCSETS, unsafe.Pointer(&raw)); err != nil {
+		return nil, err
+	}
+	return func() { ioctl(fd, syscall.TCSETS, unsafe.Pointer(&old)) }, nil
+}
+
+// terminalSize returns the size of the terminal f
+func terminalSize(f *os.File) (tianniu.TerminalSize, bool) {
+	var ws struct{ Row, Col, X, Y uint16 }
+	if err := ioctl(f.Fd(), syscall.TIOCGWINSZ, unsafe.Pointer(&ws)); err != nil || ws.Col == 0 {
+		return tianniu.TerminalSize{}, false
+	}
+	return tianniu.TerminalSize{Width: ws.Col, Height: ws.Row}, true
+}
+
+// watchResize sends the size of the terminal f now and whenever it changes,
+// until stop is closed
+func watchResize(f *os.File, stop <-chan struct{}) <-chan tianniu.TerminalSize {
+	sizes := make(chan tianniu.TerminalSize, 1)
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	go func() {
+		defer signal.Stop(winch)
+		for {
+			if size, ok := terminalSize(f); ok {
+				select {
+				case sizes <- size:
+				case <-stop:
+					return
+				}
+			}
+			select {
+			case <-winch:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return sizes
+}
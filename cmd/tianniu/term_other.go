@@ -0,0 +1,25 @@
+//go:build !linux
+
+package main
+
+import (
+	"os"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+// makeRaw leaves the terminal unchanged: raw mode is only implemented on
+// Linux
+func makeRaw(f *os.File) (func(), error) {
+	return func() {}, nil
+}
+
+// terminalSize is unknown outside Linux
+func terminalSize(f *os.File) (tianniu.TerminalSize, bool) {
+	return tianniu.TerminalSize{}, false
+}
+
+// watchResize sends no sizes outside Linux
+func watchResize(f *os.File, stop <-chan struct{}) <-chan tianniu.TerminalSize {
+	return nil
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+func usageCommand() *command {
+	return &command{
+		name:    "usage",
+		usage:   "usage [namespace] [--since 30d | --period day] [--until time] [--format table|csv|chart] [--width 60]",
+		summary: "Report the peak, average and p95 resource usage of the cluster or a namespace over a time range",
+		run:     runUsage,
+	}
+}
+
+// usageFormats render a usage report in the table formats
+var usageFormats = map[string]func(w io.Writer, report *tianniu.UsageReport, width int) error{
+	"table": writeUsageTable,
+	"csv":   writeUsageCSV,
+	"chart": writeUsageChart,
+}
+
+// usagePeriodRanges are the ranges of the --period flag, which the first
+// CLI used instead of --since
+var usagePeriodRanges = map[string]string{
+	tianniu.UsagePeriodHour:  "1h",
+	tianniu.UsagePeriodDay:   "24h",
+	tianniu.UsagePeriodWeek:  "7d",
+	tianniu.UsagePeriodMonth: "30d",
+}
+
+// usageReport is the structured output of usage
+type usageReport struct {
+	*tianniu.UsageReport
+	Summaries []tianniu.UsageSummary `json:"summaries"`
+}
+
+func runUsage(a *app, cmd *command, args []string) error {
+	var since, until, period, format string
+	var width int
+	fs := a.flagSet(cmd)
+	fs.StringVar(&since, "since", "24h", "Start of the range: an RFC3339 time or a duration ago, e.g. 30d")
+	fs.StringVar(&period, "period", "", "The last hour, day, week or month, shorthand for --since")
+	fs.StringVar(&until, "until", "", "End of the range: an RFC3339 time or a duration ago (default now)")
+	fs.StringVar(&format, "format", "table", "Render the report as a table of summaries, csv data points or a sparkline chart")
+	fs.IntVar(&width, "width", 60, "Maximum width of the sparklines of the chart")
+	if err := a.parse(fs, args, 0, 1); err != nil {
+		return err
+	}
+	render, ok := usageFormats[format]
+	if !ok {
+		return usageErrorf("invalid --format %q (use table, csv or chart)", format)
+	}
+	if width < 1 {
+		return usageErrorf("--width must be positive")
+	}
+	if period != "" {
+		sinceSet := false
+		fs.Visit(func(f *flag.Flag) { sinceSet = sinceSet || f.Name == "since" })
+		if sinceSet {
+			return usageErrorf("--period and --since cannot be used together")
+		}
+		if since, ok = usagePeriodRanges[period]; !ok {
+			return usageErrorf("invalid --period %q (use hour, day, week or month)", period)
+		}
+	}
+	start, err := parseTimeFlag("since", since)
+	if err != nil {
+		return err
+	}
+	end, err := parseTimeFlag("until", until)
+	if err != nil {
+		return err
+	}
+	if end.IsZero() {
+		end = time.Now()
+	}
+	if !start.Before(end) {
+		return usageErrorf("--since must be before --until")
+	}
+
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	report, err := client.Resources.UsageRange(a.ctx, fs.Arg(0), start, end)
+	if err != nil {
+		return fmt.Errorf("failed to get usage: %w", err)
+	}
+	if a.output.structured() {
+		return a.writeStructured(usageReport{report, report.Summaries()})
+	}
+	if a.output.name == "name" {
+		return usageErrorf("output format name is not supported by %s", a.name)
+	}
+	return render(a.stdout, report, width)
+}
+
+// usageSummaryTable shows the aggregates of each resource type
+var usageSummaryTable = &table{
+	columns: []column{
+		{header: "RESOURCE"},
+		{header: "UNIT", blank: true},
+		{header: "LIMIT", blank: true},
+		{header: "PEAK"},
+		{header: "PEAK %"},
+		{header: "PEAK AT"},
+		{header: "AVG"},
+		{header: "AVG %"},
+		{header: "P95"},
+		{header: "P95 %"},
+		{header: "SAMPLES"},
+	},
+	row: func(obj interface{}) []string {
+		s := obj.(*tianniu.UsageSummary)
+		limit := ""
+		if s.Limit > 0 {
+			limit = formatAmount(s.Limit)
+		}
+		return []string{
+			s.ResourceType, s.Unit, limit,
+			formatUsage(s.Peak), formatPercent(s.PeakPercent), formatTime(s.PeakTime),
+			formatUsage(s.Average), formatPercent(s.AveragePercent),
+			formatUsage(s.P95), formatPercent(s.P95Percent),
+			strconv.Itoa(s.Samples),
+		}
+	},
+}
+
+func formatUsage(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+func formatPercent(v float64) string {
+	return strconv.FormatFloat(v, 'f', 1, 64) + "%"
+}
+
+// writeUsageTable writes the range of the report followed by its summaries
+func writeUsageTable(w io.Writer, report *tianniu.UsageReport, width int) error {
+	writeUsageHeader(w, report)
+	summaries := report.Summaries()
+	if len(summaries) == 0 {
+		fmt.Fprintln(w, "No usage data")
+		return nil
+	}
+	return usageSummaryTable.write(w, objects(summaries), false)
+}
+
+func writeUsageHeader(w io.Writer, report *tianniu.UsageReport) {
+	scope := "cluster"
+	if report.Namespace != "" {
+		scope = "namespace " + report.Namespace
+	}
+	fmt.Fprintf(w, "Usage of %s from %s to %s", scope, formatTime(report.StartTime), formatTime(report.EndTime))
+	if report.Interval != "" {
+		fmt.Fprintf(w, ", every %s", report.Interval)
+	}
+	fmt.Fprint(w, "\n\n")
+}
+
+// writeUsageCSV writes one row per data point, for spreadsheets
+func writeUsageCSV(w io.Writer, report *tianniu.UsageReport, width int) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"resource_type", "timestamp", "usage", "usage_percent", "unit", "limit"})
+	for _, name := range usageResourceTypes(report) {
+		series := report.Resources[name]
+		percents := series.Percents()
+		for i, p := range series.DataPoints {
+			cw.Write([]string{
+				name, p.Timestamp.UTC().Format(time.RFC3339),
+				formatAmount(p.Value()), strconv.FormatFloat(percents[i], 'f', 2, 64),
+				series.Unit, formatAmount(series.Limit()),
+			})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// sparks are the levels of a sparkline, from empty to full
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// writeUsageChart writes a sparkline of the usage percentage of each
+// resource type, scaled from 0 to 100%, with its peak and average
+func writeUsageChart(w io.Writer, report *tianniu.UsageReport, width int) error {
+	writeUsageHeader(w, report)
+	summaries := report.Summaries()
+	if len(summaries) == 0 {
+		fmt.Fprintln(w, "No usage data")
+		return nil
+	}
+	nameWidth := 0
+	for _, s := range summaries {
+		if len(s.ResourceType) > nameWidth {
+			nameWidth = len(s.ResourceType)
+		}
+	}
+	for _, s := range summaries {
+		line := sparkline(report.Resources[s.ResourceType].Percents(), width)
+		fmt.Fprintf(w, "%-*s  %s  peak %s  avg %s  p95 %s\n", nameWidth, s.ResourceType, line,
+			formatPercent(s.PeakPercent), formatPercent(s.AveragePercent), formatPercent(s.P95Percent))
+	}
+	return nil
+}
+
+// sparkline draws percentages as at most width characters. Longer series
+// are split into buckets drawn at their maximum, so peaks stay visible.
+func sparkline(percents []float64, width int) string {
+	buckets := len(percents)
+	if buckets > width {
+		buckets = width
+	}
+	var b strings.Builder
+	for i := 0; i < buckets; i++ {
+		from, to := i*len(percents)/buckets, (i+1)*len(percents)/buckets
+		peak := 0.0
+		for _, v := range percents[from:to] {
+			peak = math.Max(peak, v)
+		}
+		level := int(math.Round(math.Min(peak, 100) / 100 * float64(len(sparks)-1)))
+		if level < 0 {
+			level = 0
+		}
+		b.WriteRune(sparks[level])
+	}
+	return b.String()
+}
+
+// usageResourceTypes returns the resource types of a report, sorted
+func usageResourceTypes(report *tianniu.UsageReport) []string {
+	names := make([]string, 0, len(report.Resources))
+	for name := range report.Resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
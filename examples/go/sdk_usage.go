@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+// This example uses the Go SDK directly. The same operations are available
+// from the command line through the tianniu CLI in cmd/tianniu, e.g.
+//
+//	tianniu --env production deploy list -l 'app=web'
+//	tianniu --env production db deployments list --status active
+func main() {
+	ctx := context.Background()
+
+	// Load ~/.tianniu/config.yaml (or $TIANNIU_CONFIG) and pick the default
+	// environment; its API key is resolved through the secret providers
+	config, err := tianniu.LoadConfig(tianniu.DefaultConfigPath())
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	env, err := config.Environment("")
+	if err != nil {
+		log.Fatalf("Failed to select environment: %v", err)
+	}
+	client, err := env.NewClient(ctx)
+	if err != nil {
+		log.Fatalf("Failed to create client: %v", err)
+	}
+
+	// List the web deployments of the environment
+	deployments, err := client.Deployments.List(ctx, tianniu.DeploymentListOptions{
+		Environment:   env.Name,
+		LabelSelector: "app=web",
+		Limit:         10,
+	})
+	if err != nil {
+		log.Fatalf("Failed to list deployments: %v", err)
+	}
+	for _, d := range deployments.Deployments {
+		fmt.Printf("ID: %s, Name: %s, Status: %s, Replicas: %d\n", d.ID, d.Name, d.Status, d.Replicas)
+	}
+
+	// Running containers
+	containers, err := client.Containers.List(ctx, tianniu.ContainerListOptions{Status: "running"})
+	if err != nil {
+		log.Fatalf("Failed to list containers: %v", err)
+	}
+	for _, c := range containers.Containers {
+		fmt.Printf("ID: %s, Name: %s, Image: %s\n", c.ID, c.Name, c.Image)
+	}
+
+	// How much of the environment's quotas is left
+	quotas, err := client.Resources.Quotas(ctx, tianniu.QuotaOptions{Namespace: env.Name})
+	if err != nil {
+		log.Fatalf("Failed to get quotas: %v", err)
+	}
+	for _, q := range quotas.Quotas {
+		fmt.Printf("%s: %g of %g %s available (%.1f%% used)\n", q.ResourceType, q.Available, q.Limit, q.Unit, q.UsagePercent())
+	}
+
+	// Rightsizing: review the confident recommendations and apply those
+	// whose deployment has not changed since they were made
+	recommendations, err := client.Resources.Recommendations(ctx, tianniu.RecommendationListOptions{Namespace: env.Name})
+	if err != nil {
+		log.Fatalf("Failed to list recommendations: %v", err)
+	}
+	policy := tianniu.RecommendationPolicy{RecommendationTypes: []string{"resize"}, MinConfidence: "high"}
+	for _, rec := range policy.Select(recommendations.Recommendations) {
+		review, err := client.Resources.Review(ctx, &rec)
+		if err != nil {
+			log.Fatalf("Failed to review %s: %v", rec.ID, err)
+		}
+		stale := false
+		for _, c := range review.Changes {
+			fmt.Printf("%s: %s\n", rec.ID, c)
+			stale = stale || c.Stale
+		}
+		if stale {
+			continue
+		}
+		result, err := client.Resources.ApplyRecommendation(ctx, rec.ID)
+		if err != nil {
+			log.Fatalf("Failed to apply %s: %v", rec.ID, err)
+		}
+		fmt.Printf("%s: %s\n", rec.ID, result.Status)
+	}
+}
@@ -0,0 +1,1208 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+// cliEnv is a built tianniu binary with a configuration pointing at a mock
+// server
+type cliEnv struct {
+	bin    string
+	config string
+}
+
+// setupCLI builds cmd/tianniu and writes a configuration for server
+func setupCLI(t *testing.T, server *httptest.Server) *cliEnv {
+	dir, err := ioutil.TempDir("", "tianniu-cli")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	bin := filepath.Join(dir, "tianniu")
+	build := exec.Command("go", "build", "-o", bin, "../cmd/tianniu")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to build the CLI: %v\n%s", err, out)
+	}
+
+	config := filepath.Join(dir, "config.yaml")
+	ioutil.WriteFile(config, []byte(`apiVersion: v1
+kind: TianNiuConfig
+environments:
+  - name: production
+    api_endpoint: `+server.URL+`/api/v1
+    auth:
+      type: api_key
+      api_key_env: TIANNIU_CLI_TEST_KEY
+    default: true
+`), 0600)
+	return &cliEnv{bin: bin, config: config}
+}
+
+// run runs the CLI and returns its standard output, standard error and exit
+// code
+func (c *cliEnv) run(t *testing.T, args ...string) (string, string, int) {
+	return c.runWithInput(t, "", args...)
+}
+
+// runWithInput runs the CLI with input as its standard input
+func (c *cliEnv) runWithInput(t *testing.T, input string, args ...string) (string, string, int) {
+	cmd := exec.Command(c.bin, append([]string{"--config", c.config}, args...)...)
+	cmd.Env = append(os.Environ(), "TIANNIU_CLI_TEST_KEY=cli-key")
+	cmd.Stdin = strings.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	code := 0
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatalf("Failed to run the CLI: %v", err)
+	}
+	return stdout.String(), stderr.String(), code
+}
+
+// Mock server for the CLI
+func setupCLIMockServer(t *testing.T) *httptest.Server {
+	handler := http.NewServeMux()
+	created := time.Now().Add(-3 * time.Hour)
+
+	deployments := []tianniu.Deployment{
+		{
+			ID: "d1", Name: "web-frontend", Environment: "production", Status: "active", Version: "1.2.0",
+			Replicas: 3, CreatedAt: created, Strategy: tianniu.DeploymentStrategy{Type: "RollingUpdate"},
+			Containers: []tianniu.DeploymentContainer{{Name: "web", Image: "nginx:1.25"}},
+		},
+		{ID: "d2", Name: "api-backend", Environment: "production", Status: "pending", Version: "2.0.1", Replicas: 2, CreatedAt: created},
+	}
+
+	handler.HandleFunc("/api/v1/deployments", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer cli-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(tianniu.DeploymentList{Total: 5, Limit: 2, Deployments: deployments})
+	})
+
+	handler.HandleFunc("/api/v1/deployments/d1", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(deployments[0])
+	})
+
+	// The containers of api-backend only come with its details, as with
+	// every deployment of the API
+	handler.HandleFunc("/api/v1/deployments/d2", func(w http.ResponseWriter, r *http.Request) {
+		d := deployments[1]
+		d.Containers = []tianniu.DeploymentContainer{{Name: "api", Image: "api-backend:2.0.1"}}
+		json.NewEncoder(w).Encode(d)
+	})
+
+	handler.HandleFunc("/api/v1/deployments/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": map[string]string{"code": "NOT_FOUND", "message": "deployment not found"},
+		})
+	})
+
+	handler.HandleFunc("/api/v1/containers/c1/pause", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(tianniu.Container{ID: "c1", Name: "web", Image: "nginx:1.25", Status: "pausing", CreatedAt: created})
+	})
+
+	handler.HandleFunc("/api/v1/containers/batch/stop", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"results": []map[string]string{
+			{"id": "c1", "status": "stopping", "message": "Container is stopping"},
+			{"id": "c2", "status": "error", "message": "Container is not running"},
+		}})
+	})
+	for _, id := range []string{"c1", "c2"} {
+		id := id
+		handler.HandleFunc("/api/v1/containers/"+id+"/restart", func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(tianniu.Container{ID: id, Status: "restarting"})
+		})
+	}
+
+	handler.HandleFunc("/api/v1/containers/c1/logs", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("tail") != "2" {
+			t.Errorf("Unexpected logs query %s", r.URL.RawQuery)
+		}
+		at := time.Date(2023, 6, 16, 14, 30, 12, 0, time.UTC)
+		json.NewEncoder(w).Encode(tianniu.ContainerLogs{ContainerID: "c1", Logs: []tianniu.LogEntry{
+			{Timestamp: at, Stream: "stdout", Message: "Server started on port 8080"},
+			{Timestamp: at.Add(6 * time.Second), Stream: "stderr", Message: "Warning: High memory usage"},
+		}})
+	})
+
+	handler.HandleFunc("/api/v1/containers", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("label") != "app=web" {
+			t.Errorf("Unexpected container list query %s", r.URL.RawQuery)
+		}
+		json.NewEncoder(w).Encode(tianniu.ContainerList{Total: 2, Containers: []tianniu.Container{
+			{ID: "c1", Name: "web", Status: "running"},
+			{ID: "c2", Name: "web-replica", Status: "running"},
+		}})
+	})
+
+	handler.HandleFunc("/api/v1/containers/c2/logs", func(w http.ResponseWriter, r *http.Request) {
+		at := time.Date(2023, 6, 16, 14, 30, 15, 0, time.UTC)
+		json.NewEncoder(w).Encode(tianniu.ContainerLogs{ContainerID: "c2", Logs: []tianniu.LogEntry{
+			{Timestamp: at, Stream: "stdout", Message: "Replica ready"},
+		}})
+	})
+
+	handler.HandleFunc("/api/v1/containers/c1/stats", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(tianniu.ContainerStats{
+			ContainerID: "c1",
+			CPU:         tianniu.CPUStats{UsagePercent: 12.5},
+			Memory:      tianniu.MemoryStats{Usage: 256 << 20, Limit: 1 << 30, UsagePercent: 25},
+			Network:     tianniu.NetworkStats{RxBytes: 1000, TxBytes: 2048},
+		})
+	})
+
+	handler.HandleFunc("/api/v1/containers/c1/exec", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") == "websocket" {
+			// Interactive session running cat, or exiting with 5 for false
+			tianniu.ServeExecSession(w, r, func(session *tianniu.ExecSession) int {
+				if session.Options.Command[0] == "false" {
+					return 5
+				}
+				if session.Options.TTY {
+					fmt.Fprint(session.Stdout, "tty\r\n")
+				}
+				if session.Stdin != nil {
+					io.Copy(session.Stdout, session.Stdin)
+				}
+				return 0
+			})
+			return
+		}
+		var opts tianniu.ExecOptions
+		json.NewDecoder(r.Body).Decode(&opts)
+		if len(opts.Env) != 1 || opts.Env[0].Name != "DEBUG" || opts.WorkingDir != "/app" {
+			t.Errorf("Unexpected exec request %+v", opts)
+		}
+		if opts.Command[0] == "false" {
+			json.NewEncoder(w).Encode(tianniu.ExecResult{ExitCode: 3, Stderr: "failed\n"})
+			return
+		}
+		json.NewEncoder(w).Encode(tianniu.ExecResult{Stdout: strings.Join(opts.Command, " ") + "\n"})
+	})
+
+	handler.HandleFunc("/api/v1/resources/nodes", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(tianniu.NodeList{Total: 1, Limit: 20, Nodes: []tianniu.Node{{
+			ID: "node-1", Name: "worker-01", Status: "ready", Role: "worker", CreatedAt: created,
+			Resources: tianniu.NodeResources{
+				CPU:    tianniu.NodeResource{Capacity: 32, Allocatable: 30, Allocated: 25, Available: 5},
+				Memory: tianniu.NodeResource{Capacity: 128, Allocatable: 120, Allocated: 100, Available: 20, Unit: "GB"},
+			},
+			Labels: map[string]string{"region": "beijing", "zone": "zone-a", "instance-type": "high-memory"},
+		}}})
+	})
+	var drainMu sync.Mutex
+	// Each GET evicts a pod, except the DaemonSet pod that stays on the node
+	nodePods := []tianniu.NodePod{{Name: "web-1", Namespace: "production"}, {Name: "web-2", Namespace: "production"}, {Name: "node-exporter", Namespace: "kube-system"}}
+	handler.HandleFunc("/api/v1/resources/nodes/node-1", func(w http.ResponseWriter, r *http.Request) {
+		drainMu.Lock()
+		defer drainMu.Unlock()
+		node := tianniu.Node{ID: "node-1", Name: "worker-01", Status: "ready", Pods: nodePods,
+			Conditions: []tianniu.NodeCondition{{Type: "Ready", Status: "True", Reason: "KubeletReady"}}}
+		if len(nodePods) > 1 {
+			nodePods = nodePods[1:]
+		}
+		json.NewEncoder(w).Encode(node)
+	})
+	handler.HandleFunc("/api/v1/resources/nodes/node-1/", func(w http.ResponseWriter, r *http.Request) {
+		action := strings.TrimPrefix(r.URL.Path, "/api/v1/resources/nodes/node-1/")
+		status := map[string]string{"cordon": "cordoned", "uncordon": "ready", "drain": "draining"}[action]
+		json.NewEncoder(w).Encode(tianniu.Node{ID: "node-1", Name: "worker-01", Status: status})
+	})
+
+	handler.HandleFunc("/api/v1/resources/usage/production", func(w http.ResponseWriter, r *http.Request) {
+		at := time.Date(2023, 5, 15, 0, 0, 0, 0, time.UTC)
+		if r.URL.Query().Get("period") != "hour" && r.URL.Query().Get("period") != "day" {
+			t.Errorf("Unexpected usage query %s", r.URL.RawQuery)
+		}
+		cpu := tianniu.UsageSeries{Quota: 100, Unit: "cores"}
+		for i, usage := range []float64{10, 20, 90, 40} {
+			cpu.DataPoints = append(cpu.DataPoints, tianniu.UsagePoint{Timestamp: at.Add(time.Duration(i) * time.Hour), Usage: usage, UsagePercent: usage})
+		}
+		json.NewEncoder(w).Encode(tianniu.UsageReport{Namespace: "production", Interval: "1h", Resources: map[string]tianniu.UsageSeries{"cpu": cpu}})
+	})
+
+	// rec-1 was made when web still requested CPU
+	handler.HandleFunc("/api/v1/resources/recommendations", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"recommendations": [
+			{"id": "rec-1", "resource_type": "cpu", "recommendation_type": "resize", "confidence": "high",
+				"target": {"type": "deployment", "name": "web-frontend", "namespace": "production"},
+				"current_value": {"request": 0.5}, "recommended_value": {"request": 0.25}, "potential_savings": {"cost": "¥200/month"}},
+			{"id": "rec-2", "resource_type": "memory", "recommendation_type": "resize", "confidence": "medium",
+				"target": {"type": "deployment", "name": "web-frontend", "namespace": "production"},
+				"recommended_value": {"limit": "256Mi"}, "potential_savings": {"cost": "¥50/month"}},
+			{"id": "rec-3", "resource_type": "cpu", "recommendation_type": "consolidate", "confidence": "high",
+				"target": {"type": "node_group", "name": "worker-nodes", "namespace": "system"},
+				"current_value": {"nodes": 10}, "recommended_value": {"nodes": 8}, "potential_savings": {"cost": "¥1000/month"}}
+		]}`))
+	})
+	handler.HandleFunc("/api/v1/resources/recommendations/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/resources/recommendations/"), "/apply")
+		appliedMu.Lock()
+		appliedRecommendations = append(appliedRecommendations, id)
+		appliedMu.Unlock()
+		json.NewEncoder(w).Encode(tianniu.RecommendationApplyResult{ID: id, Status: "applying", Message: "Resource optimization is being applied"})
+	})
+
+	handler.HandleFunc("/api/v1/resources/quotas", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(tianniu.NamespaceQuotas{Namespace: r.URL.Query().Get("namespace"), Quotas: []tianniu.ResourceQuota{
+			{ResourceType: "cpu", Limit: 100, Used: 45, Available: 55, Unit: "cores"},
+			{ResourceType: "memory", Limit: 256, Used: 240, Available: 16, Unit: "GB"},
+		}})
+	})
+	handler.HandleFunc("/api/v1/resources/quotas/", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Quotas []tianniu.ResourceQuota `json:"quotas"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		for i := range body.Quotas {
+			body.Quotas[i].Used = 45
+			body.Quotas[i].Available = body.Quotas[i].Limit - 45
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"namespace":      strings.TrimPrefix(r.URL.Path, "/api/v1/resources/quotas/"),
+			"updated_quotas": body.Quotas,
+		})
+	})
+
+	return httptest.NewServer(handler)
+}
+
+// Test the output formats of list and get commands
+func TestCLIOutputFormats(t *testing.T) {
+	server := setupCLIMockServer(t)
+	defer server.Close()
+	cli := setupCLI(t, server)
+
+	stdout, stderr, code := cli.run(t, "deploy", "list")
+	if code != 0 {
+		t.Fatalf("deploy list failed with %d: %s", code, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "ID  ") || strings.Contains(lines[0], "IMAGES") {
+		t.Errorf("Unexpected table:\n%s", stdout)
+	}
+	if !strings.Contains(lines[1], "web-frontend") || !strings.Contains(lines[1], "3h") {
+		t.Errorf("Unexpected table row '%s'", lines[1])
+	}
+	if !strings.Contains(stderr, "Showing 1-2 of 5, use --offset 2 for more") {
+		t.Errorf("Expected pagination note on stderr, got '%s'", stderr)
+	}
+
+	stdout, _, _ = cli.run(t, "deploy", "list", "-o", "wide")
+	if !strings.Contains(stdout, "IMAGES") || !strings.Contains(stdout, "nginx:1.25") || !strings.Contains(stdout, "<none>") {
+		t.Errorf("Unexpected wide table:\n%s", stdout)
+	}
+
+	stdout, _, _ = cli.run(t, "deploy", "list", "-o", "json")
+	var list tianniu.DeploymentList
+	if err := json.Unmarshal([]byte(stdout), &list); err != nil || list.Total != 5 || len(list.Deployments) != 2 {
+		t.Errorf("Unexpected JSON output (%v):\n%s", err, stdout)
+	}
+
+	stdout, _, _ = cli.run(t, "deploy", "get", "d1", "--output", "yaml")
+	if !strings.HasPrefix(stdout, "id: d1\nname: web-frontend\n") {
+		t.Errorf("Unexpected YAML output:\n%s", stdout)
+	}
+
+	stdout, _, _ = cli.run(t, "deploy", "list", "-o", "name")
+	if stdout != "deployment/d1\ndeployment/d2\n" {
+		t.Errorf("Unexpected name output '%s'", stdout)
+	}
+
+	stdout, _, _ = cli.run(t, "deploy", "list", "-o", `jsonpath={range .deployments[*]}{.id}{"\t"}{.replicas}{"\n"}{end}`)
+	if stdout != "d1\t3\nd2\t2\n" {
+		t.Errorf("Unexpected jsonpath range output '%s'", stdout)
+	}
+
+	stdout, _, _ = cli.run(t, "deploy", "list", "-o", "jsonpath={.deployments[*].name} {$.total} {.deployments[-1].containers}")
+	if stdout != "web-frontend api-backend 5 " {
+		t.Errorf("Unexpected jsonpath output '%s'", stdout)
+	}
+
+	stdout, _, _ = cli.run(t, "deploy", "get", "d1", "-o", "jsonpath=.strategy")
+	if stdout != `{"type":"RollingUpdate"}` {
+		t.Errorf("Unexpected jsonpath object output '%s'", stdout)
+	}
+
+	stdout, _, _ = cli.run(t, "deploy", "list", "-o", `go-template={{range .deployments}}{{if gt .replicas 2}}{{.name}}{{end}}{{end}}`)
+	if stdout != "web-frontend" {
+		t.Errorf("Unexpected go-template output '%s'", stdout)
+	}
+
+	for _, format := range []string{"xml", "jsonpath={range .deployments[*]}", "go-template={{.name", "json=x"} {
+		if _, _, code := cli.run(t, "deploy", "list", "-o", format); code != 2 {
+			t.Errorf("Expected exit code 2 for -o %s, got %d", format, code)
+		}
+	}
+
+	if _, _, code := cli.run(t, "deploy", "get", "missing", "-o", "name"); code != 4 {
+		t.Errorf("Expected exit code 4 for a missing deployment, got %d", code)
+	}
+}
+
+// deploymentStore is an in-memory deployments API. labels holds the labels
+// of deployments by ID, which the label query of the list matches.
+type deploymentStore struct {
+	mu          sync.Mutex
+	deployments map[string]*tianniu.Deployment
+	labels      map[string]map[string]string
+	nextID      int
+	writes      []string
+}
+
+func (s *deploymentStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/deployments")
+	id = strings.TrimPrefix(id, "/")
+	switch {
+	case id == "" && r.Method == "GET":
+		list := tianniu.DeploymentList{Deployments: []tianniu.Deployment{}}
+		selector, err := tianniu.ParseSelector(r.URL.Query().Get("label"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, d := range s.deployments {
+			if d.Environment == r.URL.Query().Get("environment") && selector.Matches(s.labels[d.ID]) {
+				list.Deployments = append(list.Deployments, *d)
+			}
+		}
+		sort.Slice(list.Deployments, func(i, j int) bool { return list.Deployments[i].ID < list.Deployments[j].ID })
+		list.Total = len(list.Deployments)
+		json.NewEncoder(w).Encode(list)
+		return
+	case id == "" && r.Method == "POST":
+		var d tianniu.Deployment
+		json.NewDecoder(r.Body).Decode(&d)
+		s.nextID++
+		d.ID = fmt.Sprintf("d%d", s.nextID)
+		d.Status = "pending"
+		s.deployments[d.ID] = &d
+		s.writes = append(s.writes, "create "+d.Name)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(d)
+		return
+	case strings.HasSuffix(id, "/scale") && r.Method == "POST":
+		d, ok := s.deployments[strings.TrimSuffix(id, "/scale")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var scale struct {
+			Replicas int `json:"replicas"`
+		}
+		json.NewDecoder(r.Body).Decode(&scale)
+		d.Replicas = scale.Replicas
+		s.writes = append(s.writes, "scale "+d.Name)
+		json.NewEncoder(w).Encode(d)
+		return
+	}
+
+	d, ok := s.deployments[id]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case "GET":
+		json.NewEncoder(w).Encode(d)
+	case "PUT":
+		var updated tianniu.Deployment
+		json.NewDecoder(r.Body).Decode(&updated)
+		updated.ID, updated.Status = d.ID, d.Status
+		s.deployments[id] = &updated
+		s.writes = append(s.writes, "update "+d.Name)
+		json.NewEncoder(w).Encode(updated)
+	case "DELETE":
+		delete(s.deployments, id)
+		s.writes = append(s.writes, "delete "+d.Name)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Test declarative apply with diff, dry-run and prune
+func TestCLIApply(t *testing.T) {
+	store := &deploymentStore{deployments: map[string]*tianniu.Deployment{
+		"d100": {ID: "d100", Name: "web-frontend", Environment: "production", Status: "active", Version: "1.2.0", Replicas: 3,
+			Containers: []tianniu.DeploymentContainer{{Name: "web", Image: "nginx:1.24"}}},
+		"d101": {ID: "d101", Name: "legacy-api", Environment: "production", Status: "active", Version: "0.9.0", Replicas: 1},
+		"d102": {ID: "d102", Name: "web-frontend", Environment: "staging", Status: "active", Version: "1.3.0", Replicas: 1},
+		"d103": {ID: "d103", Name: "billing", Environment: "production", Status: "active", Version: "3.1.0", Replicas: 2},
+	}, labels: map[string]map[string]string{
+		"d100": {"app": "shop"},
+		"d101": {"app": "shop"},
+		"d103": {"app": "billing"},
+	}, nextID: 200}
+	handler := http.NewServeMux()
+	handler.Handle("/api/v1/deployments", store)
+	handler.Handle("/api/v1/deployments/", store)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	cli := setupCLI(t, server)
+
+	dir := filepath.Dir(cli.config)
+	manifests := filepath.Join(dir, "manifests")
+	os.Mkdir(manifests, 0755)
+	ioutil.WriteFile(filepath.Join(manifests, "web.json"), []byte(`{
+  "name": "web-frontend",
+  "version": "1.2.0",
+  "replicas": 5,
+  "containers": [{"name": "web", "image": "nginx:1.25", "resources": {"requests": {"cpu": "0.5", "memory": "512Mi"}}}]
+}`), 0644)
+	ioutil.WriteFile(filepath.Join(manifests, "worker.yaml"), []byte(`apiVersion: v1
+kind: Deployment
+metadata:
+  name: worker
+spec:
+  version: 1.0.0
+  replicas: 2
+  containers:
+  - name: worker
+    image: registry.baidu.com/backend/worker:1.0.0
+    resources:
+      requests:
+        cpu: 250m
+        memory: 128Mi
+`), 0644)
+
+	// Pruning must be scoped by a selector
+	if _, stderr, code := cli.run(t, "apply", "-f", manifests, "--prune", "--dry-run"); code != 2 || !strings.Contains(stderr, "--prune requires a label selector") {
+		t.Errorf("Expected a usage error for --prune without -l (exit %d): %s", code, stderr)
+	}
+
+	stdout, stderr, code := cli.run(t, "apply", "-f", manifests, "--prune", "-l", "app=shop", "--dry-run")
+	if code != 0 {
+		t.Fatalf("apply --dry-run failed with %d: %s", code, stderr)
+	}
+	for _, want := range []string{
+		"deployment/web-frontend (production) updated (dry run)\n",
+		`    containers[0].image: "nginx:1.24" -> "nginx:1.25"` + "\n",
+		"    replicas: 3 -> 5\n",
+		"deployment/worker (production) created (dry run)\n",
+		"deployment/legacy-api (production) pruned (dry run)\n",
+	} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("Expected '%s' in dry run output:\n%s", strings.TrimSpace(want), stdout)
+		}
+	}
+	if strings.Contains(stdout, "billing") {
+		t.Errorf("Expected billing, which the selector does not match, to be kept:\n%s", stdout)
+	}
+	if len(store.writes) != 0 {
+		t.Errorf("Dry run changed deployments: %v", store.writes)
+	}
+
+	// Nothing changes unless the deletion is confirmed
+	_, stderr, code = cli.run(t, "apply", "-f", manifests, "--prune", "-l", "app=shop")
+	if code != 0 || !strings.Contains(stderr, "    deployment/legacy-api (production)\nDelete 1 deployments? [y/N] Aborted\n") || len(store.writes) != 0 {
+		t.Errorf("Unexpected unconfirmed prune (exit %d): %s %v", code, stderr, store.writes)
+	}
+
+	stdout, stderr, code = cli.runWithInput(t, "y\n", "apply", "-f", manifests, "--prune", "-l", "app=shop", "-o", "json")
+	if code != 0 {
+		t.Fatalf("apply failed with %d: %s", code, stderr)
+	}
+	var results []tianniu.ApplyResult
+	if err := json.Unmarshal([]byte(stdout), &results); err != nil || len(results) != 3 {
+		t.Fatalf("Unexpected apply results (%v):\n%s", err, stdout)
+	}
+	if results[1].Action != tianniu.ApplyCreated || results[1].ID != "d201" {
+		t.Errorf("Unexpected create result %+v", results[1])
+	}
+	if got := strings.Join(store.writes, ","); got != "update web-frontend,create worker,delete legacy-api" {
+		t.Errorf("Unexpected writes %s", got)
+	}
+	if store.deployments["d100"].Replicas != 5 || store.deployments["d102"].Replicas != 1 {
+		t.Error("Expected only the production web-frontend to be updated")
+	}
+	if store.deployments["d103"] == nil {
+		t.Error("Expected the unrelated billing deployment to survive the prune")
+	}
+
+	stdout, _, _ = cli.run(t, "apply", "-f", filepath.Join(manifests, "web.json"))
+	if stdout != "deployment/web-frontend (production) unchanged\n" {
+		t.Errorf("Expected a second apply to change nothing, got '%s'", stdout)
+	}
+}
+
+// Test that apply and validate take the Deployments of a directory that also
+// holds manifests of other kinds
+func TestCLIApplyExamples(t *testing.T) {
+	store := &deploymentStore{deployments: map[string]*tianniu.Deployment{}}
+	handler := http.NewServeMux()
+	handler.Handle("/api/v1/deployments", store)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	cli := setupCLI(t, server)
+
+	stdout, stderr, code := cli.run(t, "apply", "--dry-run", "-f", "../examples/manifests")
+	if code != 0 || stdout != "deployment/web-frontend (production) created (dry run)\n" {
+		t.Errorf("Unexpected apply of the examples (exit %d):\n%s%s", code, stdout, stderr)
+	}
+	if len(store.writes) != 0 {
+		t.Errorf("Dry run changed deployments: %v", store.writes)
+	}
+	stdout, stderr, code = cli.run(t, "deploy", "validate", "-f", "../examples/manifests")
+	if code != 0 || stdout != "deployment/web-frontend: valid\n" {
+		t.Errorf("Unexpected validation of the examples (exit %d):\n%s%s", code, stdout, stderr)
+	}
+
+	// A file without a Deployment is still an error for single-deployment
+	// commands
+	if _, stderr, code := cli.run(t, "deploy", "create", "-f", "../examples/manifests/redis-cache.yaml"); code != 2 || !strings.Contains(stderr, "declares no Deployment") {
+		t.Errorf("Expected a usage error (exit %d): %s", code, stderr)
+	}
+}
+
+// Test checking and enforcing the policies of an environment
+func TestCLIPolicy(t *testing.T) {
+	store := &deploymentStore{deployments: map[string]*tianniu.Deployment{}}
+	handler := http.NewServeMux()
+	handler.Handle("/api/v1/deployments", store)
+	handler.Handle("/api/v1/deployments/", store)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	cli := setupCLI(t, server)
+
+	dir := filepath.Dir(cli.config)
+	policy := filepath.Join(dir, "policy.yaml")
+	ioutil.WriteFile(policy, []byte(`apiVersion: v1
+kind: Policy
+metadata:
+  name: guardrails
+spec:
+  rules:
+  - name: pinned-images
+    environments: [production]
+    images:
+      disallowed_tags: [latest]
+  - name: highly-available
+    action: warn
+    replicas:
+      min: 2
+  - name: capacity
+    environments: [production]
+    replicas:
+      max: 10
+`), 0644)
+	manifest := filepath.Join(dir, "web.yaml")
+	ioutil.WriteFile(manifest, []byte(`apiVersion: v1
+kind: Deployment
+metadata:
+  name: web
+  environment: production
+spec:
+  version: 1.0.0
+  replicas: 1
+  containers:
+  - name: web
+    image: nginx:latest
+    resources:
+      requests:
+        cpu: 250m
+        memory: 128Mi
+`), 0644)
+
+	stdout, _, code := cli.run(t, "policy", "check", "-f", manifest, "--policy", policy)
+	want := "deployment/web (production):\n" +
+		`    deny pinned-images: containers[0].image: image tag "latest" is not allowed` + "\n" +
+		"    warn highly-available: replicas: 1 is fewer than the minimum of 2\n"
+	if code != 1 || stdout != want {
+		t.Errorf("Unexpected policy check (exit %d):\n%s", code, stdout)
+	}
+	staging := strings.Replace(readFile(t, manifest), "production", "staging", 1)
+	ioutil.WriteFile(manifest, []byte(staging), 0644)
+	if stdout, _, code := cli.run(t, "policy", "check", "-f", manifest, "--policy", policy); code != 0 || !strings.Contains(stdout, "warn highly-available") {
+		t.Errorf("Expected only a warning in staging (exit %d):\n%s", code, stdout)
+	}
+	production := strings.Replace(staging, "staging", "production", 1)
+	ioutil.WriteFile(manifest, []byte(production), 0644)
+
+	// The environment's policy file is enforced before anything is sent
+	config, _ := ioutil.ReadFile(cli.config)
+	ioutil.WriteFile(cli.config, append(config, []byte("    policy_file: "+policy+"\n")...), 0600)
+	_, stderr, code := cli.run(t, "deploy", "create", "-f", manifest)
+	if code != 1 || !strings.Contains(stderr, "Warning: deployment/web: highly-available") ||
+		!strings.Contains(stderr, "Error: deployment/web denied by policy:\n  - pinned-images: containers[0].image") {
+		t.Errorf("Expected create to be denied (exit %d):\n%s", code, stderr)
+	}
+	if len(store.writes) != 0 {
+		t.Errorf("Denied deployment was sent: %v", store.writes)
+	}
+
+	pinned := strings.Replace(readFile(t, manifest), "nginx:latest", "nginx:1.25", 1)
+	ioutil.WriteFile(manifest, []byte(pinned), 0644)
+	if _, stderr, code := cli.run(t, "deploy", "create", "-f", manifest); code != 0 || !strings.Contains(stderr, "Warning:") {
+		t.Errorf("Expected create to pass with a warning (exit %d):\n%s", code, stderr)
+	}
+
+	// Scaling is checked against the replicas rules of the deployment's environment
+	_, stderr, code = cli.run(t, "deploy", "scale", "d1", "--replicas", "20")
+	if code != 1 || !strings.Contains(stderr, "Error: deployment/web denied by policy:\n  - capacity: replicas: 20 is more than the maximum of 10") {
+		t.Errorf("Expected scale to be denied (exit %d):\n%s", code, stderr)
+	}
+	if _, stderr, code := cli.run(t, "deploy", "scale", "d1", "--replicas", "1"); code != 0 ||
+		!strings.Contains(stderr, "Warning: deployment/web: highly-available: replicas: 1 is fewer than the minimum of 2") {
+		t.Errorf("Expected scale to pass with a warning (exit %d):\n%s", code, stderr)
+	}
+	if strings.Join(store.writes, ", ") != "create web, scale web" {
+		t.Errorf("Unexpected writes %v", store.writes)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+// Test exporting a deployment of the API as Kubernetes YAML
+func TestCLIExportK8s(t *testing.T) {
+	server := setupCLIMockServer(t)
+	defer server.Close()
+	cli := setupCLI(t, server)
+
+	stdout, stderr, code := cli.run(t, "export", "k8s", "d1", "--namespace", "web")
+	if code != 0 {
+		t.Fatalf("export k8s failed with %d: %s", code, stderr)
+	}
+	for _, want := range []string{"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web-frontend\n  namespace: web\n", "      - name: web\n        image: nginx:1.25\n"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("Expected '%s' in:\n%s", strings.TrimSpace(want), stdout)
+		}
+	}
+
+	stdout, _, code = cli.run(t, "export", "k8s", "d1", "-o", "json")
+	var list struct {
+		Kind  string                   `json:"kind"`
+		Items []map[string]interface{} `json:"items"`
+	}
+	if code != 0 || json.Unmarshal([]byte(stdout), &list) != nil || list.Kind != "List" || len(list.Items) != 1 {
+		t.Errorf("Unexpected JSON export (exit %d):\n%s", code, stdout)
+	}
+
+	// --all exports every deployment of the environment in full, not the
+	// list entries, which have no containers
+	stdout, stderr, code = cli.run(t, "export", "k8s", "--all")
+	if code != 0 {
+		t.Fatalf("export k8s --all failed with %d: %s", code, stderr)
+	}
+	for _, want := range []string{"  name: web-frontend\n", "      - name: web\n        image: nginx:1.25\n", "      - name: api\n        image: api-backend:2.0.1\n"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("Expected '%s' in:\n%s", strings.TrimSpace(want), stdout)
+		}
+	}
+
+	if _, _, code := cli.run(t, "export", "k8s"); code != 2 {
+		t.Errorf("Expected exit code 2 without deployments, got %d", code)
+	}
+	if _, _, code := cli.run(t, "export", "k8s", "missing"); code != 4 {
+		t.Errorf("Expected exit code 4 for a missing deployment, got %d", code)
+	}
+}
+
+func TestCLIImport(t *testing.T) {
+	server := setupCLIMockServer(t)
+	defer server.Close()
+	cli := setupCLI(t, server)
+
+	stdout, stderr, code := cli.run(t, "import", "compose", "-f", "../examples/import/docker-compose.yml", "--environment", "staging")
+	if code != 0 {
+		t.Fatalf("import compose failed with %d: %s", code, stderr)
+	}
+	manifests, err := tianniu.DecodeManifests(strings.NewReader(stdout))
+	if err != nil || len(manifests) != 2 || manifests[1].Name() != "web-frontend" || manifests[1].Deployment.Metadata.Environment != "staging" {
+		t.Errorf("Unexpected manifests (%v):\n%s", err, stdout)
+	}
+	if !strings.Contains(stderr, "Warning: service/cache: volumes: not supported\n") {
+		t.Errorf("Expected a warning for the cache volumes, got:\n%s", stderr)
+	}
+
+	if _, _, code := cli.run(t, "import", "compose", "-f", "../examples/import/docker-compose.yml", "--strict"); code != 1 {
+		t.Errorf("Expected exit code 1 with --strict, got %d", code)
+	}
+	if _, _, code := cli.run(t, "import", "k8s"); code != 2 {
+		t.Errorf("Expected exit code 2 without a file, got %d", code)
+	}
+}
+
+// Test listing kubeconfig contexts and inspecting a deployment directly
+func TestCLICluster(t *testing.T) {
+	server := setupCLIMockServer(t)
+	defer server.Close()
+	cli := setupCLI(t, server)
+
+	if _, stderr, code := cli.run(t, "cluster", "contexts"); code != 3 || !strings.Contains(stderr, "has no kubeconfig") {
+		t.Errorf("Expected a config error without a kubeconfig (exit %d):\n%s", code, stderr)
+	}
+
+	cluster := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer cli-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/apis/apps/v1/namespaces/web/deployments/d1":
+			w.Write([]byte(`{"metadata": {"name": "d1"}, "spec": {"replicas": 2, "selector": {"matchLabels": {"app": "d1"}}},
+				"status": {"replicas": 2, "readyReplicas": 2, "updatedReplicas": 2, "availableReplicas": 2}}`))
+		case "/api/v1/namespaces/web/pods":
+			w.Write([]byte(`{"items": [{"metadata": {"name": "d1-abc", "labels": {"app": "d1"}},
+				"spec": {"nodeName": "node-1"}, "status": {"phase": "Running", "podIP": "10.0.0.5",
+				"containerStatuses": [{"name": "web", "ready": true, "restartCount": 0, "state": {"running": {}}}]}}]}`))
+		default:
+			w.Write([]byte(`{"items": []}`))
+		}
+	}))
+	defer cluster.Close()
+	kubeconfig := filepath.Join(filepath.Dir(cli.config), "kubeconfig.yaml")
+	ioutil.WriteFile(kubeconfig, []byte(`current-context: web
+clusters:
+- name: test
+  cluster:
+    server: `+cluster.URL+`
+    insecure-skip-tls-verify: true
+contexts:
+- name: web
+  context: {cluster: test, user: cli, namespace: web}
+- name: broken
+  context: {cluster: missing, user: cli}
+users:
+- name: cli
+  user: {token: cli-token}
+`), 0600)
+	config, _ := ioutil.ReadFile(cli.config)
+	ioutil.WriteFile(cli.config, append(config, []byte("    kubeconfig: kubeconfig.yaml\n")...), 0600)
+
+	stdout, stderr, code := cli.run(t, "cluster", "contexts")
+	if code != 0 || !strings.Contains(stdout, "*        web ") || !strings.Contains(stdout, cluster.URL) {
+		t.Errorf("Unexpected contexts (exit %d):\n%s%s", code, stdout, stderr)
+	}
+
+	stdout, stderr, code = cli.run(t, "cluster", "inspect", "d1")
+	if code != 0 {
+		t.Fatalf("cluster inspect failed with %d: %s", code, stderr)
+	}
+	for _, want := range []string{"Namespace:  web\n", "Selector:   app=d1\n", "Deployment: d1 2/2 ready", "d1-abc", "10.0.0.5", "Services:\n  <none>\n"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("Expected %q in:\n%s", want, stdout)
+		}
+	}
+	if _, stderr, code := cli.run(t, "cluster", "inspect", "d1", "--context", "broken"); code != 3 || !strings.Contains(stderr, "cluster missing not found") {
+		t.Errorf("Expected a config error for a broken context (exit %d):\n%s", code, stderr)
+	}
+}
+
+// Test the container lifecycle, logs, stats and exec commands
+func TestCLIContainer(t *testing.T) {
+	server := setupCLIMockServer(t)
+	defer server.Close()
+	cli := setupCLI(t, server)
+
+	if stdout, stderr, code := cli.run(t, "container", "pause", "c1"); code != 0 || !strings.HasPrefix(stdout, "Container pausing\nID ") {
+		t.Errorf("Unexpected pause output (exit %d):\n%s%s", code, stdout, stderr)
+	}
+
+	// Batches print one row per container and fail if any container failed
+	stdout, stderr, code := cli.run(t, "container", "stop", "-l", "app=web", "--timeout", "30s")
+	if code != 1 || !strings.Contains(stdout, "c1  stopping  Container is stopping") || !strings.Contains(stdout, "c2  failed    Container is not running") ||
+		!strings.Contains(stderr, "failed to stop 1 of 2 containers") {
+		t.Errorf("Unexpected batch stop output (exit %d):\n%s%s", code, stdout, stderr)
+	}
+	stdout, stderr, code = cli.run(t, "container", "restart", "c1", "c2", "--concurrency", "2", "-o", "name")
+	if code != 0 || stdout != "container/c1\ncontainer/c2\n" {
+		t.Errorf("Unexpected batch restart output (exit %d):\n%s%s", code, stdout, stderr)
+	}
+	if _, _, code := cli.run(t, "container", "start"); code != 2 {
+		t.Errorf("Expected exit code 2 without containers, got %d", code)
+	}
+
+	stdout, stderr, code = cli.run(t, "container", "logs", "c1", "--tail", "2", "--timestamps")
+	want := "2023-06-16T14:30:12Z Server started on port 8080\n2023-06-16T14:30:18Z Warning: High memory usage\n"
+	if code != 0 || stdout != want {
+		t.Errorf("Unexpected logs (exit %d):\n%s%s", code, stdout, stderr)
+	}
+	if _, _, code := cli.run(t, "container", "logs", "c1", "--since", "yesterday"); code != 2 {
+		t.Errorf("Expected exit code 2 for an invalid --since, got %d", code)
+	}
+
+	// The logs of all matching containers are merged by time
+	stdout, stderr, code = cli.run(t, "logs", "-l", "app=web", "--tail", "2")
+	want = "web         | Server started on port 8080\nweb-replica | Replica ready\nweb         | Warning: High memory usage\n"
+	if code != 0 || stdout != want {
+		t.Errorf("Unexpected merged logs (exit %d):\n%s%s", code, stdout, stderr)
+	}
+	if _, _, code := cli.run(t, "logs"); code != 2 {
+		t.Errorf("Expected exit code 2 without containers, got %d", code)
+	}
+
+	stdout, _, code = cli.run(t, "container", "stats", "c1")
+	if code != 0 || !strings.Contains(stdout, "12.50%") || !strings.Contains(stdout, "256.0Mi / 1.0Gi") || !strings.Contains(stdout, "1000B / 2.0Ki") {
+		t.Errorf("Unexpected stats (exit %d):\n%s", code, stdout)
+	}
+
+	stdout, stderr, code = cli.run(t, "container", "exec", "c1", "-e", "DEBUG=true", "-w", "/app", "--", "ls", "-la")
+	if code != 0 || stdout != "ls -la\n" {
+		t.Errorf("Unexpected exec output (exit %d):\n%s%s", code, stdout, stderr)
+	}
+	_, stderr, code = cli.run(t, "container", "exec", "c1", "-e", "DEBUG=true", "-w", "/app", "--", "false")
+	if code != 1 || stderr != "failed\nError: command exited with code 3\n" {
+		t.Errorf("Unexpected failing exec (exit %d):\n%s", code, stderr)
+	}
+	stdout, stderr, code = cli.runWithInput(t, "line one\nline two\n", "exec", "-i", "c1", "--", "cat")
+	if code != 0 || stdout != "line one\nline two\n" {
+		t.Errorf("Unexpected interactive exec output (exit %d):\n%s%s", code, stdout, stderr)
+	}
+	stdout, stderr, code = cli.runWithInput(t, "hi\n", "exec", "-it", "c1", "--", "cat")
+	if code != 0 || stdout != "tty\r\nhi\n" {
+		t.Errorf("Unexpected exec -it output (exit %d):\n%q%s", code, stdout, stderr)
+	}
+	_, stderr, code = cli.run(t, "exec", "-t", "c1", "--", "false")
+	if code != 1 || !strings.Contains(stderr, "exited with code 5") {
+		t.Errorf("Unexpected failing interactive exec (exit %d):\n%s", code, stderr)
+	}
+	if _, _, code := cli.run(t, "container", "exec", "c1"); code != 2 {
+		t.Errorf("Expected exit code 2 without a command, got %d", code)
+	}
+}
+
+// Test top and the time-series file of stats collect
+func TestCLIStats(t *testing.T) {
+	server := setupCLIMockServer(t)
+	defer server.Close()
+	cli := setupCLI(t, server)
+
+	// c2 has no stats endpoint and falls back on its listed usage
+	stdout, stderr, code := cli.run(t, "top", "-l", "app=web", "-n", "1")
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if code != 0 || len(lines) != 3 || !strings.HasPrefix(lines[1], "c1  web ") || !strings.Contains(lines[1], "12.50%") ||
+		!strings.Contains(lines[1], "256.0Mi / 1.0Gi") || !strings.HasPrefix(lines[2], "c2  web-replica") {
+		t.Errorf("Unexpected top output (exit %d):\n%s%s", code, stdout, stderr)
+	}
+	if _, _, code := cli.run(t, "top", "--sort", "age"); code != 2 {
+		t.Errorf("Expected exit code 2 for an invalid --sort, got %d", code)
+	}
+
+	file := filepath.Join(filepath.Dir(cli.config), "stats.ndjson")
+	if _, stderr, code := cli.run(t, "stats", "collect", "-l", "app=web", "--file", file, "--interval", "10ms", "-n", "2"); code != 0 {
+		t.Fatalf("stats collect failed with %d: %s", code, stderr)
+	}
+	stdout, stderr, code = cli.run(t, "stats", "history", "--file", file, "c1", "-o", "json")
+	var samples []tianniu.StatsSample
+	if code != 0 || json.Unmarshal([]byte(stdout), &samples) != nil {
+		t.Fatalf("stats history failed with %d: %s%s", code, stdout, stderr)
+	}
+	if len(samples) != 2 || samples[0].ContainerID != "c1" || samples[1].MemoryBytes != 256<<20 {
+		t.Errorf("Unexpected history %+v", samples)
+	}
+	if _, _, code := cli.run(t, "stats", "collect", "-l", "app=web"); code != 2 {
+		t.Errorf("Expected exit code 2 without --listen or --file, got %d", code)
+	}
+}
+
+// Test probing the health checks of a manifest against a local instance
+func TestCLIDeployProbe(t *testing.T) {
+	instance := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer instance.Close()
+	port := instance.Listener.Addr().(*net.TCPAddr).Port
+	server := setupCLIMockServer(t)
+	defer server.Close()
+	cli := setupCLI(t, server)
+
+	manifest := filepath.Join(filepath.Dir(cli.config), "probe.json")
+	write := func(path string) {
+		d := tianniu.Deployment{Name: "web", Containers: []tianniu.DeploymentContainer{
+			{Name: "web", Image: "nginx:1.25", HealthCheck: &tianniu.HealthCheck{HTTPPath: path, Port: port, InitialDelaySeconds: 60, FailureThreshold: 1}},
+			{Name: "sidecar", Image: "agent:1", HealthCheck: &tianniu.HealthCheck{Command: []string{"check"}}},
+		}}
+		data, _ := json.Marshal(d)
+		ioutil.WriteFile(manifest, data, 0644)
+	}
+
+	write("/health")
+	stdout, stderr, code := cli.run(t, "deploy", "probe", "-f", manifest, "--host", "127.0.0.1", "--skip-delay")
+	if code != 0 || !strings.Contains(stdout, fmt.Sprintf("web        http  http://127.0.0.1:%d/health  healthy", port)) ||
+		!strings.Contains(stdout, "skipped") {
+		t.Errorf("Unexpected probe output (exit %d):\n%s%s", code, stdout, stderr)
+	}
+
+	write("/broken")
+	stdout, stderr, code = cli.run(t, "deploy", "probe", "-f", manifest, "--host", "127.0.0.1", "--skip-delay", "--container", "web")
+	if code != 1 || !strings.Contains(stdout, "unhealthy") || strings.Contains(stdout, "sidecar") ||
+		!strings.Contains(stderr, "1 of 1 health checks failed") {
+		t.Errorf("Expected a failed probe (exit %d):\n%s%s", code, stdout, stderr)
+	}
+	if _, _, code := cli.run(t, "deploy", "probe"); code != 2 {
+		t.Errorf("Expected exit code 2 without a manifest, got %d", code)
+	}
+}
+
+// Test showing and setting the quotas of a namespace
+func TestCLIQuota(t *testing.T) {
+	server := setupCLIMockServer(t)
+	defer server.Close()
+	cli := setupCLI(t, server)
+
+	// The namespace defaults to the environment
+	stdout, stderr, code := cli.run(t, "quota", "get")
+	if code != 0 || !strings.Contains(stdout, "RESOURCE  USED  LIMIT  AVAILABLE  UNIT   USAGE\n") ||
+		!strings.Contains(stdout, "cpu       45    100    55         cores  45.0%\n") || !strings.Contains(stdout, "93.8%") {
+		t.Errorf("Unexpected quota output (exit %d):\n%s%s", code, stdout, stderr)
+	}
+	stdout, _, _ = cli.run(t, "quota", "get", "staging", "-o", "jsonpath={.namespace}")
+	if stdout != "staging" {
+		t.Errorf("Expected the staging namespace, got %q", stdout)
+	}
+
+	stdout, stderr, code = cli.run(t, "quota", "set", "staging", "cpu=150", "memory=512")
+	if code != 0 || !strings.HasPrefix(stdout, "Quotas of staging updated successfully\n") || !strings.Contains(stdout, "memory    45    512    467") {
+		t.Errorf("Unexpected quota set output (exit %d):\n%s%s", code, stdout, stderr)
+	}
+	stdout, stderr, code = cli.run(t, "quota", "set", "-f", "../examples/manifests/production-quota.yaml", "-o", "jsonpath={.namespace} {.quotas[*].resource_type}")
+	if code != 0 || stdout != "production cpu memory storage" {
+		t.Errorf("Unexpected quota set -f output (exit %d): %s%s", code, stdout, stderr)
+	}
+	for _, args := range [][]string{{"quota", "set"}, {"quota", "set", "cpu=lots"}, {"quota", "set", "-f", "quota.yaml", "cpu=1"}} {
+		if _, _, code := cli.run(t, args...); code != 2 {
+			t.Errorf("Expected exit code 2 for %v, got %d", args, code)
+		}
+	}
+}
+
+// appliedRecommendations records the recommendations applied through the
+// CLI mock server, guarded by appliedMu
+var (
+	appliedMu              sync.Mutex
+	appliedRecommendations []string
+)
+
+// takeAppliedRecommendations returns the recommendations applied so far and
+// forgets them
+func takeAppliedRecommendations() []string {
+	appliedMu.Lock()
+	defer appliedMu.Unlock()
+	applied := appliedRecommendations
+	appliedRecommendations = nil
+	return applied
+}
+
+// Test reviewing recommendations and applying them with confirmation and by
+// policy
+func TestCLIRecommendation(t *testing.T) {
+	server := setupCLIMockServer(t)
+	defer server.Close()
+	cli := setupCLI(t, server)
+	takeAppliedRecommendations()
+
+	stdout, stderr, code := cli.run(t, "recommendation", "list")
+	if code != 0 || !strings.Contains(stdout, "rec-2  deployment/production/web-frontend  memory    resize       ") ||
+		!strings.Contains(stdout, "rec-3  node_group/system/worker-nodes      cpu       consolidate  nodes=10     nodes=8") || stderr != "Potential savings: ¥1250/month\n" {
+		t.Errorf("Unexpected recommendation list (exit %d):\n%s%s", code, stdout, stderr)
+	}
+
+	stdout, stderr, code = cli.run(t, "recommendation", "diff", "rec-2", "rec-3")
+	want := "rec-2: resize memory of deployment/production/web-frontend (medium confidence, saves ¥50/month)\n" +
+		"  container web: resources.limits.memory 0 -> 256Mi\n\n" +
+		"rec-3: consolidate cpu of node_group/system/worker-nodes (high confidence, saves ¥1000/month)\n" +
+		"  current:     nodes=10\n  recommended: nodes=8\n"
+	if code != 0 || stdout != want {
+		t.Errorf("Unexpected diff (exit %d):\n%s%s", code, stdout, stderr)
+	}
+
+	// Nothing is applied unless the prompt is confirmed
+	stdout, stderr, code = cli.runWithInput(t, "n\n", "recommendation", "apply", "rec-2")
+	if code != 0 || !strings.Contains(stdout, "resources.limits.memory 0 -> 256Mi") || !strings.HasSuffix(stderr, "Apply 1 recommendations? [y/N] Aborted\n") ||
+		len(takeAppliedRecommendations()) != 0 {
+		t.Errorf("Unexpected aborted apply (exit %d):\n%s%s", code, stdout, stderr)
+	}
+	stdout, stderr, code = cli.runWithInput(t, "y\n", "recommendation", "apply", "rec-2")
+	if code != 0 || !strings.Contains(stdout, "rec-2  applying  Resource optimization is being applied") ||
+		!reflect.DeepEqual(takeAppliedRecommendations(), []string{"rec-2"}) {
+		t.Errorf("Unexpected apply (exit %d):\n%s%s", code, stdout, stderr)
+	}
+
+	// In bulk, recommendations made for other resources than the
+	// deployment has are skipped
+	takeAppliedRecommendations()
+	stdout, stderr, code = cli.run(t, "recommendation", "apply", "--all", "--min-confidence", "high", "--dry-run")
+	if code != 0 || !strings.Contains(stderr, "Skipping rec-1: deployment web-frontend changed since the recommendation was made") ||
+		!strings.HasSuffix(stdout, "\n1 recommendations would be applied (dry run)\n") || len(takeAppliedRecommendations()) != 0 {
+		t.Errorf("Unexpected dry run (exit %d):\n%s%s", code, stdout, stderr)
+	}
+	stdout, stderr, code = cli.run(t, "recommendation", "apply", "--all", "--min-savings", "100", "--yes", "-o", "jsonpath={[*].id}")
+	if code != 0 || stdout != "rec-3" || !reflect.DeepEqual(takeAppliedRecommendations(), []string{"rec-3"}) {
+		t.Errorf("Unexpected bulk apply (exit %d):\n%s%s", code, stdout, stderr)
+	}
+
+	if _, stderr, code := cli.run(t, "recommendation", "apply", "rec-9", "--yes"); code != 1 || !strings.Contains(stderr, "recommendation rec-9 not found") {
+		t.Errorf("Expected rec-9 not to be found (exit %d): %s", code, stderr)
+	}
+	for _, args := range [][]string{
+		{"recommendation", "apply"},
+		{"recommendation", "apply", "rec-1", "--all"},
+		{"recommendation", "apply", "rec-1", "--min-confidence", "high"},
+		{"recommendation", "apply", "--all", "--min-confidence", "certain"},
+	} {
+		if _, _, code := cli.run(t, args...); code != 2 {
+			t.Errorf("Expected exit code 2 for %v, got %d", args, code)
+		}
+	}
+}
+
+// Test the resource group, which nests the resource commands and keeps the
+// commands of the first CLI working
+func TestCLIResource(t *testing.T) {
+	server := setupCLIMockServer(t)
+	defer server.Close()
+	cli := setupCLI(t, server)
+
+	stdout, stderr, code := cli.run(t, "resource", "quotas")
+	if code != 0 || !strings.Contains(stdout, "cpu       45    100    55         cores  45.0%\n") ||
+		stderr != "Warning: tianniu resource quotas is deprecated, use tianniu quota get\n" {
+		t.Errorf("Unexpected resource quotas output (exit %d):\n%s%s", code, stdout, stderr)
+	}
+	stdout, stderr, code = cli.run(t, "resource", "quotas", "--namespace", "staging", "--type", "cpu", "-o", "jsonpath={.namespace}")
+	if code != 0 || stdout != "staging" {
+		t.Errorf("Unexpected resource quotas --namespace output (exit %d): %s%s", code, stdout, stderr)
+	}
+	stdout, stderr, code = cli.run(t, "resource", "nodes", "--role", "worker")
+	if code != 0 || !strings.Contains(stdout, "node-1  worker-01  ready") || !strings.Contains(stderr, "use tianniu node list") {
+		t.Errorf("Unexpected resource nodes output (exit %d):\n%s%s", code, stdout, stderr)
+	}
+	stdout, stderr, code = cli.run(t, "resource", "recommendations", "-o", "jsonpath={.recommendations[*].id}")
+	if code != 0 || stdout != "rec-1 rec-2 rec-3" {
+		t.Errorf("Unexpected resource recommendations output (exit %d): %s%s", code, stdout, stderr)
+	}
+
+	// The new commands are nested too, without a warning
+	stdout, stderr, code = cli.run(t, "resource", "quota", "get", "staging", "-o", "jsonpath={.namespace}")
+	if code != 0 || stdout != "staging" || stderr != "" {
+		t.Errorf("Unexpected resource quota get output (exit %d): %s%s", code, stdout, stderr)
+	}
+	stdout, stderr, code = cli.run(t, "resource", "usage", "production", "--period", "hour")
+	if code != 0 || !strings.HasPrefix(stdout, "Usage of namespace production from ") {
+		t.Errorf("Unexpected resource usage output (exit %d):\n%s%s", code, stdout, stderr)
+	}
+	for _, args := range [][]string{
+		{"resource", "usage", "--period", "year"},
+		{"resource", "usage", "--period", "day", "--since", "1h"},
+		{"resource", "quotas", "production"},
+	} {
+		if _, _, code := cli.run(t, args...); code != 2 {
+			t.Errorf("Expected exit code 2 for %v, got %d", args, code)
+		}
+	}
+}
+
+// Test listing, inspecting, cordoning and draining nodes
+func TestCLINode(t *testing.T) {
+	server := setupCLIMockServer(t)
+	defer server.Close()
+	cli := setupCLI(t, server)
+
+	stdout, stderr, code := cli.run(t, "node", "list", "-o", "wide")
+	if code != 0 || !strings.Contains(stdout, "25/30 (83%)") || !strings.Contains(stdout, "100/120GB (83%)") ||
+		!strings.Contains(stdout, "beijing  zone-a  high-memory") {
+		t.Errorf("Unexpected node list (exit %d):\n%s%s", code, stdout, stderr)
+	}
+
+	stdout, stderr, code = cli.run(t, "node", "get", "node-1")
+	if code != 0 || !strings.Contains(stdout, "\nConditions:\nTYPE") || !strings.Contains(stdout, "KubeletReady") ||
+		!strings.Contains(stdout, "production   web-1") {
+		t.Errorf("Unexpected node details (exit %d):\n%s%s", code, stdout, stderr)
+	}
+
+	// The first GET of node-1 above evicted web-1
+	stdout, stderr, code = cli.run(t, "node", "drain", "node-1", "--interval", "1ms", "--grace-period", "1m")
+	if code != 0 || !strings.HasPrefix(stdout, "Node drained, pods evicted: 1\n") ||
+		stderr != "Evicted production/web-2 (1 remaining)\nNot evicted kube-system/node-exporter\n" {
+		t.Errorf("Unexpected drain output (exit %d):\n%s%s", code, stdout, stderr)
+	}
+	if _, _, code := cli.run(t, "node", "drain", "node-1", "--timeout", "0s"); code != 2 {
+		t.Errorf("Expected exit code 2 without a timeout, got %d", code)
+	}
+
+	stdout, stderr, code = cli.run(t, "node", "cordon", "node-1", "node-9")
+	if code != 1 || !strings.Contains(stdout, "node-1  worker-01  cordoned") || !strings.Contains(stderr, "failed to cordon node node-9") ||
+		!strings.Contains(stderr, "failed to cordon 1 of 2 nodes") {
+		t.Errorf("Unexpected cordon output (exit %d):\n%s%s", code, stdout, stderr)
+	}
+	if _, _, code := cli.run(t, "node", "uncordon", "node-9"); code != 4 {
+		t.Errorf("Expected exit code 4 for a missing node, got %d", code)
+	}
+	if _, _, code := cli.run(t, "node", "drain"); code != 2 {
+		t.Errorf("Expected exit code 2 without a node, got %d", code)
+	}
+}
+
+// Test the table, CSV and chart renderings of usage reports
+func TestCLIUsage(t *testing.T) {
+	server := setupCLIMockServer(t)
+	defer server.Close()
+	cli := setupCLI(t, server)
+	rangeArgs := []string{"usage", "production", "--since", "2023-05-15T00:00:00Z", "--until", "2023-05-15T04:00:00Z"}
+
+	stdout, stderr, code := cli.run(t, rangeArgs...)
+	if code != 0 || !strings.HasPrefix(stdout, "Usage of namespace production from 2023-05-15T00:00:00Z to 2023-05-15T04:00:00Z, every 1h\n\n") ||
+		!strings.Contains(stdout, "cpu       cores  100    90.00  90.0%   2023-05-15T02:00:00Z  40.00  40.0%  90.00  90.0%  4") {
+		t.Errorf("Unexpected usage table (exit %d):\n%s%s", code, stdout, stderr)
+	}
+
+	stdout, _, code = cli.run(t, append(rangeArgs, "--format", "csv")...)
+	want := "resource_type,timestamp,usage,usage_percent,unit,limit\ncpu,2023-05-15T00:00:00Z,10,10.00,cores,100\n"
+	if code != 0 || !strings.HasPrefix(stdout, want) || strings.Count(stdout, "\n") != 5 {
+		t.Errorf("Unexpected usage CSV (exit %d):\n%s", code, stdout)
+	}
+
+	stdout, _, code = cli.run(t, append(rangeArgs, "--format", "chart")...)
+	if code != 0 || !strings.Contains(stdout, "cpu  ▂▂▇▄  peak 90.0%  avg 40.0%  p95 90.0%\n") {
+		t.Errorf("Unexpected usage chart (exit %d):\n%s", code, stdout)
+	}
+	stdout, _, code = cli.run(t, append(rangeArgs, "--format", "chart", "--width", "2")...)
+	if code != 0 || !strings.Contains(stdout, "cpu  ▂▇  peak") {
+		t.Errorf("Expected a chart of two buckets (exit %d):\n%s", code, stdout)
+	}
+
+	stdout, _, code = cli.run(t, append(rangeArgs, "-o", "jsonpath={.summaries[0].p95}")...)
+	if code != 0 || stdout != "90" {
+		t.Errorf("Unexpected p95 %q (exit %d)", stdout, code)
+	}
+	if _, _, code := cli.run(t, "usage", "--format", "pie"); code != 2 {
+		t.Errorf("Expected exit code 2 for an invalid --format, got %d", code)
+	}
+	if _, _, code := cli.run(t, "usage", "--since", "1h", "--until", "2h"); code != 2 {
+		t.Errorf("Expected exit code 2 for an empty range, got %d", code)
+	}
+}
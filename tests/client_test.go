@@ -0,0 +1,200 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+// Mock server for the SDK client
+func setupSDKMockServer(t *testing.T) *httptest.Server {
+	handler := http.NewServeMux()
+
+	handler.HandleFunc("/api/v1/deployments", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sdk-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": map[string]string{"code": "UNAUTHORIZED", "message": "invalid API key"},
+			})
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			query := r.URL.Query()
+			if query.Get("environment") != "production" || query.Get("label") != "team in (backend,data)" || query.Get("limit") != "5" {
+				t.Errorf("Unexpected query %s", r.URL.RawQuery)
+			}
+			json.NewEncoder(w).Encode(tianniu.DeploymentList{
+				Total:       1,
+				Limit:       5,
+				Deployments: []tianniu.Deployment{{ID: "d1", Name: "web-frontend", Environment: "production", Replicas: 3}},
+			})
+		case "POST":
+			var d tianniu.Deployment
+			if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+				t.Errorf("Failed to decode request body: %v", err)
+			}
+			d.ID = "d2"
+			d.Status = "pending"
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(d)
+		}
+	})
+
+	handler.HandleFunc("/api/v1/deployments/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": map[string]string{"code": "NOT_FOUND", "message": "deployment not found"},
+		})
+	})
+
+	handler.HandleFunc("/api/v1/containers/c1/stop", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Query().Get("timeout") != "30" {
+			t.Errorf("Unexpected stop request %s %s", r.Method, r.URL.RawQuery)
+		}
+		json.NewEncoder(w).Encode(tianniu.Container{ID: "c1", Status: "stopping"})
+	})
+
+	return httptest.NewServer(handler)
+}
+
+// Test the deployments service
+func TestSDKDeployments(t *testing.T) {
+	server := setupSDKMockServer(t)
+	defer server.Close()
+
+	ctx := context.Background()
+	client, err := tianniu.NewClient(tianniu.WithBaseURL(server.URL+"/api/v1/"), tianniu.WithAPIKey("sdk-key"))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+
+	list, err := client.Deployments.List(ctx, tianniu.DeploymentListOptions{
+		Environment:   "production",
+		LabelSelector: "team in (backend, data)",
+		Limit:         5,
+	})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if list.Total != 1 || list.Deployments[0].Name != "web-frontend" {
+		t.Errorf("Unexpected list %+v", list)
+	}
+
+	created, err := client.Deployments.Create(ctx, &tianniu.Deployment{
+		Name:        "api-backend",
+		Environment: "staging",
+		Version:     "v1.0.0",
+		Replicas:    2,
+		Containers: []tianniu.DeploymentContainer{{
+			Name:      "api",
+			Image:     "registry.baidu.com/backend/api:v1.0.0",
+			Resources: tianniu.ResourceRequirements{Requests: tianniu.ResourceList{CPU: tianniu.MustParseQuantity("500m"), Memory: tianniu.MustParseQuantity("256Mi")}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if created.ID != "d2" || created.Name != "api-backend" {
+		t.Errorf("Unexpected created deployment %+v", created)
+	}
+
+	_, err = client.Deployments.Get(ctx, "missing")
+	if !tianniu.IsNotFound(err) {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+	if err != nil && err.Error() != "API error: NOT_FOUND - deployment not found" {
+		t.Errorf("Unexpected error message '%s'", err.Error())
+	}
+
+	container, err := client.Containers.Stop(ctx, "c1", 30*time.Second)
+	if err != nil || container.Status != "stopping" {
+		t.Errorf("Unexpected stop result %+v (%v)", container, err)
+	}
+
+	bad, _ := tianniu.NewClient(tianniu.WithBaseURL(server.URL+"/api/v1"), tianniu.WithAPIKey("wrong"))
+	_, err = bad.Deployments.List(ctx, tianniu.DeploymentListOptions{})
+	apiErr, ok := err.(*tianniu.APIError)
+	if !ok || apiErr.StatusCode != http.StatusUnauthorized || apiErr.Code != "UNAUTHORIZED" {
+		t.Errorf("Expected unauthorized API error, got %v", err)
+	}
+}
+
+// Test loading the CLI configuration and creating a client from it
+func TestSDKConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tianniu-config")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "api-key")
+	ioutil.WriteFile(keyFile, []byte("sdk-key\n"), 0600)
+
+	configFile := filepath.Join(dir, "config.yaml")
+	config := `apiVersion: v1
+kind: TianNiuConfig
+environments:
+  - name: production
+    api_endpoint: https://tianniuprod.baidu.com/api/v1
+    auth:
+      type: api_key
+      api_key: file://` + keyFile + `
+    mysql_config: mysql-config.yaml
+    default: true
+  - name: staging
+    api_endpoint: https://tianniustaging.baidu.com/api/v1
+    auth:
+      type: api_key
+      api_key_env: TIANNIU_TEST_STAGING_KEY
+`
+	ioutil.WriteFile(configFile, []byte(config), 0600)
+
+	cfg, err := tianniu.LoadConfig(configFile)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	env, err := cfg.Environment("")
+	if err != nil || env.Name != "production" {
+		t.Fatalf("Expected default environment production, got %v (%v)", env, err)
+	}
+	if got := env.MySQLConfigPath(configFile); got != filepath.Join(dir, "mysql-config.yaml") {
+		t.Errorf("Unexpected MySQL config path %s", got)
+	}
+
+	client, err := env.NewClient(context.Background())
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if client.APIKey != "sdk-key" || client.BaseURL != "https://tianniuprod.baidu.com/api/v1" {
+		t.Errorf("Unexpected client %s %s", client.BaseURL, client.APIKey)
+	}
+
+	staging, _ := cfg.Environment("staging")
+	if _, err := staging.NewClient(context.Background()); err == nil {
+		t.Error("Expected unset api_key_env to fail")
+	}
+
+	if _, err := cfg.Environment("development"); err == nil {
+		t.Error("Expected unknown environment to fail")
+	}
+
+	cfg.Environments[1].Default = true
+	cfg.Environments[1].Auth.APIKey = "s3cret"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected two defaults and a literal api_key to be rejected")
+	}
+}
@@ -0,0 +1,299 @@
+package tests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+// writeKubeconfig writes a kubeconfig for server with the given user
+// credentials and returns its path
+func writeKubeconfig(t *testing.T, server *httptest.Server, user string) string {
+	dir, err := ioutil.TempDir("", "tianniu-kubeconfig")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	// The CA is a file relative to the kubeconfig
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	ioutil.WriteFile(filepath.Join(dir, "ca.crt"), ca, 0600)
+	path := filepath.Join(dir, "kubeconfig.yaml")
+	ioutil.WriteFile(path, []byte(`apiVersion: v1
+kind: Config
+current-context: production
+clusters:
+- name: cluster
+  cluster:
+    server: `+server.URL+`
+    certificate-authority: ca.crt
+contexts:
+- name: production
+  context:
+    cluster: cluster
+    user: reader
+    namespace: production
+- name: other
+  context:
+    cluster: cluster
+    user: reader
+users:
+- name: reader
+  user:
+`+user), 0600)
+	return path
+}
+
+// Test resolving kubeconfig contexts
+func TestKubeconfigClusterConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	path := writeKubeconfig(t, server, "    token: reader-token\n")
+
+	k, err := tianniu.LoadKubeconfig(path)
+	if err != nil {
+		t.Fatalf("LoadKubeconfig failed: %v", err)
+	}
+	config, err := k.ClusterConfig("")
+	if err != nil {
+		t.Fatalf("ClusterConfig failed: %v", err)
+	}
+	if config.Context != "production" || config.Server != server.URL || config.Namespace != "production" || config.Token != "reader-token" || config.TLS.RootCAs == nil {
+		t.Errorf("Unexpected cluster config %+v", config)
+	}
+	if config, err := k.ClusterConfig("other"); err != nil || config.Namespace != "default" {
+		t.Errorf("Expected the default namespace, got %+v (%v)", config, err)
+	}
+	if _, err := k.ClusterConfig("missing"); err == nil || err.Error() != "context missing not found" {
+		t.Errorf("Expected a missing context error, got %v", err)
+	}
+
+	// The sample kubeconfig's context names a user that it does not define
+	k, err = tianniu.LoadKubeconfig("../config/kubeconfig.yaml")
+	if err != nil {
+		t.Fatalf("Failed to load the sample kubeconfig: %v", err)
+	}
+	if _, err := k.ClusterConfig(""); err == nil || !strings.Contains(err.Error(), "user tianniu_admin not found") {
+		t.Errorf("Expected a missing user error, got %v", err)
+	}
+
+	env := &tianniu.Environment{Name: "production", Kubeconfig: "kube/config.yaml"}
+	if got := env.KubeconfigPath("/etc/tianniu/config.yaml"); got != "/etc/tianniu/kube/config.yaml" {
+		t.Errorf("Unexpected kubeconfig path %s", got)
+	}
+}
+
+// clusterHandler serves a namespace with the pods, services and events of
+// the web deployment and of an unrelated one
+func clusterHandler(t *testing.T) http.Handler {
+	created := time.Now().Add(-time.Hour)
+	mux := http.NewServeMux()
+	write := func(w http.ResponseWriter, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+	mux.HandleFunc("/apis/apps/v1/namespaces/production/deployments/web", func(w http.ResponseWriter, r *http.Request) {
+		write(w, map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "web"},
+			"spec": map[string]interface{}{
+				"replicas": 2,
+				"selector": map[string]interface{}{"matchLabels": map[string]string{"app": "web"}},
+				"template": map[string]interface{}{"metadata": map[string]interface{}{"labels": map[string]string{"app": "web", "tier": "frontend"}}},
+			},
+			"status": map[string]interface{}{"replicas": 2, "readyReplicas": 1, "updatedReplicas": 2},
+		})
+	})
+	mux.HandleFunc("/apis/apps/v1/namespaces/production/deployments/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		write(w, map[string]interface{}{"kind": "Status", "reason": "NotFound", "message": "deployments.apps not found"})
+	})
+	mux.HandleFunc("/api/v1/namespaces/production/pods", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("labelSelector") != "app=web" {
+			write(w, map[string]interface{}{"items": []interface{}{}})
+			return
+		}
+		pod := func(name string, ready bool, waiting string) map[string]interface{} {
+			state := map[string]interface{}{"running": map[string]interface{}{}}
+			if waiting != "" {
+				state = map[string]interface{}{"waiting": map[string]interface{}{"reason": waiting}}
+			}
+			return map[string]interface{}{
+				"metadata": map[string]interface{}{"name": name, "labels": map[string]string{"app": "web"}, "creationTimestamp": created},
+				"spec":     map[string]interface{}{"nodeName": "node-1", "containers": []interface{}{map[string]string{"name": "web", "image": "nginx"}}},
+				"status": map[string]interface{}{
+					"phase":             "Running",
+					"containerStatuses": []interface{}{map[string]interface{}{"name": "web", "ready": ready, "restartCount": 3, "state": state}},
+				},
+			}
+		}
+		write(w, map[string]interface{}{"items": []interface{}{pod("web-5d8f-a", true, ""), pod("web-5d8f-b", false, "CrashLoopBackOff")}})
+	})
+	mux.HandleFunc("/api/v1/namespaces/production/services", func(w http.ResponseWriter, r *http.Request) {
+		svc := func(name string, selector map[string]string) map[string]interface{} {
+			return map[string]interface{}{
+				"metadata": map[string]interface{}{"name": name},
+				"spec":     map[string]interface{}{"type": "ClusterIP", "selector": selector, "ports": []interface{}{map[string]interface{}{"port": 80, "targetPort": 8080}}},
+			}
+		}
+		write(w, map[string]interface{}{"items": []interface{}{
+			svc("web", map[string]string{"app": "web"}),
+			svc("web-frontend", map[string]string{"tier": "frontend"}),
+			svc("api", map[string]string{"app": "api"}),
+			svc("external", nil),
+		}})
+	})
+	mux.HandleFunc("/api/v1/namespaces/production/events", func(w http.ResponseWriter, r *http.Request) {
+		event := func(kind, name, reason string, minutes int) map[string]interface{} {
+			return map[string]interface{}{
+				"involvedObject": map[string]string{"kind": kind, "name": name},
+				"type":           "Normal",
+				"reason":         reason,
+				"lastTimestamp":  time.Now().Add(-time.Duration(minutes) * time.Minute),
+			}
+		}
+		write(w, map[string]interface{}{"items": []interface{}{
+			event("Pod", "web-5d8f-b", "BackOff", 1),
+			event("ReplicaSet", "web-5d8f", "SuccessfulCreate", 30),
+			event("Pod", "api-7c9d-a", "Pulled", 2),
+			event("Deployment", "web", "ScalingReplicaSet", 31),
+			event("ReplicaSet", "webhook-1", "SuccessfulCreate", 5),
+		}})
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("Unexpected %s request to %s", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer reader-token" {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]interface{}{"kind": "Status", "reason": "Forbidden", "message": "pods is forbidden"})
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// Test correlating the pods, services and events of a deployment
+func TestClusterInspectDeployment(t *testing.T) {
+	server := httptest.NewTLSServer(clusterHandler(t))
+	defer server.Close()
+	env := &tianniu.Environment{Name: "production", Kubeconfig: writeKubeconfig(t, server, "    token: reader-token\n")}
+	client, err := env.NewClusterClient("", "")
+	if err != nil {
+		t.Fatalf("NewClusterClient failed: %v", err)
+	}
+
+	in, err := client.InspectDeployment(context.Background(), "web", tianniu.ClusterInspectOptions{})
+	if err != nil {
+		t.Fatalf("InspectDeployment failed: %v", err)
+	}
+	if in.Namespace != "production" || in.Selector != "app=web" || in.Deployment == nil || in.Deployment.Status.ReadyReplicas != 1 {
+		t.Errorf("Unexpected inspection %+v", in)
+	}
+	if len(in.Pods) != 2 {
+		t.Fatalf("Expected two pods, got %d", len(in.Pods))
+	}
+	pod := in.Pods[1]
+	if ready, total := pod.Ready(); ready != 0 || total != 1 || pod.State() != "CrashLoopBackOff" || pod.Restarts() != 3 || pod.Spec.NodeName != "node-1" {
+		t.Errorf("Unexpected pod %+v", pod)
+	}
+	// The web service selects the pods, web-frontend the pod template
+	var services []string
+	for _, svc := range in.Services {
+		services = append(services, svc.Metadata.Name)
+	}
+	if strings.Join(services, ",") != "web,web-frontend" {
+		t.Errorf("Unexpected services %v", services)
+	}
+	var events []string
+	for _, e := range in.Events {
+		events = append(events, e.Reason)
+	}
+	if strings.Join(events, ",") != "ScalingReplicaSet,SuccessfulCreate,BackOff" {
+		t.Errorf("Unexpected events %v", events)
+	}
+
+	// Without a cluster deployment the pods are found by the exported label
+	in, err = client.InspectDeployment(context.Background(), "api", tianniu.ClusterInspectOptions{})
+	if err != nil || in.Deployment != nil || in.Selector != tianniu.K8sNameLabel+"=api" || len(in.Pods) != 0 {
+		t.Errorf("Unexpected inspection %+v (%v)", in, err)
+	}
+
+	// Kubernetes errors keep their reason
+	client, _ = (&tianniu.Environment{Kubeconfig: writeKubeconfig(t, server, "    token: wrong\n")}).NewClusterClient("", "")
+	_, err = client.ListPods(context.Background(), "", "")
+	apiErr, ok := err.(*tianniu.APIError)
+	if !ok || apiErr.StatusCode != http.StatusForbidden || apiErr.Code != "Forbidden" {
+		t.Errorf("Expected a Forbidden API error, got %v", err)
+	}
+}
+
+// Test authenticating with a client certificate from the kubeconfig
+func TestClusterClientCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "tianniu-reader"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate failed: %v", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	var user string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user = r.TLS.PeerCertificates[0].Subject.CommonName
+		w.Write([]byte(`{"items": []}`))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	path := writeKubeconfig(t, server, "    client-certificate-data: "+base64.StdEncoding.EncodeToString(certPEM)+
+		"\n    client-key-data: "+base64.StdEncoding.EncodeToString(keyPEM)+"\n")
+	k, err := tianniu.LoadKubeconfig(path)
+	if err != nil {
+		t.Fatalf("LoadKubeconfig failed: %v", err)
+	}
+	config, err := k.ClusterConfig("")
+	if err != nil {
+		t.Fatalf("ClusterConfig failed: %v", err)
+	}
+	if _, err := tianniu.NewClusterClient(config).ListServices(context.Background(), "", ""); err != nil {
+		t.Fatalf("ListServices failed: %v", err)
+	}
+	if user != "tianniu-reader" {
+		t.Errorf("Expected the client certificate, got %q", user)
+	}
+
+	k.Users[0].User.ClientKeyData = ""
+	if _, err := k.ClusterConfig(""); err == nil || !strings.Contains(err.Error(), "must be set together") {
+		t.Errorf("Expected an incomplete certificate error, got %v", err)
+	}
+}
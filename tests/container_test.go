@@ -1,310 +1,58 @@
 package tests
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
-)
-
-// Container represents a container in the TianNiu platform
-type Container struct {
-	ID        string    `json:"id,omitempty"`
-	Name      string    `json:"name"`
-	Image     string    `json:"image"`
-	Status    string    `json:"status,omitempty"`
-	CreatedAt time.Time `json:"created_at,omitempty"`
-	StartedAt time.Time `json:"started_at,omitempty"`
-	Labels    map[string]string `json:"labels,omitempty"`
-	Ports     []struct {
-		Internal int    `json:"internal"`
-		External int    `json:"external"`
-		Protocol string `json:"protocol"`
-	} `json:"ports,omitempty"`
-	Volumes []struct {
-		HostPath      string `json:"host_path"`
-		ContainerPath string `json:"container_path"`
-		Mode          string `json:"mode"`
-	} `json:"volumes,omitempty"`
-	Network struct {
-		Name      string `json:"name"`
-		IPAddress string `json:"ip_address"`
-	} `json:"network,omitempty"`
-	ResourceLimits struct {
-		CPU    string `json:"cpu"`
-		Memory string `json:"memory"`
-	} `json:"resource_limits,omitempty"`
-	ResourceUsage struct {
-		CPU       string `json:"cpu"`
-		Memory    string `json:"memory"`
-		NetworkRX string `json:"network_rx"`
-		NetworkTX string `json:"network_tx"`
-	} `json:"resource_usage,omitempty"`
-	EnvironmentVariables []struct {
-		Name  string `json:"name"`
-		Value string `json:"value"`
-	} `json:"environment_variables,omitempty"`
-	HealthCheck struct {
-		Status      string    `json:"status"`
-		LastChecked time.Time `json:"last_checked"`
-		Endpoint    string    `json:"endpoint"`
-		Interval    string    `json:"interval"`
-		Timeout     string    `json:"timeout"`
-		Retries     int       `json:"retries"`
-	} `json:"health_check,omitempty"`
-	LogsURL string `json:"logs_url,omitempty"`
-	Message string `json:"message,omitempty"`
-}
-
-// ContainerList represents a list of containers
-type ContainerList struct {
-	Total      int         `json:"total"`
-	Limit      int         `json:"limit"`
-	Offset     int         `json:"offset"`
-	Containers []Container `json:"containers"`
-}
-
-// ContainerClient represents a TianNiu API client for container operations
-type ContainerClient struct {
-	BaseURL    string
-	APIKey     string
-	HTTPClient *http.Client
-}
-
-// NewContainerClient creates a new TianNiu API client for container operations
-func NewContainerClient(baseURL, apiKey string) *ContainerClient {
-	return &ContainerClient{
-		BaseURL:    baseURL,
-		APIKey:     apiKey,
-		HTTPClient: &http.Client{Timeout: 30 * time.Second},
-	}
-}
-
-// ListContainers lists all containers
-func (c *ContainerClient) ListContainers(status string, limit, offset int) (*ContainerList, error) {
-	url := fmt.Sprintf("%s/containers?limit=%d&offset=%d", c.BaseURL, limit, offset)
-	if status != "" {
-		url += fmt.Sprintf("&status=%s", status)
-	}
-	
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Authorization", "Bearer "+c.APIKey)
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error: %s", resp.Status)
-	}
-
-	var containerList ContainerList
-	if err := json.NewDecoder(resp.Body).Decode(&containerList); err != nil {
-		return nil, err
-	}
-
-	return &containerList, nil
-}
-
-// GetContainer gets a container by ID
-func (c *ContainerClient) GetContainer(containerID string) (*Container, error) {
-	url := fmt.Sprintf("%s/containers/%s", c.BaseURL, containerID)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Authorization", "Bearer "+c.APIKey)
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error: %s", resp.Status)
-	}
-
-	var container Container
-	if err := json.NewDecoder(resp.Body).Decode(&container); err != nil {
-		return nil, err
-	}
-
-	return &container, nil
-}
-
-// CreateContainer creates a new container
-func (c *ContainerClient) CreateContainer(container *Container) (*Container, error) {
-	url := fmt.Sprintf("%s/containers", c.BaseURL)
-	
-	containerJSON, err := json.Marshal(container)
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(containerJSON))
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Authorization", "Bearer "+c.APIKey)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error: %s", resp.Status)
-	}
-
-	var createdContainer Container
-	if err := json.NewDecoder(resp.Body).Decode(&createdContainer); err != nil {
-		return nil, err
-	}
-
-	return &createdContainer, nil
-}
-
-// StartContainer starts a container
-func (c *ContainerClient) StartContainer(containerID string) (*Container, error) {
-	url := fmt.Sprintf("%s/containers/%s/start", c.BaseURL, containerID)
-	req, err := http.NewRequest("POST", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Authorization", "Bearer "+c.APIKey)
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error: %s", resp.Status)
-	}
-
-	var container Container
-	if err := json.NewDecoder(resp.Body).Decode(&container); err != nil {
-		return nil, err
-	}
-
-	return &container, nil
-}
-
-// StopContainer stops a container
-func (c *ContainerClient) StopContainer(containerID string, timeout int) (*Container, error) {
-	url := fmt.Sprintf("%s/containers/%s/stop", c.BaseURL, containerID)
-	if timeout > 0 {
-		url += fmt.Sprintf("?timeout=%d", timeout)
-	}
-	
-	req, err := http.NewRequest("POST", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Authorization", "Bearer "+c.APIKey)
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error: %s", resp.Status)
-	}
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
 
-	var container Container
-	if err := json.NewDecoder(resp.Body).Decode(&container); err != nil {
-		return nil, err
-	}
+const testContainerID = "c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2"
 
-	return &container, nil
-}
+// Mock server for container testing
+func setupContainerMockServer(t *testing.T) *httptest.Server {
+	handler := http.NewServeMux()
 
-// DeleteContainer deletes a container
-func (c *ContainerClient) DeleteContainer(containerID string, force, removeVolumes bool) (*Container, error) {
-	url := fmt.Sprintf("%s/containers/%s", c.BaseURL, containerID)
-	params := []string{}
-	
-	if force {
-		params = append(params, "force=true")
-	}
-	
-	if removeVolumes {
-		params = append(params, "remove_volumes=true")
-	}
-	
-	if len(params) > 0 {
-		url += "?" + params[0]
-		for i := 1; i < len(params); i++ {
-			url += "&" + params[i]
+	// action answers a lifecycle action with the documented status
+	action := func(method, status, message string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != method {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"id": testContainerID, "status": status, "message": message})
 		}
 	}
-	
-	req, err := http.NewRequest("DELETE", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Authorization", "Bearer "+c.APIKey)
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error: %s", resp.Status)
-	}
-
-	var container Container
-	if err := json.NewDecoder(resp.Body).Decode(&container); err != nil {
-		return nil, err
-	}
 
-	return &container, nil
-}
-
-// Mock server for container testing
-func setupContainerMockServer() *httptest.Server {
-	handler := http.NewServeMux()
-	
 	// Mock container list endpoint
 	handler.HandleFunc("/api/v1/containers", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-api-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
 		if r.Method == "GET" {
 			status := r.URL.Query().Get("status")
-			
-			containerList := ContainerList{
+
+			containerList := tianniu.ContainerList{
 				Total:  2,
 				Limit:  10,
 				Offset: 0,
-				Containers: []Container{
+				Containers: []tianniu.Container{
 					{
-						ID:        "c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2",
+						ID:        testContainerID,
 						Name:      "web-server-1",
 						Image:     "nginx:latest",
 						Status:    "running",
@@ -328,10 +76,10 @@ func setupContainerMockServer() *httptest.Server {
 					},
 				},
 			}
-			
+
 			// Filter by status if provided
 			if status != "" {
-				filteredContainers := []Container{}
+				filteredContainers := []tianniu.Container{}
 				for _, container := range containerList.Containers {
 					if container.Status == status {
 						filteredContainers = append(filteredContainers, container)
@@ -340,219 +88,180 @@ func setupContainerMockServer() *httptest.Server {
 				containerList.Containers = filteredContainers
 				containerList.Total = len(filteredContainers)
 			}
-			
+
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(containerList)
 			return
 		} else if r.Method == "POST" {
 			// Handle container creation
-			var container Container
+			var container tianniu.Container
 			if err := json.NewDecoder(r.Body).Decode(&container); err != nil {
 				http.Error(w, "Invalid request body", http.StatusBadRequest)
 				return
 			}
-			
+
 			// Generate a random ID for the new container
 			container.ID = "new1c2o3n4t5a6i7n8e9r0id"
 			container.Status = "creating"
 			container.CreatedAt = time.Now()
 			container.Message = "Container is being created and will start shortly"
-			
+
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(container)
 			return
 		}
-		
+
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	})
-	
-	// Mock container detail endpoint
-	handler.HandleFunc("/api/v1/containers/c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "GET" {
-			container := Container{
-				ID:        "c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2",
-				Name:      "web-server-1",
-				Image:     "nginx:latest",
-				Status:    "running",
-				CreatedAt: time.Now().Add(-24 * time.Hour),
-				StartedAt: time.Now().Add(-24 * time.Hour).Add(2 * time.Second),
-				Labels: map[string]string{
-					"app":         "web",
-					"environment": "production",
-				},
-			}
-			
-			container.Ports = []struct {
-				Internal int    `json:"internal"`
-				External int    `json:"external"`
-				Protocol string `json:"protocol"`
-			}{
-				{
-					Internal: 80,
-					External: 8080,
-					Protocol: "tcp",
-				},
-			}
-			
-			container.Volumes = []struct {
-				HostPath      string `json:"host_path"`
-				ContainerPath string `json:"container_path"`
-				Mode          string `json:"mode"`
-			}{
-				{
-					HostPath:      "/data/nginx/conf",
-					ContainerPath: "/etc/nginx/conf.d",
-					Mode:          "ro",
-				},
-				{
-					HostPath:      "/data/nginx/html",
-					ContainerPath: "/usr/share/nginx/html",
-					Mode:          "rw",
-				},
-			}
-			
-			container.Network.Name = "frontend-network"
-			container.Network.IPAddress = "172.18.0.2"
-			
-			container.ResourceLimits.CPU = "1.0"
-			container.ResourceLimits.Memory = "512MB"
-			
-			container.ResourceUsage.CPU = "0.05"
-			container.ResourceUsage.Memory = "128MB"
-			container.ResourceUsage.NetworkRX = "1.2MB/s"
-			container.ResourceUsage.NetworkTX = "0.8MB/s"
-			
-			container.EnvironmentVariables = []struct {
-				Name  string `json:"name"`
-				Value string `json:"value"`
-			}{
-				{
-					Name:  "NGINX_HOST",
-					Value: "example.com",
-				},
-				{
-					Name:  "NGINX_PORT",
-					Value: "80",
-				},
-			}
-			
-			container.HealthCheck.Status = "healthy"
-			container.HealthCheck.LastChecked = time.Now().Add(-15 * time.Minute)
-			container.HealthCheck.Endpoint = "http://localhost:80/health"
-			container.HealthCheck.Interval = "30s"
-			container.HealthCheck.Timeout = "5s"
-			container.HealthCheck.Retries = 3
-			
-			container.LogsURL = "https://tianniuprod.baidu.com/api/v1/containers/c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2/logs"
-			
+
+	// Mock container detail and delete endpoint
+	handler.HandleFunc("/api/v1/containers/"+testContainerID, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
 			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(container)
-			return
+			w.Write([]byte(`{
+				"id": "` + testContainerID + `",
+				"name": "web-server-1",
+				"image": "nginx:latest",
+				"status": "running",
+				"created_at": "2023-06-15T08:30:45Z",
+				"started_at": "2023-06-15T08:30:47Z",
+				"labels": {"app": "web", "environment": "production"},
+				"ports": [{"internal": 80, "external": 8080, "protocol": "tcp"}],
+				"volumes": [
+					{"host_path": "/data/nginx/conf", "container_path": "/etc/nginx/conf.d", "mode": "ro"},
+					{"host_path": "/data/nginx/html", "container_path": "/usr/share/nginx/html", "mode": "rw"}
+				],
+				"network": {"name": "frontend-network", "ip_address": "172.18.0.2"},
+				"resource_limits": {"cpu": "1.0", "memory": "512MB"},
+				"resource_usage": {"cpu": "0.05", "memory": "128MB", "network_rx": "1.2MB/s", "network_tx": "0.8MB/s"},
+				"environment_variables": [{"name": "NGINX_HOST", "value": "example.com"}, {"name": "NGINX_PORT", "value": "80"}],
+				"health_check": {"status": "healthy", "last_checked": "2023-06-15T10:45:12Z", "endpoint": "http://localhost:80/health", "interval": "30s", "timeout": "5s", "retries": 3},
+				"logs_url": "https://tianniuprod.baidu.com/api/v1/containers/` + testContainerID + `/logs"
+			}`))
+		case "DELETE":
+			query := r.URL.Query()
+			if query.Get("force") != "true" || query.Get("remove_volumes") != "true" {
+				t.Errorf("Unexpected delete query %s", r.URL.RawQuery)
+			}
+			action("DELETE", "deleted", "Container has been deleted")(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
-		
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	})
-	
-	// Mock container start endpoint
-	handler.HandleFunc("/api/v1/containers/c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2/start", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "POST" {
-			response := struct {
-				ID      string `json:"id"`
-				Status  string `json:"status"`
-				Message string `json:"message"`
-			}{
-				ID:      "c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2",
-				Status:  "starting",
-				Message: "Container is starting",
-			}
-			
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(response)
-			return
+
+	// Mock container lifecycle endpoints
+	handler.HandleFunc("/api/v1/containers/"+testContainerID+"/start", action("POST", "starting", "Container is starting"))
+	handler.HandleFunc("/api/v1/containers/"+testContainerID+"/stop", action("POST", "stopping", "Container is stopping"))
+	handler.HandleFunc("/api/v1/containers/"+testContainerID+"/restart", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("timeout") != "30" {
+			t.Errorf("Unexpected restart query %s", r.URL.RawQuery)
 		}
-		
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		action("POST", "restarting", "Container is restarting")(w, r)
 	})
-	
-	// Mock container stop endpoint
-	handler.HandleFunc("/api/v1/containers/c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2/stop", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "POST" {
-			response := struct {
-				ID      string `json:"id"`
-				Status  string `json:"status"`
-				Message string `json:"message"`
-			}{
-				ID:      "c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2",
-				Status:  "stopping",
-				Message: "Container is stopping",
-			}
-			
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(response)
-			return
+	handler.HandleFunc("/api/v1/containers/"+testContainerID+"/pause", action("POST", "pausing", "Container is being paused"))
+	handler.HandleFunc("/api/v1/containers/"+testContainerID+"/unpause", action("POST", "unpausing", "Container is being unpaused"))
+
+	// Mock container logs endpoint
+	handler.HandleFunc("/api/v1/containers/"+testContainerID+"/logs", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("tail") != "50" || query.Get("since") != "2023-06-16T14:30:00Z" || query.Get("until") != "" {
+			t.Errorf("Unexpected logs query %s", r.URL.RawQuery)
 		}
-		
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"container_id": "` + testContainerID + `",
+			"logs": [
+				{"timestamp": "2023-06-16T14:30:12Z", "stream": "stdout", "message": "Server started on port 8080"},
+				{"timestamp": "2023-06-16T14:30:18Z", "stream": "stderr", "message": "Warning: High memory usage detected (75%)"}
+			]
+		}`))
 	})
-	
-	// Mock container delete endpoint
-	handler.HandleFunc("/api/v1/containers/c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "DELETE" {
-			response := struct {
-				ID      string `json:"id"`
-				Status  string `json:"status"`
-				Message string `json:"message"`
-			}{
-				ID:      "c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2",
-				Status:  "deleted",
-				Message: "Container has been deleted",
-			}
-			
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(response)
+
+	// Mock container stats endpoint
+	handler.HandleFunc("/api/v1/containers/"+testContainerID+"/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"container_id": "` + testContainerID + `",
+			"timestamp": "2023-06-16T15:30:45Z",
+			"cpu": {"usage_percent": 12.5, "system_cpu_usage": 45.2, "online_cpus": 4},
+			"memory": {"usage": 256000000, "limit": 1073741824, "usage_percent": 23.8},
+			"network": {"rx_bytes": 1024000, "rx_packets": 1500, "rx_errors": 0, "rx_dropped": 0, "tx_bytes": 512000, "tx_packets": 1200, "tx_errors": 0, "tx_dropped": 0},
+			"io": {"read_ops": 120, "write_ops": 80, "read_bytes": 2048000, "write_bytes": 1024000}
+		}`))
+	})
+
+	// Mock container exec endpoint
+	handler.HandleFunc("/api/v1/containers/"+testContainerID+"/exec", func(w http.ResponseWriter, r *http.Request) {
+		var opts tianniu.ExecOptions
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if opts.Command[0] == "false" {
+			json.NewEncoder(w).Encode(tianniu.ExecResult{ExitCode: 1, Stderr: "failed\n"})
 			return
 		}
-		
-		// GET method is handled by the other handler
+		want := tianniu.ExecOptions{
+			Command:      []string{"ls", "-la", "/app"},
+			Env:          []tianniu.EnvVar{{Name: "DEBUG", Value: "true"}},
+			WorkingDir:   "/app",
+			User:         "app-user",
+			AttachStdout: true,
+			AttachStderr: true,
+		}
+		if !reflect.DeepEqual(opts, want) {
+			t.Errorf("Unexpected exec request %+v", opts)
+		}
+		json.NewEncoder(w).Encode(tianniu.ExecResult{Stdout: "total 24\napp.js\nconfig\n"})
+	})
+
+	// Mock missing container
+	handler.HandleFunc("/api/v1/containers/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": map[string]string{"code": "CONTAINER_NOT_FOUND", "message": "Container with ID 'missing' not found"},
+		})
 	})
-	
+
 	return httptest.NewServer(handler)
 }
 
 // Test ListContainers
 func TestListContainers(t *testing.T) {
-	server := setupContainerMockServer()
+	server := setupContainerMockServer(t)
 	defer server.Close()
-	
-	client := NewContainerClient(server.URL+"/api/v1", "test-api-key")
-	
-	containerList, err := client.ListContainers("", 10, 0)
+
+	client := newTestClient(t, server)
+
+	containerList, err := client.Containers.List(context.Background(), tianniu.ContainerListOptions{Limit: 10})
 	if err != nil {
 		t.Fatalf("ListContainers failed: %v", err)
 	}
-	
+
 	if containerList.Total != 2 {
 		t.Errorf("Expected 2 containers, got %d", containerList.Total)
 	}
-	
+
 	if len(containerList.Containers) != 2 {
 		t.Errorf("Expected 2 containers in the list, got %d", len(containerList.Containers))
 	}
-	
+
 	if containerList.Containers[0].Name != "web-server-1" {
 		t.Errorf("Expected first container name to be 'web-server-1', got '%s'", containerList.Containers[0].Name)
 	}
-	
+
 	if containerList.Containers[1].Name != "api-service" {
 		t.Errorf("Expected second container name to be 'api-service', got '%s'", containerList.Containers[1].Name)
 	}
-	
+
 	// Test filtering by status
-	containerList, err = client.ListContainers("running", 10, 0)
+	containerList, err = client.Containers.List(context.Background(), tianniu.ContainerListOptions{Status: "running", Limit: 10})
 	if err != nil {
 		t.Fatalf("ListContainers with status filter failed: %v", err)
 	}
-	
+
 	for _, container := range containerList.Containers {
 		if container.Status != "running" {
 			t.Errorf("Expected all containers to have status 'running', got '%s'", container.Status)
@@ -562,166 +271,550 @@ func TestListContainers(t *testing.T) {
 
 // Test GetContainer
 func TestGetContainer(t *testing.T) {
-	server := setupContainerMockServer()
+	server := setupContainerMockServer(t)
 	defer server.Close()
-	
-	client := NewContainerClient(server.URL+"/api/v1", "test-api-key")
-	
-	container, err := client.GetContainer("c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2")
+
+	client := newTestClient(t, server)
+
+	container, err := client.Containers.Get(context.Background(), testContainerID)
 	if err != nil {
 		t.Fatalf("GetContainer failed: %v", err)
 	}
-	
-	if container.ID != "c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2" {
-		t.Errorf("Expected container ID to be 'c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2', got '%s'", container.ID)
+
+	if container.ID != testContainerID {
+		t.Errorf("Expected container ID to be '%s', got '%s'", testContainerID, container.ID)
 	}
-	
+
 	if container.Name != "web-server-1" {
 		t.Errorf("Expected container name to be 'web-server-1', got '%s'", container.Name)
 	}
-	
+
 	if container.Image != "nginx:latest" {
 		t.Errorf("Expected container image to be 'nginx:latest', got '%s'", container.Image)
 	}
-	
+
 	if container.Status != "running" {
 		t.Errorf("Expected container status to be 'running', got '%s'", container.Status)
 	}
-	
+
 	if len(container.Ports) != 1 {
-		t.Errorf("Expected 1 port mapping, got %d", len(container.Ports))
+		t.Fatalf("Expected 1 port mapping, got %d", len(container.Ports))
 	}
-	
+
 	if container.Ports[0].Internal != 80 || container.Ports[0].External != 8080 {
 		t.Errorf("Expected port mapping 80:8080, got %d:%d", container.Ports[0].Internal, container.Ports[0].External)
 	}
-	
+
 	if len(container.Volumes) != 2 {
 		t.Errorf("Expected 2 volume mappings, got %d", len(container.Volumes))
 	}
-	
+
 	if container.Network.Name != "frontend-network" {
 		t.Errorf("Expected network name to be 'frontend-network', got '%s'", container.Network.Name)
 	}
-	
+
 	if container.Network.IPAddress != "172.18.0.2" {
 		t.Errorf("Expected IP address to be '172.18.0.2', got '%s'", container.Network.IPAddress)
 	}
-	
-	if container.ResourceLimits.CPU != "1.0" {
+
+	if container.ResourceLimits.CPU.MilliValue() != 1000 {
 		t.Errorf("Expected CPU limit to be '1.0', got '%s'", container.ResourceLimits.CPU)
 	}
-	
-	if container.ResourceLimits.Memory != "512MB" {
+
+	if container.ResourceLimits.Memory.Value() != 512000000 {
 		t.Errorf("Expected memory limit to be '512MB', got '%s'", container.ResourceLimits.Memory)
 	}
-	
+
 	if len(container.EnvironmentVariables) != 2 {
 		t.Errorf("Expected 2 environment variables, got %d", len(container.EnvironmentVariables))
 	}
-	
-	if container.HealthCheck.Status != "healthy" {
-		t.Errorf("Expected health check status to be 'healthy', got '%s'", container.HealthCheck.Status)
+
+	if container.HealthCheck == nil || container.HealthCheck.Status != "healthy" {
+		t.Errorf("Expected health check status to be 'healthy', got %+v", container.HealthCheck)
+	}
+
+	_, err = client.Containers.Get(context.Background(), "missing")
+	if !tianniu.IsNotFound(err) {
+		t.Errorf("Expected a not found error, got %v", err)
 	}
 }
 
 // Test CreateContainer
 func TestCreateContainer(t *testing.T) {
-	server := setupContainerMockServer()
+	server := setupContainerMockServer(t)
 	defer server.Close()
-	
-	client := NewContainerClient(server.URL+"/api/v1", "test-api-key")
-	
-	newContainer := &Container{
+
+	client := newTestClient(t, server)
+
+	createdContainer, err := client.Containers.Create(context.Background(), tianniu.ContainerCreateOptions{
 		Name:  "test-container",
 		Image: "ubuntu:latest",
 		Labels: map[string]string{
 			"app":         "test",
 			"environment": "development",
 		},
-	}
-	
-	createdContainer, err := client.CreateContainer(newContainer)
+	})
 	if err != nil {
 		t.Fatalf("CreateContainer failed: %v", err)
 	}
-	
+
 	if createdContainer.ID == "" {
 		t.Error("Expected container ID to be set")
 	}
-	
+
 	if createdContainer.Name != "test-container" {
 		t.Errorf("Expected container name to be 'test-container', got '%s'", createdContainer.Name)
 	}
-	
+
 	if createdContainer.Image != "ubuntu:latest" {
 		t.Errorf("Expected container image to be 'ubuntu:latest', got '%s'", createdContainer.Image)
 	}
-	
+
 	if createdContainer.Status != "creating" {
 		t.Errorf("Expected container status to be 'creating', got '%s'", createdContainer.Status)
 	}
 }
 
-// Test StartContainer
-func TestStartContainer(t *testing.T) {
-	server := setupContainerMockServer()
+// Test the start, stop, restart, pause, unpause and delete actions
+func TestContainerLifecycle(t *testing.T) {
+	server := setupContainerMockServer(t)
 	defer server.Close()
-	
-	client := NewContainerClient(server.URL+"/api/v1", "test-api-key")
-	
-	container, err := client.StartContainer("c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2")
+
+	client := newTestClient(t, server)
+	ctx := context.Background()
+
+	actions := []struct {
+		name   string
+		call   func() (*tianniu.Container, error)
+		status string
+	}{
+		{"start", func() (*tianniu.Container, error) { return client.Containers.Start(ctx, testContainerID) }, "starting"},
+		{"stop", func() (*tianniu.Container, error) {
+			return client.Containers.Stop(ctx, testContainerID, 30*time.Second)
+		}, "stopping"},
+		{"restart", func() (*tianniu.Container, error) {
+			return client.Containers.Restart(ctx, testContainerID, 30*time.Second)
+		}, "restarting"},
+		{"pause", func() (*tianniu.Container, error) { return client.Containers.Pause(ctx, testContainerID) }, "pausing"},
+		{"unpause", func() (*tianniu.Container, error) { return client.Containers.Unpause(ctx, testContainerID) }, "unpausing"},
+		{"delete", func() (*tianniu.Container, error) { return client.Containers.Delete(ctx, testContainerID, true, true) }, "deleted"},
+	}
+	for _, action := range actions {
+		container, err := action.call()
+		if err != nil {
+			t.Errorf("%s failed: %v", action.name, err)
+			continue
+		}
+		if container.ID != testContainerID {
+			t.Errorf("%s: expected container ID to be '%s', got '%s'", action.name, testContainerID, container.ID)
+		}
+		if container.Status != action.status {
+			t.Errorf("%s: expected container status to be '%s', got '%s'", action.name, action.status, container.Status)
+		}
+	}
+}
+
+// Test ContainerLogs
+func TestContainerLogs(t *testing.T) {
+	server := setupContainerMockServer(t)
+	defer server.Close()
+
+	client := newTestClient(t, server)
+
+	since := time.Date(2023, 6, 16, 22, 30, 0, 0, time.FixedZone("CST", 8*3600))
+	logs, err := client.Containers.Logs(context.Background(), testContainerID, tianniu.ContainerLogsOptions{Tail: 50, Since: since})
 	if err != nil {
-		t.Fatalf("StartContainer failed: %v", err)
+		t.Fatalf("Logs failed: %v", err)
+	}
+	defer logs.Close()
+	var entries []tianniu.LogEntry
+	for logs.Next() {
+		entries = append(entries, logs.Entry())
+	}
+	if err := logs.Err(); err != nil || len(entries) != 2 {
+		t.Fatalf("Unexpected logs %+v (%v)", entries, err)
 	}
-	
-	if container.ID != "c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2" {
-		t.Errorf("Expected container ID to be 'c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2', got '%s'", container.ID)
+	if entry := entries[1]; entry.ContainerID != testContainerID || entry.Stream != "stderr" || entry.Message != "Warning: High memory usage detected (75%)" {
+		t.Errorf("Unexpected log entry %+v", entry)
+	}
+
+	// Read returns the plain text
+	logs, err = client.Containers.Logs(context.Background(), testContainerID, tianniu.ContainerLogsOptions{Tail: 50, Since: since, Timestamps: true})
+	if err != nil {
+		t.Fatalf("Logs failed: %v", err)
 	}
-	
-	if container.Status != "starting" {
-		t.Errorf("Expected container status to be 'starting', got '%s'", container.Status)
+	text, err := ioutil.ReadAll(logs)
+	want := "2023-06-16T14:30:12Z Server started on port 8080\n2023-06-16T14:30:18Z Warning: High memory usage detected (75%)\n"
+	if err != nil || string(text) != want {
+		t.Errorf("Unexpected log text %q (%v)", text, err)
 	}
 }
 
-// Test StopContainer
-func TestStopContainer(t *testing.T) {
-	server := setupContainerMockServer()
+// Test following a log stream across a dropped connection
+func TestContainerLogsFollow(t *testing.T) {
+	start := time.Date(2023, 6, 16, 14, 30, 0, 0, time.UTC)
+	line := func(second int, message string) string {
+		data, _ := json.Marshal(tianniu.LogEntry{Timestamp: start.Add(time.Duration(second) * time.Second), Stream: "stdout", Message: message})
+		return string(data) + "\n"
+	}
+	var connections []string
+	status := "running"
+	handler := http.NewServeMux()
+	handler.HandleFunc("/api/v1/containers/f1/logs", func(w http.ResponseWriter, r *http.Request) {
+		connections = append(connections, r.URL.RawQuery)
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		switch len(connections) {
+		case 1:
+			// The connection drops after two lines with the same timestamp
+			w.Write([]byte(line(1, "one") + line(2, "two") + line(2, "three")))
+		case 2:
+			// The resumed stream repeats the lines of the last second, then
+			// the container stops
+			w.Write([]byte(line(2, "two") + line(2, "three") + line(3, "four")))
+			status = "stopped"
+		default:
+			t.Errorf("Unexpected reconnect %s", r.URL.RawQuery)
+		}
+	})
+	handler.HandleFunc("/api/v1/containers/f1", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(tianniu.Container{ID: "f1", Status: status})
+	})
+	server := httptest.NewServer(handler)
 	defer server.Close()
-	
-	client := NewContainerClient(server.URL+"/api/v1", "test-api-key")
-	
-	container, err := client.StopContainer("c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2", 30)
+
+	client := newTestClient(t, server)
+	logs, err := client.Containers.Logs(context.Background(), "f1", tianniu.ContainerLogsOptions{Follow: true, Tail: 10})
 	if err != nil {
-		t.Fatalf("StopContainer failed: %v", err)
+		t.Fatalf("Logs failed: %v", err)
+	}
+	defer logs.Close()
+	var messages []string
+	for logs.Next() {
+		messages = append(messages, logs.Entry().Message)
+	}
+	if err := logs.Err(); err != nil {
+		t.Fatalf("Follow failed: %v", err)
+	}
+	if strings.Join(messages, ",") != "one,two,three,four" {
+		t.Errorf("Unexpected messages %v", messages)
 	}
-	
-	if container.ID != "c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2" {
-		t.Errorf("Expected container ID to be 'c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2', got '%s'", container.ID)
+	if len(connections) != 2 || connections[0] != "follow=true&tail=10" || connections[1] != "follow=true&since=2023-06-16T14%3A30%3A02Z" {
+		t.Errorf("Unexpected connections %v", connections)
 	}
-	
-	if container.Status != "stopping" {
-		t.Errorf("Expected container status to be 'stopping', got '%s'", container.Status)
+
+	// Closing the stream ends a blocked Next
+	blocked := make(chan struct{})
+	handler.HandleFunc("/api/v1/containers/f2/logs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write([]byte(line(1, "waiting")))
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-blocked:
+		}
+	})
+	defer close(blocked)
+	logs, err = client.Containers.Logs(context.Background(), "f2", tianniu.ContainerLogsOptions{Follow: true})
+	if err != nil {
+		t.Fatalf("Logs failed: %v", err)
+	}
+	if !logs.Next() || logs.Entry().Message != "waiting" {
+		t.Fatalf("Expected the first line, got %+v (%v)", logs.Entry(), logs.Err())
+	}
+	time.AfterFunc(100*time.Millisecond, func() { logs.Close() })
+	if logs.Next() || logs.Err() != nil {
+		t.Errorf("Expected Close to end the stream, got %+v (%v)", logs.Entry(), logs.Err())
+	}
+}
+
+// Test merging the logs of several containers
+func TestMergeLogStreams(t *testing.T) {
+	start := time.Date(2023, 6, 16, 14, 30, 0, 0, time.UTC)
+	handler := http.NewServeMux()
+	for id, seconds := range map[string][]int{"a": {1, 4, 5}, "b": {2, 3, 6}} {
+		var logs tianniu.ContainerLogs
+		for _, second := range seconds {
+			logs.Logs = append(logs.Logs, tianniu.LogEntry{Timestamp: start.Add(time.Duration(second) * time.Second), Message: strconv.Itoa(second)})
+		}
+		handler.HandleFunc("/api/v1/containers/"+id+"/logs", func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(logs)
+		})
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	client := newTestClient(t, server)
+	var streams []*tianniu.LogStream
+	for _, id := range []string{"a", "b"} {
+		logs, err := client.Containers.Logs(context.Background(), id, tianniu.ContainerLogsOptions{})
+		if err != nil {
+			t.Fatalf("Logs failed: %v", err)
+		}
+		streams = append(streams, logs)
+	}
+	merged := tianniu.MergeLogStreams(streams)
+	defer merged.Close()
+	var lines []string
+	for merged.Next() {
+		lines = append(lines, merged.Entry().ContainerID+merged.Entry().Message)
+	}
+	if merged.Err() != nil || strings.Join(lines, ",") != "a1,b2,b3,a4,a5,b6" {
+		t.Errorf("Unexpected merged lines %v (%v)", lines, merged.Err())
 	}
 }
 
-// Test DeleteContainer
-func TestDeleteContainer(t *testing.T) {
-	server := setupContainerMockServer()
+// Test ContainerStats
+func TestContainerStats(t *testing.T) {
+	server := setupContainerMockServer(t)
 	defer server.Close()
-	
-	client := NewContainerClient(server.URL+"/api/v1", "test-api-key")
-	
-	container, err := client.DeleteContainer("c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2", true, true)
+
+	client := newTestClient(t, server)
+
+	stats, err := client.Containers.Stats(context.Background(), testContainerID)
 	if err != nil {
-		t.Fatalf("DeleteContainer failed: %v", err)
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if stats.CPU.UsagePercent != 12.5 || stats.CPU.OnlineCPUs != 4 {
+		t.Errorf("Unexpected CPU stats %+v", stats.CPU)
+	}
+	if stats.Memory.Usage != 256000000 || stats.Memory.Limit != 1073741824 {
+		t.Errorf("Unexpected memory stats %+v", stats.Memory)
+	}
+	if stats.Network.RxBytes != 1024000 || stats.Network.TxPackets != 1200 || stats.IO.ReadOps != 120 || stats.IO.WriteBytes != 1024000 {
+		t.Errorf("Unexpected network or IO stats %+v %+v", stats.Network, stats.IO)
 	}
-	
-	if container.ID != "c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2" {
-		t.Errorf("Expected container ID to be 'c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2', got '%s'", container.ID)
+}
+
+// Test ContainerExec
+func TestContainerExec(t *testing.T) {
+	server := setupContainerMockServer(t)
+	defer server.Close()
+
+	client := newTestClient(t, server)
+	ctx := context.Background()
+
+	result, err := client.Containers.Exec(ctx, testContainerID, tianniu.ExecOptions{
+		Command:      []string{"ls", "-la", "/app"},
+		Env:          []tianniu.EnvVar{{Name: "DEBUG", Value: "true"}},
+		WorkingDir:   "/app",
+		User:         "app-user",
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		t.Fatalf("Exec failed: %v", err)
+	}
+	if result.ExitCode != 0 || result.Stdout != "total 24\napp.js\nconfig\n" {
+		t.Errorf("Unexpected exec result %+v", result)
+	}
+
+	// A failing command is a result, not an error
+	result, err = client.Containers.Exec(ctx, testContainerID, tianniu.ExecOptions{Command: []string{"false"}})
+	if err != nil || result.ExitCode != 1 || result.Stderr != "failed\n" {
+		t.Errorf("Unexpected exec result %+v (%v)", result, err)
+	}
+
+	if _, err := client.Containers.Exec(ctx, testContainerID, tianniu.ExecOptions{}); err == nil {
+		t.Error("Expected an error without a command")
+	}
+}
+
+// fakeShell is a stand-in for a shell in an exec session. It reports the
+// terminal size, upper-cases each input line and exits on "exit N".
+func fakeShell(s *tianniu.ExecSession) int {
+	if s.Options.TTY {
+		size := <-s.Resize
+		fmt.Fprintf(s.Stdout, "size %dx%d\r\n", size.Width, size.Height)
+	}
+	if s.Stdin == nil {
+		fmt.Fprintf(s.Stdout, "%s in %s\n", strings.Join(s.Options.Command, " "), s.Options.WorkingDir)
+		fmt.Fprintln(s.Stderr, "no input")
+		return 0
+	}
+	scanner := bufio.NewScanner(s.Stdin)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "exit ") {
+			code, _ := strconv.Atoi(strings.TrimPrefix(line, "exit "))
+			return code
+		}
+		fmt.Fprintf(s.Stdout, "%s\r\n", strings.ToUpper(line))
+	}
+	return 0
+}
+
+// Test interactive exec sessions against a stand-in server
+func TestContainerExecStream(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/api/v1/containers/"+testContainerID+"/exec", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-api-key" {
+			t.Errorf("Missing API key on the exec handshake")
+		}
+		if err := tianniu.ServeExecSession(w, r, fakeShell); err != nil {
+			t.Errorf("ServeExecSession failed: %v", err)
+		}
+	})
+	handler.HandleFunc("/api/v1/containers/missing/exec", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": map[string]string{"code": "CONTAINER_NOT_FOUND", "message": "Container with ID 'missing' not found"},
+		})
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	client := newTestClient(t, server)
+	ctx := context.Background()
+
+	// A TTY session with a resize and input
+	resize := make(chan tianniu.TerminalSize, 1)
+	resize <- tianniu.TerminalSize{Width: 120, Height: 40}
+	var stdout bytes.Buffer
+	code, err := client.Containers.ExecStream(ctx, testContainerID, tianniu.ExecOptions{Command: []string{"sh"}, TTY: true}, tianniu.ExecStreams{
+		Stdin:  strings.NewReader("echo hi\nexit 7\n"),
+		Stdout: &stdout,
+		Resize: resize,
+	})
+	if err != nil || code != 7 {
+		t.Fatalf("Expected exit code 7, got %d (%v)", code, err)
+	}
+	if stdout.String() != "size 120x40\r\nECHO HI\r\n" {
+		t.Errorf("Unexpected TTY output %q", stdout.String())
+	}
+
+	// Without stdin or a TTY, stdout and stderr stay apart
+	var stderr bytes.Buffer
+	stdout.Reset()
+	code, err = client.Containers.ExecStream(ctx, testContainerID, tianniu.ExecOptions{Command: []string{"ls", "-la"}, WorkingDir: "/app"}, tianniu.ExecStreams{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	if err != nil || code != 0 || stdout.String() != "ls -la in /app\n" || stderr.String() != "no input\n" {
+		t.Errorf("Unexpected session (exit %d, %v): %q %q", code, err, stdout.String(), stderr.String())
+	}
+
+	_, err = client.Containers.ExecStream(ctx, "missing", tianniu.ExecOptions{Command: []string{"sh"}}, tianniu.ExecStreams{Stdout: &stdout})
+	if !tianniu.IsNotFound(err) {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+}
+
+// Test batch start and stop through the batch endpoints
+func TestContainerBatch(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/api/v1/containers", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("label") != "app=web" {
+			t.Errorf("Unexpected label selector %q", r.URL.Query().Get("label"))
+		}
+		json.NewEncoder(w).Encode(tianniu.ContainerList{Total: 2, Containers: []tianniu.Container{{ID: "b"}, {ID: "c"}}})
+	})
+	handler.HandleFunc("/api/v1/containers/batch/stop", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			ContainerIDs []string `json:"container_ids"`
+			Timeout      int      `json:"timeout"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if !reflect.DeepEqual(body.ContainerIDs, []string{"a", "b", "c"}) || body.Timeout != 30 {
+			t.Errorf("Unexpected batch request %+v", body)
+		}
+		// Out of order, with a failure and a container left out
+		json.NewEncoder(w).Encode(map[string]interface{}{"results": []map[string]string{
+			{"id": "b", "status": "error", "message": "Container is not running"},
+			{"id": "a", "status": "stopping", "message": "Container is stopping"},
+		}})
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	results, err := client.Containers.StopBatch(context.Background(), tianniu.BatchOptions{
+		IDs:           []string{"a", "b"},
+		LabelSelector: "app=web",
+		Timeout:       30 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("StopBatch failed: %v", err)
+	}
+	want := []tianniu.BatchResult{
+		{ID: "a", Status: "stopping", Message: "Container is stopping"},
+		{ID: "b", Status: "error", Message: "Container is not running", Error: "Container is not running"},
+		{ID: "c", Error: "missing from the batch response"},
+	}
+	if !reflect.DeepEqual(results.Results, want) {
+		t.Errorf("Unexpected results:\n%+v\nwant\n%+v", results.Results, want)
+	}
+	if failed := results.Failed(); len(failed) != 2 {
+		t.Errorf("Expected 2 failures, got %+v", failed)
+	}
+}
+
+// Test the fan-out of batch operations when the server has no batch endpoint
+func TestContainerBatchFanOut(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	handler := http.NewServeMux()
+	handler.HandleFunc("/api/v1/containers/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/containers/"), "/")
+		if parts[0] == "batch" {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"code": "NOT_FOUND", "message": "Not found"}})
+			return
+		}
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		if parts[0] == "c13" {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"code": "CONFLICT", "message": "Container is running"}})
+			return
+		}
+		json.NewEncoder(w).Encode(tianniu.Container{ID: parts[0], Status: "starting"})
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	var ids []string
+	for i := 0; i < 40; i++ {
+		ids = append(ids, "c"+strconv.Itoa(i))
+	}
+	results, err := client.Containers.StartBatch(context.Background(), tianniu.BatchOptions{IDs: ids, Concurrency: 4})
+	if err != nil {
+		t.Fatalf("StartBatch failed: %v", err)
+	}
+	if len(results.Results) != len(ids) {
+		t.Fatalf("Expected %d results, got %d", len(ids), len(results.Results))
+	}
+	for i, result := range results.Results {
+		if result.ID != ids[i] {
+			t.Errorf("Result %d is for %s", i, result.ID)
+		}
+		if result.ID == "c13" {
+			if !strings.Contains(result.Error, "Container is running") {
+				t.Errorf("Expected a conflict for c13, got %+v", result)
+			}
+		} else if result.Error != "" || result.Status != "starting" {
+			t.Errorf("Unexpected result %+v", result)
+		}
+	}
+	if maxInFlight > 4 || maxInFlight < 2 {
+		t.Errorf("Expected up to 4 requests in flight, got %d", maxInFlight)
+	}
+
+	// Restart has no batch endpoint
+	results, err = client.Containers.RestartBatch(context.Background(), tianniu.BatchOptions{IDs: []string{"c1", "c13"}})
+	if err != nil {
+		t.Fatalf("RestartBatch failed: %v", err)
 	}
-	
-	if container.Status != "deleted" {
-		t.Errorf("Expected container status to be 'deleted', got '%s'", container.Status)
+	if len(results.Failed()) != 1 || results.Results[0].Status != "starting" {
+		t.Errorf("Unexpected restart results %+v", results.Results)
 	}
 }
@@ -1,83 +1,26 @@
 package tests
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/baidu/tianniu-go-client/tianniu"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/stretchr/testify/assert"
-	"gopkg.in/yaml.v2"
 )
 
-// MySQLConfig represents the MySQL configuration
-type MySQLConfig struct {
-	APIVersion string `yaml:"apiVersion"`
-	Kind       string `yaml:"kind"`
-	Metadata   struct {
-		Name    string `yaml:"name"`
-		Version string `yaml:"version"`
-	} `yaml:"metadata"`
-	Environments []struct {
-		Name              string `yaml:"name"`
-		Host              string `yaml:"host"`
-		Port              int    `yaml:"port"`
-		Database          string `yaml:"database"`
-		UsernameEnv       string `yaml:"username_env"`
-		PasswordEnv       string `yaml:"password_env"`
-		MaxConnections    int    `yaml:"max_connections"`
-		ConnectionTimeout string `yaml:"connection_timeout"`
-		ReadTimeout       string `yaml:"read_timeout"`
-		WriteTimeout      string `yaml:"write_timeout"`
-		MaxIdleConns      int    `yaml:"max_idle_connections"`
-		MaxOpenConns      int    `yaml:"max_open_connections"`
-		ConnMaxLifetime   string `yaml:"connection_max_lifetime"`
-		SSLMode           string `yaml:"ssl_mode"`
-		SSLCA             string `yaml:"ssl_ca,omitempty"`
-		SSLCert           string `yaml:"ssl_cert,omitempty"`
-		SSLKey            string `yaml:"ssl_key,omitempty"`
-	} `yaml:"environments"`
-	Defaults struct {
-		Charset   string `yaml:"charset"`
-		Collation string `yaml:"collation"`
-		Timezone  string `yaml:"timezone"`
-	} `yaml:"defaults"`
-}
-
-// Container represents a container in the TianNiu platform
-type Container struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	Image     string    `json:"image"`
-	Status    string    `json:"status"`
-	CreatedAt time.Time `json:"created_at"`
-	Labels    string    `json:"labels"`
-}
-
-// Deployment represents a deployment in the TianNiu platform
-type Deployment struct {
-	ID          string    `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Status      string    `json:"status"`
-	Environment string    `json:"environment"`
-	CreatedAt   time.Time `json:"created_at"`
-	Version     string    `json:"version"`
-	Replicas    int       `json:"replicas"`
-}
-
-// DBClient represents a database client
-type DBClient struct {
-	DB     *sql.DB
-	Config *MySQLConfig
-	Env    string
-}
-
-// NewDBClient creates a new database client for testing
-func NewTestDBClient() (*DBClient, error) {
+// NewTestDBClient creates a database client on a fresh test database
+func NewTestDBClient() (*tianniu.DBClient, error) {
 	// Create a temporary database for testing
 	db, err := sql.Open("mysql", "root:root@tcp(localhost:3306)/")
 	if err != nil {
@@ -93,7 +36,7 @@ func NewTestDBClient() (*DBClient, error) {
 
 	// Close connection and connect to test database
 	db.Close()
-	db, err = sql.Open("mysql", "root:root@tcp(localhost:3306)/tianniu_test")
+	db, err = sql.Open("mysql", "root:root@tcp(localhost:3306)/tianniu_test?parseTime=true&multiStatements=true")
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to test database: %v", err)
 	}
@@ -112,231 +55,308 @@ func NewTestDBClient() (*DBClient, error) {
 	}
 
 	// Create mock config
-	config := &MySQLConfig{}
+	config := &tianniu.MySQLConfig{}
 	config.Defaults.Charset = "utf8mb4"
 	config.Defaults.Collation = "utf8mb4_unicode_ci"
 	config.Defaults.Timezone = "Asia/Shanghai"
 
-	return &DBClient{
+	return &tianniu.DBClient{
 		DB:     db,
 		Config: config,
 		Env:    "test",
 	}, nil
 }
 
-// Close closes the database connection
-func (c *DBClient) Close() error {
-	if c.DB != nil {
-		// Drop test database
-		_, err := c.DB.Exec("DROP DATABASE IF EXISTS tianniu_test")
-		if err != nil {
-			return fmt.Errorf("failed to drop test database: %v", err)
-		}
-		return c.DB.Close()
+// closeTestDB drops the test database and closes the connection
+func closeTestDB(client *tianniu.DBClient) error {
+	if _, err := client.DB.Exec("DROP DATABASE IF EXISTS tianniu_test"); err != nil {
+		return fmt.Errorf("failed to drop test database: %v", err)
 	}
-	return nil
+	return client.Close()
 }
 
-// GetContainers gets all containers
-func (c *DBClient) GetContainers(limit int) ([]Container, error) {
-	query := "SELECT id, name, image, status, created_at, labels FROM containers ORDER BY created_at DESC LIMIT ?"
-	rows, err := c.DB.Query(query, limit)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query containers: %v", err)
-	}
-	defer rows.Close()
+// recordingDriver is a database/sql driver that records the queries it gets
+// and answers each with the same canned rows, to test the SQL built by
+// DBClient without a database
+type recordingDriver struct {
+	mu      sync.Mutex
+	queries []recordedQuery
+	columns []string
+	rows    [][]driver.Value
+}
 
-	var containers []Container
-	for rows.Next() {
-		var container Container
-		if err := rows.Scan(&container.ID, &container.Name, &container.Image, &container.Status, &container.CreatedAt, &container.Labels); err != nil {
-			return nil, fmt.Errorf("failed to scan container row: %v", err)
-		}
-		containers = append(containers, container)
-	}
+type recordedQuery struct {
+	query string
+	args  []interface{}
+}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating container rows: %v", err)
-	}
+// newRecordingClient returns a DBClient whose queries are answered by a
+// recordingDriver with rows of the given columns
+func newRecordingClient(columns []string, rows ...[]driver.Value) (*tianniu.DBClient, *recordingDriver) {
+	d := &recordingDriver{columns: columns, rows: rows}
+	return &tianniu.DBClient{DB: sql.OpenDB(d), Env: "test"}, d
+}
 
-	return containers, nil
+// last returns the most recent query, failing the test if there is none
+func (d *recordingDriver) last(t *testing.T) recordedQuery {
+	t.Helper()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.queries) == 0 {
+		t.Fatal("Expected a query")
+	}
+	return d.queries[len(d.queries)-1]
 }
 
-// GetContainerByID gets a container by ID
-func (c *DBClient) GetContainerByID(id string) (*Container, error) {
-	query := "SELECT id, name, image, status, created_at, labels FROM containers WHERE id = ?"
-	row := c.DB.QueryRow(query, id)
+func (d *recordingDriver) Connect(context.Context) (driver.Conn, error) { return recordingConn{d}, nil }
+func (d *recordingDriver) Driver() driver.Driver                        { return d }
+func (d *recordingDriver) Open(string) (driver.Conn, error)             { return recordingConn{d}, nil }
 
-	var container Container
-	if err := row.Scan(&container.ID, &container.Name, &container.Image, &container.Status, &container.CreatedAt, &container.Labels); err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("container with ID %s not found", id)
-		}
-		return nil, fmt.Errorf("failed to scan container row: %v", err)
-	}
+type recordingConn struct{ d *recordingDriver }
 
-	return &container, nil
+func (c recordingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("prepared statements are not supported")
 }
-
-// CreateContainer creates a new container
-func (c *DBClient) CreateContainer(container *Container) error {
-	query := "INSERT INTO containers (id, name, image, status, created_at, labels) VALUES (?, ?, ?, ?, ?, ?)"
-	_, err := c.DB.Exec(query, container.ID, container.Name, container.Image, container.Status, container.CreatedAt, container.Labels)
-	if err != nil {
-		return fmt.Errorf("failed to create container: %v", err)
-	}
-	return nil
+func (c recordingConn) Close() error { return nil }
+func (c recordingConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("transactions are not supported")
 }
 
-// UpdateContainerStatus updates a container's status
-func (c *DBClient) UpdateContainerStatus(id, status string) error {
-	query := "UPDATE containers SET status = ? WHERE id = ?"
-	result, err := c.DB.Exec(query, status, id)
-	if err != nil {
-		return fmt.Errorf("failed to update container status: %v", err)
+func (c recordingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	recorded := recordedQuery{query: query}
+	for _, arg := range args {
+		recorded.args = append(recorded.args, arg.Value)
 	}
+	c.d.queries = append(c.d.queries, recorded)
+	return &recordingRows{columns: c.d.columns, rows: c.d.rows}, nil
+}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %v", err)
-	}
+type recordingRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("container with ID %s not found", id)
+func (r *recordingRows) Columns() []string { return r.columns }
+func (r *recordingRows) Close() error      { return nil }
+func (r *recordingRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
 	}
-
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
 	return nil
 }
 
-// DeleteContainer deletes a container
-func (c *DBClient) DeleteContainer(id string) error {
-	query := "DELETE FROM containers WHERE id = ?"
-	result, err := c.DB.Exec(query, id)
-	if err != nil {
-		return fmt.Errorf("failed to delete container: %v", err)
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %v", err)
-	}
+var (
+	containerColumns  = []string{"id", "name", "image", "status", "created_at", "labels"}
+	deploymentColumns = []string{"id", "name", "description", "status", "environment", "created_at", "version", "replicas"}
+)
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("container with ID %s not found", id)
+// containerRows returns n container rows, one minute apart and newest first
+func containerRows(n int, newest time.Time) [][]driver.Value {
+	var rows [][]driver.Value
+	for i := 0; i < n; i++ {
+		rows = append(rows, []driver.Value{fmt.Sprintf("c%d", n-i), fmt.Sprintf("web-%d", n-i), "nginx:1.25", "running",
+			newest.Add(-time.Duration(i) * time.Minute), `{"app": "web"}`})
 	}
-
-	return nil
+	return rows
 }
 
-// GetDeployments gets all deployments
-func (c *DBClient) GetDeployments(limit int) ([]Deployment, error) {
-	query := "SELECT id, name, description, status, environment, created_at, version, replicas FROM deployments ORDER BY created_at DESC LIMIT ?"
-	rows, err := c.DB.Query(query, limit)
+// Test that a page's cursor selects the rows after its last row
+func TestListCursor(t *testing.T) {
+	newest := time.Date(2024, 3, 1, 12, 0, 0, 500, time.UTC)
+	client, recorder := newRecordingClient(containerColumns, containerRows(3, newest)...)
+
+	page, err := client.ListContainers(tianniu.ListFilter{Limit: 2})
 	if err != nil {
-		return nil, fmt.Errorf("failed to query deployments: %v", err)
+		t.Fatalf("ListContainers failed: %v", err)
 	}
-	defer rows.Close()
-
-	var deployments []Deployment
-	for rows.Next() {
-		var deployment Deployment
-		if err := rows.Scan(&deployment.ID, &deployment.Name, &deployment.Description, &deployment.Status, &deployment.Environment, &deployment.CreatedAt, &deployment.Version, &deployment.Replicas); err != nil {
-			return nil, fmt.Errorf("failed to scan deployment row: %v", err)
-		}
-		deployments = append(deployments, deployment)
+	if len(page.Containers) != 2 || page.Containers[1].ID != "c2" || page.NextCursor == "" {
+		t.Fatalf("Expected a page of two with a cursor, got %+v", page)
 	}
-
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating deployment rows: %v", err)
+	if page.Containers[0].Labels["app"] != "web" {
+		t.Errorf("Expected the labels to be decoded, got %v", page.Containers[0].Labels)
 	}
 
-	return deployments, nil
+	if _, err := client.ListContainers(tianniu.ListFilter{Limit: 2, Cursor: page.NextCursor}); err != nil {
+		t.Fatalf("ListContainers with cursor failed: %v", err)
+	}
+	q := recorder.last(t)
+	want := "SELECT id, name, image, status, created_at, labels FROM containers" +
+		" WHERE (created_at < ? OR (created_at = ? AND id < ?)) ORDER BY created_at DESC, id DESC LIMIT ?"
+	if q.query != want {
+		t.Errorf("Unexpected query:\n%s", q.query)
+	}
+	last := newest.Add(-time.Minute)
+	if len(q.args) != 4 || !last.Equal(q.args[0].(time.Time)) || !last.Equal(q.args[1].(time.Time)) ||
+		q.args[2] != "c2" || q.args[3] != int64(3) {
+		t.Errorf("Expected the cursor of c2 at %s, got %v", last, q.args)
+	}
 }
 
-// GetDeploymentByID gets a deployment by ID
-func (c *DBClient) GetDeploymentByID(id string) (*Deployment, error) {
-	query := "SELECT id, name, description, status, environment, created_at, version, replicas FROM deployments WHERE id = ?"
-	row := c.DB.QueryRow(query, id)
-
-	var deployment Deployment
-	if err := row.Scan(&deployment.ID, &deployment.Name, &deployment.Description, &deployment.Status, &deployment.Environment, &deployment.CreatedAt, &deployment.Version, &deployment.Replicas); err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("deployment with ID %s not found", id)
+// Test that malformed cursors are rejected before anything is queried
+func TestListBadCursor(t *testing.T) {
+	client, recorder := newRecordingClient(containerColumns)
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	for _, cursor := range []string{
+		"%%%",
+		encode("2024-03-01T12:00:00Z"),
+		encode("2024-03-01T12:00:00Z|"),
+		encode("yesterday|c1"),
+		base64.StdEncoding.EncodeToString([]byte("2024-03-01T12:00:00Z|c1")),
+	} {
+		if _, err := client.ListContainers(tianniu.ListFilter{Cursor: cursor}); err == nil || !strings.Contains(err.Error(), "invalid cursor") {
+			t.Errorf("Expected cursor %q to be invalid, got %v", cursor, err)
+		}
+		if _, err := client.ListDeployments(tianniu.ListFilter{Cursor: cursor}); err == nil {
+			t.Errorf("Expected cursor %q to be invalid for deployments", cursor)
 		}
-		return nil, fmt.Errorf("failed to scan deployment row: %v", err)
 	}
-
-	return &deployment, nil
-}
-
-// CreateDeployment creates a new deployment
-func (c *DBClient) CreateDeployment(deployment *Deployment) error {
-	query := "INSERT INTO deployments (id, name, description, status, environment, created_at, version, replicas) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
-	_, err := c.DB.Exec(query, deployment.ID, deployment.Name, deployment.Description, deployment.Status, deployment.Environment, deployment.CreatedAt, deployment.Version, deployment.Replicas)
-	if err != nil {
-		return fmt.Errorf("failed to create deployment: %v", err)
+	if len(recorder.queries) != 0 {
+		t.Errorf("Expected no queries, got %v", recorder.queries)
 	}
-	return nil
 }
 
-// UpdateDeploymentStatus updates a deployment's status
-func (c *DBClient) UpdateDeploymentStatus(id, status string) error {
-	query := "UPDATE deployments SET status = ? WHERE id = ?"
-	result, err := c.DB.Exec(query, status, id)
-	if err != nil {
-		return fmt.Errorf("failed to update deployment status: %v", err)
-	}
+// Test the WHERE and ORDER clauses built from filters and label selectors
+func TestListClauses(t *testing.T) {
+	after := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	client, recorder := newRecordingClient(containerColumns)
 
-	rowsAffected, err := result.RowsAffected()
+	_, err := client.ListContainers(tianniu.ListFilter{Status: "running", Environment: "staging", LabelSelector: "app=web,!canary", CreatedAfter: after})
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %v", err)
+		t.Fatalf("ListContainers failed: %v", err)
 	}
-
-	if rowsAffected == 0 {
-		return fmt.Errorf("deployment with ID %s not found", id)
+	q := recorder.last(t)
+	want := "SELECT id, name, image, status, created_at, labels FROM containers" +
+		" WHERE status = ? AND created_at >= ? AND JSON_UNQUOTE(JSON_EXTRACT(labels, ?)) = ? AND" +
+		" (labels IS NULL OR NOT JSON_CONTAINS_PATH(labels, 'one', ?)) AND JSON_UNQUOTE(JSON_EXTRACT(labels, ?)) = ?" +
+		" ORDER BY created_at DESC, id DESC LIMIT ?"
+	if q.query != want {
+		t.Errorf("Unexpected container query:\n%s", q.query)
 	}
-
-	return nil
-}
-
-// ScaleDeployment scales a deployment
-func (c *DBClient) ScaleDeployment(id string, replicas int) error {
-	query := "UPDATE deployments SET replicas = ? WHERE id = ?"
-	result, err := c.DB.Exec(query, replicas, id)
-	if err != nil {
-		return fmt.Errorf("failed to scale deployment: %v", err)
+	wantArgs := fmt.Sprint([]interface{}{"running", after, `$."app"`, "web", `$."canary"`, `$."environment"`, "staging", int64(21)})
+	if fmt.Sprint(q.args) != wantArgs {
+		t.Errorf("Expected args %s, got %v", wantArgs, q.args)
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	// Deployments match the selector through the containers of their spec
+	_, err = client.ListDeployments(tianniu.ListFilter{Environment: "production", LabelSelector: "tier in (api,web)"})
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %v", err)
+		t.Fatalf("ListDeployments failed: %v", err)
+	}
+	q = recorder.last(t)
+	want = "SELECT id, name, description, status, environment, created_at, version, replicas FROM deployments" +
+		" WHERE environment = ? AND EXISTS (SELECT 1 FROM containers c WHERE" +
+		" JSON_CONTAINS(deployments.containers, JSON_OBJECT('name', c.name)) AND JSON_UNQUOTE(JSON_EXTRACT(c.labels, ?)) IN (?, ?))" +
+		" ORDER BY created_at DESC, id DESC LIMIT ?"
+	if q.query != want {
+		t.Errorf("Unexpected deployment query:\n%s", q.query)
+	}
+	if fmt.Sprint(q.args) != fmt.Sprint([]interface{}{"production", `$."tier"`, "api", "web", int64(21)}) {
+		t.Errorf("Unexpected deployment args %v", q.args)
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("deployment with ID %s not found", id)
+	// Without filters there is no WHERE clause
+	if _, err := client.ListDeployments(tianniu.ListFilter{}); err != nil {
+		t.Fatalf("ListDeployments failed: %v", err)
+	}
+	if q := recorder.last(t); strings.Contains(q.query, "WHERE") {
+		t.Errorf("Unexpected WHERE clause in %s", q.query)
 	}
 
-	return nil
+	// Malformed selectors are rejected before anything is queried
+	count := len(recorder.queries)
+	for _, selector := range []string{`a"b=x`, "app in web", "=web"} {
+		if _, err := client.ListContainers(tianniu.ListFilter{LabelSelector: selector}); err == nil {
+			t.Errorf("Expected selector %q to be rejected", selector)
+		}
+	}
+	if len(recorder.queries) != count {
+		t.Errorf("Expected no queries for malformed selectors")
+	}
 }
 
-// DeleteDeployment deletes a deployment
-func (c *DBClient) DeleteDeployment(id string) error {
-	query := "DELETE FROM deployments WHERE id = ?"
-	result, err := c.DB.Exec(query, id)
-	if err != nil {
-		return fmt.Errorf("failed to delete deployment: %v", err)
+// Test the page size and the cursor of the last page
+func TestListPagination(t *testing.T) {
+	newest := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		limit     int
+		rows      int
+		wantLimit int64
+		wantPage  int
+		hasNext   bool
+	}{
+		{limit: 0, rows: 3, wantLimit: 21, wantPage: 3},
+		{limit: -5, rows: 21, wantLimit: 21, wantPage: 20, hasNext: true},
+		{limit: 2, rows: 2, wantLimit: 3, wantPage: 2},
+		{limit: 2, rows: 3, wantLimit: 3, wantPage: 2, hasNext: true},
+		{limit: 5000, rows: 1, wantLimit: 1001, wantPage: 1},
+	}
+	for _, test := range tests {
+		client, recorder := newRecordingClient(containerColumns, containerRows(test.rows, newest)...)
+		page, err := client.ListContainers(tianniu.ListFilter{Limit: test.limit})
+		if err != nil {
+			t.Fatalf("ListContainers failed: %v", err)
+		}
+		q := recorder.last(t)
+		if q.args[len(q.args)-1] != test.wantLimit {
+			t.Errorf("Limit %d: expected LIMIT %d, got %v", test.limit, test.wantLimit, q.args)
+		}
+		if len(page.Containers) != test.wantPage || (page.NextCursor != "") != test.hasNext {
+			t.Errorf("Limit %d with %d rows: expected %d containers (next %v), got %d (next %q)",
+				test.limit, test.rows, test.wantPage, test.hasNext, len(page.Containers), page.NextCursor)
+		}
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	// Deployments are paginated the same way
+	rows := [][]driver.Value{
+		{"d2", "web", nil, "active", "production", newest, "1.1.0", int64(3)},
+		{"d1", "web", "first", "active", "production", newest.Add(-time.Minute), "1.0.0", int64(2)},
+	}
+	client, _ := newRecordingClient(deploymentColumns, rows...)
+	page, err := client.ListDeployments(tianniu.ListFilter{Limit: 1})
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %v", err)
+		t.Fatalf("ListDeployments failed: %v", err)
 	}
-
-	if rowsAffected == 0 {
-		return fmt.Errorf("deployment with ID %s not found", id)
+	if len(page.Deployments) != 1 || page.Deployments[0].ID != "d2" || page.Deployments[0].Replicas != 3 || page.NextCursor == "" {
+		t.Errorf("Unexpected deployment page %+v", page)
 	}
+}
 
-	return nil
+// Test the conditions of each filter field
+func TestListFilterConditions(t *testing.T) {
+	after := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	before := after.Add(24 * time.Hour)
+	tests := []struct {
+		filter tianniu.ListFilter
+		where  string
+		args   []interface{}
+	}{
+		{tianniu.ListFilter{Status: "stopped"}, " WHERE status = ?", []interface{}{"stopped"}},
+		{tianniu.ListFilter{Environment: "staging"}, " WHERE environment = ?", []interface{}{"staging"}},
+		// LIKE wildcards in the prefix match literally
+		{tianniu.ListFilter{NamePrefix: `web_1%\`}, " WHERE name LIKE ?", []interface{}{`web\_1\%\\%`}},
+		{tianniu.ListFilter{CreatedAfter: after, CreatedBefore: before}, " WHERE created_at >= ? AND created_at < ?", []interface{}{after, before}},
+		{tianniu.ListFilter{Status: "active", Environment: "production", NamePrefix: "api"},
+			" WHERE status = ? AND environment = ? AND name LIKE ?", []interface{}{"active", "production", "api%"}},
+	}
+	client, recorder := newRecordingClient(deploymentColumns)
+	for _, test := range tests {
+		if _, err := client.ListDeployments(test.filter); err != nil {
+			t.Fatalf("ListDeployments failed: %v", err)
+		}
+		q := recorder.last(t)
+		want := "SELECT id, name, description, status, environment, created_at, version, replicas FROM deployments" +
+			test.where + " ORDER BY created_at DESC, id DESC LIMIT ?"
+		if q.query != want {
+			t.Errorf("%+v: unexpected query:\n%s", test.filter, q.query)
+		}
+		if args := fmt.Sprint(append(test.args, int64(21))); fmt.Sprint(q.args) != args {
+			t.Errorf("%+v: expected args %s, got %v", test.filter, args, q.args)
+		}
+	}
 }
 
 // TestContainerOperations tests container database operations
@@ -351,16 +371,16 @@ func TestContainerOperations(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to create test client: %v", err)
 	}
-	defer client.Close()
+	defer closeTestDB(client)
 
 	// Test creating a container
-	container := &Container{
+	container := &tianniu.Container{
 		ID:        "test-container-id",
 		Name:      "test-container",
 		Image:     "nginx:latest",
 		Status:    "created",
 		CreatedAt: time.Now(),
-		Labels:    `{"app": "test", "environment": "testing"}`,
+		Labels:    map[string]string{"app": "test", "environment": "testing"},
 	}
 
 	err = client.CreateContainer(container)
@@ -388,7 +408,7 @@ func TestContainerOperations(t *testing.T) {
 	containers, err := client.GetContainers(10)
 	assert.NoError(t, err, "Failed to get containers")
 	assert.GreaterOrEqual(t, len(containers), 1, "Expected at least one container")
-	
+
 	// Find our test container in the list
 	found := false
 	for _, c := range containers {
@@ -420,10 +440,10 @@ func TestDeploymentOperations(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to create test client: %v", err)
 	}
-	defer client.Close()
+	defer closeTestDB(client)
 
 	// Test creating a deployment
-	deployment := &Deployment{
+	deployment := &tianniu.Deployment{
 		ID:          "test-deployment-id",
 		Name:        "test-deployment",
 		Description: "Test deployment for unit tests",
@@ -470,7 +490,7 @@ func TestDeploymentOperations(t *testing.T) {
 	deployments, err := client.GetDeployments(10)
 	assert.NoError(t, err, "Failed to get deployments")
 	assert.GreaterOrEqual(t, len(deployments), 1, "Expected at least one deployment")
-	
+
 	// Find our test deployment in the list
 	found := false
 	for _, d := range deployments {
@@ -489,3 +509,75 @@ func TestDeploymentOperations(t *testing.T) {
 	_, err = client.GetDeploymentByID(deployment.ID)
 	assert.Error(t, err, "Deployment should not exist after deletion")
 }
+
+// TestListFilters tests filtered, keyset-paginated list queries
+func TestListFilters(t *testing.T) {
+	// Skip if not running in CI environment
+	if os.Getenv("CI") != "true" {
+		t.Skip("Skipping test in non-CI environment")
+	}
+
+	// Create test client
+	client, err := NewTestDBClient()
+	if err != nil {
+		t.Fatalf("Failed to create test client: %v", err)
+	}
+	defer closeTestDB(client)
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for i, c := range []*tianniu.Container{
+		{ID: "filter-a", Name: "filter-web-1", Image: "nginx:1.25", Status: "running", Labels: map[string]string{"app": "web", "environment": "staging"}},
+		{ID: "filter-b", Name: "filter-web-2", Image: "nginx:1.25", Status: "stopped", Labels: map[string]string{"app": "web", "environment": "staging"}},
+		{ID: "filter-c", Name: "filter-api-1", Image: "api:v1", Status: "running", Labels: map[string]string{"app": "api", "environment": "staging"}},
+	} {
+		c.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+		assert.NoError(t, client.CreateContainer(c), "Failed to create container")
+		id := c.ID
+		t.Cleanup(func() {
+			assert.NoError(t, client.DeleteContainer(id), "Failed to delete container")
+		})
+	}
+
+	// Filter by name prefix and label
+	page, err := client.ListContainers(tianniu.ListFilter{NamePrefix: "filter-web", LabelSelector: "app=web"})
+	assert.NoError(t, err, "Failed to list containers by prefix and label")
+	assert.Len(t, page.Containers, 2, "Expected two web containers")
+	assert.Equal(t, "filter-b", page.Containers[0].ID, "Expected newest container first")
+
+	// Filter by status and environment label
+	page, err = client.ListContainers(tianniu.ListFilter{Status: "running", Environment: "staging"})
+	assert.NoError(t, err, "Failed to list containers by status and environment")
+	assert.Len(t, page.Containers, 2, "Expected two running staging containers")
+
+	// Walk the pages one row at a time
+	var seen []string
+	filter := tianniu.ListFilter{NamePrefix: "filter-", Limit: 1}
+	for {
+		page, err := client.ListContainers(filter)
+		assert.NoError(t, err, "Failed to list container page")
+		for _, c := range page.Containers {
+			seen = append(seen, c.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		filter.Cursor = page.NextCursor
+	}
+	assert.Equal(t, []string{"filter-c", "filter-b", "filter-a"}, seen, "Unexpected page order")
+
+	// Created-time range
+	page, err = client.ListContainers(tianniu.ListFilter{NamePrefix: "filter-", CreatedAfter: base.Add(time.Minute), CreatedBefore: base.Add(2 * time.Minute)})
+	assert.NoError(t, err, "Failed to list containers by created range")
+	assert.Len(t, page.Containers, 1, "Expected one container in range")
+
+	// Invalid cursors and label keys are rejected
+	_, err = client.ListContainers(tianniu.ListFilter{Cursor: "not-a-cursor"})
+	assert.Error(t, err, "Expected invalid cursor to be rejected")
+	_, err = client.ListContainers(tianniu.ListFilter{LabelSelector: `a"b=x`})
+	assert.Error(t, err, "Expected invalid label key to be rejected")
+
+	// Set-based selectors
+	page, err = client.ListContainers(tianniu.ListFilter{NamePrefix: "filter-", LabelSelector: "app in (api,db),!canary"})
+	assert.NoError(t, err, "Failed to list containers by set selector")
+	assert.Len(t, page.Containers, 1, "Expected one api container")
+}
@@ -0,0 +1,215 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+// Test converting health checks between the deployment and container shapes
+func TestHealthCheckConversion(t *testing.T) {
+	tests := []struct {
+		name      string
+		check     tianniu.HealthCheck
+		probe     tianniu.Probe
+		container tianniu.ContainerHealth
+	}{
+		{
+			name:      "http",
+			check:     tianniu.HealthCheck{HTTPPath: "/health", Port: 8080, PeriodSeconds: 30, TimeoutSeconds: 5, SuccessThreshold: 1, FailureThreshold: 3},
+			probe:     tianniu.Probe{Type: "http", Scheme: "http", Port: 8080, Path: "/health", PeriodSeconds: 30, TimeoutSeconds: 5, SuccessThreshold: 1, FailureThreshold: 3},
+			container: tianniu.ContainerHealth{Endpoint: "http://localhost:8080/health", Interval: "30s", Timeout: "5s", Retries: 3},
+		},
+		{
+			// The sample database row of the postgres deployment
+			name:      "tcp",
+			check:     tianniu.HealthCheck{TCPPort: 5432, InitialDelaySeconds: 30, PeriodSeconds: 60, TimeoutSeconds: 10, SuccessThreshold: 1, FailureThreshold: 3},
+			probe:     tianniu.Probe{Type: "tcp", Port: 5432, InitialDelaySeconds: 30, PeriodSeconds: 60, TimeoutSeconds: 10, SuccessThreshold: 1, FailureThreshold: 3},
+			container: tianniu.ContainerHealth{Endpoint: "tcp://localhost:5432", Interval: "60s", Timeout: "10s", Retries: 3},
+		},
+		{
+			name:      "exec",
+			check:     tianniu.HealthCheck{Command: []string{"pg_isready"}, PeriodSeconds: 10, FailureThreshold: 3},
+			probe:     tianniu.Probe{Type: "exec", Command: []string{"pg_isready"}, PeriodSeconds: 10, FailureThreshold: 3},
+			container: tianniu.ContainerHealth{Command: []string{"pg_isready"}, Interval: "10s", Retries: 3},
+		},
+	}
+	for _, tt := range tests {
+		probe, err := tt.check.Probe()
+		if err != nil {
+			t.Fatalf("%s: Probe failed: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(*probe, tt.probe) {
+			t.Errorf("%s: got probe %+v, want %+v", tt.name, *probe, tt.probe)
+		}
+		if got := probe.ContainerHealth(); !reflect.DeepEqual(*got, tt.container) {
+			t.Errorf("%s: got container health %+v, want %+v", tt.name, *got, tt.container)
+		}
+		if got := probe.HealthCheck(); !reflect.DeepEqual(*got, tt.check) {
+			t.Errorf("%s: round trip gave %+v, want %+v", tt.name, *got, tt.check)
+		}
+
+		// The container shape has no initial delay or success threshold
+		back, err := tt.container.Probe()
+		if err != nil {
+			t.Fatalf("%s: ContainerHealth.Probe failed: %v", tt.name, err)
+		}
+		want := tt.probe
+		want.InitialDelaySeconds, want.SuccessThreshold = 0, 0
+		if tt.name != "exec" {
+			want.Host = "localhost"
+		}
+		if !reflect.DeepEqual(*back, want) {
+			t.Errorf("%s: got probe %+v from the container shape, want %+v", tt.name, *back, want)
+		}
+	}
+
+	if p, err := (&tianniu.ContainerHealth{Endpoint: "https://example.com/ready?full=1"}).Probe(); err != nil || p.Port != 443 || p.Path != "/ready?full=1" {
+		t.Errorf("Unexpected HTTPS probe %+v, %v", p, err)
+	}
+	for _, h := range []tianniu.ContainerHealth{
+		{Endpoint: "/health"},
+		{Endpoint: "tcp://localhost"},
+		{Endpoint: "udp://localhost:53"},
+		{Endpoint: "http://localhost/health", Interval: "often"},
+		{Endpoint: "http://localhost/health", Command: []string{"true"}},
+	} {
+		if _, err := h.Probe(); err == nil {
+			t.Errorf("Expected an error for %+v", h)
+		}
+	}
+	if _, err := (&tianniu.HealthCheck{HTTPPath: "/health", Port: 80, TCPPort: 80}).Probe(); err == nil {
+		t.Error("Expected an error for a health check with two kinds")
+	}
+}
+
+// Test validating TCP and exec health checks of deployments
+func TestValidateHealthCheckKinds(t *testing.T) {
+	d := &tianniu.Deployment{
+		Name:        "database",
+		Environment: "production",
+		Version:     "v1.0.0",
+		Replicas:    1,
+		Containers: []tianniu.DeploymentContainer{{
+			Name:  "database",
+			Image: "postgres:13",
+			Ports: []tianniu.ContainerPort{{Name: "postgres", ContainerPort: 5432, ServicePort: 5432}},
+			Resources: tianniu.ResourceRequirements{
+				Requests: tianniu.ResourceList{CPU: tianniu.MustParseQuantity("1"), Memory: tianniu.MustParseQuantity("1Gi")},
+			},
+			HealthCheck: &tianniu.HealthCheck{TCPPort: 5432, PeriodSeconds: 60, TimeoutSeconds: 10},
+		}},
+	}
+	if err := d.Validate(); err != nil {
+		t.Fatalf("Expected a valid TCP health check, got %v", err)
+	}
+
+	d.Containers[0].HealthCheck.TCPPort = 5433
+	if err := d.Validate(); err == nil || !strings.Contains(err.Error(), "health_check.tcp_port: 5433 matches no container_port") {
+		t.Errorf("Expected a tcp_port error, got %v", err)
+	}
+	d.Containers[0].HealthCheck.Command = []string{"pg_isready"}
+	if err := d.Validate(); err == nil || !strings.Contains(err.Error(), "mutually exclusive") {
+		t.Errorf("Expected a mutually exclusive error, got %v", err)
+	}
+	d.Containers[0].HealthCheck.TCPPort = 0
+	if err := d.Validate(); err != nil {
+		t.Errorf("Expected a valid exec health check, got %v", err)
+	}
+}
+
+// Test exporting TCP and exec health checks as Kubernetes probes and back
+func TestHealthCheckKubernetes(t *testing.T) {
+	d := &tianniu.Deployment{
+		Name:     "database",
+		Replicas: 1,
+		Containers: []tianniu.DeploymentContainer{
+			{Name: "db", Image: "postgres:13", Ports: []tianniu.ContainerPort{{ContainerPort: 5432}},
+				HealthCheck: &tianniu.HealthCheck{TCPPort: 5432, PeriodSeconds: 60, TimeoutSeconds: 10, SuccessThreshold: 1, FailureThreshold: 3}},
+			{Name: "exporter", Image: "exporter:1", HealthCheck: &tianniu.HealthCheck{Command: []string{"check"}, PeriodSeconds: 10, TimeoutSeconds: 1, SuccessThreshold: 1, FailureThreshold: 3}},
+		},
+	}
+	objects := tianniu.ExportKubernetes(d, tianniu.K8sExportOptions{})
+	containers := objects.Deployment.Spec.Template.Spec.Containers
+	if probe := containers[0].ReadinessProbe; probe == nil || probe.TCPSocket == nil || probe.TCPSocket.Port.Int != 5432 || probe.HTTPGet != nil {
+		t.Errorf("Unexpected TCP probe %+v", probe)
+	}
+	if probe := containers[1].LivenessProbe; probe == nil || probe.Exec == nil || !reflect.DeepEqual(probe.Exec.Command, []string{"check"}) {
+		t.Errorf("Unexpected exec probe %+v", probe)
+	}
+
+	// JSON is a YAML document
+	data, err := json.Marshal(objects.Deployment)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	result, err := tianniu.ImportKubernetes(bytes.NewReader(data), tianniu.ImportOptions{})
+	if err != nil {
+		t.Fatalf("ImportKubernetes failed: %v", err)
+	}
+	for i, c := range result.Deployments[0].Containers {
+		if !reflect.DeepEqual(c.HealthCheck, d.Containers[i].HealthCheck) {
+			t.Errorf("Container %s: health check %+v came back as %+v", c.Name, d.Containers[i].HealthCheck, c.HealthCheck)
+		}
+	}
+}
+
+// Test running HTTP and TCP probes locally
+func TestProber(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			w.WriteHeader(http.StatusOK)
+		case "/moved":
+			http.Redirect(w, r, "/elsewhere", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	prober := &tianniu.Prober{Host: "127.0.0.1", SkipInitialDelay: true}
+	ctx := context.Background()
+	report, err := prober.Run(ctx, &tianniu.Probe{Type: "http", Port: port, Path: "/health", InitialDelaySeconds: 60, SuccessThreshold: 1})
+	if err != nil || !report.Healthy || len(report.Attempts) != 1 || report.Attempts[0].Message != "HTTP 200 OK" {
+		t.Errorf("Unexpected report %+v, %v", report, err)
+	}
+	if result := prober.Check(ctx, &tianniu.Probe{Type: "http", Port: port, Path: "/moved"}); !result.Healthy {
+		t.Errorf("Expected a redirect to be healthy, got %+v", result)
+	}
+	report, err = prober.Run(ctx, &tianniu.Probe{Type: "http", Port: port, Path: "/broken", PeriodSeconds: 1, FailureThreshold: 2})
+	if err != nil || report.Healthy || len(report.Attempts) != 2 || !strings.Contains(report.Attempts[1].Message, "503") {
+		t.Errorf("Unexpected report %+v, %v", report, err)
+	}
+
+	// TCP against the server, then against a closed port
+	report, err = prober.Run(ctx, &tianniu.Probe{Type: "tcp", Port: port})
+	if err != nil || !report.Healthy || report.Target != "tcp://127.0.0.1:"+u.Port() {
+		t.Errorf("Unexpected TCP report %+v, %v", report, err)
+	}
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	closed := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	if result := prober.Check(ctx, &tianniu.Probe{Type: "tcp", Port: closed}); result.Healthy || !strings.Contains(result.Message, "refused") {
+		t.Errorf("Expected a refused connection, got %+v", result)
+	}
+
+	if _, err := prober.Run(ctx, &tianniu.Probe{Type: "exec", Command: []string{"true"}}); err == nil {
+		t.Error("Expected an error for an exec probe")
+	}
+	if _, err := prober.Run(ctx, &tianniu.Probe{Type: "http", Port: 0}); err == nil {
+		t.Error("Expected an error for a probe without a port")
+	}
+}
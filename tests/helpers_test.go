@@ -0,0 +1,20 @@
+package tests
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+// Helpers shared by the test files. run_tests.sh compiles this file together
+// with each of them.
+
+// newTestClient returns an SDK client for the API of a mock server
+func newTestClient(t *testing.T, server *httptest.Server) *tianniu.Client {
+	client, err := tianniu.NewClient(tianniu.WithBaseURL(server.URL+"/api/v1"), tianniu.WithAPIKey("test-api-key"))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	return client
+}
@@ -0,0 +1,331 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+func importWarnings(result *tianniu.ImportResult) []string {
+	var warnings []string
+	for _, w := range result.Warnings {
+		warnings = append(warnings, w.String())
+	}
+	return warnings
+}
+
+// Test that exported Kubernetes objects import back to the deployment
+func TestImportKubernetesRoundTrip(t *testing.T) {
+	data, err := ioutil.ReadFile("../examples/go/sample-deployment.json")
+	if err != nil {
+		t.Fatalf("Failed to read sample deployment: %v", err)
+	}
+	var d tianniu.Deployment
+	if err := json.Unmarshal(data, &d); err != nil {
+		t.Fatalf("Failed to parse sample deployment: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tianniu.EncodeManifests(&buf, tianniu.ExportKubernetes(&d, tianniu.K8sExportOptions{}).Items()...); err != nil {
+		t.Fatalf("EncodeManifests failed: %v", err)
+	}
+
+	result, err := tianniu.ImportKubernetes(&buf, tianniu.ImportOptions{})
+	if err != nil {
+		t.Fatalf("ImportKubernetes failed: %v", err)
+	}
+	if len(result.Warnings) != 0 {
+		t.Errorf("Expected no warnings, got %v", importWarnings(result))
+	}
+	if len(result.Deployments) != 1 {
+		t.Fatalf("Expected one deployment, got %d", len(result.Deployments))
+	}
+	got := result.Deployments[0]
+	if err := got.Validate(); err != nil {
+		t.Errorf("Imported deployment is not valid: %v", err)
+	}
+	if got.Name != d.Name || got.Environment != d.Environment || got.Version != d.Version || got.Description != d.Description || got.Replicas != 3 || got.Strategy != d.Strategy {
+		t.Errorf("Unexpected deployment %+v", got)
+	}
+	c := got.Containers[0]
+	if c.Resources.Limits.CPU.String() != "1" || c.Resources.Requests.Memory.String() != "512Mi" {
+		t.Errorf("Unexpected resources %+v", c.Resources)
+	}
+	if len(c.EnvironmentVariables) != 2 || c.EnvironmentVariables[1].Name != "LOG_LEVEL" || c.EnvironmentVariables[1].Value != "info" {
+		t.Errorf("Unexpected env %+v", c.EnvironmentVariables)
+	}
+	if !reflect.DeepEqual(c.HealthCheck, d.Containers[0].HealthCheck) {
+		t.Errorf("Expected health check %+v, got %+v", d.Containers[0].HealthCheck, c.HealthCheck)
+	}
+	// The service targets the container port, which becomes the service_port
+	svc := got.Services[0]
+	if c.Ports[0].ServicePort != 80 || svc.Type != "LoadBalancer" || svc.Ports[0].Port != 80 || svc.Ports[0].TargetPort != 80 {
+		t.Errorf("Unexpected ports %+v and service %+v", c.Ports, svc)
+	}
+}
+
+const kubectlDeployment = `apiVersion: v1
+kind: List
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: api
+    namespace: backend
+    uid: 0c5d2b5e
+    labels:
+      team: payments
+  spec:
+    replicas: 4
+    revisionHistoryLimit: 10
+    selector:
+      matchLabels:
+        app: api
+    strategy:
+      rollingUpdate:
+        maxSurge: 50%
+        maxUnavailable: 0
+    template:
+      metadata:
+        labels:
+          app: api
+      spec:
+        dnsPolicy: ClusterFirst
+        volumes:
+        - name: data
+          emptyDir: {}
+        containers:
+        - name: api
+          image: registry.baidu.com/backend/api:v1.4.0
+          imagePullPolicy: IfNotPresent
+          ports:
+          - name: http
+            containerPort: 8080
+          - name: metrics
+            containerPort: 9090
+            protocol: UDP
+          envFrom:
+          - secretRef:
+              name: api-credentials
+          env:
+          - name: LOG_LEVEL
+            valueFrom:
+              configMapKeyRef:
+                name: api-config
+                key: log-level
+          - name: POD_NAME
+            valueFrom:
+              fieldRef:
+                fieldPath: metadata.name
+          resources:
+            limits:
+              memory: 1G
+              nvidia.com/gpu: "1"
+          readinessProbe:
+            httpGet:
+              path: /ready
+              port: http
+          livenessProbe:
+            tcpSocket:
+              port: 8080
+  status:
+    replicas: 4
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: api-config
+  namespace: backend
+data:
+  log-level: debug
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: api
+  namespace: backend
+spec:
+  type: NodePort
+  clusterIP: 10.0.0.12
+  selector:
+    app: api
+  ports:
+  - name: http
+    port: 80
+    targetPort: http
+    nodePort: 30080
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: orphan
+  namespace: backend
+spec:
+  selector:
+    app: other
+  ports:
+  - port: 80
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: api
+`
+
+// Test importing a deployment as kubectl prints it, with unsupported fields
+func TestImportKubernetesWarnings(t *testing.T) {
+	_, err := tianniu.ImportKubernetes(strings.NewReader(kubectlDeployment), tianniu.ImportOptions{})
+	if err == nil || !strings.Contains(err.Error(), `document 5: Ingress api: unsupported apiVersion "networking.k8s.io/v1"`) {
+		t.Fatalf("Expected an apiVersion error, got %v", err)
+	}
+
+	input := strings.Replace(kubectlDeployment, "networking.k8s.io/v1", "v1", 1)
+	result, err := tianniu.ImportKubernetes(strings.NewReader(input), tianniu.ImportOptions{Environment: "production"})
+	if err != nil {
+		t.Fatalf("ImportKubernetes failed: %v", err)
+	}
+	d := result.Deployments[0]
+	if d.Environment != "production" || d.Version != "v1.4.0" || d.Strategy.MaxSurge != 2 || d.Strategy.MaxUnavailable != 0 {
+		t.Errorf("Unexpected deployment %+v", d)
+	}
+	c := d.Containers[0]
+	if len(c.Ports) != 1 || c.Ports[0].ServicePort != 8080 || c.Resources.Limits.Memory.String() != "1GB" {
+		t.Errorf("Unexpected container %+v", c)
+	}
+	if len(c.EnvironmentVariables) != 1 || c.EnvironmentVariables[0].Value != "debug" {
+		t.Errorf("Unexpected env %+v", c.EnvironmentVariables)
+	}
+	if c.HealthCheck == nil || c.HealthCheck.Port != 8080 || c.HealthCheck.HTTPPath != "/ready" || c.HealthCheck.PeriodSeconds != 10 {
+		t.Errorf("Unexpected health check %+v", c.HealthCheck)
+	}
+	if len(d.Services) != 1 || d.Services[0].Type != "NodePort" || d.Services[0].Ports[0].TargetPort != 8080 {
+		t.Errorf("Unexpected services %+v", d.Services)
+	}
+
+	want := []string{
+		"ingress/api: kind Ingress is not supported",
+		"deployment/api: spec.template.spec.containers[0].env[1].valueFrom.fieldRef: not supported",
+		"deployment/api: spec.template.spec.volumes: not supported",
+		"deployment/api: metadata.labels: deployments have no labels or annotations; dropped team",
+		"deployment/api: spec.strategy.rollingUpdate.maxSurge: 50% of 4 replicas converted to 2",
+		"deployment/api: spec.template.spec.containers[0].ports[1].protocol: UDP ports are not supported",
+		"deployment/api: spec.template.spec.containers[0].resources.limits.nvidia.com/gpu: only cpu and memory are supported",
+		"deployment/api: spec.template.spec.containers[0].envFrom[0]: Secret api-credentials is not in the input; its keys are unknown",
+		"deployment/api: spec.template.spec.containers[0].livenessProbe: differs from the readinessProbe; only the readinessProbe is imported",
+		"service/api: spec.ports[0].nodePort: node ports are assigned by TianNiu; 30080 is dropped",
+		"service/orphan: spec.selector: selects no imported deployment; the service is dropped",
+	}
+	got := importWarnings(result)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected warnings:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+// Test importing the example compose file
+func TestImportCompose(t *testing.T) {
+	f, err := os.Open("../examples/import/docker-compose.yml")
+	if err != nil {
+		t.Fatalf("Failed to open the example: %v", err)
+	}
+	defer f.Close()
+	result, err := tianniu.ImportCompose(f, tianniu.ImportOptions{Environment: "staging"})
+	if err != nil {
+		t.Fatalf("ImportCompose failed: %v", err)
+	}
+	if len(result.Deployments) != 2 {
+		t.Fatalf("Expected two deployments, got %d", len(result.Deployments))
+	}
+	for _, d := range result.Deployments {
+		if err := d.Validate(); err != nil {
+			t.Errorf("Deployment %s is not valid: %v", d.Name, err)
+		}
+	}
+
+	cache, web := result.Deployments[0], result.Deployments[1]
+	if web.Name != "web-frontend" || web.Version != "v2.3.1" || web.Replicas != 3 || web.Environment != "staging" {
+		t.Errorf("Unexpected deployment %+v", web)
+	}
+	if web.Strategy != (tianniu.DeploymentStrategy{Type: tianniu.StrategyRollingUpdate, MaxSurge: 1}) {
+		t.Errorf("Unexpected strategy %+v", web.Strategy)
+	}
+	c := web.Containers[0]
+	if c.Resources.Limits.Memory.String() != "1Gi" || c.Resources.Requests.CPU.String() != "500m" {
+		t.Errorf("Unexpected resources %+v", c.Resources)
+	}
+	want := tianniu.HealthCheck{HTTPPath: "/health", Port: 8080, InitialDelaySeconds: 10, PeriodSeconds: 30, TimeoutSeconds: 5, SuccessThreshold: 1, FailureThreshold: 3}
+	if c.HealthCheck == nil || !reflect.DeepEqual(*c.HealthCheck, want) {
+		t.Errorf("Unexpected health check %+v", c.HealthCheck)
+	}
+	if svc := web.Services[0]; svc.Type != "LoadBalancer" || svc.Ports[0].Port != 80 || svc.Ports[0].TargetPort != 8080 {
+		t.Errorf("Unexpected service %+v", svc)
+	}
+	// Exposed ports are only reachable inside the cluster
+	if svc := cache.Services[0]; svc.Type != "ClusterIP" || svc.Ports[0].Port != 6379 {
+		t.Errorf("Unexpected service %+v", svc)
+	}
+
+	got := strings.Join(importWarnings(result), "\n")
+	if got != "compose: volumes: top-level volumes are not supported\n"+
+		"service/cache: volumes: not supported\n"+
+		"service/web_frontend: renamed to web-frontend\n"+
+		"service/web_frontend: depends_on: not supported" {
+		t.Errorf("Unexpected warnings:\n%s", got)
+	}
+}
+
+// Test the compose value formats that are converted or reported
+func TestImportComposeFormats(t *testing.T) {
+	compose := `services:
+  app:
+    image: app
+    ports:
+      - "127.0.0.1:8080:80"
+      - "53:53/udp"
+      - "9000-9001:9000-9001"
+      - target: 443
+        published: 8443
+    environment:
+      - MODE=prod
+      - HOME
+      - URL=http://${HOST}
+    mem_limit: 2147483648
+    healthcheck:
+      test: pg_isready
+`
+	result, err := tianniu.ImportCompose(strings.NewReader(compose), tianniu.ImportOptions{})
+	if err != nil {
+		t.Fatalf("ImportCompose failed: %v", err)
+	}
+	d := result.Deployments[0]
+	c := d.Containers[0]
+	if d.Version != "latest" || len(c.Ports) != 2 || c.Ports[1].ContainerPort != 443 || d.Services[0].Ports[1].Port != 8443 {
+		t.Errorf("Unexpected deployment %+v", d)
+	}
+	if len(c.EnvironmentVariables) != 2 || c.Resources.Limits.Memory.String() != "2Gi" {
+		t.Errorf("Unexpected container %+v", c)
+	}
+	// A test that requests no URL runs in the container
+	if c.HealthCheck == nil || !reflect.DeepEqual(c.HealthCheck.Command, []string{"/bin/sh", "-c", "pg_isready"}) || c.HealthCheck.HTTPPath != "" {
+		t.Errorf("Unexpected health check %+v", c.HealthCheck)
+	}
+	want := []string{
+		"service/app: environment[1]: HOME takes its value from the shell running compose; it is dropped",
+		"service/app: environment[2]: URL uses variable interpolation; set its value before deploying",
+		"service/app: ports[0]: the host IP 127.0.0.1 is dropped",
+		"service/app: ports[1]: udp ports are not supported",
+		"service/app: ports[2]: port ranges such as 9000-9001 are not supported",
+		"service/app: image: no image tag; using version latest",
+	}
+	if got := importWarnings(result); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected warnings:\n%s", strings.Join(got, "\n"))
+	}
+
+	if _, err := tianniu.ImportCompose(strings.NewReader("version: '3'\n"), tianniu.ImportOptions{}); err == nil {
+		t.Error("Expected an error for a file without services")
+	}
+}
@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+// Test exporting the sample deployment to Kubernetes objects
+func TestExportKubernetes(t *testing.T) {
+	data, err := ioutil.ReadFile("../examples/go/sample-deployment.json")
+	if err != nil {
+		t.Fatalf("Failed to read sample deployment: %v", err)
+	}
+	var d tianniu.Deployment
+	if err := json.Unmarshal(data, &d); err != nil {
+		t.Fatalf("Failed to parse sample deployment: %v", err)
+	}
+
+	objects := tianniu.ExportKubernetes(&d, tianniu.K8sExportOptions{})
+	if len(objects.Items()) != 3 || len(objects.ConfigMaps) != 1 || len(objects.Secrets) != 0 || len(objects.Services) != 1 {
+		t.Fatalf("Unexpected objects %+v", objects)
+	}
+
+	k := objects.Deployment
+	if k.APIVersion != "apps/v1" || k.Metadata.Namespace != "production" || k.Spec.Replicas != 3 {
+		t.Errorf("Unexpected deployment metadata %+v", k)
+	}
+	if k.Spec.Strategy.Type != "RollingUpdate" || k.Spec.Strategy.RollingUpdate.MaxSurge.Int != 1 {
+		t.Errorf("Unexpected strategy %+v", k.Spec.Strategy)
+	}
+	for key, value := range k.Spec.Selector.MatchLabels {
+		if k.Spec.Template.Metadata.Labels[key] != value {
+			t.Errorf("Pod template labels do not match selector %s=%s", key, value)
+		}
+	}
+
+	c := k.Spec.Template.Spec.Containers[0]
+	if c.Resources.Limits["cpu"].String() != "1" || c.Resources.Requests["memory"].String() != "512Mi" {
+		t.Errorf("Unexpected resources %+v", c.Resources)
+	}
+	if c.LivenessProbe.HTTPGet.Path != "/health" || c.ReadinessProbe.PeriodSeconds != 30 || c.LivenessProbe.SuccessThreshold != 0 {
+		t.Errorf("Unexpected probes %+v %+v", c.LivenessProbe, c.ReadinessProbe)
+	}
+	cm := objects.ConfigMaps[0]
+	if c.EnvFrom[0].ConfigMapRef.Name != cm.Metadata.Name || cm.Data["LOG_LEVEL"] != "info" {
+		t.Errorf("Unexpected env %+v from %+v", c.EnvFrom, cm)
+	}
+
+	// The service targets the container port behind service_port 8080
+	svc := objects.Services[0]
+	if svc.Spec.Type != "LoadBalancer" || svc.Spec.Ports[0].Port != 80 || svc.Spec.Ports[0].TargetPort.Int != 80 {
+		t.Errorf("Unexpected service %+v", svc.Spec)
+	}
+
+	var buf bytes.Buffer
+	if err := tianniu.EncodeManifests(&buf, objects.Items()...); err != nil {
+		t.Fatalf("EncodeManifests failed: %v", err)
+	}
+	for _, want := range []string{"kind: ConfigMap\n", "---\napiVersion: apps/v1\nkind: Deployment\n", "        cpu: \"1.0\"\n", "    targetPort: 80\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected '%s' in:\n%s", strings.TrimSpace(want), buf.String())
+		}
+	}
+}
+
+// Test the ConfigMaps and Secrets of a deployment with several containers
+func TestExportKubernetesSecrets(t *testing.T) {
+	d := &tianniu.Deployment{
+		Name: "api", Environment: "staging", Version: "v1", Replicas: 2,
+		Strategy: tianniu.DeploymentStrategy{Type: tianniu.StrategyRecreate},
+		Containers: []tianniu.DeploymentContainer{
+			{
+				Name:  "api",
+				Image: "api:v1",
+				Resources: tianniu.ResourceRequirements{
+					Limits: tianniu.ResourceList{Memory: tianniu.MustParseQuantity("512MB")},
+				},
+				EnvironmentVariables: []tianniu.EnvVar{
+					{Name: "DB_HOST", Value: "db"},
+					{Name: "DB_PASSWORD", ValueFrom: &tianniu.EnvVarSource{SecretName: "db", Key: "password"}},
+				},
+			},
+			{
+				Name:  "worker",
+				Image: "worker:v1",
+				EnvironmentVariables: []tianniu.EnvVar{
+					{Name: "DB_USER", ValueFrom: &tianniu.EnvVarSource{SecretName: "db", Key: "user"}},
+					{Name: "API_TOKEN", ValueFrom: &tianniu.EnvVarSource{SecretName: "api", Key: "token"}},
+				},
+			},
+		},
+	}
+
+	objects := tianniu.ExportKubernetes(d, tianniu.K8sExportOptions{Namespace: "apps"})
+	if len(objects.ConfigMaps) != 1 || objects.ConfigMaps[0].Metadata.Name != "api-api-env" {
+		t.Errorf("Expected one ConfigMap for the api container, got %+v", objects.ConfigMaps)
+	}
+	if len(objects.Secrets) != 2 || objects.Secrets[0].Metadata.Name != "api" || objects.Secrets[1].Metadata.Name != "db" {
+		t.Fatalf("Expected the api and db secrets, got %+v", objects.Secrets)
+	}
+	db := objects.Secrets[1]
+	if len(db.StringData) != 2 || db.Metadata.Namespace != "apps" || db.Metadata.Annotations[tianniu.K8sPlaceholderAnnotation] != "true" {
+		t.Errorf("Unexpected placeholder secret %+v", db)
+	}
+
+	k := objects.Deployment
+	if k.Spec.Strategy.Type != "Recreate" || k.Spec.Strategy.RollingUpdate != nil {
+		t.Errorf("Unexpected strategy %+v", k.Spec.Strategy)
+	}
+	worker := k.Spec.Template.Spec.Containers[1]
+	if len(worker.EnvFrom) != 0 || worker.Env[1].ValueFrom.SecretKeyRef.Name != "api" {
+		t.Errorf("Unexpected worker env %+v", worker.Env)
+	}
+	// Kubernetes writes decimal bytes without the B
+	if memory := k.Spec.Template.Spec.Containers[0].Resources.Limits["memory"]; memory.String() != "512M" {
+		t.Errorf("Expected memory 512M, got %s", memory)
+	}
+}
@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+const multiDocManifest = `apiVersion: v1
+kind: Deployment
+metadata:
+  name: web-frontend
+  environment: production
+spec:
+  version: v2.3.1
+  replicas: 3
+  containers:
+  - name: web
+    image: nginx:1.25
+---
+# empty documents are skipped
+---
+apiVersion: v1
+kind: Container
+metadata:
+  name: redis-cache
+  labels:
+    app: cache
+spec:
+  image: redis:7.2
+  health_check:
+    endpoint: tcp://localhost:6379
+    retries: 3
+---
+apiVersion: v1
+kind: ResourceQuota
+metadata:
+  name: production
+spec:
+  limits:
+    memory: 512
+    cpu: 150
+`
+
+// Test decoding multi-document manifests of every kind
+func TestDecodeManifests(t *testing.T) {
+	manifests, err := tianniu.DecodeManifests(strings.NewReader(multiDocManifest))
+	if err != nil {
+		t.Fatalf("DecodeManifests failed: %v", err)
+	}
+	if len(manifests) != 3 {
+		t.Fatalf("Expected 3 manifests, got %d", len(manifests))
+	}
+
+	d := manifests[0].Deployment.Deployment()
+	if d.Name != "web-frontend" || d.Environment != "production" || d.Replicas != 3 || d.Containers[0].Image != "nginx:1.25" {
+		t.Errorf("Unexpected deployment %+v", d)
+	}
+
+	opts := manifests[1].Container.CreateOptions()
+	if opts.Name != "redis-cache" || opts.Labels["app"] != "cache" || opts.HealthCheck.Retries != 3 {
+		t.Errorf("Unexpected container options %+v", opts)
+	}
+
+	quotas := manifests[2].ResourceQuota.Quotas()
+	if quotas.Namespace != "production" || len(quotas.Quotas) != 2 || quotas.Quotas[0].ResourceType != "cpu" || quotas.Quotas[1].Limit != 512 {
+		t.Errorf("Unexpected quotas %+v", quotas)
+	}
+}
+
+// Test that malformed manifests are rejected with the document number
+func TestDecodeManifestsStrict(t *testing.T) {
+	tests := []struct {
+		manifest string
+		err      string
+	}{
+		{"apiVersion: v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replica: 3\n", `document 1: invalid Deployment manifest: json: unknown field "replica"`},
+		{"apiVersion: v1\nkind: Deployment\nmetadata:\n  name: web\n---\napiVersion: v1\nkind: Pod\nmetadata:\n  name: web\n", `document 2: unsupported kind "Pod"`},
+		{"apiVersion: v2\nkind: Container\nmetadata:\n  name: web\n", `document 1: unsupported apiVersion "v2" (want "v1")`},
+		{"apiVersion: v1\nkind: Container\nspec:\n  image: nginx\n", "document 1: Container manifest has no metadata.name"},
+		{"apiVersion: v1\nkind: Deployment\nmetadata:\n  name: web\n  labels:\n    app: web\n", "document 1: Deployment web: metadata.labels is only supported for containers"},
+		{"apiVersion: v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: three\n", "document 1: invalid Deployment manifest: json: cannot unmarshal string"},
+	}
+
+	for _, test := range tests {
+		_, err := tianniu.DecodeManifests(strings.NewReader(test.manifest))
+		if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+			t.Errorf("Expected error '%s', got %v", test.err, err)
+		}
+	}
+}
+
+// Test that converting a deployment to a manifest and back keeps its spec
+func TestManifestRoundTrip(t *testing.T) {
+	data, err := ioutil.ReadFile("../examples/go/sample-deployment.json")
+	if err != nil {
+		t.Fatalf("Failed to read sample deployment: %v", err)
+	}
+	var original tianniu.Deployment
+	if err := json.Unmarshal(data, &original); err != nil {
+		t.Fatalf("Failed to parse sample deployment: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tianniu.EncodeManifests(&buf, tianniu.NewDeploymentManifest(&original)); err != nil {
+		t.Fatalf("EncodeManifests failed: %v", err)
+	}
+	manifests, err := tianniu.DecodeManifests(&buf)
+	if err != nil {
+		t.Fatalf("DecodeManifests failed: %v\n%s", err, buf.String())
+	}
+	decoded := manifests[0].Deployment.Deployment()
+	if changes, _ := tianniu.DiffDeployments(&original, decoded); len(changes) != 0 {
+		t.Errorf("Round trip changed the deployment: %+v", changes)
+	}
+
+	example, err := tianniu.LoadManifests("../examples/manifests/web-frontend.yaml")
+	if err != nil {
+		t.Fatalf("Failed to load example manifest: %v", err)
+	}
+	if !reflect.DeepEqual(example[0].Deployment.Deployment(), decoded) {
+		t.Error("examples/manifests/web-frontend.yaml is out of date with sample-deployment.json")
+	}
+
+	for _, path := range []string{"../examples/manifests/redis-cache.yaml", "../examples/manifests/production-quota.yaml"} {
+		if _, err := tianniu.LoadManifests(path); err != nil {
+			t.Errorf("Failed to load %s: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+	"github.com/go-sql-driver/mysql"
+)
+
+// testCert is a certificate and its key, signed by a test CA
+type testCert struct {
+	cert *x509.Certificate
+	der  []byte
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert creates a certificate for host signed by parent, or a self
+// signed CA certificate when parent is nil
+func newTestCert(t *testing.T, host string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{host},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		template.DNSNames = nil
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate failed: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, der: der, key: key}
+}
+
+// write saves the certificate and key as PEM files in dir
+func (c *testCert) write(t *testing.T, dir, name string) (certFile, keyFile string) {
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey failed: %v", err)
+	}
+	certFile = filepath.Join(dir, name+".pem")
+	keyFile = filepath.Join(dir, name+"-key.pem")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+// Test the tls.Config built for each ssl_mode
+func TestMySQLTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tianniu-mysql-tls")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, "Test CA", nil)
+	caFile, _ := ca.write(t, dir, "ca")
+	server := newTestCert(t, "db.internal", ca)
+	otherHost := newTestCert(t, "other.internal", ca)
+	rogue := newTestCert(t, "db.internal", newTestCert(t, "Rogue CA", nil))
+	clientCert, clientKey := newTestCert(t, "tianniu", ca).write(t, dir, "client")
+	empty := filepath.Join(dir, "empty.pem")
+	ioutil.WriteFile(empty, []byte("not a certificate\n"), 0600)
+
+	env := func(mode, ca string) *tianniu.MySQLEnvironment {
+		return &tianniu.MySQLEnvironment{Name: "prod", Host: "db.internal", Port: 3306, SSLMode: mode, SSLCA: ca}
+	}
+
+	for _, mode := range []string{"", "disable"} {
+		if config, err := env(mode, "").TLSConfig(); err != nil || config != nil {
+			t.Errorf("ssl_mode %q: expected no TLS, got %v, %v", mode, config, err)
+		}
+	}
+
+	// prefer and require encrypt without checking the server
+	for _, mode := range []string{"prefer", "require"} {
+		e := env(mode, "")
+		e.SSLCert, e.SSLKey = clientCert, clientKey
+		config, err := e.TLSConfig()
+		if err != nil {
+			t.Fatalf("ssl_mode %s: TLSConfig failed: %v", mode, err)
+		}
+		if !config.InsecureSkipVerify || config.VerifyPeerCertificate != nil || config.MinVersion != tls.VersionTLS12 {
+			t.Errorf("ssl_mode %s: expected unverified TLS 1.2+, got %+v", mode, config)
+		}
+		if len(config.Certificates) != 1 {
+			t.Errorf("ssl_mode %s: expected the client certificate, got %d", mode, len(config.Certificates))
+		}
+	}
+
+	// verify-ca checks the chain but not the host name
+	config, err := env("verify-ca", caFile).TLSConfig()
+	if err != nil {
+		t.Fatalf("ssl_mode verify-ca: TLSConfig failed: %v", err)
+	}
+	if !config.InsecureSkipVerify || config.VerifyPeerCertificate == nil {
+		t.Fatalf("ssl_mode verify-ca: expected a custom chain check, got %+v", config)
+	}
+	for _, c := range []*testCert{server, otherHost} {
+		if err := config.VerifyPeerCertificate([][]byte{c.der}, nil); err != nil {
+			t.Errorf("ssl_mode verify-ca: expected %s to verify, got %v", c.cert.Subject.CommonName, err)
+		}
+	}
+	if err := config.VerifyPeerCertificate([][]byte{rogue.der}, nil); err == nil {
+		t.Error("ssl_mode verify-ca: expected a certificate of another CA to fail")
+	}
+	if err := config.VerifyPeerCertificate(nil, nil); err == nil {
+		t.Error("ssl_mode verify-ca: expected a missing certificate to fail")
+	}
+
+	// verify-full leaves the chain and host name checks to crypto/tls
+	config, err = env("verify-full", caFile).TLSConfig()
+	if err != nil {
+		t.Fatalf("ssl_mode verify-full: TLSConfig failed: %v", err)
+	}
+	if config.InsecureSkipVerify || config.VerifyPeerCertificate != nil || config.ServerName != "db.internal" || config.RootCAs == nil {
+		t.Fatalf("ssl_mode verify-full: expected standard verification of db.internal, got %+v", config)
+	}
+	verify := func(c *testCert) error {
+		_, err := c.cert.Verify(x509.VerifyOptions{Roots: config.RootCAs, DNSName: config.ServerName})
+		return err
+	}
+	if err := verify(server); err != nil {
+		t.Errorf("ssl_mode verify-full: expected the server certificate to verify, got %v", err)
+	}
+	if verify(otherHost) == nil || verify(rogue) == nil {
+		t.Error("ssl_mode verify-full: expected the wrong host and the wrong CA to fail")
+	}
+
+	// Unusable settings
+	tests := []struct {
+		env *tianniu.MySQLEnvironment
+		err string
+	}{
+		{env("verify-ca", filepath.Join(dir, "missing.pem")), "failed to read ssl_ca"},
+		{env("verify-full", empty), "no certificates found in ssl_ca"},
+		{env("verify-ca", ""), "verify-ca requires ssl_ca"},
+		{env("verify-full", ""), "verify-full requires ssl_ca"},
+		{&tianniu.MySQLEnvironment{SSLMode: "require", SSLCert: clientCert}, "must be set together"},
+		{&tianniu.MySQLEnvironment{SSLMode: "require", SSLCert: clientCert, SSLKey: filepath.Join(dir, "missing-key.pem")}, "failed to load client certificate"},
+		{env("always", ""), `unsupported ssl_mode "always"`},
+	}
+	for _, test := range tests {
+		if _, err := test.env.TLSConfig(); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("ssl_mode %s: expected error containing '%s', got %v", test.env.SSLMode, test.err, err)
+		}
+	}
+}
+
+// Test that the DSN carries every field, escaped so the driver reads it back
+func TestMySQLFormatDSN(t *testing.T) {
+	if err := mysql.RegisterTLSConfig("tianniu-test", &tls.Config{}); err != nil {
+		t.Fatalf("RegisterTLSConfig failed: %v", err)
+	}
+	defer mysql.DeregisterTLSConfig("tianniu-test")
+
+	config := &tianniu.MySQLConfig{}
+	config.Defaults.Charset = "utf8mb4"
+	config.Defaults.Collation = "utf8mb4_unicode_ci"
+	config.Defaults.Timezone = "Asia/Shanghai"
+
+	tests := []struct {
+		name     string
+		env      tianniu.MySQLEnvironment
+		username string
+		password string
+		tlsName  string
+		addr     string
+		fallback bool
+	}{
+		{
+			name:     "special characters",
+			env:      tianniu.MySQLEnvironment{Host: "db.internal", Port: 3306, Database: "tianniu", ConnectionTimeout: "5s", ReadTimeout: "30s", WriteTimeout: "1m"},
+			username: "app@prod",
+			password: `p@ss:w/rd?x=1&y#%!'"`,
+			addr:     "db.internal:3306",
+		},
+		{
+			name:     "ipv6 host with tls",
+			env:      tianniu.MySQLEnvironment{Host: "::1", Port: 3307, Database: "tianniu_dev", SSLMode: "require"},
+			username: "dev",
+			password: "/tcp(evil:1)/",
+			tlsName:  "tianniu-test",
+			addr:     "[::1]:3307",
+		},
+		{
+			name:     "prefer falls back to plaintext",
+			env:      tianniu.MySQLEnvironment{Host: "db.internal", Port: 3306, Database: "tianniu", SSLMode: "prefer"},
+			username: "app",
+			password: "",
+			tlsName:  "tianniu-test",
+			addr:     "db.internal:3306",
+			fallback: true,
+		},
+	}
+	for _, test := range tests {
+		dsn, err := config.FormatDSN(&test.env, test.username, test.password, test.tlsName)
+		if err != nil {
+			t.Fatalf("%s: FormatDSN failed: %v", test.name, err)
+		}
+		parsed, err := mysql.ParseDSN(dsn)
+		if err != nil {
+			t.Fatalf("%s: ParseDSN(%s) failed: %v", test.name, dsn, err)
+		}
+		if parsed.User != test.username || parsed.Passwd != test.password || parsed.Addr != test.addr || parsed.DBName != test.env.Database {
+			t.Errorf("%s: credentials or address did not round-trip: %+v", test.name, parsed)
+		}
+		if !parsed.ParseTime || parsed.Collation != "utf8mb4_unicode_ci" || !strings.Contains(dsn, "charset=utf8mb4") || parsed.Loc.String() != "Asia/Shanghai" {
+			t.Errorf("%s: defaults not applied: %+v", test.name, parsed)
+		}
+		if parsed.TLSConfig != test.tlsName || parsed.AllowFallbackToPlaintext != test.fallback {
+			t.Errorf("%s: expected tls %q (fallback %v), got %q (%v)", test.name, test.tlsName, test.fallback, parsed.TLSConfig, parsed.AllowFallbackToPlaintext)
+		}
+		if test.env.ConnectionTimeout != "" && (parsed.Timeout != 5*time.Second || parsed.ReadTimeout != 30*time.Second || parsed.WriteTimeout != time.Minute) {
+			t.Errorf("%s: timeouts not applied: %v %v %v", test.name, parsed.Timeout, parsed.ReadTimeout, parsed.WriteTimeout)
+		}
+	}
+
+	bad := &tianniu.MySQLEnvironment{Host: "db.internal", Port: 3306, Database: "tianniu", ReadTimeout: "soon"}
+	if _, err := config.FormatDSN(bad, "app", "secret", ""); err == nil || !strings.Contains(err.Error(), "invalid read timeout") {
+		t.Errorf("Expected an invalid read timeout, got %v", err)
+	}
+	config.Defaults.Timezone = "Mars/Olympus_Mons"
+	if _, err := config.FormatDSN(&tests[0].env, "app", "secret", ""); err == nil || !strings.Contains(err.Error(), "invalid timezone") {
+		t.Errorf("Expected an invalid timezone, got %v", err)
+	}
+}
+
+// Test that Validate reports every problem of the configuration at once
+func TestMySQLConfigValidate(t *testing.T) {
+	os.Setenv("TIANNIU_TEST_DB_USER", "app")
+	defer os.Unsetenv("TIANNIU_TEST_DB_USER")
+	os.Unsetenv("TIANNIU_TEST_DB_PASS")
+
+	valid := tianniu.MySQLEnvironment{
+		Name: "staging", Host: "db.staging", Port: 3306, Database: "tianniu",
+		UsernameEnv: "TIANNIU_TEST_DB_USER", Password: "file:///run/secrets/db-pass",
+		MaxConnections: 20, MaxOpenConns: 10, MaxIdleConns: 5, ConnMaxLifetime: "1h",
+		SSLMode: "verify-full", SSLCA: "/etc/ssl/db-ca.pem",
+	}
+	config := &tianniu.MySQLConfig{Environments: []tianniu.MySQLEnvironment{valid}}
+	config.Defaults.Charset = "utf8mb4"
+	if err := config.Validate("staging"); err != nil {
+		t.Fatalf("Expected a valid configuration, got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(c *tianniu.MySQLConfig)
+		env    string
+		errors []string
+	}{
+		{
+			name: "every field of an environment",
+			change: func(c *tianniu.MySQLConfig) {
+				c.Environments = append(c.Environments, tianniu.MySQLEnvironment{
+					Name: "prod", Port: 70000, Username: "vault:db/user", UsernameEnv: "DB_USER",
+					ConnectionTimeout: "5 seconds", ReadTimeout: "-1s",
+					MaxConnections: 10, MaxOpenConns: 20, MaxIdleConns: -1,
+					SSLMode: "verify-ca", SSLCert: "/etc/ssl/client.pem",
+				})
+			},
+			errors: []string{
+				"environment prod: host is required",
+				"environment prod: port 70000 is out of range",
+				"environment prod: database is required",
+				"environment prod: username and username_env are mutually exclusive",
+				"environment prod: password (secret reference) or password_env is required",
+				"environment prod: connection_timeout: ",
+				"environment prod: read_timeout: duration -1s must not be negative",
+				"environment prod: max_idle_connections must not be negative",
+				"environment prod: max_open_connections (20) exceeds max_connections (10)",
+				"environment prod: ssl_mode verify-ca requires ssl_ca",
+				"environment prod: ssl_cert and ssl_key must be set together",
+			},
+		},
+		{
+			name: "defaults, names and the selected environment",
+			change: func(c *tianniu.MySQLConfig) {
+				c.Defaults.Charset = ""
+				c.Defaults.Timezone = "Mars/Olympus_Mons"
+				c.Environments = append(c.Environments, valid, tianniu.MySQLEnvironment{})
+				c.Environments[1].SSLMode = "disable"
+				c.Environments[2].Host = "db.internal"
+			},
+			env: "prod",
+			errors: []string{
+				"defaults.charset is required",
+				`defaults.timezone "Mars/Olympus_Mons": `,
+				"environment staging: defined more than once",
+				"environment staging: ssl_ca/ssl_cert are set but ssl_mode disables TLS",
+				"environments[2]: name is required",
+				"environments[2]: port 0 is out of range",
+				"environments[2]: database is required",
+				"environments[2]: username (secret reference) or username_env is required",
+				"environments[2]: password (secret reference) or password_env is required",
+				"environment prod not found in configuration (available: staging, staging, )",
+			},
+		},
+		{
+			name: "unset credential variables",
+			change: func(c *tianniu.MySQLConfig) {
+				c.Environments[0].Password = ""
+				c.Environments[0].PasswordEnv = "TIANNIU_TEST_DB_PASS"
+				c.Environments[0].SSLMode = "sometimes"
+			},
+			env: "staging",
+			errors: []string{
+				`environment staging: unsupported ssl_mode "sometimes"`,
+				"environment staging: password variable TIANNIU_TEST_DB_PASS is not set",
+			},
+		},
+	}
+	for _, test := range tests {
+		c := &tianniu.MySQLConfig{Environments: []tianniu.MySQLEnvironment{valid}}
+		c.Defaults.Charset = "utf8mb4"
+		test.change(c)
+		err := c.Validate(test.env)
+		problems, ok := err.(tianniu.ConfigErrors)
+		if !ok {
+			t.Errorf("%s: expected ConfigErrors, got %v", test.name, err)
+			continue
+		}
+		if len(problems) != len(test.errors) {
+			t.Errorf("%s: expected %d problems, got %d:\n%v", test.name, len(test.errors), len(problems), err)
+		}
+		for i, want := range test.errors {
+			if i < len(problems) && !strings.HasPrefix(problems[i], want) {
+				t.Errorf("%s: expected problem %d to start with '%s', got '%s'", test.name, i, want, problems[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+const testPolicy = `apiVersion: v1
+kind: Policy
+metadata:
+  name: guardrails
+spec:
+  rules:
+  - name: trusted-registry
+    environments: [production]
+    images:
+      allowed_registries: [registry.baidu.com]
+      disallowed_tags: [latest]
+  - name: resource-limits
+    environments: [production]
+    resources:
+      require_limits: true
+      max_memory: 4Gi
+  - name: no-debug-logging
+    environments: [production]
+    env:
+      forbidden:
+        LOG_LEVEL: [debug]
+        DEBUG: []
+  - name: highly-available
+    action: warn
+    kinds: [Deployment]
+    replicas:
+      min: 2
+  - name: owned-containers
+    kinds: [Container]
+    labels:
+      required: [team]
+`
+
+func loadTestPolicies(t *testing.T) tianniu.Policies {
+	manifests, err := tianniu.DecodeManifests(strings.NewReader(testPolicy))
+	if err != nil {
+		t.Fatalf("DecodeManifests failed: %v", err)
+	}
+	return tianniu.Policies{manifests[0].Policy}
+}
+
+func policyDeployment(environment string) *tianniu.Deployment {
+	return &tianniu.Deployment{
+		Name: "api-backend", Environment: environment, Version: "v1.5.1", Replicas: 1,
+		Containers: []tianniu.DeploymentContainer{
+			{
+				Name:  "api",
+				Image: "registry.baidu.com/backend/api-service:v1.5.1",
+				Resources: tianniu.ResourceRequirements{
+					Limits: tianniu.ResourceList{CPU: tianniu.MustParseQuantity("2"), Memory: tianniu.MustParseQuantity("2Gi")},
+				},
+				EnvironmentVariables: []tianniu.EnvVar{{Name: "LOG_LEVEL", Value: "debug"}},
+			},
+			{
+				Name:  "proxy",
+				Image: "nginx",
+				Resources: tianniu.ResourceRequirements{
+					Limits: tianniu.ResourceList{CPU: tianniu.MustParseQuantity("1"), Memory: tianniu.MustParseQuantity("8GB")},
+				},
+				EnvironmentVariables: []tianniu.EnvVar{{Name: "DEBUG", Value: "0"}},
+			},
+		},
+	}
+}
+
+// Test that the rules of the deployment's environment are evaluated
+func TestPolicyCheckDeployment(t *testing.T) {
+	policies := loadTestPolicies(t)
+
+	results := policies.CheckDeployment(policyDeployment("production"))
+	want := map[string]tianniu.PolicyAction{
+		"highly-available: replicas":                               tianniu.PolicyWarn,
+		"no-debug-logging: containers[0].environment_variables[0]": tianniu.PolicyDeny,
+		"trusted-registry: containers[1].image":                    tianniu.PolicyDeny,
+		"resource-limits: containers[1].resources.limits.memory":   tianniu.PolicyDeny,
+		"no-debug-logging: containers[1].environment_variables[0]": tianniu.PolicyDeny,
+	}
+	got := map[string]int{}
+	for _, r := range results {
+		key := r.Rule + ": " + r.Field
+		got[key]++
+		if action, ok := want[key]; !ok || action != r.Action {
+			t.Errorf("Unexpected result %s (%s)", r, r.Action)
+		}
+	}
+	for key := range want {
+		if got[key] == 0 {
+			t.Errorf("Expected a result for %s", key)
+		}
+	}
+	// nginx is both outside the registry and implicitly tagged latest
+	if got["trusted-registry: containers[1].image"] != 2 {
+		t.Errorf("Expected two image results for nginx, got %d", got["trusted-registry: containers[1].image"])
+	}
+
+	err := results.Err()
+	perr, ok := err.(*tianniu.PolicyError)
+	if !ok || len(perr.Denials) != 5 || !strings.HasPrefix(err.Error(), "denied by policy:\n  - ") {
+		t.Errorf("Unexpected policy error %v", err)
+	}
+
+	// Only the warn rule applies to staging
+	results = policies.CheckDeployment(policyDeployment("staging"))
+	if len(results) != 1 || results.Err() != nil || len(results.Warnings()) != 1 {
+		t.Errorf("Expected a single warning in staging, got %v", results)
+	}
+}
+
+// Test the rules that apply to containers
+func TestPolicyCheckContainer(t *testing.T) {
+	policies := loadTestPolicies(t)
+	opts := &tianniu.ContainerCreateOptions{
+		Name:   "redis-cache",
+		Image:  "registry.baidu.com/infra/redis:7.2",
+		Labels: map[string]string{"app": "cache"},
+	}
+
+	results := policies.CheckContainer("production", opts)
+	fields := []string{}
+	for _, r := range results {
+		fields = append(fields, r.Rule+": "+r.Field)
+	}
+	if strings.Join(fields, ", ") != "resource-limits: resource_limits.cpu, resource-limits: resource_limits.memory, owned-containers: labels" {
+		t.Errorf("Unexpected results %v", results)
+	}
+
+	opts.Labels["team"] = "infra"
+	opts.ResourceLimits = &tianniu.ContainerLimits{CPU: tianniu.MustParseQuantity("500m"), Memory: tianniu.MustParseQuantity("1Gi")}
+	if results := policies.CheckContainer("production", opts); len(results) != 0 {
+		t.Errorf("Expected no results, got %v", results)
+	}
+}
+
+// Test that scaling evaluates only the replicas rules
+func TestPolicyCheckScale(t *testing.T) {
+	manifests, err := tianniu.DecodeManifests(strings.NewReader(`apiVersion: v1
+kind: Policy
+metadata:
+  name: capacity
+spec:
+  rules:
+  - name: production-replicas
+    environments: [production]
+    replicas:
+      min: 3
+      max: 10
+`))
+	if err != nil {
+		t.Fatalf("DecodeManifests failed: %v", err)
+	}
+	policies := append(loadTestPolicies(t), manifests[0].Policy)
+
+	results := policies.CheckScale("production", 1)
+	if len(results) != 2 || len(results.Warnings()) != 1 {
+		t.Fatalf("Expected a warning and a denial, got %v", results)
+	}
+	perr, ok := results.Err().(*tianniu.PolicyError)
+	if !ok || len(perr.Denials) != 1 || perr.Denials[0].Rule != "production-replicas" || perr.Denials[0].Field != "replicas" {
+		t.Errorf("Unexpected policy error %v", results.Err())
+	}
+
+	if results := policies.CheckScale("production", 11); results.Err() == nil || len(results.Warnings()) != 0 {
+		t.Errorf("Expected scaling above the maximum to be denied, got %v", results)
+	}
+	if results := policies.CheckScale("production", 5); len(results) != 0 {
+		t.Errorf("Expected no results, got %v", results)
+	}
+	// The production rule does not apply to staging
+	if results := policies.CheckScale("staging", 1); len(results) != 1 || results.Err() != nil {
+		t.Errorf("Expected a single warning in staging, got %v", results)
+	}
+}
+
+// Test that malformed policies are rejected when they are loaded
+func TestPolicyValidation(t *testing.T) {
+	tests := []struct {
+		rules string
+		err   string
+	}{
+		{"  - name: a\n    action: block\n    images:\n      require_tag: true\n", `unsupported action "block"`},
+		{"  - name: a\n    kinds: [Pod]\n    images:\n      require_tag: true\n", `unsupported kind "Pod"`},
+		{"  - name: a\n", "has no checks"},
+		{"  - name: a\n    replicas:\n      min: 5\n      max: 2\n", "not a valid range"},
+		{"  - name: a\n    images:\n      require_tag: true\n  - name: a\n    images:\n      require_tag: true\n", `duplicate rule name "a"`},
+		{"  - name: a\n    resources:\n      max_cpu: lots\n", `malformed quantity "lots"`},
+	}
+	for _, test := range tests {
+		manifest := "apiVersion: v1\nkind: Policy\nmetadata:\n  name: p\nspec:\n  rules:\n" + test.rules
+		_, err := tianniu.DecodeManifests(strings.NewReader(manifest))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Expected error containing '%s', got %v", test.err, err)
+		}
+	}
+
+	if _, err := tianniu.LoadPolicies("../examples/policies/guardrails.yaml"); err != nil {
+		t.Errorf("Failed to load the example policies: %v", err)
+	}
+}
+
+// Test enforcing policies as server middleware
+func TestPolicyMiddleware(t *testing.T) {
+	policies := loadTestPolicies(t)
+	var received []string
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		received = append(received, r.Method+" "+r.URL.Path+" "+body["name"].(string))
+		w.WriteHeader(http.StatusCreated)
+	})
+	server := httptest.NewServer(policies.Middleware("production", api))
+	defer server.Close()
+
+	send := func(method, path string, body interface{}) *http.Response {
+		data, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, server.URL+path, bytes.NewReader(data))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		return resp
+	}
+
+	resp := send("POST", "/api/v1/deployments", policyDeployment("production"))
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected 403, got %d", resp.StatusCode)
+	}
+	var errResp struct {
+		Error tianniu.APIError `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&errResp)
+	resp.Body.Close()
+	if errResp.Error.Code != "POLICY_DENIED" || !strings.Contains(errResp.Error.Message, "no-debug-logging") {
+		t.Errorf("Unexpected error response %+v", errResp.Error)
+	}
+	if len(resp.Header.Values("Warning")) != 1 {
+		t.Errorf("Expected one Warning header, got %v", resp.Header.Values("Warning"))
+	}
+
+	resp = send("PUT", "/api/v1/deployments/d1", policyDeployment("staging"))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || len(resp.Header.Values("Warning")) != 1 {
+		t.Errorf("Expected the staging update to pass with a warning, got %d %v", resp.StatusCode, resp.Header)
+	}
+
+	opts := tianniu.ContainerCreateOptions{Name: "redis", Image: "redis:7.2"}
+	resp = send("POST", "/api/v1/containers", opts)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected the container to be denied, got %d", resp.StatusCode)
+	}
+
+	// Scaling below the minimum is warned about
+	resp = send("POST", "/api/v1/deployments/d1/scale", map[string]interface{}{"name": "scale", "replicas": 1})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || len(resp.Header.Values("Warning")) != 1 {
+		t.Errorf("Expected scale to pass with a warning, got %d %v", resp.StatusCode, resp.Header)
+	}
+	resp = send("POST", "/api/v1/deployments/d1/scale", map[string]interface{}{"name": "scale", "replicas": 3})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || len(resp.Header.Values("Warning")) != 0 {
+		t.Errorf("Expected scale to pass without warnings, got %d %v", resp.StatusCode, resp.Header)
+	}
+
+	// Other requests are not checked
+	resp = send("POST", "/api/v1/deployments/d1/rollback", map[string]interface{}{"name": "rollback"})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("Expected rollback to pass, got %d", resp.StatusCode)
+	}
+
+	if strings.Join(received, "; ") != "PUT /api/v1/deployments/d1 api-backend; POST /api/v1/deployments/d1/scale scale; POST /api/v1/deployments/d1/scale scale; POST /api/v1/deployments/d1/rollback rollback" {
+		t.Errorf("Unexpected requests reached the API: %v", received)
+	}
+}
@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+// Test parsing quantities in every supported form to their canonical string
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		input     string
+		canonical string
+		milli     int64
+	}{
+		{"1.0", "1", 1000},
+		{"0.5", "500m", 500},
+		{"500m", "500m", 500},
+		{"2", "2", 2000},
+		{"0.0001", "1m", 1},
+		{"512Mi", "512Mi", 512 << 20 * 1000},
+		{"1Gi", "1Gi", 1 << 30 * 1000},
+		{"1024Mi", "1Gi", 1 << 30 * 1000},
+		{"1.5Gi", "1536Mi", 1536 << 20 * 1000},
+		{"512MB", "512MB", 512e9},
+		{"8GB", "8GB", 8e12},
+		{"8000MB", "8GB", 8e12},
+		{"1.5GB", "1500MB", 1.5e12},
+		{"2k", "2k", 2e6},
+		{"-250m", "-250m", -250},
+		{"0", "0", 0},
+	}
+
+	for _, test := range tests {
+		q, err := tianniu.ParseQuantity(test.input)
+		if err != nil {
+			t.Errorf("ParseQuantity(%q) failed: %v", test.input, err)
+			continue
+		}
+		if q.String() != test.canonical || q.MilliValue() != test.milli {
+			t.Errorf("ParseQuantity(%q) = %s (%dm), expected %s (%dm)", test.input, q, q.MilliValue(), test.canonical, test.milli)
+		}
+	}
+
+	for _, input := range []string{"", "abc", "1.2.3", "512 MB", "1Zi", "1e3", "99999999999PB"} {
+		if _, err := tianniu.ParseQuantity(input); err == nil {
+			t.Errorf("Expected ParseQuantity(%q) to fail", input)
+		}
+	}
+}
+
+// Test arithmetic and comparison across units
+func TestQuantityArithmetic(t *testing.T) {
+	mi := tianniu.MustParseQuantity("512Mi")
+	mb := tianniu.MustParseQuantity("512MB")
+	if mi.Cmp(mb) <= 0 {
+		t.Errorf("Expected 512Mi > 512MB")
+	}
+	if tianniu.MustParseQuantity("1Gi").Cmp(tianniu.MustParseQuantity("1024Mi")) != 0 {
+		t.Errorf("Expected 1Gi == 1024Mi")
+	}
+	if tianniu.MustParseQuantity("0.5").Cmp(tianniu.MustParseQuantity("500m")) != 0 {
+		t.Errorf("Expected 0.5 == 500m")
+	}
+
+	if sum := mi.Add(mi); sum.String() != "1Gi" {
+		t.Errorf("Expected 512Mi + 512Mi = 1Gi, got %s", sum)
+	}
+	if sum := mi.Add(mb); sum.Value() != 512<<20+512e6 || sum.Format() != tianniu.BinarySI {
+		t.Errorf("Unexpected 512Mi + 512MB = %s", sum)
+	}
+	if sum := (tianniu.Quantity{}).Add(mb); sum.String() != "512MB" {
+		t.Errorf("Expected the sum of an unset quantity to keep the other's unit, got %s", sum)
+	}
+	if diff := tianniu.MustParseQuantity("1").Sub(tianniu.MustParseQuantity("250m")); diff.String() != "750m" {
+		t.Errorf("Expected 1 - 250m = 750m, got %s", diff)
+	}
+	if scaled := tianniu.MustParseQuantity("250m").Scale(3); scaled.String() != "750m" {
+		t.Errorf("Expected 250m * 3 = 750m, got %s", scaled)
+	}
+	if scaled := tianniu.MustParseQuantity("1Gi").Scale(0.5); scaled.String() != "512Mi" {
+		t.Errorf("Expected 1Gi * 0.5 = 512Mi, got %s", scaled)
+	}
+}
+
+// Test that quantities decode from strings and numbers and encode as the API
+// writes them
+func TestQuantityJSON(t *testing.T) {
+	var limits tianniu.ContainerLimits
+	if err := json.Unmarshal([]byte(`{"cpu": 1.5, "memory": "1024Mi"}`), &limits); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	data, err := json.Marshal(limits)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(data) != `{"cpu":"1.5","memory":"1Gi"}` {
+		t.Errorf("Unexpected JSON %s", data)
+	}
+
+	// CPU goes out in decimal cores, as in the API's own requests and responses
+	for in, want := range map[string]string{"500m": `"0.5"`, "1": `"1.0"`, "2.0": `"2.0"`, "50m": `"0.05"`, "1250m": `"1.25"`, "-0.5": `"-0.5"`, "2k": `"2k"`, "512MB": `"512MB"`} {
+		if data, err := json.Marshal(tianniu.MustParseQuantity(in)); err != nil || string(data) != want {
+			t.Errorf("Expected %s to encode as %s, got %s (%v)", in, want, data, err)
+		}
+	}
+
+	// null is unset, like the empty string
+	if err := json.Unmarshal([]byte(`{"cpu": null, "memory": ""}`), &limits); err != nil {
+		t.Fatalf("Unmarshal of null failed: %v", err)
+	}
+	if !limits.CPU.IsZero() || !limits.Memory.IsZero() {
+		t.Errorf("Expected null and empty quantities to be unset, got %s and %s", limits.CPU, limits.Memory)
+	}
+	if data, _ := json.Marshal(limits); string(data) != `{}` {
+		t.Errorf("Expected unset quantities to be omitted, got %s", data)
+	}
+
+	if err := json.Unmarshal([]byte(`{"cpu": "lots"}`), &limits); err == nil {
+		t.Error("Expected a malformed quantity to fail to decode")
+	}
+
+	data, err = json.Marshal(tianniu.ResourceList{Memory: tianniu.MustParseQuantity("256Mi")})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(data) != `{"memory":"256Mi"}` {
+		t.Errorf("Expected the unset CPU to be omitted, got %s", data)
+	}
+}
+
+// Test converting quota amounts to quantities
+func TestResourceQuotaQuantity(t *testing.T) {
+	cpu := tianniu.ResourceQuota{ResourceType: "cpu", Limit: 150, Used: 12.5, Unit: "cores"}
+	if q, err := cpu.Quantity(cpu.Used); err != nil || q.String() != "12500m" {
+		t.Errorf("Expected 12500m, got %v (%v)", q, err)
+	}
+
+	memory := tianniu.ResourceQuota{ResourceType: "memory", Limit: 512, Unit: "GB"}
+	q, err := memory.Quantity(memory.Limit)
+	if err != nil || q.Cmp(tianniu.MustParseQuantity("512000MB")) != 0 {
+		t.Errorf("Expected 512GB, got %v (%v)", q, err)
+	}
+
+	network := tianniu.ResourceQuota{ResourceType: "network", Limit: 100, Unit: "Mbps"}
+	if _, err := network.Quantity(network.Limit); err == nil {
+		t.Error("Expected Mbps to have no quantity")
+	}
+}
@@ -0,0 +1,623 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+// Mock server answering the documented resource responses
+func setupResourcesMockServer(t *testing.T) *httptest.Server {
+	handler := http.NewServeMux()
+
+	handler.HandleFunc("/api/v1/resources/quotas", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("namespace") != "production" {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"code": "NAMESPACE_NOT_FOUND", "message": "Namespace not found"}})
+			return
+		}
+		quotas := []tianniu.ResourceQuota{
+			{ResourceType: "cpu", Limit: 100, Used: 45, Available: 55, Unit: "cores"},
+			{ResourceType: "memory", Limit: 256, Used: 128, Available: 128, Unit: "GB"},
+			{ResourceType: "network", Limit: 100, Used: 25, Available: 75, Unit: "Mbps"},
+		}
+		if rt := r.URL.Query().Get("resource_type"); rt != "" {
+			for _, q := range quotas {
+				if q.ResourceType == rt {
+					quotas = []tianniu.ResourceQuota{q}
+				}
+			}
+		}
+		json.NewEncoder(w).Encode(tianniu.NamespaceQuotas{Namespace: "production", Quotas: quotas})
+	})
+
+	handler.HandleFunc("/api/v1/resources/quotas/production", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var body map[string][]map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		want := []map[string]interface{}{
+			{"resource_type": "cpu", "limit": 150.0},
+			{"resource_type": "memory", "limit": 512.0},
+		}
+		if !reflect.DeepEqual(body["quotas"], want) {
+			t.Errorf("Unexpected quota update %v", body)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"namespace": "production",
+			"updated_quotas": []tianniu.ResourceQuota{
+				{ResourceType: "cpu", Limit: 150, Used: 45, Available: 105, Unit: "cores"},
+				{ResourceType: "memory", Limit: 512, Used: 128, Available: 384, Unit: "GB"},
+			},
+			"message": "Resource quotas updated successfully",
+		})
+	})
+
+	// worker-01 loses one pod per GET once drained; worker-02 never does;
+	// worker-03 keeps its DaemonSet pod when the drain is done
+	var mu sync.Mutex
+	draining := false
+	pods := []tianniu.NodePod{
+		{Name: "web-frontend-5d8fb97d55-2xvqz", Namespace: "production", Status: "running", CPURequest: tianniu.MustParseQuantity("0.5"), MemoryRequest: tianniu.MustParseQuantity("512Mi")},
+		{Name: "api-backend-7c9d8f6b4-k2l3m", Namespace: "production", Status: "running"},
+		{Name: "redis-0", Namespace: "cache", Status: "running"},
+	}
+	handler.HandleFunc("/api/v1/resources/nodes", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("role") != "worker" || r.URL.Query().Get("limit") != "50" {
+			t.Errorf("Unexpected node list query %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"total": 1, "limit": 50, "offset": 0, "nodes": [{
+			"id": "node-1", "name": "worker-01.palo.prod.baidu.com", "status": "ready", "role": "worker",
+			"created_at": "2023-01-15T08:30:00Z", "ip_address": "10.0.1.101",
+			"resources": {
+				"cpu": {"capacity": 32, "allocatable": 30, "allocated": 25, "available": 5},
+				"memory": {"capacity": 128, "allocatable": 120, "allocated": 100, "available": 20, "unit": "GB"},
+				"pods": {"capacity": 110, "allocatable": 110, "allocated": 85, "available": 25}
+			},
+			"conditions": [{"type": "Ready", "status": "True", "last_transition_time": "2023-05-10T12:45:30Z", "reason": "KubeletReady"}],
+			"labels": {"region": "beijing", "zone": "zone-a", "instance-type": "high-memory"}
+		}]}`))
+	})
+	handler.HandleFunc("/api/v1/resources/nodes/node-1", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		status := "ready"
+		if draining && len(pods) > 0 {
+			pods = pods[1:]
+			status = "draining"
+		}
+		if draining && len(pods) == 0 {
+			status = "cordoned"
+		}
+		w.Write([]byte(`{"id": "node-1", "name": "worker-01.palo.prod.baidu.com", "status": "` + status + `",
+			"system_info": {"kernel_version": "5.4.0-1045-aws", "architecture": "amd64"}, "taints": [], "pods": `))
+		json.NewEncoder(w).Encode(pods)
+		w.Write([]byte("}"))
+	})
+	handler.HandleFunc("/api/v1/resources/nodes/node-1/drain", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Query().Get("grace_period") != "60" || r.URL.Query().Get("force") != "true" {
+			t.Errorf("Unexpected drain request %s %s", r.Method, r.URL.RawQuery)
+		}
+		mu.Lock()
+		draining = true
+		mu.Unlock()
+		w.Write([]byte(`{"id": "node-1", "name": "worker-01.palo.prod.baidu.com", "status": "draining", "message": "Node drain operation has started"}`))
+	})
+	handler.HandleFunc("/api/v1/resources/nodes/node-1/cordon", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": "node-1", "name": "worker-01.palo.prod.baidu.com", "status": "cordoned", "message": "Node has been cordoned successfully"}`))
+	})
+	handler.HandleFunc("/api/v1/resources/nodes/node-2", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": "node-2", "status": "draining", "pods": [{"name": "stuck", "namespace": "batch"}]}`))
+	})
+	handler.HandleFunc("/api/v1/resources/nodes/node-2/drain", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": "node-2", "status": "draining"}`))
+	})
+	node3Drained := false
+	handler.HandleFunc("/api/v1/resources/nodes/node-3", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if node3Drained {
+			w.Write([]byte(`{"id": "node-3", "status": "cordoned", "message": "Node drained", "pods": [{"name": "node-exporter-x7k2p", "namespace": "kube-system"}]}`))
+			return
+		}
+		w.Write([]byte(`{"id": "node-3", "status": "ready", "pods": [{"name": "report-1", "namespace": "batch"}, {"name": "node-exporter-x7k2p", "namespace": "kube-system"}]}`))
+	})
+	handler.HandleFunc("/api/v1/resources/nodes/node-3/drain", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		node3Drained = true
+		mu.Unlock()
+		w.Write([]byte(`{"id": "node-3", "status": "draining"}`))
+	})
+
+	// Hourly points of the requested range, both ends included, so that
+	// consecutive windows overlap by one point. CPU usage is the hour of the
+	// day; the namespace has a quota of 50 and no percentages.
+	usage := func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		start, err1 := time.Parse(time.RFC3339, query.Get("start_time"))
+		end, err2 := time.Parse(time.RFC3339, query.Get("end_time"))
+		if err1 != nil || err2 != nil {
+			t.Errorf("Unexpected usage query %s", r.URL.RawQuery)
+		}
+		mu.Lock()
+		usagePeriods = append(usagePeriods, query.Get("period"))
+		mu.Unlock()
+		cpu := tianniu.UsageSeries{Capacity: 100}
+		network := tianniu.UsageSeries{Capacity: 1000, Unit: "Mbps"}
+		namespace := strings.TrimPrefix(r.URL.Path, "/api/v1/resources/usage/")
+		if namespace != r.URL.Path {
+			cpu = tianniu.UsageSeries{Quota: 50}
+		}
+		for at := start.Truncate(time.Hour); !at.After(end); at = at.Add(time.Hour) {
+			point := tianniu.UsagePoint{Timestamp: at, Usage: float64(at.Hour())}
+			if namespace == r.URL.Path {
+				point.UsagePercent = float64(at.Hour())
+			}
+			cpu.DataPoints = append(cpu.DataPoints, point)
+			network.DataPoints = append(network.DataPoints, tianniu.UsagePoint{Timestamp: at, Ingress: 300, Egress: 200, Total: 500, UsagePercent: 50})
+		}
+		json.NewEncoder(w).Encode(tianniu.UsageReport{
+			Period: query.Get("period"), StartTime: start, EndTime: end, Interval: "1h",
+			Resources: map[string]tianniu.UsageSeries{"cpu": cpu, "network": network, "storage": {Capacity: 10000}},
+		})
+	}
+	handler.HandleFunc("/api/v1/resources/usage", usage)
+	handler.HandleFunc("/api/v1/resources/usage/", usage)
+
+	// The recommendations of the API documentation, with the deployments
+	// they target. web-frontend has had its memory limit changed since.
+	handler.HandleFunc("/api/v1/resources/recommendations", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("namespace") != "production" {
+			t.Errorf("Unexpected recommendations query %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"namespace": "production", "recommendations": [
+			{"id": "rec-1", "resource_type": "cpu", "recommendation_type": "resize",
+				"target": {"type": "deployment", "name": "api-backend", "namespace": "production"},
+				"current_value": {"request": 2.0, "limit": 4.0}, "recommended_value": {"request": 1.0, "limit": 2.0},
+				"potential_savings": {"cpu": 2.0, "cost": "¥200/month"}, "confidence": "high",
+				"reason": "CPU utilization has been consistently below 30% for the past 30 days",
+				"observation_period": {"start_time": "2023-04-15T00:00:00Z", "end_time": "2023-05-15T00:00:00Z"}},
+			{"id": "rec-2", "resource_type": "memory", "recommendation_type": "resize",
+				"target": {"type": "deployment", "name": "web-frontend", "namespace": "production"},
+				"current_value": {"request": "1Gi", "limit": "2Gi"}, "recommended_value": {"request": "512Mi", "limit": "1Gi"},
+				"potential_savings": {"memory": "1Gi", "cost": "¥100/month"}, "confidence": "medium"},
+			{"id": "rec-3", "resource_type": "cpu", "recommendation_type": "consolidate",
+				"target": {"type": "node_group", "name": "worker-nodes", "namespace": "system"},
+				"current_value": {"nodes": 10, "total_cpu": 320, "used_cpu": 160}, "recommended_value": {"nodes": 8, "total_cpu": 256, "used_cpu": 160},
+				"potential_savings": {"nodes": 2, "cpu": 64, "cost": "¥1000/month"}, "confidence": "high"}
+		]}`))
+	})
+	handler.HandleFunc("/api/v1/resources/recommendations/rec-1/apply", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Write([]byte(`{"id": "rec-1", "status": "applying", "message": "Resource optimization is being applied", "estimated_completion_time": "2023-05-16T15:30:00Z"}`))
+	})
+	cpu := tianniu.ResourceRequirements{
+		Requests: tianniu.ResourceList{CPU: tianniu.MustParseQuantity("2")},
+		Limits:   tianniu.ResourceList{CPU: tianniu.MustParseQuantity("4")},
+	}
+	memory := tianniu.ResourceRequirements{
+		Requests: tianniu.ResourceList{Memory: tianniu.MustParseQuantity("1Gi")},
+		Limits:   tianniu.ResourceList{Memory: tianniu.MustParseQuantity("1536Mi")},
+	}
+	deployments := []tianniu.Deployment{
+		{ID: "d1", Name: "web-frontend", Environment: "production", Containers: []tianniu.DeploymentContainer{{Name: "web", Image: "nginx:1.25", Resources: memory}}},
+		{ID: "d2", Name: "api-backend", Environment: "production", Containers: []tianniu.DeploymentContainer{
+			{Name: "api", Image: "api:2.0.1", Resources: cpu},
+			{Name: "sidecar", Image: "envoy:1.26", Resources: cpu},
+		}},
+	}
+	// Like the API, the list leaves out containers, which only come with
+	// the details of a deployment
+	handler.HandleFunc("/api/v1/deployments", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("environment") != "production" {
+			t.Errorf("Unexpected deployments query %s", r.URL.RawQuery)
+		}
+		list := tianniu.DeploymentList{Total: len(deployments)}
+		for _, d := range deployments {
+			list.Deployments = append(list.Deployments, tianniu.Deployment{ID: d.ID, Name: d.Name, Environment: d.Environment})
+		}
+		json.NewEncoder(w).Encode(list)
+	})
+	handler.HandleFunc("/api/v1/deployments/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/api/v1/deployments/")
+		for _, d := range deployments {
+			if d.ID == id {
+				json.NewEncoder(w).Encode(d)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error": {"code": "NOT_FOUND", "message": "deployment not found"}}`))
+	})
+
+	return httptest.NewServer(handler)
+}
+
+// usagePeriods records the periods of the usage requests
+var usagePeriods []string
+
+// Test getting the quotas of a namespace and their utilization
+func TestResourceQuotas(t *testing.T) {
+	server := setupResourcesMockServer(t)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	quotas, err := client.Resources.Quotas(context.Background(), tianniu.QuotaOptions{Namespace: "production"})
+	if err != nil {
+		t.Fatalf("Quotas failed: %v", err)
+	}
+	if quotas.Namespace != "production" || len(quotas.Quotas) != 3 {
+		t.Fatalf("Unexpected quotas %+v", quotas)
+	}
+	cpu := quotas.Quota("cpu")
+	if cpu == nil || cpu.UsagePercent() != 45 || cpu.Available != 55 {
+		t.Errorf("Unexpected cpu quota %+v", cpu)
+	}
+	if memory := quotas.Quota("memory"); memory == nil || memory.UsagePercent() != 50 {
+		t.Errorf("Unexpected memory quota %+v", memory)
+	}
+	if quotas.Quota("storage") != nil {
+		t.Error("Expected no storage quota")
+	}
+	if (tianniu.ResourceQuota{ResourceType: "gpu"}).UsagePercent() != 0 {
+		t.Error("Expected 0% usage without a limit")
+	}
+
+	quotas, err = client.Resources.Quotas(context.Background(), tianniu.QuotaOptions{Namespace: "production", ResourceType: "memory"})
+	if err != nil || len(quotas.Quotas) != 1 || quotas.Quotas[0].ResourceType != "memory" {
+		t.Errorf("Unexpected memory quotas %+v, %v", quotas, err)
+	}
+	if _, err := client.Resources.Quotas(context.Background(), tianniu.QuotaOptions{Namespace: "missing"}); !tianniu.IsNotFound(err) {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+}
+
+// Test updating quota limits
+func TestUpdateResourceQuotas(t *testing.T) {
+	server := setupResourcesMockServer(t)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	manifest := &tianniu.ResourceQuotaManifest{
+		Metadata: tianniu.ObjectMeta{Name: "production"},
+		Spec:     tianniu.ResourceQuotaSpec{Limits: map[string]float64{"memory": 512, "cpu": 150}},
+	}
+	updated, err := client.Resources.UpdateQuotas(context.Background(), manifest.Quotas())
+	if err != nil {
+		t.Fatalf("UpdateQuotas failed: %v", err)
+	}
+	if updated.Namespace != "production" || len(updated.Quotas) != 2 || updated.Quota("cpu").Available != 105 {
+		t.Errorf("Unexpected updated quotas %+v", updated)
+	}
+
+	for _, q := range []*tianniu.NamespaceQuotas{
+		{Quotas: []tianniu.ResourceQuota{{ResourceType: "cpu", Limit: 1}}},
+		{Namespace: "production"},
+		{Namespace: "production", Quotas: []tianniu.ResourceQuota{{ResourceType: "cpu", Limit: -1}}},
+	} {
+		if _, err := client.Resources.UpdateQuotas(context.Background(), q); err == nil {
+			t.Errorf("Expected an error for %+v", q)
+		}
+	}
+}
+
+// Test listing and inspecting nodes
+func TestNodes(t *testing.T) {
+	server := setupResourcesMockServer(t)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	list, err := client.Nodes.List(context.Background(), tianniu.NodeListOptions{Role: "worker", Limit: 50})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if list.Total != 1 || len(list.Nodes) != 1 {
+		t.Fatalf("Unexpected node list %+v", list)
+	}
+	node := list.Nodes[0]
+	if node.Region() != "beijing" || node.Zone() != "zone-a" || node.InstanceType() != "high-memory" {
+		t.Errorf("Unexpected node labels %v", node.Labels)
+	}
+	if node.Resources.Memory.Unit != "GB" || node.Resources.Pods.Available != 25 || int(node.Resources.CPU.AllocatedPercent()) != 83 {
+		t.Errorf("Unexpected node resources %+v", node.Resources)
+	}
+	if ready := node.Condition("Ready"); ready == nil || ready.Status != "True" || ready.LastTransitionTime.IsZero() {
+		t.Errorf("Unexpected Ready condition %+v", ready)
+	}
+	if node.Condition("DiskPressure") != nil {
+		t.Error("Expected no DiskPressure condition")
+	}
+
+	got, err := client.Nodes.Get(context.Background(), "node-1")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got.SystemInfo == nil || got.SystemInfo.Architecture != "amd64" || len(got.Pods) != 3 ||
+		got.Pods[0].CPURequest.String() != "500m" || got.Pods[0].MemoryRequest.String() != "512Mi" {
+		t.Errorf("Unexpected node %+v", got)
+	}
+	// Unset requests and limits are left out rather than sent as "0"
+	if data, err := json.Marshal(got.Pods[1]); err != nil || string(data) != `{"name":"api-backend-7c9d8f6b4-k2l3m","namespace":"production","status":"running"}` {
+		t.Errorf("Unexpected pod JSON %s, %v", data, err)
+	}
+
+	cordoned, err := client.Nodes.Cordon(context.Background(), "node-1")
+	if err != nil || cordoned.Status != "cordoned" || cordoned.Message == "" {
+		t.Errorf("Unexpected cordon result %+v, %v", cordoned, err)
+	}
+	if _, err := client.Nodes.Uncordon(context.Background(), "node-9"); !tianniu.IsNotFound(err) {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+}
+
+// Test draining a node, with progress reports and a timeout
+func TestDrainNode(t *testing.T) {
+	server := setupResourcesMockServer(t)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	var reports []tianniu.DrainProgress
+	result, err := client.Nodes.Drain(context.Background(), "node-1", tianniu.DrainOptions{
+		GracePeriod:  time.Minute,
+		Force:        true,
+		PollInterval: time.Millisecond,
+		Progress:     func(p tianniu.DrainProgress) { reports = append(reports, p) },
+	})
+	if err != nil {
+		t.Fatalf("Drain failed: %v", err)
+	}
+	if len(result.Evicted) != 3 || result.Evicted[2].Name != "redis-0" || len(result.Node.Pods) != 0 {
+		t.Errorf("Unexpected drain result %+v", result)
+	}
+	// The pod list shrinks by one per poll
+	if len(reports) != 3 || len(reports[0].Evicted) != 1 || len(reports[0].Remaining) != 2 || len(reports[2].Remaining) != 0 {
+		t.Errorf("Unexpected progress reports %+v", reports)
+	}
+
+	result, err = client.Nodes.Drain(context.Background(), "node-2", tianniu.DrainOptions{Timeout: 50 * time.Millisecond, PollInterval: 10 * time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "node node-2 still has 1 pods") {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+	if result == nil || len(result.Evicted) != 0 || result.Node.Status != "draining" {
+		t.Errorf("Expected the result so far, got %+v", result)
+	}
+
+	// A pod the server never evicts does not hold the drain up once the
+	// node is no longer draining
+	start := time.Now()
+	reports = nil
+	result, err = client.Nodes.Drain(context.Background(), "node-3", tianniu.DrainOptions{
+		PollInterval: time.Millisecond,
+		Progress:     func(p tianniu.DrainProgress) { reports = append(reports, p) },
+	})
+	if err != nil {
+		t.Fatalf("Drain failed: %v", err)
+	}
+	if len(result.Evicted) != 1 || result.Evicted[0].Name != "report-1" ||
+		len(result.Remaining) != 1 || result.Remaining[0].Name != "node-exporter-x7k2p" || result.Node.Status != "cordoned" {
+		t.Errorf("Unexpected drain result %+v", result)
+	}
+	if len(reports) != 1 || len(reports[0].Remaining) != 1 {
+		t.Errorf("Unexpected progress reports %+v", reports)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the drain to end with the server's, took %v", elapsed)
+	}
+}
+
+// Test fetching usage over ranges of any length and summarizing it
+func TestUsageRange(t *testing.T) {
+	server := setupResourcesMockServer(t)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	// A whole day fits one request
+	start := time.Date(2023, 5, 15, 0, 0, 0, 0, time.UTC)
+	usagePeriods = nil
+	report, err := client.Resources.UsageRange(context.Background(), "", start, start.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("UsageRange failed: %v", err)
+	}
+	if !reflect.DeepEqual(usagePeriods, []string{"day"}) || report.Period != "day" || report.Interval != "1h" {
+		t.Errorf("Unexpected requests %v for report %+v", usagePeriods, report)
+	}
+	cpu := report.Resources["cpu"]
+	if len(cpu.DataPoints) != 24 || cpu.Limit() != 100 {
+		t.Errorf("Expected the 24 hours of the day, got %d points", len(cpu.DataPoints))
+	}
+
+	// Hours 0 to 23: peak 23, average 11.5, p95 the 23rd of 24 values
+	summaries := report.Summaries()
+	if len(summaries) != 2 || summaries[0].ResourceType != "cpu" || summaries[1].ResourceType != "network" {
+		t.Fatalf("Unexpected summaries %+v", summaries)
+	}
+	want := tianniu.UsageSummary{
+		ResourceType: "cpu", Limit: 100, Samples: 24,
+		Peak: 23, PeakTime: start.Add(23 * time.Hour), PeakPercent: 23,
+		Average: 11.5, AveragePercent: 11.5, P95: 22, P95Percent: 22,
+	}
+	if !reflect.DeepEqual(summaries[0], want) {
+		t.Errorf("Got summary %+v, want %+v", summaries[0], want)
+	}
+	if network := summaries[1]; network.Peak != 500 || network.Average != 500 || network.Unit != "Mbps" {
+		t.Errorf("Unexpected network summary %+v", network)
+	}
+
+	// 45 days are fetched as two months, without the overlapping point
+	usagePeriods = nil
+	report, err = client.Resources.UsageRange(context.Background(), "production", start, start.Add(45*24*time.Hour))
+	if err != nil {
+		t.Fatalf("UsageRange failed: %v", err)
+	}
+	cpu = report.Resources["cpu"]
+	if !reflect.DeepEqual(usagePeriods, []string{"month", "month"}) || len(cpu.DataPoints) != 45*24 || report.Namespace != "production" {
+		t.Errorf("Unexpected requests %v with %d points", usagePeriods, len(cpu.DataPoints))
+	}
+	for i := 1; i < len(cpu.DataPoints); i++ {
+		if !cpu.DataPoints[i].Timestamp.After(cpu.DataPoints[i-1].Timestamp) {
+			t.Fatalf("Points %d and %d are out of order", i-1, i)
+		}
+	}
+	// Percentages are computed from the quota when the API leaves them out
+	if summary := report.Summaries()[0]; summary.Limit != 50 || summary.PeakPercent != 46 {
+		t.Errorf("Unexpected namespace summary %+v", summary)
+	}
+
+	if _, err := client.Resources.UsageRange(context.Background(), "", start, start); err == nil {
+		t.Error("Expected an error for an empty range")
+	}
+}
+
+// Test listing recommendations and selecting them by policy
+func TestRecommendations(t *testing.T) {
+	server := setupResourcesMockServer(t)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	list, err := client.Resources.Recommendations(context.Background(), tianniu.RecommendationListOptions{Namespace: "production"})
+	if err != nil {
+		t.Fatalf("Recommendations failed: %v", err)
+	}
+	if list.Namespace != "production" || len(list.Recommendations) != 3 {
+		t.Fatalf("Unexpected recommendations %+v", list)
+	}
+	rec := list.Recommendations[0]
+	if rec.Target.String() != "deployment/production/api-backend" || rec.ObservationPeriod == nil || rec.ObservationPeriod.EndTime.IsZero() {
+		t.Errorf("Unexpected recommendation %+v", rec)
+	}
+	if q, ok, err := rec.RecommendedValue.Quantity("request"); !ok || err != nil || q.String() != "1" {
+		t.Errorf("Unexpected recommended request %v, %v, %v", q, ok, err)
+	}
+	if amount, currency, ok := rec.MonthlySavings(); !ok || amount != 200 || currency != "¥" {
+		t.Errorf("Unexpected savings %v %q %v", amount, currency, ok)
+	}
+	if _, _, ok := (&tianniu.Recommendation{}).MonthlySavings(); ok {
+		t.Error("Expected no savings without a cost")
+	}
+
+	ids := func(recs []tianniu.Recommendation) []string {
+		var ids []string
+		for _, r := range recs {
+			ids = append(ids, r.ID)
+		}
+		return ids
+	}
+	for _, tc := range []struct {
+		policy tianniu.RecommendationPolicy
+		want   []string
+	}{
+		{tianniu.RecommendationPolicy{}, []string{"rec-1", "rec-2", "rec-3"}},
+		{tianniu.RecommendationPolicy{MinConfidence: "high"}, []string{"rec-1", "rec-3"}},
+		{tianniu.RecommendationPolicy{ResourceTypes: []string{"memory"}}, []string{"rec-2"}},
+		{tianniu.RecommendationPolicy{RecommendationTypes: []string{"resize"}, MinMonthlySavings: 150}, []string{"rec-1"}},
+		{tianniu.RecommendationPolicy{Namespaces: []string{"staging"}}, nil},
+	} {
+		if got := ids(tc.policy.Select(list.Recommendations)); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Policy %+v selected %v, want %v", tc.policy, got, tc.want)
+		}
+	}
+	for _, p := range []tianniu.RecommendationPolicy{{MinConfidence: "certain"}, {MinMonthlySavings: -1}} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("Expected an error for policy %+v", p)
+		}
+	}
+}
+
+// Test reviewing recommendations against their deployments and applying them
+func TestReviewRecommendations(t *testing.T) {
+	server := setupResourcesMockServer(t)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	list, err := client.Resources.Recommendations(context.Background(), tianniu.RecommendationListOptions{Namespace: "production"})
+	if err != nil {
+		t.Fatalf("Recommendations failed: %v", err)
+	}
+
+	// api-backend has two containers and rec-1 does not say which it is for
+	if _, err := client.Resources.Review(context.Background(), &list.Recommendations[0]); err == nil ||
+		!strings.Contains(err.Error(), "does not name which of the 2 containers of deployment api-backend") {
+		t.Errorf("Expected a recommendation without container to be refused, got %v", err)
+	}
+
+	// Naming the container halves its CPU and leaves the sidecar alone
+	api := list.Recommendations[0]
+	api.Target.Container = "api"
+	review, err := client.Resources.Review(context.Background(), &api)
+	if err != nil {
+		t.Fatalf("Review failed: %v", err)
+	}
+	var changes []string
+	for _, c := range review.Changes {
+		if c.Stale {
+			t.Errorf("Unexpected stale change %s", c)
+		}
+		changes = append(changes, c.String())
+	}
+	want := []string{
+		"container api: resources.requests.cpu 2 -> 1",
+		"container api: resources.limits.cpu 4 -> 2",
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("Got changes %q, want %q", changes, want)
+	}
+	if review.Deployment.Containers[0].Resources.Limits.CPU.String() != "4" || review.Proposed.Containers[0].Resources.Limits.CPU.String() != "2" ||
+		review.Proposed.Containers[1].Resources.Limits.CPU.String() != "4" {
+		t.Errorf("Expected a copy with only the api container resized, got %+v and %+v", review.Deployment.Containers, review.Proposed.Containers)
+	}
+	api.Target.Container = "db"
+	if _, _, err := api.ApplyTo(review.Deployment); err == nil || !strings.Contains(err.Error(), "targets container db") {
+		t.Errorf("Expected a missing container to be refused, got %v", err)
+	}
+
+	// The memory limit of web-frontend is no longer the 2Gi the
+	// recommendation was made for
+	review, err = client.Resources.Review(context.Background(), &list.Recommendations[1])
+	if err != nil {
+		t.Fatalf("Review failed: %v", err)
+	}
+	if len(review.Changes) != 2 || review.Changes[0].Stale || !review.Changes[1].Stale || review.Changes[1].Current.String() != "1536Mi" {
+		t.Errorf("Unexpected changes %+v", review.Changes)
+	}
+
+	// Consolidating nodes changes no deployment
+	review, err = client.Resources.Review(context.Background(), &list.Recommendations[2])
+	if err != nil || review.Deployment != nil || len(review.Changes) != 0 {
+		t.Errorf("Unexpected node group review %+v, %v", review, err)
+	}
+	if _, _, err := list.Recommendations[2].ApplyTo(&tianniu.Deployment{Name: "worker-nodes"}); err == nil {
+		t.Error("Expected an error applying a consolidation to a deployment")
+	}
+	if _, _, err := list.Recommendations[0].ApplyTo(&tianniu.Deployment{Name: "web-frontend"}); err == nil {
+		t.Error("Expected an error applying a recommendation to another deployment")
+	}
+	missing := list.Recommendations[0]
+	missing.Target.Name = "gone"
+	if _, err := client.Resources.Review(context.Background(), &missing); err == nil {
+		t.Error("Expected an error for a missing deployment")
+	}
+
+	result, err := client.Resources.ApplyRecommendation(context.Background(), "rec-1")
+	if err != nil {
+		t.Fatalf("ApplyRecommendation failed: %v", err)
+	}
+	if result.ID != "rec-1" || result.Status != "applying" || !result.EstimatedCompletionTime.Equal(time.Date(2023, 5, 16, 15, 30, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected apply result %+v", result)
+	}
+	if _, err := client.Resources.ApplyRecommendation(context.Background(), "rec-9"); !tianniu.IsNotFound(err) {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+}
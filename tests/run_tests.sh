@@ -23,8 +23,8 @@ run_tests() {
     
     echo -e "${YELLOW}Running $test_name tests...${NC}"
     
-    # Run the test
-    go test -v $test_file
+    # Run the test together with the shared helpers
+    go test -v ./helpers_test.go $test_file
     
     # Check the result
     if [ $? -eq 0 ]; then
@@ -68,18 +68,93 @@ deployment_result=$?
 run_tests ./container_test.go "Container"
 container_result=$?
 
+# Run SDK client tests
+run_tests ./client_test.go "Client"
+client_result=$?
+
 # Run database tests
 run_tests ./database_test.go "Database"
 database_result=$?
 
+# Run selector tests
+run_tests ./selector_test.go "Selector"
+selector_result=$?
+
+# Run secret provider tests
+run_tests ./secrets_test.go "Secrets"
+secrets_result=$?
+
+# Run manifest tests
+run_tests ./manifest_test.go "Manifest"
+manifest_result=$?
+
+# Run validation tests
+run_tests ./validate_test.go "Validation"
+validate_result=$?
+
+# Run quantity tests
+run_tests ./quantity_test.go "Quantity"
+quantity_result=$?
+
+# Run policy tests
+run_tests ./policy_test.go "Policy"
+policy_result=$?
+
+# Run kubernetes tests
+run_tests ./kubernetes_test.go "Kubernetes"
+kubernetes_result=$?
+
+# Run import tests
+run_tests ./import_test.go "Import"
+import_result=$?
+
+# Run cluster tests
+run_tests ./cluster_test.go "Cluster"
+cluster_result=$?
+
+# Run stats tests
+run_tests ./stats_test.go "Stats"
+stats_result=$?
+
+# Run health tests
+run_tests ./health_test.go "Health"
+health_result=$?
+
+# Run resources tests
+run_tests ./resources_test.go "Resources"
+resources_result=$?
+
+# Run mysql tests
+run_tests ./mysql_test.go "MySQL"
+mysql_result=$?
+
+# Run command line tests
+run_tests ./cli_test.go "CLI"
+cli_result=$?
+
 # Print summary
 echo -e "\n${YELLOW}Test Summary:${NC}"
 [ $deployment_result -eq 0 ] && echo -e "${GREEN}✓ Deployment tests passed${NC}" || echo -e "${RED}✗ Deployment tests failed${NC}"
 [ $container_result -eq 0 ] && echo -e "${GREEN}✓ Container tests passed${NC}" || echo -e "${RED}✗ Container tests failed${NC}"
+[ $client_result -eq 0 ] && echo -e "${GREEN}✓ Client tests passed${NC}" || echo -e "${RED}✗ Client tests failed${NC}"
 [ $database_result -eq 0 ] && echo -e "${GREEN}✓ Database tests passed${NC}" || echo -e "${RED}✗ Database tests failed${NC}"
+[ $selector_result -eq 0 ] && echo -e "${GREEN}✓ Selector tests passed${NC}" || echo -e "${RED}✗ Selector tests failed${NC}"
+[ $secrets_result -eq 0 ] && echo -e "${GREEN}✓ Secrets tests passed${NC}" || echo -e "${RED}✗ Secrets tests failed${NC}"
+[ $manifest_result -eq 0 ] && echo -e "${GREEN}✓ Manifest tests passed${NC}" || echo -e "${RED}✗ Manifest tests failed${NC}"
+[ $validate_result -eq 0 ] && echo -e "${GREEN}✓ Validation tests passed${NC}" || echo -e "${RED}✗ Validation tests failed${NC}"
+[ $quantity_result -eq 0 ] && echo -e "${GREEN}✓ Quantity tests passed${NC}" || echo -e "${RED}✗ Quantity tests failed${NC}"
+[ $policy_result -eq 0 ] && echo -e "${GREEN}✓ Policy tests passed${NC}" || echo -e "${RED}✗ Policy tests failed${NC}"
+[ $kubernetes_result -eq 0 ] && echo -e "${GREEN}✓ Kubernetes tests passed${NC}" || echo -e "${RED}✗ Kubernetes tests failed${NC}"
+[ $import_result -eq 0 ] && echo -e "${GREEN}✓ Import tests passed${NC}" || echo -e "${RED}✗ Import tests failed${NC}"
+[ $cluster_result -eq 0 ] && echo -e "${GREEN}✓ Cluster tests passed${NC}" || echo -e "${RED}✗ Cluster tests failed${NC}"
+[ $stats_result -eq 0 ] && echo -e "${GREEN}✓ Stats tests passed${NC}" || echo -e "${RED}✗ Stats tests failed${NC}"
+[ $health_result -eq 0 ] && echo -e "${GREEN}✓ Health tests passed${NC}" || echo -e "${RED}✗ Health tests failed${NC}"
+[ $resources_result -eq 0 ] && echo -e "${GREEN}✓ Resources tests passed${NC}" || echo -e "${RED}✗ Resources tests failed${NC}"
+[ $mysql_result -eq 0 ] && echo -e "${GREEN}✓ MySQL tests passed${NC}" || echo -e "${RED}✗ MySQL tests failed${NC}"
+[ $cli_result -eq 0 ] && echo -e "${GREEN}✓ CLI tests passed${NC}" || echo -e "${RED}✗ CLI tests failed${NC}"
 
 # Exit with error if any test failed
-if [ $deployment_result -ne 0 ] || [ $container_result -ne 0 ] || [ $database_result -ne 0 ]; then
+if [ $deployment_result -ne 0 ] || [ $container_result -ne 0 ] || [ $client_result -ne 0 ] || [ $database_result -ne 0 ] || [ $selector_result -ne 0 ] || [ $secrets_result -ne 0 ] || [ $manifest_result -ne 0 ] || [ $validate_result -ne 0 ] || [ $quantity_result -ne 0 ] || [ $policy_result -ne 0 ] || [ $kubernetes_result -ne 0 ] || [ $import_result -ne 0 ] || [ $cluster_result -ne 0 ] || [ $stats_result -ne 0 ] || [ $health_result -ne 0 ] || [ $resources_result -ne 0 ] || [ $mysql_result -ne 0 ] || [ $cli_result -ne 0 ]; then
     echo -e "\n${RED}Some tests failed!${NC}"
     exit 1
 else
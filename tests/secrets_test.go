@@ -0,0 +1,214 @@
+package tests
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+// Test env and file secret references
+func TestResolveEnvAndFileSecrets(t *testing.T) {
+	ctx := context.Background()
+
+	os.Setenv("TIANNIU_TEST_SECRET", "from-env")
+	defer os.Unsetenv("TIANNIU_TEST_SECRET")
+
+	for _, ref := range []string{"env:TIANNIU_TEST_SECRET", "env://TIANNIU_TEST_SECRET"} {
+		value, err := tianniu.ResolveSecret(ctx, ref)
+		if err != nil {
+			t.Fatalf("ResolveSecret(%s) failed: %v", ref, err)
+		}
+		if value != "from-env" {
+			t.Errorf("Expected 'from-env' for %s, got '%s'", ref, value)
+		}
+	}
+
+	if _, err := tianniu.ResolveSecret(ctx, "env:TIANNIU_TEST_UNSET"); err == nil {
+		t.Error("Expected unset variable to fail")
+	}
+
+	dir, err := ioutil.TempDir("", "tianniu-secrets")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "db-pass")
+	if err := ioutil.WriteFile(path, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	value, err := tianniu.ResolveSecret(ctx, "file://"+path)
+	if err != nil {
+		t.Fatalf("ResolveSecret(file) failed: %v", err)
+	}
+	if value != "s3cret" {
+		t.Errorf("Expected 's3cret', got '%s'", value)
+	}
+
+	if _, err := tianniu.ResolveSecret(ctx, "file:relative/path"); err == nil {
+		t.Error("Expected relative file reference to be rejected")
+	}
+}
+
+// Test the encrypted keystore and the keystore provider
+func TestKeystoreSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tianniu-keystore")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "keystore")
+	ks, err := tianniu.NewKeystore(path, "correct horse")
+	if err != nil {
+		t.Fatalf("NewKeystore failed: %v", err)
+	}
+	if err := ks.Set("mysql-prod-password", "tianniu_password"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := ks.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected keystore mode 0600, got %v", info.Mode().Perm())
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	if strings.Contains(string(data), "tianniu_password") {
+		t.Error("Keystore file contains the plaintext secret")
+	}
+
+	if _, err := tianniu.OpenKeystore(path, "wrong"); err == nil {
+		t.Error("Expected wrong passphrase to fail")
+	}
+
+	provider := &tianniu.KeystoreSecretProvider{Path: path, Passphrase: "correct horse"}
+	resolver := tianniu.NewSecretResolver()
+	resolver.Register("keystore", provider)
+
+	value, err := resolver.Resolve(context.Background(), "keystore:mysql-prod-password")
+	if err != nil {
+		t.Fatalf("Resolve(keystore) failed: %v", err)
+	}
+	if value != "tianniu_password" {
+		t.Errorf("Expected 'tianniu_password', got '%s'", value)
+	}
+
+	if _, err := resolver.Resolve(context.Background(), "keystore:missing"); err == nil {
+		t.Error("Expected missing keystore entry to fail")
+	}
+}
+
+// Test exec plugins, custom providers and reference parsing
+func TestExecAndCustomSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tianniu-exec")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	plugin := filepath.Join(dir, "plugin.sh")
+	script := "#!/bin/sh\nif [ \"$1\" = fail ]; then echo denied >&2; exit 1; fi\necho \"secret-for-$1\"\n"
+	if err := ioutil.WriteFile(plugin, []byte(script), 0700); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	ctx := context.Background()
+	value, err := tianniu.ResolveSecret(ctx, "exec://"+plugin+"?arg=db")
+	if err != nil {
+		t.Fatalf("ResolveSecret(exec) failed: %v", err)
+	}
+	if value != "secret-for-db" {
+		t.Errorf("Expected 'secret-for-db', got '%s'", value)
+	}
+
+	_, err = tianniu.ResolveSecret(ctx, "exec://"+plugin+"?arg=fail")
+	if err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Errorf("Expected plugin stderr in error, got %v", err)
+	}
+	if err != nil && strings.Contains(err.Error(), "arg=fail") {
+		t.Errorf("Expected query to be redacted from error, got %v", err)
+	}
+
+	resolver := tianniu.NewSecretResolver()
+	resolver.Register("vault", tianniu.SecretProviderFunc(func(_ context.Context, ref *url.URL) (string, error) {
+		return "vault:" + ref.Host + ref.Path, nil
+	}))
+	value, err = resolver.Resolve(ctx, "vault://secret/data/db")
+	if err != nil || value != "vault:secret/data/db" {
+		t.Errorf("Unexpected custom provider result '%s' (%v)", value, err)
+	}
+
+	if _, err := resolver.Resolve(ctx, "s3cret"); err == nil {
+		t.Error("Expected reference without scheme to be rejected")
+	}
+	if _, err := resolver.Resolve(ctx, "unknown:thing"); err == nil {
+		t.Error("Expected unknown scheme to be rejected")
+	}
+}
+
+// Test that the OAuth client secret is resolved and checked like the API key
+func TestClientSecretRef(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tianniu-client-secret")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "client-secret")
+	ioutil.WriteFile(path, []byte("oauth-secret\n"), 0600)
+	os.Setenv("TIANNIU_TEST_CLIENT_SECRET", "from-env")
+	defer os.Unsetenv("TIANNIU_TEST_CLIENT_SECRET")
+
+	var cfg tianniu.Config
+	cfg.Environments = make([]tianniu.Environment, 2)
+	cfg.Environments[0].Name = "production"
+	cfg.Environments[0].Auth.ClientSecretRef = "file://" + path
+	cfg.Environments[1].Name = "staging"
+	cfg.Environments[1].Auth.ClientSecret = "TIANNIU_TEST_CLIENT_SECRET"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	ctx := context.Background()
+	for i, want := range []string{"oauth-secret", "from-env"} {
+		value, err := cfg.Environments[i].ResolveClientSecret(ctx)
+		if err != nil || value != want {
+			t.Errorf("Expected '%s' for %s, got '%s' (%v)", want, cfg.Environments[i].Name, value, err)
+		}
+	}
+	if _, err := (&tianniu.Environment{Name: "dev"}).ResolveClientSecret(ctx); err == nil {
+		t.Error("Expected a missing client secret to fail")
+	}
+
+	// References that can never resolve fail validation
+	cfg.Environments[0].Auth.ClientSecretRef = "hunter2"
+	cfg.Environments[1].Auth.ClientSecretRef = "vault://secret/oauth"
+	err = cfg.Validate()
+	problems, ok := err.(tianniu.ConfigErrors)
+	want := []string{
+		"environment production: client_secret: secret reference \"hunter2\" has no scheme",
+		"environment staging: client_secret and client_secret_env are mutually exclusive",
+		"environment staging: client_secret: no secret provider for scheme \"vault\"",
+	}
+	if !ok || len(problems) != len(want) {
+		t.Fatalf("Expected %d problems, got %v", len(want), err)
+	}
+	for i := range want {
+		if !strings.HasPrefix(problems[i], want[i]) {
+			t.Errorf("Expected problem '%s', got '%s'", want[i], problems[i])
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+// Test ParseSelector
+func TestParseSelector(t *testing.T) {
+	selector, err := tianniu.ParseSelector("app=web, team in (backend, data),!canary,tier,env!=dev")
+	if err != nil {
+		t.Fatalf("ParseSelector failed: %v", err)
+	}
+
+	reqs := selector.Requirements()
+	if len(reqs) != 5 {
+		t.Fatalf("Expected 5 requirements, got %d", len(reqs))
+	}
+
+	expected := []tianniu.Requirement{
+		{Key: "app", Operator: tianniu.OpEquals, Values: []string{"web"}},
+		{Key: "team", Operator: tianniu.OpIn, Values: []string{"backend", "data"}},
+		{Key: "canary", Operator: tianniu.OpDoesNotExist},
+		{Key: "tier", Operator: tianniu.OpExists},
+		{Key: "env", Operator: tianniu.OpNotEquals, Values: []string{"dev"}},
+	}
+	if !reflect.DeepEqual(reqs, expected) {
+		t.Errorf("Expected requirements %+v, got %+v", expected, reqs)
+	}
+
+	if selector.String() != "app=web,team in (backend,data),!canary,tier,env!=dev" {
+		t.Errorf("Unexpected canonical form '%s'", selector.String())
+	}
+
+	// An empty value is valid
+	if _, err := tianniu.ParseSelector("app="); err != nil {
+		t.Errorf("Expected 'app=' to parse, got %v", err)
+	}
+
+	for _, bad := range []string{"=web", "team in backend", "team in (a,b", "app=web,", "app=web team=x", "team within (a)", `a"b=c`} {
+		if _, err := tianniu.ParseSelector(bad); err == nil {
+			t.Errorf("Expected '%s' to be rejected", bad)
+		}
+	}
+}
+
+// Test Selector.Matches
+func TestSelectorMatches(t *testing.T) {
+	selector, err := tianniu.ParseSelector("app=web,team in (backend,data),!canary")
+	if err != nil {
+		t.Fatalf("ParseSelector failed: %v", err)
+	}
+
+	cases := []struct {
+		labels map[string]string
+		match  bool
+	}{
+		{map[string]string{"app": "web", "team": "backend"}, true},
+		{map[string]string{"app": "web", "team": "data", "environment": "production"}, true},
+		{map[string]string{"app": "web", "team": "frontend"}, false},
+		{map[string]string{"app": "web", "team": "backend", "canary": "true"}, false},
+		{map[string]string{"app": "api", "team": "backend"}, false},
+		{nil, false},
+	}
+
+	for _, c := range cases {
+		if got := selector.Matches(c.labels); got != c.match {
+			t.Errorf("Expected Matches(%v) to be %v, got %v", c.labels, c.match, got)
+		}
+	}
+
+	empty, err := tianniu.ParseSelector("")
+	if err != nil {
+		t.Fatalf("ParseSelector of empty string failed: %v", err)
+	}
+	if !empty.Empty() || !empty.Matches(nil) {
+		t.Error("Expected empty selector to match everything")
+	}
+}
+
+// Test Selector.MySQLCondition
+func TestSelectorMySQLCondition(t *testing.T) {
+	selector, err := tianniu.ParseSelector("app=web,team notin (qa),!canary")
+	if err != nil {
+		t.Fatalf("ParseSelector failed: %v", err)
+	}
+
+	cond, args, err := selector.MySQLCondition("labels")
+	if err != nil {
+		t.Fatalf("MySQLCondition failed: %v", err)
+	}
+
+	expectedCond := `JSON_UNQUOTE(JSON_EXTRACT(labels, ?)) = ? AND ` +
+		`(JSON_EXTRACT(labels, ?) IS NULL OR JSON_UNQUOTE(JSON_EXTRACT(labels, ?)) NOT IN (?)) AND ` +
+		`(labels IS NULL OR NOT JSON_CONTAINS_PATH(labels, 'one', ?))`
+	if cond != expectedCond {
+		t.Errorf("Unexpected condition:\n%s", cond)
+	}
+
+	expectedArgs := []interface{}{`$."app"`, "web", `$."team"`, `$."team"`, "qa", `$."canary"`}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("Expected args %v, got %v", expectedArgs, args)
+	}
+
+	if _, _, err := selector.MySQLCondition("labels; DROP TABLE containers"); err == nil {
+		t.Error("Expected unsafe column name to be rejected")
+	}
+}
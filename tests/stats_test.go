@@ -0,0 +1,180 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+// Test parsing the rates of the resource usage
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		input string
+		want  float64
+	}{
+		{"1.2MB/s", 1.2e6},
+		{"512Ki/s", 512 * 1024},
+		{"0B/s", 0},
+		{"300", 300},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		got, err := tianniu.ParseRate(tt.input)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseRate(%q) = %v, %v; want %v", tt.input, got, err, tt.want)
+		}
+	}
+	if _, err := tianniu.ParseRate("fast"); err == nil {
+		t.Error("Expected an error for a malformed rate")
+	}
+}
+
+// Test converting the resource usage strings of a container
+func TestSampleFromUsage(t *testing.T) {
+	c := &tianniu.Container{
+		ID:             "c1",
+		Name:           "web",
+		ResourceLimits: tianniu.ContainerLimits{Memory: tianniu.MustParseQuantity("512MB")},
+		ResourceUsage: tianniu.ResourceUsage{
+			CPU:       tianniu.MustParseQuantity("0.75"),
+			Memory:    tianniu.MustParseQuantity("128MB"),
+			NetworkRX: "1.2MB/s",
+			NetworkTX: "800KB/s",
+		},
+	}
+	sample, err := tianniu.SampleFromUsage(c)
+	if err != nil {
+		t.Fatalf("SampleFromUsage failed: %v", err)
+	}
+	if sample.Source != "usage" || sample.CPUPercent != 75 || sample.MemoryBytes != 128e6 || sample.MemoryPercent != 25 ||
+		sample.NetworkRxRate != 1.2e6 || sample.NetworkTxRate != 800e3 {
+		t.Errorf("Unexpected sample %+v", sample)
+	}
+
+	c.ResourceUsage.NetworkTX = "a lot"
+	if _, err := tianniu.SampleFromUsage(c); err == nil || !strings.Contains(err.Error(), "network_tx") {
+		t.Errorf("Expected a network_tx error, got %v", err)
+	}
+}
+
+// Mock server with one container answering stats and one only reporting
+// its resource usage in the list
+func setupStatsMockServer(t *testing.T) *httptest.Server {
+	var mu sync.Mutex
+	calls := 0
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	handler := http.NewServeMux()
+	handler.HandleFunc("/api/v1/containers", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("status") != "running" {
+			t.Errorf("Expected running containers, got query %s", r.URL.RawQuery)
+		}
+		json.NewEncoder(w).Encode(tianniu.ContainerList{Total: 2, Containers: []tianniu.Container{
+			{ID: "a1", Name: "api", Status: "running"},
+			{ID: "b2", Name: "batch", Status: "running", ResourceUsage: tianniu.ResourceUsage{
+				CPU:       tianniu.MustParseQuantity("0.5"),
+				Memory:    tianniu.MustParseQuantity("64Mi"),
+				NetworkRX: "2KB/s",
+			}},
+		}})
+	})
+	handler.HandleFunc("/api/v1/containers/a1/stats", func(w http.ResponseWriter, r *http.Request) {
+		// 10 seconds and 5000 received bytes between samples
+		mu.Lock()
+		n := calls
+		calls++
+		mu.Unlock()
+		json.NewEncoder(w).Encode(tianniu.ContainerStats{
+			ContainerID: "a1",
+			Timestamp:   start.Add(time.Duration(n) * 10 * time.Second),
+			CPU:         tianniu.CPUStats{UsagePercent: 40},
+			Memory:      tianniu.MemoryStats{Usage: 100 << 20, Limit: 400 << 20, UsagePercent: 25},
+			Network:     tianniu.NetworkStats{RxBytes: 10000 + int64(n)*5000, TxBytes: 500},
+		})
+	})
+	handler.HandleFunc("/api/v1/containers/b2/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	return httptest.NewServer(handler)
+}
+
+// Test sampling, rates, the fallback on resource usage and the exports
+func TestStatsCollector(t *testing.T) {
+	server := setupStatsMockServer(t)
+	defer server.Close()
+	client := newTestClient(t, server)
+	collector := tianniu.NewStatsCollector(client, tianniu.StatsCollectorOptions{})
+
+	if _, err := collector.Collect(context.Background()); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	samples, err := collector.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if len(samples) != 2 || samples[0].ContainerID != "a1" || samples[1].ContainerID != "b2" {
+		t.Fatalf("Unexpected samples %+v", samples)
+	}
+	a1, b2 := samples[0], samples[1]
+	if a1.Source != "stats" || a1.Name != "api" || a1.CPUPercent != 40 || a1.NetworkRxRate != 500 || a1.NetworkTxRate != 0 {
+		t.Errorf("Unexpected stats sample %+v", a1)
+	}
+	if b2.Source != "usage" || b2.CPUPercent != 50 || b2.MemoryBytes != 64<<20 || b2.NetworkRxRate != 2000 {
+		t.Errorf("Unexpected usage sample %+v", b2)
+	}
+
+	// Prometheus metrics of the latest samples
+	rec := httptest.NewRecorder()
+	collector.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	metrics := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE tianniu_container_cpu_usage_percent gauge\n",
+		`tianniu_container_cpu_usage_percent{id="a1",name="api"} 40` + "\n",
+		`tianniu_container_memory_limit_bytes{id="a1",name="api"} 4.194304e+08` + "\n",
+		`tianniu_container_network_receive_bytes_per_second{id="b2",name="batch"} 2000` + "\n",
+		`tianniu_container_network_receive_bytes_total{id="a1",name="api"} 15000` + "\n",
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("Metrics missing %q:\n%s", want, metrics)
+		}
+	}
+	if strings.Contains(metrics, `tianniu_container_network_receive_bytes_total{id="b2"`) {
+		t.Errorf("Usage samples have no counters:\n%s", metrics)
+	}
+
+	// Time-series file round trip
+	var buf bytes.Buffer
+	if err := tianniu.WriteSamples(&buf, samples); err != nil {
+		t.Fatalf("WriteSamples failed: %v", err)
+	}
+	read, err := tianniu.ReadSamples(&buf, func(s *tianniu.StatsSample) bool { return s.ContainerID == "a1" })
+	if err != nil {
+		t.Fatalf("ReadSamples failed: %v", err)
+	}
+	if len(read) != 1 || !read[0].Timestamp.Equal(a1.Timestamp) || read[0].NetworkRxRate != 500 {
+		t.Errorf("Unexpected samples read back %+v", read)
+	}
+}
+
+// Test that containers named by ID are not silently dropped
+func TestStatsCollectorMissingContainer(t *testing.T) {
+	server := setupStatsMockServer(t)
+	defer server.Close()
+	client := newTestClient(t, server)
+	collector := tianniu.NewStatsCollector(client, tianniu.StatsCollectorOptions{IDs: []string{"a1", "gone"}})
+
+	samples, err := collector.Collect(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "gone") {
+		t.Errorf("Expected an error for the missing container, got %v", err)
+	}
+	if len(samples) != 1 || samples[0].ContainerID != "a1" {
+		t.Errorf("Expected the sample of a1, got %+v", samples)
+	}
+}
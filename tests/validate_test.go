@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/baidu/tianniu-go-client/tianniu"
+)
+
+// Test that the sample deployment is valid
+func TestValidateSampleDeployment(t *testing.T) {
+	data, err := ioutil.ReadFile("../examples/go/sample-deployment.json")
+	if err != nil {
+		t.Fatalf("Failed to read sample deployment: %v", err)
+	}
+	var d tianniu.Deployment
+	if err := json.Unmarshal(data, &d); err != nil {
+		t.Fatalf("Failed to parse sample deployment: %v", err)
+	}
+	if err := d.Validate(); err != nil {
+		t.Errorf("Expected the sample deployment to be valid: %v", err)
+	}
+}
+
+// Test that every problem of a deployment is reported with its field path
+func TestValidateDeployment(t *testing.T) {
+	d := &tianniu.Deployment{
+		Name:        "Web_Frontend",
+		Environment: "production",
+		Version:     "v2.3.1",
+		Replicas:    2,
+		Strategy:    tianniu.DeploymentStrategy{Type: "rolling-update", MaxUnavailable: 3},
+		Containers: []tianniu.DeploymentContainer{
+			{
+				Name:  "web",
+				Image: "nginx:1.25",
+				Ports: []tianniu.ContainerPort{{Name: "http", ContainerPort: 80, ServicePort: 8080}},
+				Resources: tianniu.ResourceRequirements{
+					Limits:   tianniu.ResourceList{CPU: tianniu.MustParseQuantity("1"), Memory: tianniu.MustParseQuantity("256Mi")},
+					Requests: tianniu.ResourceList{CPU: tianniu.MustParseQuantity("1.5"), Memory: tianniu.MustParseQuantity("512MB")},
+				},
+				EnvironmentVariables: []tianniu.EnvVar{
+					{Name: "LOG_LEVEL", Value: "info"},
+					{Name: "DB_PASSWORD", Value: "x", ValueFrom: &tianniu.EnvVarSource{SecretName: "db"}},
+				},
+				HealthCheck: &tianniu.HealthCheck{HTTPPath: "/health", Port: 8080, PeriodSeconds: 10, TimeoutSeconds: 30},
+			},
+			{
+				Name:  "sidecar",
+				Image: "registry.baidu.com/infra/proxy:1.0",
+				Ports: []tianniu.ContainerPort{{Name: "proxy", ContainerPort: 9000, ServicePort: 8080}},
+				Resources: tianniu.ResourceRequirements{
+					Limits: tianniu.ResourceList{CPU: tianniu.MustParseQuantity("1Gi"), Memory: tianniu.MustParseQuantity("100m")},
+				},
+			},
+		},
+		Services: []tianniu.Service{
+			{Name: "web", Type: "Ingress", Ports: []tianniu.ServicePort{{Port: 80, TargetPort: 9090}}},
+		},
+	}
+
+	err := d.Validate()
+	errs, ok := err.(tianniu.ValidationErrors)
+	if !ok {
+		t.Fatalf("Expected ValidationErrors, got %v", err)
+	}
+
+	want := map[string]bool{
+		"name":                                              true,
+		"strategy.max_unavailable":                          true,
+		"containers[0].resources.requests.cpu":              true,
+		"containers[0].resources.requests.memory":           true,
+		"containers[0].environment_variables[1]":            true,
+		"containers[0].environment_variables[1].value_from": true,
+		"containers[0].health_check.port":                   true,
+		"containers[0].health_check.timeout_seconds":        true,
+		"containers[1].ports[0].service_port":               true,
+		"containers[1].resources.requests.cpu":              true,
+		"containers[1].resources.requests.memory":           true,
+		"containers[1].resources.limits.cpu":                true,
+		"containers[1].resources.limits.memory":             true,
+		"services[0].type":                                  true,
+		"services[0].ports[0].target_port":                  true,
+	}
+	got := map[string]bool{}
+	for _, fe := range errs {
+		got[fe.Field] = true
+		if !want[fe.Field] {
+			t.Errorf("Unexpected error %v", fe)
+		}
+	}
+	for field := range want {
+		if !got[field] {
+			t.Errorf("Expected an error for %s in:\n%v", field, err)
+		}
+	}
+
+	// Quantities are compared in their base unit
+	d = &tianniu.Deployment{
+		Name: "api", Environment: "staging", Version: "v1", Replicas: 1,
+		Containers: []tianniu.DeploymentContainer{{
+			Name:  "api",
+			Image: "api:v1",
+			Resources: tianniu.ResourceRequirements{
+				Limits:   tianniu.ResourceList{CPU: tianniu.MustParseQuantity("1"), Memory: tianniu.MustParseQuantity("1Gi")},
+				Requests: tianniu.ResourceList{CPU: tianniu.MustParseQuantity("500m"), Memory: tianniu.MustParseQuantity("1000MB")},
+			},
+		}},
+	}
+	if err := d.Validate(); err != nil {
+		t.Errorf("Expected a valid deployment, got %v", err)
+	}
+}
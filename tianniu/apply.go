@@ -0,0 +1,295 @@
+package tianniu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FieldChange is one changed field between a live and a desired object. Path
+// uses the JSON field names, e.g. "containers[0].image"; Old is nil for
+// added fields and New is nil for removed ones.
+type FieldChange struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// ApplyAction is what Apply did, or would do, with one deployment
+type ApplyAction string
+
+const (
+	ApplyCreated   ApplyAction = "created"
+	ApplyUpdated   ApplyAction = "updated"
+	ApplyUnchanged ApplyAction = "unchanged"
+	ApplyPruned    ApplyAction = "pruned"
+)
+
+// ApplyResult is the outcome of applying one deployment
+type ApplyResult struct {
+	Action      ApplyAction   `json:"action"`
+	ID          string        `json:"id,omitempty"`
+	Name        string        `json:"name"`
+	Environment string        `json:"environment"`
+	Changes     []FieldChange `json:"changes,omitempty"`
+}
+
+// ApplyOptions controls Apply
+type ApplyOptions struct {
+	// DryRun computes the results without changing anything
+	DryRun bool
+	// Prune deletes the deployments of the manifests' environments that
+	// match PruneSelector and that no manifest names
+	Prune bool
+	// PruneSelector is the label selector, e.g. "app=web", that scopes
+	// pruning to the deployments the manifests manage. It is required with
+	// Prune, so that applying part of an environment does not delete the
+	// rest of it.
+	PruneSelector string
+}
+
+// applyPageSize is the page size used to index the live deployments
+const applyPageSize = 100
+
+// Apply makes the deployments of the platform match manifests. Manifests are
+// matched to live deployments by name and environment; matched deployments
+// are updated if their spec differs, the others are created. All manifests
+// are validated before any change is made. Apply stops at the first failure
+// and returns the results so far with the error.
+func (s *DeploymentsService) Apply(ctx context.Context, manifests []*Deployment, opts ApplyOptions) ([]ApplyResult, error) {
+	if opts.Prune {
+		if opts.PruneSelector == "" {
+			return nil, fmt.Errorf("pruning requires a label selector")
+		}
+		if _, err := ParseSelector(opts.PruneSelector); err != nil {
+			return nil, fmt.Errorf("invalid prune selector: %v", err)
+		}
+	}
+	type key struct{ environment, name string }
+	wanted := make(map[key]bool, len(manifests))
+	var environments []string
+	for _, m := range manifests {
+		if m.Name == "" || m.Environment == "" {
+			return nil, fmt.Errorf("manifest is missing name or environment")
+		}
+		k := key{m.Environment, m.Name}
+		if wanted[k] {
+			return nil, fmt.Errorf("deployment %s is declared twice for environment %s", m.Name, m.Environment)
+		}
+		wanted[k] = true
+		if !containsString(environments, m.Environment) {
+			environments = append(environments, m.Environment)
+		}
+	}
+
+	// Validate every manifest before changing anything
+	var invalid []string
+	for _, m := range manifests {
+		if err := m.Validate(); err != nil {
+			invalid = append(invalid, fmt.Sprintf("deployment %s (%s): %v", m.Name, m.Environment, err))
+		}
+	}
+	if len(invalid) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(invalid, "\n"))
+	}
+
+	// Index the live deployments of every environment by name, and collect
+	// those the prune selector matches
+	live := make(map[key]Deployment)
+	var prunable []Deployment
+	for _, env := range environments {
+		deployments, err := s.ListAll(ctx, env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list deployments of %s: %v", env, err)
+		}
+		for _, d := range deployments {
+			live[key{d.Environment, d.Name}] = d
+		}
+		if !opts.Prune {
+			continue
+		}
+		selected, err := s.listAll(ctx, DeploymentListOptions{Environment: env, LabelSelector: opts.PruneSelector})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list deployments of %s: %v", env, err)
+		}
+		for _, d := range selected {
+			if !wanted[key{d.Environment, d.Name}] && !containsDeployment(prunable, d.ID) {
+				prunable = append(prunable, d)
+			}
+		}
+	}
+
+	results := make([]ApplyResult, 0, len(manifests))
+	for _, m := range manifests {
+		result := ApplyResult{Name: m.Name, Environment: m.Environment}
+		existing, ok := live[key{m.Environment, m.Name}]
+		if !ok {
+			result.Action = ApplyCreated
+			if !opts.DryRun {
+				created, err := s.Create(ctx, m)
+				if err != nil {
+					return results, fmt.Errorf("failed to create deployment %s: %v", m.Name, err)
+				}
+				result.ID = created.ID
+			}
+			results = append(results, result)
+			continue
+		}
+
+		result.ID = existing.ID
+		current, err := s.Get(ctx, existing.ID)
+		if err != nil {
+			return results, fmt.Errorf("failed to get deployment %s: %v", m.Name, err)
+		}
+		result.Changes, err = DiffDeployments(current, m)
+		if err != nil {
+			return results, err
+		}
+		result.Action = ApplyUnchanged
+		if len(result.Changes) > 0 {
+			result.Action = ApplyUpdated
+			if !opts.DryRun {
+				if _, err := s.Update(ctx, existing.ID, m); err != nil {
+					return results, fmt.Errorf("failed to update deployment %s: %v", m.Name, err)
+				}
+			}
+		}
+		results = append(results, result)
+	}
+
+	if opts.Prune {
+		for _, d := range prunable {
+			if !opts.DryRun {
+				if err := s.Delete(ctx, d.ID, false); err != nil {
+					return results, fmt.Errorf("failed to prune deployment %s: %v", d.Name, err)
+				}
+			}
+			results = append(results, ApplyResult{Action: ApplyPruned, ID: d.ID, Name: d.Name, Environment: d.Environment})
+		}
+	}
+	return results, nil
+}
+
+// ListAll lists every deployment of an environment, following the pages of
+// List
+func (s *DeploymentsService) ListAll(ctx context.Context, environment string) ([]Deployment, error) {
+	return s.listAll(ctx, DeploymentListOptions{Environment: environment})
+}
+
+// listAll follows the pages of List for opts, ignoring its limit and offset
+func (s *DeploymentsService) listAll(ctx context.Context, opts DeploymentListOptions) ([]Deployment, error) {
+	var all []Deployment
+	opts.Limit = applyPageSize
+	for {
+		opts.Offset = len(all)
+		list, err := s.List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, list.Deployments...)
+		if len(list.Deployments) == 0 || len(all) >= list.Total {
+			return all, nil
+		}
+	}
+}
+
+// containsDeployment reports whether deployments holds the deployment id
+func containsDeployment(deployments []Deployment, id string) bool {
+	for _, d := range deployments {
+		if d.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// DiffDeployments returns the spec fields that differ between a live and a
+// desired deployment. Fields managed by the server, such as the ID, status,
+// timestamps and external endpoints, are ignored.
+func DiffDeployments(live, desired *Deployment) ([]FieldChange, error) {
+	oldValue, err := specValue(live)
+	if err != nil {
+		return nil, err
+	}
+	newValue, err := specValue(desired)
+	if err != nil {
+		return nil, err
+	}
+	var changes []FieldChange
+	diffValues("", oldValue, newValue, &changes)
+	return changes, nil
+}
+
+// specValue returns the generic JSON form of the spec fields of d
+func specValue(d *Deployment) (interface{}, error) {
+	spec := *d
+	spec.ID = ""
+	spec.Status = ""
+	spec.Message = ""
+	spec.Services = make([]Service, len(d.Services))
+	for i, svc := range d.Services {
+		svc.ExternalEndpoints = nil
+		spec.Services[i] = svc
+	}
+	if len(spec.Services) == 0 {
+		spec.Services = nil
+	}
+
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	var value map[string]interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	for _, field := range []string{"created_at", "updated_at"} {
+		delete(value, field)
+	}
+	return value, nil
+}
+
+// diffValues appends the differences between two generic JSON values
+func diffValues(path string, oldValue, newValue interface{}, changes *[]FieldChange) {
+	switch o := oldValue.(type) {
+	case map[string]interface{}:
+		n, ok := newValue.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(o)+len(n))
+		for k := range o {
+			keys = append(keys, k)
+		}
+		for k := range n {
+			if _, ok := o[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := k
+			if path != "" {
+				child = path + "." + k
+			}
+			diffValues(child, o[k], n[k], changes)
+		}
+		return
+	case []interface{}:
+		n, ok := newValue.([]interface{})
+		if !ok || len(n) != len(o) {
+			break
+		}
+		for i := range o {
+			diffValues(path+"["+strconv.Itoa(i)+"]", o[i], n[i], changes)
+		}
+		return
+	}
+	if !reflect.DeepEqual(oldValue, newValue) {
+		*changes = append(*changes, FieldChange{Path: path, Old: oldValue, New: newValue})
+	}
+}
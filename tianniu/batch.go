@@ -0,0 +1,223 @@
+package tianniu
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultBatchConcurrency bounds the requests in flight of a batch operation
+// that falls back to one request per container
+const DefaultBatchConcurrency = 10
+
+// BatchOptions selects the containers of a batch operation. The containers
+// listed in IDs and those matching LabelSelector are combined.
+type BatchOptions struct {
+	IDs           []string
+	LabelSelector string
+
+	// Timeout is the graceful-stop timeout of stop and restart. Zero uses
+	// the server default.
+	Timeout time.Duration
+
+	// Concurrency bounds the requests in flight when the batch endpoint is
+	// unavailable. Zero means DefaultBatchConcurrency.
+	Concurrency int
+}
+
+// BatchResult is the outcome of a batch operation for one container
+type BatchResult struct {
+	ID      string `json:"id"`
+	Status  string `json:"status,omitempty"`
+	Message string `json:"message,omitempty"`
+	// Error is set when the operation failed for this container
+	Error string `json:"error,omitempty"`
+}
+
+// BatchResults holds one result per container, in the order of the IDs
+// followed by the containers matching the selector
+type BatchResults struct {
+	Results []BatchResult `json:"results"`
+}
+
+// Failed returns the results of the containers the operation failed for
+func (r *BatchResults) Failed() []BatchResult {
+	var failed []BatchResult
+	for _, result := range r.Results {
+		if result.Error != "" {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// batchRequest is the request body of the batch endpoints
+type batchRequest struct {
+	ContainerIDs []string `json:"container_ids"`
+	Timeout      int      `json:"timeout,omitempty"`
+}
+
+// failedStatuses mark a failure in a batch endpoint response
+var failedStatuses = []string{"error", "failed"}
+
+// StartBatch starts several containers. The error is only set when the
+// containers could not be resolved; failures of single containers are
+// reported in the results.
+func (s *ContainersService) StartBatch(ctx context.Context, opts BatchOptions) (*BatchResults, error) {
+	return s.batch(ctx, "start", opts, func(ctx context.Context, id string) (*Container, error) {
+		return s.Start(ctx, id)
+	})
+}
+
+// StopBatch stops several containers, like StartBatch
+func (s *ContainersService) StopBatch(ctx context.Context, opts BatchOptions) (*BatchResults, error) {
+	return s.batch(ctx, "stop", opts, func(ctx context.Context, id string) (*Container, error) {
+		return s.Stop(ctx, id, opts.Timeout)
+	})
+}
+
+// RestartBatch restarts several containers, like StartBatch. The API has no
+// batch restart endpoint, so each container is restarted by its own request.
+func (s *ContainersService) RestartBatch(ctx context.Context, opts BatchOptions) (*BatchResults, error) {
+	return s.batch(ctx, "", opts, func(ctx context.Context, id string) (*Container, error) {
+		return s.Restart(ctx, id, opts.Timeout)
+	})
+}
+
+// batch runs action on the selected containers through its batch endpoint,
+// or through one call of single per container when action is empty or the
+// endpoint is unavailable
+func (s *ContainersService) batch(ctx context.Context, action string, opts BatchOptions, single func(context.Context, string) (*Container, error)) (*BatchResults, error) {
+	ids, err := s.batchIDs(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return &BatchResults{Results: []BatchResult{}}, nil
+	}
+
+	if action != "" {
+		var resp BatchResults
+		body := batchRequest{ContainerIDs: ids, Timeout: timeoutSeconds(opts.Timeout)}
+		err := s.client.call(ctx, "POST", "/containers/batch/"+action, nil, body, &resp)
+		if err == nil {
+			return orderResults(ids, resp.Results), nil
+		}
+		if !batchUnavailable(err) {
+			return nil, err
+		}
+	}
+	return fanOut(ctx, ids, opts.Concurrency, single), nil
+}
+
+// batchIDs resolves the containers of a batch, without duplicates
+func (s *ContainersService) batchIDs(ctx context.Context, opts BatchOptions) ([]string, error) {
+	seen := make(map[string]bool)
+	var ids []string
+	add := func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, id := range opts.IDs {
+		add(id)
+	}
+	if opts.LabelSelector == "" {
+		return ids, nil
+	}
+
+	containers, err := s.listAll(ctx, ContainerListOptions{LabelSelector: opts.LabelSelector})
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range containers {
+		add(c.ID)
+	}
+	return ids, nil
+}
+
+// batchUnavailable reports whether a batch endpoint is missing on the
+// server, as opposed to rejecting the request
+func batchUnavailable(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.StatusCode {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	}
+	return false
+}
+
+// orderResults puts the results of a batch endpoint in the order of ids.
+// Containers missing from the response are reported as failed.
+func orderResults(ids []string, results []BatchResult) *BatchResults {
+	byID := make(map[string]BatchResult, len(results))
+	for _, result := range results {
+		if result.Error == "" && containsString(failedStatuses, result.Status) {
+			result.Error = result.Message
+			if result.Error == "" {
+				result.Error = "operation failed"
+			}
+		}
+		byID[result.ID] = result
+	}
+	ordered := make([]BatchResult, len(ids))
+	for i, id := range ids {
+		result, ok := byID[id]
+		if !ok {
+			result = BatchResult{ID: id, Error: "missing from the batch response"}
+		}
+		ordered[i] = result
+	}
+	return &BatchResults{Results: ordered}
+}
+
+// fanOut calls single for each container with at most concurrency calls in
+// flight
+func fanOut(ctx context.Context, ids []string, concurrency int, single func(context.Context, string) (*Container, error)) *BatchResults {
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+
+	results := make([]BatchResult, len(ids))
+	forEachLimit(len(ids), concurrency, func(i int) {
+		result := BatchResult{ID: ids[i]}
+		container, err := single(ctx, ids[i])
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Status = container.Status
+		}
+		results[i] = result
+	})
+	return &BatchResults{Results: results}
+}
+
+// forEachLimit calls fn for 0 to n-1 with at most limit calls running at
+// once, and returns when all calls have returned
+func forEachLimit(n, limit int, fn func(i int)) {
+	if limit > n {
+		limit = n
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < limit; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
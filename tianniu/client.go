@@ -0,0 +1,200 @@
+package tianniu
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is the production API endpoint
+const DefaultBaseURL = "https://tianniuprod.baidu.com/api/v1"
+
+// Client is a TianNiu API client. The API is grouped into services that
+// share the client's endpoint, credentials and HTTP client.
+type Client struct {
+	BaseURL    string
+	APIKey     string
+	HTTPClient *http.Client
+	UserAgent  string
+
+	Deployments *DeploymentsService
+	Containers  *ContainersService
+	Resources   *ResourcesService
+	Nodes       *NodesService
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithAPIKey sets the API key sent as a bearer token
+func WithAPIKey(apiKey string) Option {
+	return func(c *Client) {
+		c.APIKey = apiKey
+	}
+}
+
+// WithBaseURL sets the API endpoint, e.g. https://tianniuprod.baidu.com/api/v1
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.BaseURL = strings.TrimRight(baseURL, "/")
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for requests
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.HTTPClient = httpClient
+	}
+}
+
+// NewClient creates a new TianNiu API client. Without options it talks to
+// DefaultBaseURL using the API key in TIANNIU_API_KEY.
+func NewClient(opts ...Option) (*Client, error) {
+	c := &Client{
+		BaseURL:    DefaultBaseURL,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		UserAgent:  "tianniu-go-client",
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.APIKey == "" {
+		c.APIKey = os.Getenv("TIANNIU_API_KEY")
+	}
+	if c.APIKey == "" {
+		return nil, fmt.Errorf("no API key configured (use WithAPIKey or set TIANNIU_API_KEY)")
+	}
+	if _, err := url.Parse(c.BaseURL); err != nil {
+		return nil, fmt.Errorf("invalid base URL: %v", err)
+	}
+
+	c.Deployments = &DeploymentsService{client: c}
+	c.Containers = &ContainersService{client: c}
+	c.Resources = &ResourcesService{client: c}
+	c.Nodes = &NodesService{client: c}
+	return c, nil
+}
+
+// APIError is an error response from the API
+type APIError struct {
+	StatusCode int
+	Status     string
+	Code       string      `json:"code"`
+	Message    string      `json:"message"`
+	Details    interface{} `json:"details,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" && e.Message == "" {
+		return fmt.Sprintf("API error: %s", e.Status)
+	}
+	return fmt.Sprintf("API error: %s - %s", e.Code, e.Message)
+}
+
+// IsNotFound reports whether err is an API 404 response
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// newRequest builds a request for path relative to BaseURL. A non-nil body
+// is sent as JSON.
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Request, error) {
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	return req, nil
+}
+
+// do sends the request and decodes a successful JSON response into out,
+// which may be nil
+func (c *Client) do(req *http.Request, out interface{}) error {
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+	if out == nil {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	if raw, ok := out.(*json.RawMessage); ok {
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		*raw = data
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Get sends a GET request for path relative to BaseURL and decodes the JSON
+// response into out. Pass a *json.RawMessage to keep the body undecoded. It
+// is the escape hatch for endpoints without a typed method.
+func (c *Client) Get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	return c.call(ctx, "GET", path, query, nil, out)
+}
+
+// call is newRequest followed by do
+func (c *Client) call(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	req, err := c.newRequest(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	return c.do(req, out)
+}
+
+// checkResponse turns a non-2xx response into an *APIError
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	apiErr := &APIError{StatusCode: resp.StatusCode, Status: resp.Status}
+	var errResp struct {
+		Error *APIError `json:"error"`
+	}
+	errResp.Error = apiErr
+	json.NewDecoder(resp.Body).Decode(&errResp)
+	return apiErr
+}
@@ -0,0 +1,393 @@
+package tianniu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// K8sPod is a v1 Pod as the cluster reports it
+type K8sPod struct {
+	Metadata K8sObjectMeta `json:"metadata"`
+	Spec     K8sPodSpec    `json:"spec"`
+	Status   K8sPodStatus  `json:"status"`
+}
+
+// K8sPodStatus is the observed state of a pod
+type K8sPodStatus struct {
+	Phase             string               `json:"phase,omitempty"`
+	Reason            string               `json:"reason,omitempty"`
+	Message           string               `json:"message,omitempty"`
+	HostIP            string               `json:"hostIP,omitempty"`
+	PodIP             string               `json:"podIP,omitempty"`
+	StartTime         *time.Time           `json:"startTime,omitempty"`
+	ContainerStatuses []K8sContainerStatus `json:"containerStatuses,omitempty"`
+}
+
+// K8sContainerStatus is the observed state of a container of a pod
+type K8sContainerStatus struct {
+	Name         string            `json:"name"`
+	Image        string            `json:"image"`
+	Ready        bool              `json:"ready"`
+	RestartCount int               `json:"restartCount"`
+	State        K8sContainerState `json:"state"`
+}
+
+// K8sContainerState is set in exactly one of its fields
+type K8sContainerState struct {
+	Waiting    *K8sContainerStateDetail `json:"waiting,omitempty"`
+	Running    *K8sContainerStateDetail `json:"running,omitempty"`
+	Terminated *K8sContainerStateDetail `json:"terminated,omitempty"`
+}
+
+// K8sContainerStateDetail describes a waiting, running or terminated
+// container
+type K8sContainerStateDetail struct {
+	Reason    string     `json:"reason,omitempty"`
+	Message   string     `json:"message,omitempty"`
+	ExitCode  int        `json:"exitCode,omitempty"`
+	StartedAt *time.Time `json:"startedAt,omitempty"`
+}
+
+// Ready returns the number of ready containers and the number of containers
+func (p *K8sPod) Ready() (ready, total int) {
+	for _, c := range p.Status.ContainerStatuses {
+		if c.Ready {
+			ready++
+		}
+	}
+	return ready, len(p.Spec.Containers)
+}
+
+// Restarts returns the restarts of all containers of the pod
+func (p *K8sPod) Restarts() int {
+	restarts := 0
+	for _, c := range p.Status.ContainerStatuses {
+		restarts += c.RestartCount
+	}
+	return restarts
+}
+
+// State summarizes the pod as kubectl does: the reason a container is
+// waiting or terminated, such as CrashLoopBackOff, or else the phase
+func (p *K8sPod) State() string {
+	for _, c := range p.Status.ContainerStatuses {
+		if w := c.State.Waiting; w != nil && w.Reason != "" {
+			return w.Reason
+		}
+		if t := c.State.Terminated; t != nil && t.Reason != "" {
+			return t.Reason
+		}
+	}
+	if p.Status.Reason != "" {
+		return p.Status.Reason
+	}
+	return p.Status.Phase
+}
+
+// K8sEvent is a v1 Event about an object of the cluster
+type K8sEvent struct {
+	Metadata       K8sObjectMeta      `json:"metadata"`
+	InvolvedObject K8sObjectReference `json:"involvedObject"`
+	Type           string             `json:"type,omitempty"`
+	Reason         string             `json:"reason,omitempty"`
+	Message        string             `json:"message,omitempty"`
+	Count          int                `json:"count,omitempty"`
+	FirstTimestamp *time.Time         `json:"firstTimestamp,omitempty"`
+	LastTimestamp  *time.Time         `json:"lastTimestamp,omitempty"`
+}
+
+// K8sObjectReference names the object of an event
+type K8sObjectReference struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// Time returns when the event was last seen
+func (e *K8sEvent) Time() time.Time {
+	switch {
+	case e.LastTimestamp != nil:
+		return *e.LastTimestamp
+	case e.FirstTimestamp != nil:
+		return *e.FirstTimestamp
+	case e.Metadata.CreationTimestamp != nil:
+		return *e.Metadata.CreationTimestamp
+	}
+	return time.Time{}
+}
+
+// ClusterClient reads the Kubernetes objects behind TianNiu deployments
+// directly from the cluster API server. It only sends GET requests, so it
+// is safe to use while the TianNiu API is degraded.
+type ClusterClient struct {
+	Context    string
+	Server     string
+	Namespace  string
+	HTTPClient *http.Client
+
+	token    string
+	username string
+	password string
+}
+
+// NewClusterClient creates a client for a resolved kubeconfig context
+func NewClusterClient(config *ClusterConfig) *ClusterClient {
+	return &ClusterClient{
+		Context:   config.Context,
+		Server:    config.Server,
+		Namespace: config.Namespace,
+		HTTPClient: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: config.TLS, Proxy: http.ProxyFromEnvironment},
+		},
+		token:    config.Token,
+		username: config.Username,
+		password: config.Password,
+	}
+}
+
+// NewClusterClient loads the kubeconfig of the environment and creates a
+// client for one of its contexts, or its current context when context is
+// empty. configPath is the path of the TianNiu configuration, against which
+// a relative kubeconfig path is resolved.
+func (e *Environment) NewClusterClient(configPath, context string) (*ClusterClient, error) {
+	path := e.KubeconfigPath(configPath)
+	if path == "" {
+		return nil, fmt.Errorf("environment %s has no kubeconfig", e.Name)
+	}
+	k, err := LoadKubeconfig(path)
+	if err != nil {
+		return nil, err
+	}
+	config, err := k.ClusterConfig(context)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return NewClusterClient(config), nil
+}
+
+// get reads an object or list of the API server into v. Kubernetes errors
+// are returned as *APIError with the Status reason as the code.
+func (c *ClusterClient) get(ctx context.Context, path string, query url.Values, v interface{}) error {
+	u := c.Server + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	switch {
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	case c.username != "":
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		apiErr := &APIError{StatusCode: resp.StatusCode, Status: resp.Status}
+		var status struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &status) == nil {
+			apiErr.Code, apiErr.Message = status.Reason, status.Message
+		}
+		return apiErr
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (c *ClusterClient) namespace(namespace string) string {
+	if namespace == "" {
+		return c.Namespace
+	}
+	return namespace
+}
+
+// GetDeployment gets an apps/v1 Deployment of a namespace, or of the
+// context's namespace when namespace is empty
+func (c *ClusterClient) GetDeployment(ctx context.Context, namespace, name string) (*K8sDeployment, error) {
+	var d K8sDeployment
+	path := fmt.Sprintf("/apis/apps/v1/namespaces/%s/deployments/%s", url.PathEscape(c.namespace(namespace)), url.PathEscape(name))
+	if err := c.get(ctx, path, nil, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// ListPods lists the pods of a namespace that match a label selector such
+// as "app=web"; an empty selector matches every pod
+func (c *ClusterClient) ListPods(ctx context.Context, namespace, selector string) ([]K8sPod, error) {
+	var list struct {
+		Items []K8sPod `json:"items"`
+	}
+	if err := c.get(ctx, c.listPath(namespace, "pods"), selectorQuery(selector), &list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// ListServices lists the services of a namespace that match a label
+// selector
+func (c *ClusterClient) ListServices(ctx context.Context, namespace, selector string) ([]K8sService, error) {
+	var list struct {
+		Items []K8sService `json:"items"`
+	}
+	if err := c.get(ctx, c.listPath(namespace, "services"), selectorQuery(selector), &list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// ListEvents lists the events of a namespace, oldest first
+func (c *ClusterClient) ListEvents(ctx context.Context, namespace string) ([]K8sEvent, error) {
+	var list struct {
+		Items []K8sEvent `json:"items"`
+	}
+	if err := c.get(ctx, c.listPath(namespace, "events"), nil, &list); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(list.Items, func(i, j int) bool { return list.Items[i].Time().Before(list.Items[j].Time()) })
+	return list.Items, nil
+}
+
+func (c *ClusterClient) listPath(namespace, resource string) string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/%s", url.PathEscape(c.namespace(namespace)), resource)
+}
+
+func selectorQuery(selector string) url.Values {
+	if selector == "" {
+		return nil
+	}
+	return url.Values{"labelSelector": {selector}}
+}
+
+// ClusterInspectOptions control InspectDeployment
+type ClusterInspectOptions struct {
+	// Namespace defaults to the namespace of the context
+	Namespace string
+	// Selector of the pods. It defaults to the selector of the Kubernetes
+	// deployment of the same name, or else to the app.kubernetes.io/name
+	// label that ExportKubernetes sets.
+	Selector string
+}
+
+// ClusterInspection is what runs in the cluster for a TianNiu deployment
+type ClusterInspection struct {
+	Context   string `json:"context"`
+	Namespace string `json:"namespace"`
+	Selector  string `json:"selector"`
+	// Deployment is nil when the namespace has no Deployment of that name
+	Deployment *K8sDeployment `json:"deployment,omitempty"`
+	Pods       []K8sPod       `json:"pods"`
+	Services   []K8sService   `json:"services"`
+	Events     []K8sEvent     `json:"events"`
+}
+
+// InspectDeployment collects the pods of a deployment by label, the services
+// whose selector matches those pods, and the events about the deployment,
+// its ReplicaSets, pods and services
+func (c *ClusterClient) InspectDeployment(ctx context.Context, name string, opts ClusterInspectOptions) (*ClusterInspection, error) {
+	namespace := c.namespace(opts.Namespace)
+	in := &ClusterInspection{Context: c.Context, Namespace: namespace, Selector: opts.Selector}
+
+	d, err := c.GetDeployment(ctx, namespace, name)
+	if err != nil && !IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get deployment %s: %v", name, err)
+	}
+	in.Deployment = d
+	if in.Selector == "" && d != nil && len(d.Spec.Selector.MatchLabels) > 0 {
+		in.Selector = labelSelector(d.Spec.Selector.MatchLabels)
+	}
+	if in.Selector == "" {
+		in.Selector = K8sNameLabel + "=" + name
+	}
+
+	if in.Pods, err = c.ListPods(ctx, namespace, in.Selector); err != nil {
+		return nil, fmt.Errorf("failed to list pods: %v", err)
+	}
+	services, err := c.ListServices(ctx, namespace, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %v", err)
+	}
+	var podLabels []map[string]string
+	if d != nil {
+		podLabels = append(podLabels, d.Spec.Template.Metadata.Labels)
+	}
+	for _, p := range in.Pods {
+		podLabels = append(podLabels, p.Metadata.Labels)
+	}
+	for _, svc := range services {
+		if selectsAny(svc.Spec.Selector, podLabels) {
+			in.Services = append(in.Services, svc)
+		}
+	}
+
+	events, err := c.ListEvents(ctx, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %v", err)
+	}
+	involved := map[string]bool{"Deployment/" + name: true}
+	for _, p := range in.Pods {
+		involved["Pod/"+p.Metadata.Name] = true
+	}
+	for _, svc := range in.Services {
+		involved["Service/"+svc.Metadata.Name] = true
+	}
+	for _, e := range events {
+		obj := e.InvolvedObject
+		// ReplicaSets are named after their deployment
+		if involved[obj.Kind+"/"+obj.Name] || (obj.Kind == "ReplicaSet" && strings.HasPrefix(obj.Name, name+"-")) {
+			in.Events = append(in.Events, e)
+		}
+	}
+	return in, nil
+}
+
+// labelSelector formats labels as a sorted "k=v,k=v" selector
+func labelSelector(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for _, k := range sortedKeys(labels) {
+		pairs = append(pairs, k+"="+labels[k])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// selectsAny reports whether a service selector matches any of the label
+// sets. An empty selector matches nothing.
+func selectsAny(selector map[string]string, labelSets []map[string]string) bool {
+	if len(selector) == 0 {
+		return false
+	}
+	for _, labels := range labelSets {
+		matches := true
+		for k, v := range selector {
+			if labels[k] != v {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,449 @@
+package tianniu
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// composeIgnoredKeys are service keys that have no effect on a TianNiu
+// deployment, so dropping them is not reported
+var composeIgnoredKeys = []string{"container_name", "hostname", "restart"}
+
+var (
+	composeMemoryPattern = regexp.MustCompile(`^(?i)([0-9]+(?:\.[0-9]+)?)\s*([bkmg]?)b?$`)
+	composeURLPattern    = regexp.MustCompile(`(https?)://(?:localhost|127\.0\.0\.1|0\.0\.0\.0)(?::([0-9]+))?(/[^\s'"|;&]*)?`)
+)
+
+// composePort is a port of a compose service
+type composePort struct {
+	target    int
+	published int
+}
+
+// composeService is the state of converting one compose service
+type composeService struct {
+	object string
+	result *ImportResult
+	d      *Deployment
+	c      *DeploymentContainer
+	ports  []composePort
+}
+
+func (s *composeService) warn(field, format string, args ...interface{}) {
+	s.result.warn(s.object, field, format, args...)
+}
+
+// ImportCompose converts the services of a docker-compose file to TianNiu
+// deployments with a single container each. Published and exposed ports
+// become a service named after the compose service, of type LoadBalancer
+// when any port is published. deploy.replicas, deploy.resources and
+// deploy.update_config map to the replicas, resources and rolling update
+// strategy; a healthcheck becomes an HTTP health check when it requests a
+// URL on localhost and an exec health check otherwise. Volumes, networks, dependencies and other keys with no
+// TianNiu equivalent are dropped and reported as warnings.
+func ImportCompose(r io.Reader, opts ImportOptions) (*ImportResult, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	generic, err := jsonCompatible(raw)
+	if err != nil {
+		return nil, err
+	}
+	file, _ := generic.(map[string]interface{})
+	services, _ := file["services"].(map[string]interface{})
+	if len(services) == 0 {
+		return nil, fmt.Errorf("not a compose file: no services")
+	}
+
+	result := &ImportResult{}
+	for _, key := range sortedKeys(file) {
+		switch {
+		case key == "services", key == "version", key == "name", strings.HasPrefix(key, "x-"):
+		default:
+			result.warn("compose", key, "top-level %s are not supported", key)
+		}
+	}
+	for _, name := range sortedKeys(services) {
+		spec, ok := services[name].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("services.%s: not a mapping", name)
+		}
+		result.Deployments = append(result.Deployments, importComposeService(result, name, spec, opts))
+	}
+	return result, nil
+}
+
+// importComposeService converts one compose service
+func importComposeService(result *ImportResult, name string, spec map[string]interface{}, opts ImportOptions) *Deployment {
+	deploymentName := strings.ToLower(strings.Replace(name, "_", "-", -1))
+	image, _ := spec["image"].(string)
+	s := &composeService{
+		object: "service/" + name,
+		result: result,
+		d: &Deployment{
+			Name:        deploymentName,
+			Environment: opts.Environment,
+			Replicas:    1,
+			Containers:  []DeploymentContainer{{Name: deploymentName, Image: image}},
+		},
+	}
+	s.c = &s.d.Containers[0]
+	if deploymentName != name {
+		s.warn("", "renamed to %s", deploymentName)
+	}
+
+	for _, key := range sortedKeys(spec) {
+		value := spec[key]
+		switch key {
+		case "image":
+		case "build":
+			if image == "" {
+				s.warn(key, "builds are not supported; push the image and set image")
+			}
+		case "ports", "expose":
+			list, _ := value.([]interface{})
+			for i, p := range list {
+				s.port(fmt.Sprintf("%s[%d]", key, i), p, key == "expose")
+			}
+		case "environment":
+			s.environment(value)
+		case "deploy":
+			s.deploy(value)
+		case "healthcheck":
+			s.healthCheck(value)
+		case "scale":
+			s.replicas(key, value)
+		case "cpus":
+			s.c.Resources.Limits.CPU = s.cpu(key, value)
+		case "mem_limit":
+			s.c.Resources.Limits.Memory = s.memory(key, value)
+		case "mem_reservation":
+			s.c.Resources.Requests.Memory = s.memory(key, value)
+		default:
+			if !containsString(composeIgnoredKeys, key) && !strings.HasPrefix(key, "x-") {
+				s.warn(key, "not supported")
+			}
+		}
+	}
+
+	s.services()
+	if s.d.Version, _ = imageTag(image); s.d.Version == "" {
+		s.d.Version = "latest"
+		s.warn("image", "no image tag; using version latest")
+	}
+	return s.d
+}
+
+// port parses a "[host:][published:]target[/protocol]" string or a long
+// syntax mapping
+func (s *composeService) port(field string, value interface{}, expose bool) {
+	var p composePort
+	var target, published, protocol string
+	switch value := value.(type) {
+	case int:
+		target = strconv.Itoa(value)
+	case string:
+		spec := value
+		if i := strings.Index(spec, "/"); i >= 0 {
+			spec, protocol = spec[:i], spec[i+1:]
+		}
+		parts := strings.Split(spec, ":")
+		target = parts[len(parts)-1]
+		if len(parts) > 1 {
+			published = parts[len(parts)-2]
+		}
+		if len(parts) > 2 {
+			s.warn(field, "the host IP %s is dropped", strings.Join(parts[:len(parts)-2], ":"))
+		}
+	case map[string]interface{}:
+		target = fmt.Sprint(value["target"])
+		if value["published"] != nil {
+			published = fmt.Sprint(value["published"])
+		}
+		protocol, _ = value["protocol"].(string)
+		for _, key := range sortedKeys(value) {
+			if !containsString([]string{"target", "published", "protocol", "mode", "name"}, key) {
+				s.warn(field+"."+key, "not supported")
+			}
+		}
+	default:
+		s.warn(field, "unrecognized port %v", value)
+		return
+	}
+	if protocol != "" && protocol != "tcp" {
+		s.warn(field, "%s ports are not supported", protocol)
+		return
+	}
+	var err error
+	if p.target, err = strconv.Atoi(target); err != nil {
+		s.warn(field, "port ranges such as %s are not supported", target)
+		return
+	}
+	if published != "" && !expose {
+		if p.published, err = strconv.Atoi(published); err != nil {
+			s.warn(field, "published port ranges such as %s are not supported", published)
+			return
+		}
+	}
+	s.ports = append(s.ports, p)
+}
+
+// services adds a container port for each target port and a service that
+// exposes them
+func (s *composeService) services() {
+	if len(s.ports) == 0 {
+		return
+	}
+	svc := Service{Name: s.d.Name, Type: "ClusterIP"}
+	targets := map[int]bool{}
+	servicePorts := map[int]bool{}
+	for _, p := range s.ports {
+		if !targets[p.target] {
+			targets[p.target] = true
+			s.c.Ports = append(s.c.Ports, ContainerPort{Name: fmt.Sprintf("port-%d", p.target), ContainerPort: p.target, ServicePort: p.target})
+		}
+		port := p.target
+		if p.published != 0 {
+			port = p.published
+			svc.Type = "LoadBalancer"
+		}
+		if !servicePorts[port] {
+			servicePorts[port] = true
+			svc.Ports = append(svc.Ports, ServicePort{Name: fmt.Sprintf("port-%d", port), Port: port, TargetPort: p.target})
+		}
+	}
+	s.d.Services = []Service{svc}
+}
+
+// environment reads a mapping or a list of NAME=value strings
+func (s *composeService) environment(value interface{}) {
+	set := func(field, name string, value interface{}) {
+		if value == nil {
+			s.warn(field, "%s takes its value from the shell running compose; it is dropped", name)
+			return
+		}
+		v := fmt.Sprint(value)
+		if strings.Contains(v, "${") {
+			s.warn(field, "%s uses variable interpolation; set its value before deploying", name)
+		}
+		s.c.EnvironmentVariables = setEnv(s.c.EnvironmentVariables, EnvVar{Name: name, Value: v})
+	}
+	switch env := value.(type) {
+	case map[string]interface{}:
+		for _, name := range sortedKeys(env) {
+			set("environment."+name, name, env[name])
+		}
+	case []interface{}:
+		for i, e := range env {
+			pair := fmt.Sprint(e)
+			field := fmt.Sprintf("environment[%d]", i)
+			if i := strings.Index(pair, "="); i >= 0 {
+				set(field, pair[:i], pair[i+1:])
+			} else {
+				set(field, pair, nil)
+			}
+		}
+	}
+}
+
+// deploy reads the replicas, resources and update_config of deploy
+func (s *composeService) deploy(value interface{}) {
+	deploy, _ := value.(map[string]interface{})
+	for _, key := range sortedKeys(deploy) {
+		field := "deploy." + key
+		switch key {
+		case "replicas":
+			s.replicas(field, deploy[key])
+		case "resources":
+			resources, _ := deploy[key].(map[string]interface{})
+			for _, kind := range sortedKeys(resources) {
+				list, _ := resources[kind].(map[string]interface{})
+				var target *ResourceList
+				switch kind {
+				case "limits":
+					target = &s.c.Resources.Limits
+				case "reservations":
+					target = &s.c.Resources.Requests
+				default:
+					s.warn(field+"."+kind, "not supported")
+					continue
+				}
+				for _, name := range sortedKeys(list) {
+					resourceField := field + "." + kind + "." + name
+					switch name {
+					case "cpus":
+						target.CPU = s.cpu(resourceField, list[name])
+					case "memory":
+						target.Memory = s.memory(resourceField, list[name])
+					default:
+						s.warn(resourceField, "only cpus and memory are supported")
+					}
+				}
+			}
+		case "update_config":
+			s.updateConfig(field, deploy[key])
+		default:
+			s.warn(field, "not supported")
+		}
+	}
+}
+
+// updateConfig maps the parallelism and order of updates to a rolling
+// update: start-first surges by parallelism, stop-first takes down
+// parallelism replicas at a time
+func (s *composeService) updateConfig(field string, value interface{}) {
+	config, _ := value.(map[string]interface{})
+	parallelism := 1
+	order := "stop-first"
+	for _, key := range sortedKeys(config) {
+		switch key {
+		case "parallelism":
+			parallelism, _ = config[key].(int)
+		case "order":
+			order = fmt.Sprint(config[key])
+		default:
+			s.warn(field+"."+key, "not supported")
+		}
+	}
+	// A parallelism of 0 updates every replica at once
+	if parallelism <= 0 || parallelism > s.d.Replicas {
+		parallelism = s.d.Replicas
+	}
+	s.d.Strategy = DeploymentStrategy{Type: StrategyRollingUpdate}
+	if order == "start-first" {
+		s.d.Strategy.MaxSurge = parallelism
+	} else {
+		s.d.Strategy.MaxUnavailable = parallelism
+	}
+}
+
+// healthCheck converts a test that requests a URL on localhost, such as
+// "curl -f http://localhost:8080/health", to an HTTP check and any other
+// test to an exec check
+func (s *composeService) healthCheck(value interface{}) {
+	hc, _ := value.(map[string]interface{})
+	if disable, _ := hc["disable"].(bool); disable {
+		return
+	}
+	var command string
+	var exec []string
+	switch test := hc["test"].(type) {
+	case string:
+		command = test
+		exec = []string{"/bin/sh", "-c", test}
+	case []interface{}:
+		words := make([]string, len(test))
+		for i, w := range test {
+			words[i] = fmt.Sprint(w)
+		}
+		if len(words) > 0 && words[0] == "NONE" {
+			return
+		}
+		shell := len(words) > 0 && words[0] == "CMD-SHELL"
+		if len(words) > 0 && (words[0] == "CMD" || shell) {
+			words = words[1:]
+		}
+		command = strings.Join(words, " ")
+		exec = words
+		if shell {
+			exec = []string{"/bin/sh", "-c", command}
+		}
+	}
+	h := &HealthCheck{PeriodSeconds: 30, TimeoutSeconds: 30, SuccessThreshold: 1, FailureThreshold: 3}
+	m := composeURLPattern.FindStringSubmatch(command)
+	switch {
+	case m != nil:
+		h.HTTPPath, h.Port = m[3], 80
+	case len(exec) > 0:
+		h.Command = exec
+	default:
+		s.warn("healthcheck.test", "no test; the health check is dropped")
+		return
+	}
+	if m != nil && m[1] == "https" {
+		h.Port = 443
+	}
+	if m != nil && m[2] != "" {
+		h.Port, _ = strconv.Atoi(m[2])
+	}
+	if m != nil && h.HTTPPath == "" {
+		h.HTTPPath = "/"
+	}
+	for _, key := range sortedKeys(hc) {
+		field := "healthcheck." + key
+		switch key {
+		case "test", "disable":
+		case "interval":
+			h.PeriodSeconds = s.seconds(field, hc[key], h.PeriodSeconds)
+		case "timeout":
+			h.TimeoutSeconds = s.seconds(field, hc[key], h.TimeoutSeconds)
+		case "start_period":
+			h.InitialDelaySeconds = s.seconds(field, hc[key], 0)
+		case "retries":
+			if retries, ok := hc[key].(int); ok {
+				h.FailureThreshold = retries
+			}
+		default:
+			s.warn(field, "not supported")
+		}
+	}
+	s.c.HealthCheck = h
+}
+
+func (s *composeService) replicas(field string, value interface{}) {
+	replicas, ok := value.(int)
+	if !ok {
+		s.warn(field, "%v is not a number of replicas", value)
+		return
+	}
+	s.d.Replicas = replicas
+}
+
+// cpu parses a number of cores such as 0.5
+func (s *composeService) cpu(field string, value interface{}) Quantity {
+	q, err := ParseQuantity(fmt.Sprint(value))
+	if err != nil || q.Format() != DecimalSI {
+		s.warn(field, "%v is not a number of CPUs", value)
+		return Quantity{}
+	}
+	return q
+}
+
+// memory parses a byte count or an amount with a b, k, m or g unit, which
+// docker reads as powers of 1024
+func (s *composeService) memory(field string, value interface{}) Quantity {
+	m := composeMemoryPattern.FindStringSubmatch(fmt.Sprint(value))
+	if m == nil {
+		s.warn(field, "%v is not an amount of memory", value)
+		return Quantity{}
+	}
+	suffix := map[string]string{"": "", "b": "", "k": "Ki", "m": "Mi", "g": "Gi"}[strings.ToLower(m[2])]
+	q, err := ParseQuantity(m[1] + suffix)
+	if err != nil {
+		s.warn(field, "%v is not an amount of memory", value)
+		return Quantity{}
+	}
+	return NewMilliQuantity(q.MilliValue(), BinarySI)
+}
+
+// seconds parses a duration such as 1m30s, rounding up to whole seconds
+func (s *composeService) seconds(field string, value interface{}, def int) int {
+	d, err := time.ParseDuration(fmt.Sprint(value))
+	if err != nil {
+		s.warn(field, "%v is not a duration", value)
+		return def
+	}
+	return int((d + time.Second - 1) / time.Second)
+}
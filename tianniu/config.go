@@ -0,0 +1,195 @@
+package tianniu
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config represents the configuration for the TianNiu platform
+type Config struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name    string `yaml:"name"`
+		Version string `yaml:"version"`
+	} `yaml:"metadata"`
+	Environments []Environment `yaml:"environments"`
+}
+
+// Environment is one entry of the environments list in the TianNiu
+// configuration
+type Environment struct {
+	Name        string `yaml:"name"`
+	APIEndpoint string `yaml:"api_endpoint"`
+	Auth        struct {
+		Type            string `yaml:"type"`
+		APIKey          string `yaml:"api_key,omitempty"`
+		APIKeyEnv       string `yaml:"api_key_env,omitempty"`
+		ClientID        string `yaml:"client_id_env,omitempty"`
+		ClientSecretRef string `yaml:"client_secret,omitempty"`
+		ClientSecret    string `yaml:"client_secret_env,omitempty"`
+	} `yaml:"auth"`
+	Kubeconfig  string `yaml:"kubeconfig"`
+	MySQLConfig string `yaml:"mysql_config,omitempty"`
+	PolicyFile  string `yaml:"policy_file,omitempty"`
+	Default     bool   `yaml:"default"`
+}
+
+// DefaultConfigPath returns $TIANNIU_CONFIG, or ~/.tianniu/config.yaml
+func DefaultConfigPath() string {
+	if path := os.Getenv("TIANNIU_CONFIG"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".tianniu", "config.yaml")
+	}
+	return filepath.Join(home, ".tianniu", "config.yaml")
+}
+
+// LoadConfig loads the TianNiu configuration from a YAML file
+func LoadConfig(configPath string) (*Config, error) {
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// Environment returns the environment with the given name, or the default
+// environment when name is empty. A single environment is the default even
+// when it is not marked as such.
+func (c *Config) Environment(name string) (*Environment, error) {
+	for i := range c.Environments {
+		env := &c.Environments[i]
+		if (name == "" && env.Default) || (name != "" && env.Name == name) {
+			return env, nil
+		}
+	}
+	if name == "" && len(c.Environments) == 1 {
+		return &c.Environments[0], nil
+	}
+	if name == "" {
+		return nil, fmt.Errorf("no default environment found in configuration")
+	}
+	return nil, fmt.Errorf("environment %s not found in configuration", name)
+}
+
+// Validate checks the environments without resolving any secret, but
+// secret references must name a scheme DefaultSecretResolver supports. All
+// problems are returned together as ConfigErrors.
+func (c *Config) Validate() error {
+	var problems ConfigErrors
+	if len(c.Environments) == 0 {
+		problems = append(problems, "no environments defined")
+	}
+
+	seen := map[string]bool{}
+	defaults := 0
+	for i, env := range c.Environments {
+		prefix := fmt.Sprintf("environments[%d]", i)
+		if env.Name == "" {
+			problems = append(problems, prefix+": name is required")
+		} else {
+			prefix = "environment " + env.Name
+			if seen[env.Name] {
+				problems = append(problems, prefix+": defined more than once")
+			}
+			seen[env.Name] = true
+		}
+		if env.Default {
+			defaults++
+		}
+
+		if env.APIEndpoint != "" {
+			if u, err := url.Parse(env.APIEndpoint); err != nil || u.Scheme == "" || u.Host == "" {
+				problems = append(problems, fmt.Sprintf("%s: api_endpoint %q is not an absolute URL", prefix, env.APIEndpoint))
+			}
+		}
+		for _, c := range []struct{ field, ref, legacy string }{
+			{"api_key", env.Auth.APIKey, env.Auth.APIKeyEnv},
+			{"client_secret", env.Auth.ClientSecretRef, env.Auth.ClientSecret},
+		} {
+			if c.ref != "" && c.legacy != "" {
+				problems = append(problems, fmt.Sprintf("%s: %s and %s_env are mutually exclusive", prefix, c.field, c.field))
+			}
+			if c.ref != "" {
+				if err := DefaultSecretResolver.Check(c.ref); err != nil {
+					problems = append(problems, fmt.Sprintf("%s: %s: %v", prefix, c.field, err))
+				}
+			}
+		}
+	}
+	if defaults > 1 {
+		problems = append(problems, "more than one environment is marked default")
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// ResolveAPIKey resolves the API key of the environment. The auth api_key
+// field is a secret reference such as file:///run/secrets/tianniu-key;
+// api_key_env names an environment variable. TIANNIU_API_KEY is used when
+// neither is configured.
+func (e *Environment) ResolveAPIKey(ctx context.Context) (string, error) {
+	ref := e.Auth.APIKey
+	if ref == "" && e.Auth.APIKeyEnv != "" {
+		ref = "env:" + e.Auth.APIKeyEnv
+	}
+	if ref == "" {
+		ref = "env:TIANNIU_API_KEY"
+	}
+	return ResolveSecret(ctx, ref)
+}
+
+// ResolveClientSecret resolves the OAuth client secret of the environment.
+// The auth client_secret field is a secret reference; client_secret_env
+// names an environment variable.
+func (e *Environment) ResolveClientSecret(ctx context.Context) (string, error) {
+	ref := e.Auth.ClientSecretRef
+	if ref == "" && e.Auth.ClientSecret != "" {
+		ref = "env:" + e.Auth.ClientSecret
+	}
+	if ref == "" {
+		return "", fmt.Errorf("no client secret configured for environment %s", e.Name)
+	}
+	return ResolveSecret(ctx, ref)
+}
+
+// NewClient creates an API client for the environment
+func (e *Environment) NewClient(ctx context.Context, opts ...Option) (*Client, error) {
+	apiKey, err := e.ResolveAPIKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defaults := []Option{WithAPIKey(apiKey)}
+	if e.APIEndpoint != "" {
+		defaults = append(defaults, WithBaseURL(e.APIEndpoint))
+	}
+	return NewClient(append(defaults, opts...)...)
+}
+
+// MySQLConfigPath returns the MySQL configuration path of the environment.
+// Relative paths are resolved against the directory of the TianNiu
+// configuration file.
+func (e *Environment) MySQLConfigPath(configPath string) string {
+	if e.MySQLConfig == "" || filepath.IsAbs(e.MySQLConfig) {
+		return e.MySQLConfig
+	}
+	return filepath.Join(filepath.Dir(configPath), e.MySQLConfig)
+}
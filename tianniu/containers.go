@@ -0,0 +1,352 @@
+package tianniu
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Container represents a container in the TianNiu platform
+type Container struct {
+	ID                   string            `json:"id,omitempty"`
+	Name                 string            `json:"name"`
+	Image                string            `json:"image"`
+	Status               string            `json:"status,omitempty"`
+	CreatedAt            time.Time         `json:"created_at,omitempty"`
+	StartedAt            time.Time         `json:"started_at,omitempty"`
+	Labels               map[string]string `json:"labels,omitempty"`
+	Ports                []Port            `json:"ports,omitempty"`
+	Volumes              []Volume          `json:"volumes,omitempty"`
+	Network              ContainerNetwork  `json:"network,omitempty"`
+	ResourceLimits       ContainerLimits   `json:"resource_limits,omitempty"`
+	ResourceUsage        ResourceUsage     `json:"resource_usage,omitempty"`
+	EnvironmentVariables []EnvVar          `json:"environment_variables,omitempty"`
+	HealthCheck          *ContainerHealth  `json:"health_check,omitempty"`
+	LogsURL              string            `json:"logs_url,omitempty"`
+	Message              string            `json:"message,omitempty"`
+}
+
+// Port publishes an internal container port on an external port
+type Port struct {
+	Internal int    `json:"internal"`
+	External int    `json:"external"`
+	Protocol string `json:"protocol"`
+}
+
+// Volume mounts a host path into a container
+type Volume struct {
+	HostPath      string `json:"host_path"`
+	ContainerPath string `json:"container_path"`
+	Mode          string `json:"mode"`
+}
+
+// ContainerNetwork is the network a container is attached to
+type ContainerNetwork struct {
+	Name      string `json:"name"`
+	IPAddress string `json:"ip_address"`
+}
+
+// ContainerLimits caps the CPU and memory of a container, e.g. "1.0" and
+// "512MB"
+type ContainerLimits struct {
+	CPU    Quantity `json:"cpu,omitzero"`
+	Memory Quantity `json:"memory,omitzero"`
+}
+
+// ResourceUsage is the current resource usage of a container as reported by
+// the API, e.g. "0.05", "128MB" and "1.2MB/s"
+type ResourceUsage struct {
+	CPU       Quantity `json:"cpu"`
+	Memory    Quantity `json:"memory"`
+	NetworkRX string   `json:"network_rx"`
+	NetworkTX string   `json:"network_tx"`
+}
+
+// ContainerHealth is the health check of a container and its last result
+type ContainerHealth struct {
+	Status      string    `json:"status,omitempty"`
+	LastChecked time.Time `json:"last_checked,omitempty"`
+	Endpoint    string    `json:"endpoint,omitempty"`
+	Interval    string    `json:"interval"`
+	Timeout     string    `json:"timeout"`
+	Retries     int       `json:"retries"`
+	// Command is run in the container instead of requesting Endpoint
+	Command []string `json:"command,omitempty"`
+}
+
+// RestartPolicy tells the platform when to restart a container
+type RestartPolicy struct {
+	Type       string `json:"type"`
+	MaxRetries int    `json:"max_retries,omitempty"`
+}
+
+// ContainerList represents a list of containers
+type ContainerList struct {
+	Total      int         `json:"total"`
+	Limit      int         `json:"limit"`
+	Offset     int         `json:"offset"`
+	Containers []Container `json:"containers"`
+}
+
+// ContainerListOptions narrows a container list. Zero-valued fields are not
+// sent.
+type ContainerListOptions struct {
+	Status        string
+	LabelSelector string
+	Limit         int
+	Offset        int
+}
+
+// ContainerCreateOptions is the request body of a container create
+type ContainerCreateOptions struct {
+	Name                 string            `json:"name"`
+	Image                string            `json:"image"`
+	Labels               map[string]string `json:"labels,omitempty"`
+	Ports                []Port            `json:"ports,omitempty"`
+	Volumes              []Volume          `json:"volumes,omitempty"`
+	Network              string            `json:"network,omitempty"`
+	ResourceLimits       *ContainerLimits  `json:"resource_limits,omitempty"`
+	EnvironmentVariables []EnvVar          `json:"environment_variables,omitempty"`
+	HealthCheck          *ContainerHealth  `json:"health_check,omitempty"`
+	RestartPolicy        *RestartPolicy    `json:"restart_policy,omitempty"`
+}
+
+// ContainersService talks to the /containers endpoints
+type ContainersService struct {
+	client *Client
+}
+
+// List lists containers
+func (s *ContainersService) List(ctx context.Context, opts ContainerListOptions) (*ContainerList, error) {
+	query := url.Values{}
+	if opts.Status != "" {
+		query.Set("status", opts.Status)
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Offset > 0 {
+		query.Set("offset", strconv.Itoa(opts.Offset))
+	}
+	if opts.LabelSelector != "" {
+		selector, err := ParseSelector(opts.LabelSelector)
+		if err != nil {
+			return nil, err
+		}
+		query.Set("label", selector.String())
+	}
+
+	var list ContainerList
+	if err := s.client.call(ctx, "GET", "/containers", query, nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// listAll lists all containers matching opts, page by page
+func (s *ContainersService) listAll(ctx context.Context, opts ContainerListOptions) ([]Container, error) {
+	opts.Limit, opts.Offset = 100, 0
+	var containers []Container
+	for {
+		page, err := s.List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		containers = append(containers, page.Containers...)
+		opts.Offset += len(page.Containers)
+		if len(page.Containers) == 0 || opts.Offset >= page.Total {
+			return containers, nil
+		}
+	}
+}
+
+// Get gets a container by ID
+func (s *ContainersService) Get(ctx context.Context, id string) (*Container, error) {
+	var container Container
+	if err := s.client.call(ctx, "GET", containerPath(id), nil, nil, &container); err != nil {
+		return nil, err
+	}
+	return &container, nil
+}
+
+// Create creates a new container
+func (s *ContainersService) Create(ctx context.Context, opts ContainerCreateOptions) (*Container, error) {
+	var container Container
+	if err := s.client.call(ctx, "POST", "/containers", nil, opts, &container); err != nil {
+		return nil, err
+	}
+	return &container, nil
+}
+
+// Start starts a container
+func (s *ContainersService) Start(ctx context.Context, id string) (*Container, error) {
+	var container Container
+	if err := s.client.call(ctx, "POST", containerPath(id)+"/start", nil, nil, &container); err != nil {
+		return nil, err
+	}
+	return &container, nil
+}
+
+// Stop stops a container, waiting up to timeout for it to exit gracefully.
+// A zero timeout uses the server default.
+func (s *ContainersService) Stop(ctx context.Context, id string, timeout time.Duration) (*Container, error) {
+	var container Container
+	if err := s.client.call(ctx, "POST", containerPath(id)+"/stop", timeoutQuery(timeout), nil, &container); err != nil {
+		return nil, err
+	}
+	return &container, nil
+}
+
+// Delete deletes a container
+func (s *ContainersService) Delete(ctx context.Context, id string, force, removeVolumes bool) (*Container, error) {
+	query := url.Values{}
+	if force {
+		query.Set("force", "true")
+	}
+	if removeVolumes {
+		query.Set("remove_volumes", "true")
+	}
+
+	var container Container
+	if err := s.client.call(ctx, "DELETE", containerPath(id), query, nil, &container); err != nil {
+		return nil, err
+	}
+	return &container, nil
+}
+
+// Restart restarts a container, waiting up to timeout for it to stop
+// gracefully. A zero timeout uses the server default.
+func (s *ContainersService) Restart(ctx context.Context, id string, timeout time.Duration) (*Container, error) {
+	var container Container
+	if err := s.client.call(ctx, "POST", containerPath(id)+"/restart", timeoutQuery(timeout), nil, &container); err != nil {
+		return nil, err
+	}
+	return &container, nil
+}
+
+// Pause suspends the processes of a running container
+func (s *ContainersService) Pause(ctx context.Context, id string) (*Container, error) {
+	var container Container
+	if err := s.client.call(ctx, "POST", containerPath(id)+"/pause", nil, nil, &container); err != nil {
+		return nil, err
+	}
+	return &container, nil
+}
+
+// Unpause resumes a paused container
+func (s *ContainersService) Unpause(ctx context.Context, id string) (*Container, error) {
+	var container Container
+	if err := s.client.call(ctx, "POST", containerPath(id)+"/unpause", nil, nil, &container); err != nil {
+		return nil, err
+	}
+	return &container, nil
+}
+
+// ContainerStats is a sample of the resource usage of a container
+type ContainerStats struct {
+	ContainerID string       `json:"container_id"`
+	Timestamp   time.Time    `json:"timestamp"`
+	CPU         CPUStats     `json:"cpu"`
+	Memory      MemoryStats  `json:"memory"`
+	Network     NetworkStats `json:"network"`
+	IO          BlockIOStats `json:"io"`
+}
+
+// CPUStats is the CPU usage of a container
+type CPUStats struct {
+	UsagePercent   float64 `json:"usage_percent"`
+	SystemCPUUsage float64 `json:"system_cpu_usage"`
+	OnlineCPUs     int     `json:"online_cpus"`
+}
+
+// MemoryStats is the memory usage of a container in bytes
+type MemoryStats struct {
+	Usage        int64   `json:"usage"`
+	Limit        int64   `json:"limit"`
+	UsagePercent float64 `json:"usage_percent"`
+}
+
+// NetworkStats are the network counters of a container
+type NetworkStats struct {
+	RxBytes   int64 `json:"rx_bytes"`
+	RxPackets int64 `json:"rx_packets"`
+	RxErrors  int64 `json:"rx_errors"`
+	RxDropped int64 `json:"rx_dropped"`
+	TxBytes   int64 `json:"tx_bytes"`
+	TxPackets int64 `json:"tx_packets"`
+	TxErrors  int64 `json:"tx_errors"`
+	TxDropped int64 `json:"tx_dropped"`
+}
+
+// BlockIOStats are the disk counters of a container
+type BlockIOStats struct {
+	ReadOps    int64 `json:"read_ops"`
+	WriteOps   int64 `json:"write_ops"`
+	ReadBytes  int64 `json:"read_bytes"`
+	WriteBytes int64 `json:"write_bytes"`
+}
+
+// Stats gets the current resource usage of a container
+func (s *ContainersService) Stats(ctx context.Context, id string) (*ContainerStats, error) {
+	var stats ContainerStats
+	if err := s.client.call(ctx, "GET", containerPath(id)+"/stats", nil, nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// ExecOptions is the request body of a command run in a container.
+// Command is required.
+type ExecOptions struct {
+	Command      []string `json:"command"`
+	Env          []EnvVar `json:"env,omitempty"`
+	WorkingDir   string   `json:"working_dir,omitempty"`
+	User         string   `json:"user,omitempty"`
+	TTY          bool     `json:"tty"`
+	AttachStdin  bool     `json:"attach_stdin"`
+	AttachStdout bool     `json:"attach_stdout"`
+	AttachStderr bool     `json:"attach_stderr"`
+}
+
+// ExecResult is the exit code and output of a command run in a container
+type ExecResult struct {
+	ExitCode int    `json:"exit_code"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+}
+
+// Exec runs a command in a running container and waits for it to exit. A
+// non-zero exit code is not an error.
+func (s *ContainersService) Exec(ctx context.Context, id string, opts ExecOptions) (*ExecResult, error) {
+	if len(opts.Command) == 0 {
+		return nil, fmt.Errorf("exec: command is required")
+	}
+	var result ExecResult
+	if err := s.client.call(ctx, "POST", containerPath(id)+"/exec", nil, opts, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func containerPath(id string) string {
+	return "/containers/" + url.PathEscape(id)
+}
+
+// timeoutQuery encodes a graceful-stop timeout in whole seconds
+func timeoutQuery(timeout time.Duration) url.Values {
+	query := url.Values{}
+	if timeout > 0 {
+		query.Set("timeout", strconv.Itoa(timeoutSeconds(timeout)))
+	}
+	return query
+}
+
+// timeoutSeconds rounds a graceful-stop timeout up to whole seconds
+func timeoutSeconds(timeout time.Duration) int {
+	if timeout <= 0 {
+		return 0
+	}
+	return int((timeout + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,544 @@
+package tianniu
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// ListFilter narrows a container or deployment list query. Zero-valued
+// fields are ignored.
+type ListFilter struct {
+	Status        string
+	Environment   string
+	NamePrefix    string
+	LabelSelector string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Limit         int
+	Cursor        string
+}
+
+// ContainerPage is one page of a keyset-paginated container list
+type ContainerPage struct {
+	Containers []Container `json:"containers"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// DeploymentPage is one page of a keyset-paginated deployment list
+type DeploymentPage struct {
+	Deployments []Deployment `json:"deployments"`
+	NextCursor  string       `json:"next_cursor,omitempty"`
+}
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 1000
+)
+
+// DBClient represents a database client
+type DBClient struct {
+	DB     *sql.DB
+	Config *MySQLConfig
+	Env    string
+}
+
+// NewDBClient creates a new database client
+func NewDBClient(configPath, env string) (*DBClient, error) {
+	// Load configuration
+	config, err := LoadMySQLConfig(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %v", err)
+	}
+
+	// Validate the whole configuration before touching the network
+	if err := config.Validate(env); err != nil {
+		return nil, err
+	}
+	envConfig := config.Environment(env)
+
+	// Resolve credentials through the secret providers
+	username, err := ResolveSecret(context.Background(), credentialRef(envConfig.Username, envConfig.UsernameEnv))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve username: %v", err)
+	}
+	password, err := ResolveSecret(context.Background(), credentialRef(envConfig.Password, envConfig.PasswordEnv))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve password: %v", err)
+	}
+
+	// Add SSL options if required
+	tlsName, err := registerTLSConfig(envConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build DSN
+	dsn, err := config.FormatDSN(envConfig, username, password, tlsName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Connect to database
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+
+	// Configure connection pool
+	maxOpen := envConfig.MaxOpenConns
+	if maxOpen == 0 {
+		maxOpen = envConfig.MaxConnections
+	}
+	db.SetMaxOpenConns(maxOpen)
+	db.SetMaxIdleConns(envConfig.MaxIdleConns)
+
+	connMaxLifetime, _ := parseOptionalDuration(envConfig.ConnMaxLifetime)
+	db.SetConnMaxLifetime(connMaxLifetime)
+
+	// Test connection
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %v", err)
+	}
+
+	return &DBClient{
+		DB:     db,
+		Config: config,
+		Env:    env,
+	}, nil
+}
+
+// Close closes the database connection
+func (c *DBClient) Close() error {
+	return c.DB.Close()
+}
+
+// GetContainers gets the most recently created containers
+func (c *DBClient) GetContainers(limit int) ([]Container, error) {
+	page, err := c.ListContainers(ListFilter{Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+	return page.Containers, nil
+}
+
+// ListContainers gets one page of containers matching the filter, newest
+// first. Containers have no environment column, so Environment is matched
+// against the "environment" label.
+func (c *DBClient) ListContainers(filter ListFilter) (*ContainerPage, error) {
+	selector, err := ParseSelector(filter.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	if filter.Environment != "" {
+		selector, err = selector.Add("environment", OpEquals, filter.Environment)
+		if err != nil {
+			return nil, err
+		}
+		filter.Environment = ""
+	}
+
+	where, args, limit, err := buildListConditions(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if !selector.Empty() {
+		cond, condArgs, err := selector.MySQLCondition("labels")
+		if err != nil {
+			return nil, err
+		}
+		where = appendCondition(where, cond)
+		args = append(args, condArgs...)
+	}
+
+	query := "SELECT id, name, image, status, created_at, labels FROM containers" + where +
+		" ORDER BY created_at DESC, id DESC LIMIT ?"
+	rows, err := c.DB.Query(query, append(args, limit+1)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query containers: %v", err)
+	}
+	defer rows.Close()
+
+	var containers []Container
+	for rows.Next() {
+		var container Container
+		var labels sql.NullString
+		if err := rows.Scan(&container.ID, &container.Name, &container.Image, &container.Status, &container.CreatedAt, &labels); err != nil {
+			return nil, fmt.Errorf("failed to scan container row: %v", err)
+		}
+		if container.Labels, err = decodeLabels(labels); err != nil {
+			return nil, fmt.Errorf("container %s: %v", container.ID, err)
+		}
+		containers = append(containers, container)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating container rows: %v", err)
+	}
+
+	page := &ContainerPage{Containers: containers}
+	if len(containers) > limit {
+		page.Containers = containers[:limit]
+		last := page.Containers[limit-1]
+		page.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+
+	return page, nil
+}
+
+// GetContainerByID gets a container by ID
+func (c *DBClient) GetContainerByID(id string) (*Container, error) {
+	query := "SELECT id, name, image, status, created_at, labels FROM containers WHERE id = ?"
+	row := c.DB.QueryRow(query, id)
+
+	var container Container
+	var labels sql.NullString
+	if err := row.Scan(&container.ID, &container.Name, &container.Image, &container.Status, &container.CreatedAt, &labels); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("container with ID %s not found", id)
+		}
+		return nil, fmt.Errorf("failed to scan container row: %v", err)
+	}
+
+	var err error
+	if container.Labels, err = decodeLabels(labels); err != nil {
+		return nil, fmt.Errorf("container %s: %v", container.ID, err)
+	}
+
+	return &container, nil
+}
+
+// CreateContainer creates a new container
+func (c *DBClient) CreateContainer(container *Container) error {
+	var labels interface{}
+	if len(container.Labels) > 0 {
+		data, err := json.Marshal(container.Labels)
+		if err != nil {
+			return fmt.Errorf("failed to encode labels: %v", err)
+		}
+		labels = string(data)
+	}
+
+	query := "INSERT INTO containers (id, name, image, status, created_at, labels) VALUES (?, ?, ?, ?, ?, ?)"
+	_, err := c.DB.Exec(query, container.ID, container.Name, container.Image, container.Status, container.CreatedAt, labels)
+	if err != nil {
+		return fmt.Errorf("failed to create container: %v", err)
+	}
+	return nil
+}
+
+// UpdateContainerStatus updates a container's status
+func (c *DBClient) UpdateContainerStatus(id, status string) error {
+	query := "UPDATE containers SET status = ? WHERE id = ?"
+	result, err := c.DB.Exec(query, status, id)
+	if err != nil {
+		return fmt.Errorf("failed to update container status: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("container with ID %s not found", id)
+	}
+
+	return nil
+}
+
+// DeleteContainer deletes a container
+func (c *DBClient) DeleteContainer(id string) error {
+	query := "DELETE FROM containers WHERE id = ?"
+	result, err := c.DB.Exec(query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete container: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("container with ID %s not found", id)
+	}
+
+	return nil
+}
+
+// GetDeployments gets the most recently created deployments
+func (c *DBClient) GetDeployments(limit int) ([]Deployment, error) {
+	page, err := c.ListDeployments(ListFilter{Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+	return page.Deployments, nil
+}
+
+// ListDeployments gets one page of deployments matching the filter, newest
+// first. Deployments carry no labels of their own: a deployment matches the
+// label selector when any container row named in its spec matches it.
+func (c *DBClient) ListDeployments(filter ListFilter) (*DeploymentPage, error) {
+	selector, err := ParseSelector(filter.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	where, args, limit, err := buildListConditions(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if !selector.Empty() {
+		cond, condArgs, err := selector.MySQLCondition("c.labels")
+		if err != nil {
+			return nil, err
+		}
+		where = appendCondition(where, "EXISTS (SELECT 1 FROM containers c WHERE "+
+			"JSON_CONTAINS(deployments.containers, JSON_OBJECT('name', c.name)) AND "+cond+")")
+		args = append(args, condArgs...)
+	}
+
+	query := "SELECT id, name, description, status, environment, created_at, version, replicas FROM deployments" + where +
+		" ORDER BY created_at DESC, id DESC LIMIT ?"
+	rows, err := c.DB.Query(query, append(args, limit+1)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deployments: %v", err)
+	}
+	defer rows.Close()
+
+	var deployments []Deployment
+	for rows.Next() {
+		var deployment Deployment
+		var description sql.NullString
+		if err := rows.Scan(&deployment.ID, &deployment.Name, &description, &deployment.Status, &deployment.Environment, &deployment.CreatedAt, &deployment.Version, &deployment.Replicas); err != nil {
+			return nil, fmt.Errorf("failed to scan deployment row: %v", err)
+		}
+		deployment.Description = description.String
+		deployments = append(deployments, deployment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating deployment rows: %v", err)
+	}
+
+	page := &DeploymentPage{Deployments: deployments}
+	if len(deployments) > limit {
+		page.Deployments = deployments[:limit]
+		last := page.Deployments[limit-1]
+		page.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+
+	return page, nil
+}
+
+// GetDeploymentByID gets a deployment by ID
+func (c *DBClient) GetDeploymentByID(id string) (*Deployment, error) {
+	query := "SELECT id, name, description, status, environment, created_at, version, replicas FROM deployments WHERE id = ?"
+	row := c.DB.QueryRow(query, id)
+
+	var deployment Deployment
+	var description sql.NullString
+	if err := row.Scan(&deployment.ID, &deployment.Name, &description, &deployment.Status, &deployment.Environment, &deployment.CreatedAt, &deployment.Version, &deployment.Replicas); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("deployment with ID %s not found", id)
+		}
+		return nil, fmt.Errorf("failed to scan deployment row: %v", err)
+	}
+	deployment.Description = description.String
+
+	return &deployment, nil
+}
+
+// CreateDeployment creates a new deployment
+func (c *DBClient) CreateDeployment(deployment *Deployment) error {
+	containers := deployment.Containers
+	if containers == nil {
+		containers = []DeploymentContainer{}
+	}
+	containersJSON, err := json.Marshal(containers)
+	if err != nil {
+		return fmt.Errorf("failed to encode containers: %v", err)
+	}
+
+	query := "INSERT INTO deployments (id, name, description, status, environment, created_at, version, replicas, containers) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	_, err = c.DB.Exec(query, deployment.ID, deployment.Name, deployment.Description, deployment.Status, deployment.Environment, deployment.CreatedAt, deployment.Version, deployment.Replicas, string(containersJSON))
+	if err != nil {
+		return fmt.Errorf("failed to create deployment: %v", err)
+	}
+	return nil
+}
+
+// UpdateDeploymentStatus updates a deployment's status
+func (c *DBClient) UpdateDeploymentStatus(id, status string) error {
+	query := "UPDATE deployments SET status = ? WHERE id = ?"
+	result, err := c.DB.Exec(query, status, id)
+	if err != nil {
+		return fmt.Errorf("failed to update deployment status: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("deployment with ID %s not found", id)
+	}
+
+	return nil
+}
+
+// ScaleDeployment scales a deployment
+func (c *DBClient) ScaleDeployment(id string, replicas int) error {
+	query := "UPDATE deployments SET replicas = ? WHERE id = ?"
+	result, err := c.DB.Exec(query, replicas, id)
+	if err != nil {
+		return fmt.Errorf("failed to scale deployment: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("deployment with ID %s not found", id)
+	}
+
+	return nil
+}
+
+// DeleteDeployment deletes a deployment
+func (c *DBClient) DeleteDeployment(id string) error {
+	query := "DELETE FROM deployments WHERE id = ?"
+	result, err := c.DB.Exec(query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete deployment: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("deployment with ID %s not found", id)
+	}
+
+	return nil
+}
+
+// buildListConditions turns a filter into a WHERE clause, its arguments and
+// the effective page size. The clause is empty when nothing is filtered.
+func buildListConditions(filter ListFilter) (string, []interface{}, int, error) {
+	var conds []string
+	var args []interface{}
+
+	if filter.Status != "" {
+		conds = append(conds, "status = ?")
+		args = append(args, filter.Status)
+	}
+
+	if filter.Environment != "" {
+		conds = append(conds, "environment = ?")
+		args = append(args, filter.Environment)
+	}
+
+	if filter.NamePrefix != "" {
+		conds = append(conds, "name LIKE ?")
+		args = append(args, escapeLike(filter.NamePrefix)+"%")
+	}
+
+	if !filter.CreatedAfter.IsZero() {
+		conds = append(conds, "created_at >= ?")
+		args = append(args, filter.CreatedAfter)
+	}
+
+	if !filter.CreatedBefore.IsZero() {
+		conds = append(conds, "created_at < ?")
+		args = append(args, filter.CreatedBefore)
+	}
+
+	if filter.Cursor != "" {
+		createdAt, id, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return "", nil, 0, err
+		}
+		conds = append(conds, "(created_at < ? OR (created_at = ? AND id < ?))")
+		args = append(args, createdAt, createdAt, id)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	if len(conds) == 0 {
+		return "", args, limit, nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args, limit, nil
+}
+
+// appendCondition adds one more condition to a WHERE clause built by
+// buildListConditions
+func appendCondition(where, cond string) string {
+	if where == "" {
+		return " WHERE " + cond
+	}
+	return where + " AND " + cond
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// encodeCursor builds an opaque keyset cursor from the last row of a page
+func encodeCursor(createdAt time.Time, id string) string {
+	raw := createdAt.UTC().Format(time.RFC3339Nano) + "|" + id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor parses a cursor produced by encodeCursor
+func decodeCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("invalid cursor: %v", err)
+	}
+
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return time.Time{}, "", fmt.Errorf("invalid cursor: malformed value")
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("invalid cursor: %v", err)
+	}
+
+	return createdAt, parts[1], nil
+}
+
+// decodeLabels parses the JSON labels column; NULL means no labels
+func decodeLabels(column sql.NullString) (map[string]string, error) {
+	if !column.Valid || column.String == "" {
+		return nil, nil
+	}
+	var labels map[string]string
+	if err := json.Unmarshal([]byte(column.String), &labels); err != nil {
+		return nil, fmt.Errorf("invalid labels: %v", err)
+	}
+	return labels, nil
+}
@@ -0,0 +1,214 @@
+package tianniu
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Deployment represents a deployment in the TianNiu platform
+type Deployment struct {
+	ID          string                `json:"id,omitempty"`
+	Name        string                `json:"name"`
+	Description string                `json:"description,omitempty"`
+	Status      string                `json:"status,omitempty"`
+	Environment string                `json:"environment"`
+	CreatedAt   time.Time             `json:"created_at,omitempty"`
+	UpdatedAt   time.Time             `json:"updated_at,omitempty"`
+	Version     string                `json:"version"`
+	Replicas    int                   `json:"replicas"`
+	Strategy    DeploymentStrategy    `json:"strategy,omitempty"`
+	Containers  []DeploymentContainer `json:"containers,omitempty"`
+	Services    []Service             `json:"services,omitempty"`
+	Message     string                `json:"message,omitempty"`
+}
+
+// DeploymentStrategy controls how a deployment rolls out new versions
+type DeploymentStrategy struct {
+	Type           string `json:"type"`
+	MaxSurge       int    `json:"max_surge,omitempty"`
+	MaxUnavailable int    `json:"max_unavailable,omitempty"`
+}
+
+// DeploymentContainer is the container template of a deployment
+type DeploymentContainer struct {
+	Name                 string               `json:"name"`
+	Image                string               `json:"image"`
+	Ports                []ContainerPort      `json:"ports,omitempty"`
+	Resources            ResourceRequirements `json:"resources,omitempty"`
+	EnvironmentVariables []EnvVar             `json:"environment_variables,omitempty"`
+	HealthCheck          *HealthCheck         `json:"health_check,omitempty"`
+}
+
+// ContainerPort exposes a container port through a service port
+type ContainerPort struct {
+	Name          string `json:"name"`
+	ContainerPort int    `json:"container_port"`
+	ServicePort   int    `json:"service_port"`
+}
+
+// ResourceRequirements holds the CPU and memory limits and requests of a
+// container
+type ResourceRequirements struct {
+	Limits   ResourceList `json:"limits,omitempty"`
+	Requests ResourceList `json:"requests,omitempty"`
+}
+
+// ResourceList is an amount of CPU and memory, e.g. "0.5" and "512Mi"
+type ResourceList struct {
+	CPU    Quantity `json:"cpu,omitzero"`
+	Memory Quantity `json:"memory,omitzero"`
+}
+
+// EnvVar is an environment variable, set either to a literal value or from
+// a secret
+type EnvVar struct {
+	Name      string        `json:"name"`
+	Value     string        `json:"value,omitempty"`
+	ValueFrom *EnvVarSource `json:"value_from,omitempty"`
+}
+
+// EnvVarSource references a key of a platform secret
+type EnvVarSource struct {
+	SecretName string `json:"secret_name"`
+	Key        string `json:"key"`
+}
+
+// HealthCheck is the health check of a deployment container: an HTTP GET
+// of HTTPPath on Port, a TCP connection to TCPPort, or a Command run in the
+// container. Probe converts it to the model shared with containers.
+type HealthCheck struct {
+	HTTPPath            string   `json:"http_path,omitempty"`
+	Port                int      `json:"port,omitempty"`
+	TCPPort             int      `json:"tcp_port,omitempty"`
+	Command             []string `json:"command,omitempty"`
+	InitialDelaySeconds int      `json:"initial_delay_seconds"`
+	PeriodSeconds       int      `json:"period_seconds"`
+	TimeoutSeconds      int      `json:"timeout_seconds"`
+	SuccessThreshold    int      `json:"success_threshold"`
+	FailureThreshold    int      `json:"failure_threshold"`
+}
+
+// Service exposes the containers of a deployment
+type Service struct {
+	Name              string        `json:"name"`
+	Type              string        `json:"type"`
+	Ports             []ServicePort `json:"ports,omitempty"`
+	ExternalEndpoints []string      `json:"external_endpoints,omitempty"`
+}
+
+// ServicePort maps a service port to a target port
+type ServicePort struct {
+	Name       string `json:"name"`
+	Port       int    `json:"port"`
+	TargetPort int    `json:"target_port"`
+}
+
+// DeploymentList represents a list of deployments
+type DeploymentList struct {
+	Total       int          `json:"total"`
+	Limit       int          `json:"limit"`
+	Offset      int          `json:"offset"`
+	Deployments []Deployment `json:"deployments"`
+}
+
+// DeploymentListOptions narrows a deployment list. Zero-valued fields are
+// not sent.
+type DeploymentListOptions struct {
+	Status        string
+	Environment   string
+	LabelSelector string
+	Limit         int
+	Offset        int
+}
+
+// DeploymentsService talks to the /deployments endpoints
+type DeploymentsService struct {
+	client *Client
+}
+
+// List lists deployments, optionally narrowed by a label selector such as
+// "app=web,team in (backend,data)"
+func (s *DeploymentsService) List(ctx context.Context, opts DeploymentListOptions) (*DeploymentList, error) {
+	query := url.Values{}
+	if opts.Status != "" {
+		query.Set("status", opts.Status)
+	}
+	if opts.Environment != "" {
+		query.Set("environment", opts.Environment)
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Offset > 0 {
+		query.Set("offset", strconv.Itoa(opts.Offset))
+	}
+	if opts.LabelSelector != "" {
+		selector, err := ParseSelector(opts.LabelSelector)
+		if err != nil {
+			return nil, err
+		}
+		query.Set("label", selector.String())
+	}
+
+	var list DeploymentList
+	if err := s.client.call(ctx, "GET", "/deployments", query, nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// Get gets a deployment by ID
+func (s *DeploymentsService) Get(ctx context.Context, id string) (*Deployment, error) {
+	var deployment Deployment
+	if err := s.client.call(ctx, "GET", "/deployments/"+url.PathEscape(id), nil, nil, &deployment); err != nil {
+		return nil, err
+	}
+	return &deployment, nil
+}
+
+// Create creates a new deployment. The deployment is validated first, and
+// a ValidationErrors is returned without calling the API if it is invalid.
+func (s *DeploymentsService) Create(ctx context.Context, deployment *Deployment) (*Deployment, error) {
+	if err := deployment.Validate(); err != nil {
+		return nil, err
+	}
+	var created Deployment
+	if err := s.client.call(ctx, "POST", "/deployments", nil, deployment, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// Update replaces the spec of an existing deployment. Like Create it
+// validates the deployment first.
+func (s *DeploymentsService) Update(ctx context.Context, id string, deployment *Deployment) (*Deployment, error) {
+	if err := deployment.Validate(); err != nil {
+		return nil, err
+	}
+	var updated Deployment
+	if err := s.client.call(ctx, "PUT", "/deployments/"+url.PathEscape(id), nil, deployment, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// Scale sets the number of replicas of a deployment
+func (s *DeploymentsService) Scale(ctx context.Context, id string, replicas int) (*Deployment, error) {
+	body := map[string]int{"replicas": replicas}
+	var scaled Deployment
+	if err := s.client.call(ctx, "POST", "/deployments/"+url.PathEscape(id)+"/scale", nil, body, &scaled); err != nil {
+		return nil, err
+	}
+	return &scaled, nil
+}
+
+// Delete deletes a deployment
+func (s *DeploymentsService) Delete(ctx context.Context, id string, force bool) error {
+	query := url.Values{}
+	if force {
+		query.Set("force", "true")
+	}
+	return s.client.call(ctx, "DELETE", "/deployments/"+url.PathEscape(id), query, nil, nil)
+}
@@ -0,0 +1,356 @@
+package tianniu
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// ExecProtocol is the WebSocket subprotocol of interactive exec sessions.
+// Every message starts with a channel byte followed by the channel data:
+//
+//	0 stdin   client to server; an empty message closes stdin
+//	1 stdout  server to client
+//	2 stderr  server to client, unused with a TTY
+//	3 status  server to client, JSON {"exit_code": 0} or {"error": "..."}
+//	4 resize  client to server, JSON {"width": 80, "height": 24}
+const ExecProtocol = "v1.exec.tianniu.baidu.com"
+
+const (
+	execStdin byte = iota
+	execStdout
+	execStderr
+	execStatus
+	execResize
+)
+
+// TerminalSize is the size of a TTY in characters
+type TerminalSize struct {
+	Width  uint16 `json:"width"`
+	Height uint16 `json:"height"`
+}
+
+// ExecStreams connects an interactive exec session to local streams.
+// Stdin is optional. With a TTY the remote terminal merges stderr into
+// stdout. Resize delivers terminal size changes and may be nil.
+type ExecStreams struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	Resize <-chan TerminalSize
+}
+
+// execStatusMessage is the final message of a session
+type execStatusMessage struct {
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ExecStream runs a command in a running container over a WebSocket,
+// streaming stdin, stdout and stderr until the command exits, and returns
+// its exit code. A non-zero exit code is not an error.
+//
+// Reading Stdin continues in the background after the command exits, so
+// pass a reader that is closed or ends with the session when that matters.
+func (s *ContainersService) ExecStream(ctx context.Context, id string, opts ExecOptions, streams ExecStreams) (int, error) {
+	if len(opts.Command) == 0 {
+		return 0, fmt.Errorf("exec: command is required")
+	}
+	opts.AttachStdin = streams.Stdin != nil
+	opts.AttachStdout = streams.Stdout != nil
+	opts.AttachStderr = streams.Stderr != nil && !opts.TTY
+
+	key, err := wsKey()
+	if err != nil {
+		return 0, err
+	}
+	req, err := s.client.newRequest(ctx, "GET", containerPath(id)+"/exec", execQuery(opts), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Protocol", ExecProtocol)
+
+	// The client timeout would cut the session
+	httpClient := *s.client.HTTPClient
+	httpClient.Timeout = 0
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer resp.Body.Close()
+		if err := checkResponse(resp); err != nil {
+			return 0, err
+		}
+	}
+	rw, ok := resp.Body.(io.ReadWriteCloser)
+	if resp.StatusCode != http.StatusSwitchingProtocols || !ok {
+		resp.Body.Close()
+		return 0, fmt.Errorf("exec: server did not upgrade to a WebSocket (%s)", resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != wsAccept(key) {
+		rw.Close()
+		return 0, fmt.Errorf("exec: invalid WebSocket handshake")
+	}
+
+	conn := newWSConn(rw, nil, true)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+			conn.Close()
+		}
+	}()
+	if streams.Stdin != nil {
+		go execPump(conn, streams.Stdin)
+	}
+	if streams.Resize != nil {
+		go func() {
+			for {
+				select {
+				case size, ok := <-streams.Resize:
+					if !ok {
+						return
+					}
+					data, _ := json.Marshal(size)
+					if conn.WriteMessage(append([]byte{execResize}, data...)) != nil {
+						return
+					}
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	for {
+		message, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return 0, ctx.Err()
+			}
+			if err == io.EOF {
+				return 0, fmt.Errorf("exec: session closed without an exit status")
+			}
+			return 0, fmt.Errorf("exec: %v", err)
+		}
+		if len(message) == 0 {
+			continue
+		}
+		data := message[1:]
+		switch message[0] {
+		case execStdout:
+			if streams.Stdout != nil {
+				streams.Stdout.Write(data)
+			}
+		case execStderr:
+			if streams.Stderr != nil {
+				streams.Stderr.Write(data)
+			}
+		case execStatus:
+			var status execStatusMessage
+			if err := json.Unmarshal(data, &status); err != nil {
+				return 0, fmt.Errorf("exec: invalid status: %v", err)
+			}
+			if status.Error != "" {
+				return 0, fmt.Errorf("exec: %s", status.Error)
+			}
+			return status.ExitCode, nil
+		}
+	}
+}
+
+// execPump copies stdin to the session and closes it at EOF
+func execPump(conn *wsConn, stdin io.Reader) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := stdin.Read(buf)
+		if n > 0 {
+			if conn.WriteMessage(append([]byte{execStdin}, buf[:n]...)) != nil {
+				return
+			}
+		}
+		if err != nil {
+			conn.WriteMessage([]byte{execStdin})
+			return
+		}
+	}
+}
+
+// execQuery encodes the options of an interactive session
+func execQuery(opts ExecOptions) url.Values {
+	query := url.Values{"command": opts.Command}
+	for _, env := range opts.Env {
+		query.Add("env", env.Name+"="+env.Value)
+	}
+	if opts.WorkingDir != "" {
+		query.Set("working_dir", opts.WorkingDir)
+	}
+	if opts.User != "" {
+		query.Set("user", opts.User)
+	}
+	for name, set := range map[string]bool{"tty": opts.TTY, "stdin": opts.AttachStdin, "stdout": opts.AttachStdout, "stderr": opts.AttachStderr} {
+		if set {
+			query.Set(name, "true")
+		}
+	}
+	return query
+}
+
+// ExecSession is the server side of an interactive exec session. Stdin is
+// nil unless the client attached it; Resize is closed when the client
+// disconnects.
+type ExecSession struct {
+	Options ExecOptions
+	Stdin   io.Reader
+	Stdout  io.Writer
+	Stderr  io.Writer
+	Resize  <-chan TerminalSize
+}
+
+// ServeExecSession accepts an interactive exec session on a request made
+// by ContainersService.ExecStream and runs fn with its streams. The value
+// fn returns is sent to the client as the exit code. It is meant for
+// stand-in servers and tests.
+func ServeExecSession(w http.ResponseWriter, r *http.Request, fn func(*ExecSession) int) error {
+	query := r.URL.Query()
+	opts := ExecOptions{
+		Command:      query["command"],
+		WorkingDir:   query.Get("working_dir"),
+		User:         query.Get("user"),
+		TTY:          query.Get("tty") == "true",
+		AttachStdin:  query.Get("stdin") == "true",
+		AttachStdout: query.Get("stdout") == "true",
+		AttachStderr: query.Get("stderr") == "true",
+	}
+	for _, env := range query["env"] {
+		name, value, _ := strings.Cut(env, "=")
+		opts.Env = append(opts.Env, EnvVar{Name: name, Value: value})
+	}
+	if len(opts.Command) == 0 {
+		http.Error(w, "command is required", http.StatusBadRequest)
+		return fmt.Errorf("exec: command is required")
+	}
+	conn, err := wsUpgrade(w, r, ExecProtocol)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stdin := newExecInput()
+	resize := make(chan TerminalSize, 8)
+	go func() {
+		defer close(resize)
+		defer stdin.Close()
+		for {
+			message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if len(message) == 0 {
+				continue
+			}
+			switch message[0] {
+			case execStdin:
+				if len(message) == 1 {
+					stdin.Close()
+				} else {
+					stdin.Write(message[1:])
+				}
+			case execResize:
+				var size TerminalSize
+				if json.Unmarshal(message[1:], &size) == nil {
+					select {
+					case resize <- size:
+					default:
+					}
+				}
+			}
+		}
+	}()
+
+	session := &ExecSession{
+		Options: opts,
+		Stdout:  &execWriter{conn: conn, channel: execStdout},
+		Stderr:  &execWriter{conn: conn, channel: execStderr},
+		Resize:  resize,
+	}
+	if opts.AttachStdin {
+		session.Stdin = stdin
+	}
+	if opts.TTY {
+		session.Stderr = session.Stdout
+	}
+	code := fn(session)
+	data, _ := json.Marshal(execStatusMessage{ExitCode: code})
+	return conn.WriteMessage(append([]byte{execStatus}, data...))
+}
+
+// execWriter writes to an output channel of a session
+type execWriter struct {
+	conn    *wsConn
+	channel byte
+}
+
+func (w *execWriter) Write(p []byte) (int, error) {
+	if err := w.conn.WriteMessage(append([]byte{w.channel}, p...)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// execInput buffers the stdin of a session so that a command that is not
+// reading does not stall the resize and close messages behind it
+type execInput struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	buf    bytes.Buffer
+	closed bool
+}
+
+func newExecInput() *execInput {
+	in := &execInput{}
+	in.cond = sync.NewCond(&in.mu)
+	return in
+}
+
+func (in *execInput) Write(p []byte) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if !in.closed {
+		in.buf.Write(p)
+		in.cond.Broadcast()
+	}
+}
+
+func (in *execInput) Read(p []byte) (int, error) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	for in.buf.Len() == 0 && !in.closed {
+		in.cond.Wait()
+	}
+	if in.buf.Len() == 0 {
+		return 0, io.EOF
+	}
+	return in.buf.Read(p)
+}
+
+func (in *execInput) Close() {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.closed = true
+	in.cond.Broadcast()
+}
@@ -0,0 +1,369 @@
+package tianniu
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Probe types
+const (
+	ProbeHTTP = "http"
+	ProbeTCP  = "tcp"
+	ProbeExec = "exec"
+)
+
+// Probe is a health check in one model for deployments and containers. An
+// HTTP probe succeeds on a 2xx or 3xx response, a TCP probe when the port
+// accepts a connection, and an exec probe when Command exits with 0.
+//
+// Deployments write probes as HealthCheck and containers as
+// ContainerHealth; the container shape has no initial delay and no success
+// threshold, so those are lost when converting to it.
+type Probe struct {
+	Type string `json:"type"`
+
+	// Scheme is http or https for HTTP probes
+	Scheme string `json:"scheme,omitempty"`
+	// Host is where the probe connects; empty means the container itself
+	Host    string   `json:"host,omitempty"`
+	Port    int      `json:"port,omitempty"`
+	Path    string   `json:"path,omitempty"`
+	Command []string `json:"command,omitempty"`
+
+	InitialDelaySeconds int `json:"initial_delay_seconds,omitempty"`
+	PeriodSeconds       int `json:"period_seconds,omitempty"`
+	TimeoutSeconds      int `json:"timeout_seconds,omitempty"`
+	SuccessThreshold    int `json:"success_threshold,omitempty"`
+	FailureThreshold    int `json:"failure_threshold,omitempty"`
+}
+
+// Probe converts the health check of a deployment container. Exactly one
+// of http_path, tcp_port and command must be set.
+func (h *HealthCheck) Probe() (*Probe, error) {
+	p := &Probe{
+		InitialDelaySeconds: h.InitialDelaySeconds,
+		PeriodSeconds:       h.PeriodSeconds,
+		TimeoutSeconds:      h.TimeoutSeconds,
+		SuccessThreshold:    h.SuccessThreshold,
+		FailureThreshold:    h.FailureThreshold,
+	}
+	kinds := 0
+	if h.HTTPPath != "" {
+		kinds++
+		p.Type, p.Scheme, p.Port, p.Path = ProbeHTTP, "http", h.Port, h.HTTPPath
+	}
+	if h.TCPPort != 0 {
+		kinds++
+		p.Type, p.Port = ProbeTCP, h.TCPPort
+	}
+	if len(h.Command) > 0 {
+		kinds++
+		p.Type, p.Command = ProbeExec, h.Command
+	}
+	if kinds != 1 {
+		return nil, fmt.Errorf("health check must set exactly one of http_path, tcp_port and command")
+	}
+	return p, nil
+}
+
+// HealthCheck converts p to the health check of a deployment container.
+// The host and scheme of an HTTP probe have no place there and are dropped.
+func (p *Probe) HealthCheck() *HealthCheck {
+	h := &HealthCheck{
+		InitialDelaySeconds: p.InitialDelaySeconds,
+		PeriodSeconds:       p.PeriodSeconds,
+		TimeoutSeconds:      p.TimeoutSeconds,
+		SuccessThreshold:    p.SuccessThreshold,
+		FailureThreshold:    p.FailureThreshold,
+	}
+	switch p.Type {
+	case ProbeHTTP:
+		h.HTTPPath, h.Port = p.path(), p.Port
+	case ProbeTCP:
+		h.TCPPort = p.Port
+	case ProbeExec:
+		h.Command = p.Command
+	}
+	return h
+}
+
+// Probe converts the health check of a container. HTTP and TCP checks are
+// written as an endpoint URL, such as "http://localhost:8080/health" or
+// "tcp://localhost:5432"; exec checks set Command instead.
+func (h *ContainerHealth) Probe() (*Probe, error) {
+	p := &Probe{FailureThreshold: h.Retries}
+	var err error
+	if p.PeriodSeconds, err = durationSeconds("interval", h.Interval); err != nil {
+		return nil, err
+	}
+	if p.TimeoutSeconds, err = durationSeconds("timeout", h.Timeout); err != nil {
+		return nil, err
+	}
+	if len(h.Command) > 0 {
+		if h.Endpoint != "" {
+			return nil, fmt.Errorf("health check must not set both endpoint and command")
+		}
+		p.Type, p.Command = ProbeExec, h.Command
+		return p, nil
+	}
+
+	u, err := url.Parse(h.Endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid health check endpoint %q: want a URL such as http://localhost:8080/health or tcp://localhost:5432", h.Endpoint)
+	}
+	p.Host = u.Hostname()
+	if port := u.Port(); port != "" {
+		if p.Port, err = strconv.Atoi(port); err != nil {
+			return nil, fmt.Errorf("invalid port in health check endpoint %q", h.Endpoint)
+		}
+	}
+	switch u.Scheme {
+	case "http", "https":
+		p.Type, p.Scheme, p.Path = ProbeHTTP, u.Scheme, u.RequestURI()
+		if p.Port == 0 {
+			p.Port = 80
+			if u.Scheme == "https" {
+				p.Port = 443
+			}
+		}
+	case "tcp":
+		if p.Port == 0 {
+			return nil, fmt.Errorf("health check endpoint %q has no port", h.Endpoint)
+		}
+		p.Type = ProbeTCP
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q in health check endpoint %q", u.Scheme, h.Endpoint)
+	}
+	return p, nil
+}
+
+// ContainerHealth converts p to the health check of a container
+func (p *Probe) ContainerHealth() *ContainerHealth {
+	h := &ContainerHealth{Retries: p.FailureThreshold}
+	if p.PeriodSeconds > 0 {
+		h.Interval = strconv.Itoa(p.PeriodSeconds) + "s"
+	}
+	if p.TimeoutSeconds > 0 {
+		h.Timeout = strconv.Itoa(p.TimeoutSeconds) + "s"
+	}
+	host := p.Host
+	if host == "" {
+		host = "localhost"
+	}
+	switch p.Type {
+	case ProbeHTTP:
+		scheme := p.Scheme
+		if scheme == "" {
+			scheme = "http"
+		}
+		h.Endpoint = scheme + "://" + net.JoinHostPort(host, strconv.Itoa(p.Port)) + p.path()
+	case ProbeTCP:
+		h.Endpoint = "tcp://" + net.JoinHostPort(host, strconv.Itoa(p.Port))
+	case ProbeExec:
+		h.Command = p.Command
+	}
+	return h
+}
+
+// Validate checks that p is complete
+func (p *Probe) Validate() error {
+	switch p.Type {
+	case ProbeHTTP, ProbeTCP:
+		if p.Port <= 0 || p.Port > 65535 {
+			return fmt.Errorf("%s probe port %d is out of range", p.Type, p.Port)
+		}
+		if p.Type == ProbeHTTP && p.Scheme != "" && p.Scheme != "http" && p.Scheme != "https" {
+			return fmt.Errorf("unsupported HTTP probe scheme %q", p.Scheme)
+		}
+	case ProbeExec:
+		if len(p.Command) == 0 {
+			return fmt.Errorf("exec probe has no command")
+		}
+	default:
+		return fmt.Errorf("unknown probe type %q", p.Type)
+	}
+	if p.PeriodSeconds > 0 && p.TimeoutSeconds > p.PeriodSeconds {
+		return fmt.Errorf("probe timeout %ds is longer than its period %ds", p.TimeoutSeconds, p.PeriodSeconds)
+	}
+	return nil
+}
+
+// Target describes what p checks, e.g. "http://localhost:8080/health"
+func (p *Probe) Target() string {
+	if p.Type == ProbeExec {
+		return strings.Join(p.Command, " ")
+	}
+	return p.ContainerHealth().Endpoint
+}
+
+func (p *Probe) path() string {
+	if p.Path == "" {
+		return "/"
+	}
+	return p.Path
+}
+
+// durationSeconds parses a duration such as "30s" into whole seconds,
+// rounded up. Empty is zero.
+func durationSeconds(name, value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid health check %s %q", name, value)
+	}
+	return timeoutSeconds(d), nil
+}
+
+// ProbeResult is the outcome of one probe attempt
+type ProbeResult struct {
+	Healthy  bool          `json:"healthy"`
+	Message  string        `json:"message"`
+	Duration time.Duration `json:"duration"`
+}
+
+// ProbeReport is the outcome of running a probe to a verdict
+type ProbeReport struct {
+	Target   string        `json:"target"`
+	Healthy  bool          `json:"healthy"`
+	Attempts []ProbeResult `json:"attempts"`
+}
+
+// Prober runs HTTP and TCP probes from the local machine, to check a
+// health check against a running instance before deploying it. Exec
+// probes need the container and are not supported.
+type Prober struct {
+	// Host replaces the host of the probes, e.g. where a local instance
+	// listens. Empty uses the host of the probe, or localhost.
+	Host string
+
+	// SkipInitialDelay starts probing at once
+	SkipInitialDelay bool
+
+	// InsecureSkipVerify accepts any certificate of HTTPS probes
+	InsecureSkipVerify bool
+}
+
+// Check runs one attempt of p within its timeout (1s when unset)
+func (pr *Prober) Check(ctx context.Context, p *Probe) ProbeResult {
+	timeout := time.Duration(p.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	result := pr.check(ctx, p)
+	result.Duration = time.Since(start)
+	return result
+}
+
+func (pr *Prober) check(ctx context.Context, p *Probe) ProbeResult {
+	host := pr.Host
+	if host == "" {
+		host = p.Host
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	address := net.JoinHostPort(host, strconv.Itoa(p.Port))
+
+	switch p.Type {
+	case ProbeTCP:
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return ProbeResult{Message: err.Error()}
+		}
+		conn.Close()
+		return ProbeResult{Healthy: true, Message: "connected to " + address}
+	case ProbeHTTP:
+		scheme := p.Scheme
+		if scheme == "" {
+			scheme = "http"
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", scheme+"://"+address+p.path(), nil)
+		if err != nil {
+			return ProbeResult{Message: err.Error()}
+		}
+		transport := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: pr.InsecureSkipVerify}}
+		defer transport.CloseIdleConnections()
+		// Redirects are a success, as for Kubernetes probes
+		client := &http.Client{
+			Transport:     transport,
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return ProbeResult{Message: err.Error()}
+		}
+		resp.Body.Close()
+		return ProbeResult{Healthy: resp.StatusCode >= 200 && resp.StatusCode < 400, Message: "HTTP " + resp.Status}
+	case ProbeExec:
+		return ProbeResult{Message: "exec probes run in the container and cannot be checked locally"}
+	}
+	return ProbeResult{Message: fmt.Sprintf("unknown probe type %q", p.Type)}
+}
+
+// Run probes p as the platform would: after the initial delay, once per
+// period, until SuccessThreshold attempts in a row succeed or
+// FailureThreshold attempts in a row fail (1 and 3 when unset). The error
+// is only set for an invalid probe or a done context.
+func (pr *Prober) Run(ctx context.Context, p *Probe) (*ProbeReport, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if p.Type == ProbeExec {
+		return nil, fmt.Errorf("exec probes run in the container and cannot be checked locally")
+	}
+	successes, failures := orDefault(p.SuccessThreshold, 1), orDefault(p.FailureThreshold, 3)
+	period := time.Duration(orDefault(p.PeriodSeconds, 10)) * time.Second
+	report := &ProbeReport{Target: p.Target()}
+	if pr.Host != "" {
+		local := *p
+		local.Host = pr.Host
+		report.Target = local.Target()
+	}
+
+	wait := time.Duration(0)
+	if !pr.SkipInitialDelay {
+		wait = time.Duration(p.InitialDelaySeconds) * time.Second
+	}
+	ok, failed := 0, 0
+	for {
+		if wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return report, ctx.Err()
+			}
+		}
+		result := pr.Check(ctx, p)
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		report.Attempts = append(report.Attempts, result)
+		if result.Healthy {
+			ok, failed = ok+1, 0
+		} else {
+			ok, failed = 0, failed+1
+		}
+		if ok >= successes {
+			report.Healthy = true
+			return report, nil
+		}
+		if failed >= failures {
+			return report, nil
+		}
+		wait = period - result.Duration
+	}
+}
@@ -0,0 +1,713 @@
+package tianniu
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ImportWarning is a field of an imported file that has no exact TianNiu
+// equivalent. Object names the source object, e.g. "deployment/web", and
+// Field is the path of the field in that object.
+type ImportWarning struct {
+	Object  string `json:"object"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (w ImportWarning) String() string {
+	if w.Field == "" {
+		return w.Object + ": " + w.Message
+	}
+	return w.Object + ": " + w.Field + ": " + w.Message
+}
+
+// ImportResult holds the deployments converted from a file, and every field
+// that was dropped or approximated on the way
+type ImportResult struct {
+	Deployments []*Deployment   `json:"deployments"`
+	Warnings    []ImportWarning `json:"warnings"`
+}
+
+func (r *ImportResult) warn(object, field, format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, ImportWarning{Object: object, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// ImportOptions control ImportKubernetes and ImportCompose
+type ImportOptions struct {
+	// Environment of the deployments. Kubernetes objects otherwise take it
+	// from the TianNiu environment label or their namespace; compose
+	// services leave it unset.
+	Environment string
+}
+
+// k8sServerFields are the fields the Kubernetes API server sets or
+// defaults. They carry no intent, so dropping them is not reported. The
+// value is the default that is ignored, or "*" for any value.
+var k8sServerFields = map[string]string{
+	"status":                                                        "*",
+	"metadata.creationTimestamp":                                    "*",
+	"metadata.uid":                                                  "*",
+	"metadata.resourceVersion":                                      "*",
+	"metadata.generation":                                           "*",
+	"metadata.managedFields":                                        "*",
+	"metadata.selfLink":                                             "*",
+	"spec.progressDeadlineSeconds":                                  "*",
+	"spec.revisionHistoryLimit":                                     "*",
+	"spec.template.metadata.creationTimestamp":                      "*",
+	"spec.template.spec.restartPolicy":                              "Always",
+	"spec.template.spec.dnsPolicy":                                  "ClusterFirst",
+	"spec.template.spec.schedulerName":                              "default-scheduler",
+	"spec.template.spec.terminationGracePeriodSeconds":              "30",
+	"spec.template.spec.containers[].imagePullPolicy":               "*",
+	"spec.template.spec.containers[].terminationMessagePath":        "*",
+	"spec.template.spec.containers[].terminationMessagePolicy":      "*",
+	"spec.template.spec.containers[].livenessProbe.httpGet.scheme":  "HTTP",
+	"spec.template.spec.containers[].readinessProbe.httpGet.scheme": "HTTP",
+	"spec.clusterIP":                                                "*",
+	"spec.clusterIPs":                                               "*",
+	"spec.ipFamilies":                                               "*",
+	"spec.ipFamilyPolicy":                                           "*",
+	"spec.internalTrafficPolicy":                                    "Cluster",
+	"spec.externalTrafficPolicy":                                    "Cluster",
+	"spec.sessionAffinity":                                          "None",
+	"spec.allocateLoadBalancerNodePorts":                            "true",
+}
+
+// k8sKnownLabels are the labels and annotations that ExportKubernetes sets
+var k8sKnownLabels = []string{
+	K8sNameLabel, K8sVersionLabel, K8sManagedByLabel, K8sEnvironmentLabel,
+	K8sDescriptionAnnotation, K8sIDAnnotation,
+	"kubectl.kubernetes.io/last-applied-configuration",
+	"deployment.kubernetes.io/revision",
+}
+
+var indexPattern = regexp.MustCompile(`\[[0-9]+\]`)
+
+// k8sObject is one decoded object of a Kubernetes file
+type k8sObject struct {
+	kind      string
+	name      string
+	namespace string
+	raw       map[string]interface{}
+	data      []byte
+}
+
+func (o *k8sObject) ref() string {
+	return strings.ToLower(o.kind) + "/" + o.name
+}
+
+// k8sImport is the state of one ImportKubernetes call
+type k8sImport struct {
+	opts       ImportOptions
+	result     *ImportResult
+	configMaps map[string]*K8sConfigMap
+	secrets    map[string]*K8sSecret
+}
+
+// importedDeployment pairs a Kubernetes deployment with its conversion
+type importedDeployment struct {
+	k8s *K8sDeployment
+	d   *Deployment
+}
+
+// ImportKubernetes converts the apps/v1 Deployments of a multi-document
+// Kubernetes YAML stream, which may also be a kubectl List, to TianNiu
+// deployments. ConfigMaps in the stream are inlined as literal variables,
+// Secret references become value_from references, and Services are attached
+// to the deployment whose pod labels they select. The readiness probe, or
+// the liveness probe when there is none, becomes the health check. Fields
+// with no TianNiu equivalent, such as volumes, are dropped and reported as
+// warnings.
+func ImportKubernetes(r io.Reader, opts ImportOptions) (*ImportResult, error) {
+	objects, err := decodeK8sObjects(r)
+	if err != nil {
+		return nil, err
+	}
+	im := &k8sImport{
+		opts:       opts,
+		result:     &ImportResult{},
+		configMaps: map[string]*K8sConfigMap{},
+		secrets:    map[string]*K8sSecret{},
+	}
+
+	var deployments, services []*k8sObject
+	for _, o := range objects {
+		var target interface{}
+		switch o.kind {
+		case "Deployment":
+			deployments = append(deployments, o)
+			continue
+		case "Service":
+			services = append(services, o)
+			continue
+		case "ConfigMap":
+			cm := &K8sConfigMap{}
+			im.configMaps[o.namespace+"/"+o.name] = cm
+			target = cm
+		case "Secret":
+			s := &K8sSecret{}
+			im.secrets[o.namespace+"/"+o.name] = s
+			target = s
+		default:
+			im.result.warn(o.ref(), "", "kind %s is not supported", o.kind)
+			continue
+		}
+		if err := json.Unmarshal(o.data, target); err != nil {
+			return nil, fmt.Errorf("%s: %v", o.ref(), err)
+		}
+	}
+
+	var imported []importedDeployment
+	for _, o := range deployments {
+		k := &K8sDeployment{}
+		if err := im.decode(o, k); err != nil {
+			return nil, err
+		}
+		d := im.deployment(k, o.raw)
+		imported = append(imported, importedDeployment{k8s: k, d: d})
+		im.result.Deployments = append(im.result.Deployments, d)
+	}
+	for _, o := range services {
+		ks := &K8sService{}
+		if err := im.decode(o, ks); err != nil {
+			return nil, err
+		}
+		im.service(ks, imported)
+	}
+	return im.result, nil
+}
+
+// decodeK8sObjects reads every object of a YAML stream, expanding Lists
+func decodeK8sObjects(r io.Reader) ([]*k8sObject, error) {
+	dec := yaml.NewDecoder(r)
+	var objects []*k8sObject
+	for doc := 1; ; doc++ {
+		var raw interface{}
+		err := dec.Decode(&raw)
+		if err == io.EOF {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %v", doc, err)
+		}
+		if raw == nil {
+			continue
+		}
+		generic, err := jsonCompatible(raw)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %v", doc, err)
+		}
+		obj, ok := generic.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("document %d: not a Kubernetes object", doc)
+		}
+		items := []interface{}{obj}
+		if obj["kind"] == "List" {
+			items, _ = obj["items"].([]interface{})
+		}
+		for i, item := range items {
+			o, err := newK8sObject(item)
+			if err != nil {
+				if obj["kind"] == "List" {
+					return nil, fmt.Errorf("document %d: items[%d]: %v", doc, i, err)
+				}
+				return nil, fmt.Errorf("document %d: %v", doc, err)
+			}
+			objects = append(objects, o)
+		}
+	}
+}
+
+func newK8sObject(item interface{}) (*k8sObject, error) {
+	raw, ok := item.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("not a Kubernetes object")
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var header struct {
+		APIVersion string        `json:"apiVersion"`
+		Kind       string        `json:"kind"`
+		Metadata   K8sObjectMeta `json:"metadata"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("invalid object: %v", err)
+	}
+	if header.Kind == "" || header.Metadata.Name == "" {
+		return nil, fmt.Errorf("object has no kind or metadata.name")
+	}
+	want := "v1"
+	if header.Kind == "Deployment" {
+		want = "apps/v1"
+	}
+	if header.APIVersion != want {
+		return nil, fmt.Errorf("%s %s: unsupported apiVersion %q (want %q)", header.Kind, header.Metadata.Name, header.APIVersion, want)
+	}
+	return &k8sObject{
+		kind:      header.Kind,
+		name:      header.Metadata.Name,
+		namespace: header.Metadata.Namespace,
+		raw:       raw,
+		data:      data,
+	}, nil
+}
+
+// decode decodes o into target and reports the fields that target has no
+// place for
+func (im *k8sImport) decode(o *k8sObject, target interface{}) error {
+	if err := json.Unmarshal(o.data, target); err != nil {
+		return fmt.Errorf("%s: %v", o.ref(), err)
+	}
+	data, err := json.Marshal(target)
+	if err != nil {
+		return err
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	for _, field := range droppedFields(o.raw, decoded, "") {
+		im.result.warn(o.ref(), field, "not supported")
+	}
+	return nil
+}
+
+// droppedFields returns the paths of the non-empty fields of src that are
+// missing from decoded, skipping the fields set by the API server
+func droppedFields(src, decoded interface{}, path string) []string {
+	var dropped []string
+	switch src := src.(type) {
+	case map[string]interface{}:
+		other, _ := decoded.(map[string]interface{})
+		keys := make([]string, 0, len(src))
+		for k := range src {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			field := k
+			if path != "" {
+				field = path + "." + k
+			}
+			if isEmptyValue(src[k]) || isServerField(field, src[k]) {
+				continue
+			}
+			value, ok := other[k]
+			if !ok {
+				dropped = append(dropped, field)
+				continue
+			}
+			dropped = append(dropped, droppedFields(src[k], value, field)...)
+		}
+	case []interface{}:
+		other, _ := decoded.([]interface{})
+		for i, e := range src {
+			if i < len(other) {
+				dropped = append(dropped, droppedFields(e, other[i], fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	}
+	return dropped
+}
+
+func isServerField(field string, value interface{}) bool {
+	want, ok := k8sServerFields[indexPattern.ReplaceAllString(field, "[]")]
+	return ok && (want == "*" || want == fmt.Sprint(value))
+}
+
+func isEmptyValue(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	}
+	return rv.IsZero()
+}
+
+// lookupField returns the value at a path of nested maps
+func lookupField(raw map[string]interface{}, path ...string) (interface{}, bool) {
+	var v interface{} = raw
+	for _, key := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// deployment converts a Kubernetes deployment
+func (im *k8sImport) deployment(k *K8sDeployment, raw map[string]interface{}) *Deployment {
+	object := "deployment/" + k.Metadata.Name
+	d := &Deployment{
+		Name:        k.Metadata.Name,
+		Description: k.Metadata.Annotations[K8sDescriptionAnnotation],
+		Environment: im.opts.Environment,
+		Version:     k.Metadata.Labels[K8sVersionLabel],
+		Replicas:    k.Spec.Replicas,
+	}
+	if _, ok := lookupField(raw, "spec", "replicas"); !ok {
+		d.Replicas = 1
+	}
+	if d.Environment == "" {
+		d.Environment = k.Metadata.Labels[K8sEnvironmentLabel]
+	}
+	if d.Environment == "" {
+		d.Environment = k.Metadata.Namespace
+	}
+	for _, meta := range []struct {
+		field string
+		keys  map[string]string
+	}{
+		{"metadata.labels", k.Metadata.Labels},
+		{"metadata.annotations", k.Metadata.Annotations},
+	} {
+		var dropped []string
+		for key := range meta.keys {
+			if !containsString(k8sKnownLabels, key) {
+				dropped = append(dropped, key)
+			}
+		}
+		if len(dropped) > 0 {
+			sort.Strings(dropped)
+			im.result.warn(object, meta.field, "deployments have no labels or annotations; dropped %s", strings.Join(dropped, ", "))
+		}
+	}
+
+	switch s := k.Spec.Strategy; s.Type {
+	case "", "RollingUpdate":
+		d.Strategy.Type = StrategyRollingUpdate
+		for _, bound := range []struct {
+			name    string
+			target  *int
+			roundUp bool
+		}{
+			{"maxSurge", &d.Strategy.MaxSurge, true},
+			{"maxUnavailable", &d.Strategy.MaxUnavailable, false},
+		} {
+			field := "spec.strategy.rollingUpdate." + bound.name
+			value, ok := lookupField(raw, "spec", "strategy", "rollingUpdate", bound.name)
+			if !ok {
+				// The Kubernetes default of 25% is not reported
+				*bound.target = scalePercent(25, d.Replicas, bound.roundUp)
+				continue
+			}
+			switch value := value.(type) {
+			case int:
+				*bound.target = value
+			case string:
+				percent, err := strconv.Atoi(strings.TrimSuffix(value, "%"))
+				if err != nil || !strings.HasSuffix(value, "%") {
+					im.result.warn(object, field, "%q is not a number or percentage", value)
+					continue
+				}
+				*bound.target = scalePercent(percent, d.Replicas, bound.roundUp)
+				im.result.warn(object, field, "%s of %d replicas converted to %d", value, d.Replicas, *bound.target)
+			}
+		}
+	case "Recreate":
+		d.Strategy.Type = StrategyRecreate
+	default:
+		im.result.warn(object, "spec.strategy.type", "strategy %q is not supported", s.Type)
+	}
+
+	for i, kc := range k.Spec.Template.Spec.Containers {
+		d.Containers = append(d.Containers, im.container(object, fmt.Sprintf("spec.template.spec.containers[%d]", i), k.Metadata.Namespace, kc))
+	}
+
+	if d.Version == "" && len(d.Containers) > 0 {
+		d.Version, _ = imageTag(d.Containers[0].Image)
+	}
+	if d.Version == "" {
+		d.Version = "latest"
+		im.result.warn(object, "", "no version label or image tag; using version latest")
+	}
+	return d
+}
+
+// scalePercent converts a percentage of replicas to a count, rounding as
+// Kubernetes does: up for max surge and down for max unavailable
+func scalePercent(percent, replicas int, roundUp bool) int {
+	n := float64(percent) * float64(replicas) / 100
+	if roundUp {
+		return int(math.Ceil(n))
+	}
+	return int(math.Floor(n))
+}
+
+// container converts a container of a pod template
+func (im *k8sImport) container(object, path, namespace string, kc K8sContainer) DeploymentContainer {
+	c := DeploymentContainer{Name: kc.Name, Image: kc.Image}
+	for j, p := range kc.Ports {
+		if p.Protocol != "" && p.Protocol != "TCP" {
+			im.result.warn(object, fmt.Sprintf("%s.ports[%d].protocol", path, j), "%s ports are not supported", p.Protocol)
+			continue
+		}
+		c.Ports = append(c.Ports, ContainerPort{Name: p.Name, ContainerPort: p.ContainerPort})
+	}
+	c.Resources = ResourceRequirements{
+		Limits:   im.resourceList(object, path+".resources.limits", kc.Resources.Limits),
+		Requests: im.resourceList(object, path+".resources.requests", kc.Resources.Requests),
+	}
+
+	for j, from := range kc.EnvFrom {
+		field := fmt.Sprintf("%s.envFrom[%d]", path, j)
+		switch {
+		case from.ConfigMapRef != nil:
+			cm, ok := im.configMaps[namespace+"/"+from.ConfigMapRef.Name]
+			if !ok {
+				im.result.warn(object, field, "ConfigMap %s is not in the input; its variables are dropped", from.ConfigMapRef.Name)
+				continue
+			}
+			for _, key := range sortedKeys(cm.Data) {
+				c.EnvironmentVariables = setEnv(c.EnvironmentVariables, EnvVar{Name: key, Value: cm.Data[key]})
+			}
+		case from.SecretRef != nil:
+			s, ok := im.secrets[namespace+"/"+from.SecretRef.Name]
+			if !ok {
+				im.result.warn(object, field, "Secret %s is not in the input; its keys are unknown", from.SecretRef.Name)
+				continue
+			}
+			keys := map[string]string{}
+			for key := range s.Data {
+				keys[key] = ""
+			}
+			for key := range s.StringData {
+				keys[key] = ""
+			}
+			for _, key := range sortedKeys(keys) {
+				ref := &EnvVarSource{SecretName: from.SecretRef.Name, Key: key}
+				c.EnvironmentVariables = setEnv(c.EnvironmentVariables, EnvVar{Name: key, ValueFrom: ref})
+			}
+		}
+	}
+	for j, env := range kc.Env {
+		field := fmt.Sprintf("%s.env[%d]", path, j)
+		switch {
+		case env.ValueFrom == nil:
+			c.EnvironmentVariables = setEnv(c.EnvironmentVariables, EnvVar{Name: env.Name, Value: env.Value})
+		case env.ValueFrom.SecretKeyRef != nil:
+			ref := env.ValueFrom.SecretKeyRef
+			c.EnvironmentVariables = setEnv(c.EnvironmentVariables, EnvVar{Name: env.Name, ValueFrom: &EnvVarSource{SecretName: ref.Name, Key: ref.Key}})
+		case env.ValueFrom.ConfigMapKeyRef != nil:
+			ref := env.ValueFrom.ConfigMapKeyRef
+			cm, ok := im.configMaps[namespace+"/"+ref.Name]
+			value, found := "", false
+			if ok {
+				value, found = cm.Data[ref.Key]
+			}
+			if !found {
+				im.result.warn(object, field, "ConfigMap key %s/%s is not in the input; %s is dropped", ref.Name, ref.Key, env.Name)
+				continue
+			}
+			c.EnvironmentVariables = setEnv(c.EnvironmentVariables, EnvVar{Name: env.Name, Value: value})
+		}
+		// Other sources, such as fieldRef, are reported as dropped fields
+	}
+
+	probe, field := kc.ReadinessProbe, path+".readinessProbe"
+	if probe == nil {
+		probe, field = kc.LivenessProbe, path+".livenessProbe"
+	} else if kc.LivenessProbe != nil && !sameProbe(*kc.LivenessProbe, *probe) {
+		im.result.warn(object, path+".livenessProbe", "differs from the readinessProbe; only the readinessProbe is imported")
+	}
+	if probe != nil {
+		c.HealthCheck = im.healthCheck(object, field, probe, c.Ports)
+	}
+	return c
+}
+
+// healthCheck converts an HTTP, TCP or exec probe. A named port that
+// matches no container port drops the health check.
+func (im *k8sImport) healthCheck(object, field string, probe *K8sProbe, ports []ContainerPort) *HealthCheck {
+	port := func(action string, p K8sIntOrString) int {
+		if p.String == "" {
+			if p.Int == 0 {
+				im.result.warn(object, field+"."+action+".port", "no port; the health check is dropped")
+			}
+			return p.Int
+		}
+		for _, cp := range ports {
+			if cp.Name == p.String {
+				return cp.ContainerPort
+			}
+		}
+		im.result.warn(object, field+"."+action+".port", "port %q matches no container port; the health check is dropped", p.String)
+		return 0
+	}
+	h := &HealthCheck{
+		InitialDelaySeconds: probe.InitialDelaySeconds,
+		PeriodSeconds:       orDefault(probe.PeriodSeconds, 10),
+		TimeoutSeconds:      orDefault(probe.TimeoutSeconds, 1),
+		SuccessThreshold:    orDefault(probe.SuccessThreshold, 1),
+		FailureThreshold:    orDefault(probe.FailureThreshold, 3),
+	}
+	switch {
+	case probe.HTTPGet != nil:
+		if h.Port = port("httpGet", probe.HTTPGet.Port); h.Port == 0 {
+			return nil
+		}
+		h.HTTPPath = probe.HTTPGet.Path
+	case probe.TCPSocket != nil:
+		if h.TCPPort = port("tcpSocket", probe.TCPSocket.Port); h.TCPPort == 0 {
+			return nil
+		}
+	case probe.Exec != nil && len(probe.Exec.Command) > 0:
+		h.Command = probe.Exec.Command
+	default:
+		return nil
+	}
+	return h
+}
+
+// resourceList converts Kubernetes cpu and memory quantities. Memory in
+// decimal units is written the TianNiu way, e.g. "512MB" for "512M".
+func (im *k8sImport) resourceList(object, path string, list map[string]Quantity) ResourceList {
+	var r ResourceList
+	for _, name := range sortedKeys(list) {
+		q := list[name]
+		switch name {
+		case "cpu":
+			r.CPU = q
+		case "memory":
+			if q.Format() == DecimalSI && q.MilliValue()%1000 == 0 {
+				q = NewMilliQuantity(q.MilliValue(), DecimalBytes)
+			}
+			r.Memory = q
+		default:
+			im.result.warn(object, path+"."+name, "only cpu and memory are supported")
+		}
+	}
+	return r
+}
+
+// service attaches a Kubernetes service to the deployment it selects.
+// Service target ports name a container port; TianNiu services target the
+// service_port of a container, which is set to the container port.
+func (im *k8sImport) service(ks *K8sService, imported []importedDeployment) {
+	object := "service/" + ks.Metadata.Name
+	var matches []*Deployment
+	for _, i := range imported {
+		labels := []map[string]string{i.k8s.Spec.Template.Metadata.Labels}
+		if i.k8s.Metadata.Namespace == ks.Metadata.Namespace && selectsAny(ks.Spec.Selector, labels) {
+			matches = append(matches, i.d)
+		}
+	}
+	if len(matches) == 0 {
+		im.result.warn(object, "spec.selector", "selects no imported deployment; the service is dropped")
+		return
+	}
+	d := matches[0]
+	if len(matches) > 1 {
+		im.result.warn(object, "spec.selector", "selects several deployments; attached to %s", d.Name)
+	}
+
+	svc := Service{Name: ks.Metadata.Name, Type: ks.Spec.Type}
+	if svc.Type == "" {
+		svc.Type = "ClusterIP"
+	}
+	if !containsString(serviceTypes, svc.Type) {
+		im.result.warn(object, "spec.type", "service type %s is not supported; the service is dropped", svc.Type)
+		return
+	}
+	for j, p := range ks.Spec.Ports {
+		field := fmt.Sprintf("spec.ports[%d]", j)
+		if p.Protocol != "" && p.Protocol != "TCP" {
+			im.result.warn(object, field+".protocol", "%s ports are not supported", p.Protocol)
+			continue
+		}
+		if p.NodePort != 0 {
+			im.result.warn(object, field+".nodePort", "node ports are assigned by TianNiu; %d is dropped", p.NodePort)
+		}
+		port := targetContainerPort(d, p.TargetPort)
+		if port == nil && p.TargetPort.String != "" {
+			im.result.warn(object, field+".targetPort", "%q matches no container port; the port is dropped", p.TargetPort.String)
+			continue
+		}
+		if port == nil {
+			target := p.TargetPort.Int
+			if target == 0 {
+				target = p.Port
+			}
+			if len(d.Containers) == 0 {
+				continue
+			}
+			im.result.warn(object, field+".targetPort", "%d is not a declared container port; added to container %s", target, d.Containers[0].Name)
+			d.Containers[0].Ports = append(d.Containers[0].Ports, ContainerPort{ContainerPort: target})
+			port = &d.Containers[0].Ports[len(d.Containers[0].Ports)-1]
+		}
+		if port.ServicePort == 0 {
+			port.ServicePort = port.ContainerPort
+		}
+		svc.Ports = append(svc.Ports, ServicePort{Name: p.Name, Port: p.Port, TargetPort: port.ServicePort})
+	}
+	if len(svc.Ports) > 0 {
+		d.Services = append(d.Services, svc)
+	}
+}
+
+// targetContainerPort finds the container port a service target port
+// names. A zero target port defaults to the service port, as in Kubernetes.
+func targetContainerPort(d *Deployment, target K8sIntOrString) *ContainerPort {
+	for i := range d.Containers {
+		for j := range d.Containers[i].Ports {
+			p := &d.Containers[i].Ports[j]
+			if (target.String != "" && p.Name == target.String) || (target.String == "" && p.ContainerPort == target.Int) {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+// setEnv sets a variable, replacing an earlier one of the same name
+func setEnv(vars []EnvVar, env EnvVar) []EnvVar {
+	for i := range vars {
+		if vars[i].Name == env.Name {
+			vars[i] = env
+			return vars
+		}
+	}
+	return append(vars, env)
+}
+
+// sameProbe reports whether two probes differ only in the success
+// threshold, which Kubernetes requires to be 1 for liveness probes
+func sameProbe(a, b K8sProbe) bool {
+	a.SuccessThreshold, b.SuccessThreshold = 0, 0
+	return reflect.DeepEqual(a, b)
+}
+
+func orDefault(value, def int) int {
+	if value == 0 {
+		return def
+	}
+	return value
+}
+
+func sortedKeys(m interface{}) []string {
+	keys := reflect.ValueOf(m).MapKeys()
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		names[i] = k.String()
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,236 @@
+package tianniu
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	keystoreVersion    = 1
+	keystoreIterations = 600000
+	keystoreCheckValue = "tianniu-keystore"
+)
+
+// Keystore is a passphrase-encrypted file of named secrets. Each value is
+// sealed with AES-256-GCM under a key derived with PBKDF2-SHA256, using the
+// entry name as additional data so entries cannot be swapped.
+type Keystore struct {
+	path string
+	key  []byte
+	file keystoreFile
+}
+
+type keystoreFile struct {
+	Version    int                      `json:"version"`
+	KDF        string                   `json:"kdf"`
+	Iterations int                      `json:"iterations"`
+	Salt       []byte                   `json:"salt"`
+	Check      keystoreEntry            `json:"check"`
+	Entries    map[string]keystoreEntry `json:"entries"`
+}
+
+type keystoreEntry struct {
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// DefaultKeystorePath returns ~/.tianniu/keystore
+func DefaultKeystorePath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".tianniu", "keystore")
+	}
+	return filepath.Join(home, ".tianniu", "keystore")
+}
+
+// NewKeystore creates an empty keystore that is written to path on Save
+func NewKeystore(path, passphrase string) (*Keystore, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("keystore passphrase must not be empty")
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	ks := &Keystore{
+		path: path,
+		file: keystoreFile{
+			Version:    keystoreVersion,
+			KDF:        "pbkdf2-sha256",
+			Iterations: keystoreIterations,
+			Salt:       salt,
+			Entries:    map[string]keystoreEntry{},
+		},
+	}
+	if err := ks.deriveKey(passphrase); err != nil {
+		return nil, err
+	}
+
+	check, err := ks.seal("", keystoreCheckValue)
+	if err != nil {
+		return nil, err
+	}
+	ks.file.Check = check
+	return ks, nil
+}
+
+// OpenKeystore loads and unlocks an existing keystore
+func OpenKeystore(path, passphrase string) (*Keystore, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore: %v", err)
+	}
+
+	ks := &Keystore{path: path}
+	if err := json.Unmarshal(data, &ks.file); err != nil {
+		return nil, fmt.Errorf("failed to parse keystore %s: %v", path, err)
+	}
+	if ks.file.Version != keystoreVersion || ks.file.KDF != "pbkdf2-sha256" {
+		return nil, fmt.Errorf("unsupported keystore format in %s", path)
+	}
+	if ks.file.Entries == nil {
+		ks.file.Entries = map[string]keystoreEntry{}
+	}
+
+	if err := ks.deriveKey(passphrase); err != nil {
+		return nil, err
+	}
+	if check, err := ks.open("", ks.file.Check); err != nil || check != keystoreCheckValue {
+		return nil, fmt.Errorf("wrong passphrase for keystore %s", path)
+	}
+	return ks, nil
+}
+
+// Get decrypts the named entry
+func (ks *Keystore) Get(name string) (string, error) {
+	entry, ok := ks.file.Entries[name]
+	if !ok {
+		return "", fmt.Errorf("keystore entry %s not found", name)
+	}
+	value, err := ks.open(name, entry)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt keystore entry %s: %v", name, err)
+	}
+	return value, nil
+}
+
+// Set encrypts value under name, replacing any existing entry
+func (ks *Keystore) Set(name, value string) error {
+	if name == "" {
+		return fmt.Errorf("keystore entry name must not be empty")
+	}
+	entry, err := ks.seal(name, value)
+	if err != nil {
+		return err
+	}
+	ks.file.Entries[name] = entry
+	return nil
+}
+
+// Delete removes the named entry
+func (ks *Keystore) Delete(name string) error {
+	if _, ok := ks.file.Entries[name]; !ok {
+		return fmt.Errorf("keystore entry %s not found", name)
+	}
+	delete(ks.file.Entries, name)
+	return nil
+}
+
+// Names returns the entry names in sorted order
+func (ks *Keystore) Names() []string {
+	names := make([]string, 0, len(ks.file.Entries))
+	for name := range ks.file.Entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Save writes the keystore atomically with owner-only permissions
+func (ks *Keystore) Save() error {
+	data, err := json.MarshalIndent(ks.file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(ks.path), 0700); err != nil {
+		return fmt.Errorf("failed to create keystore directory: %v", err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(ks.path), ".keystore-*")
+	if err != nil {
+		return fmt.Errorf("failed to write keystore: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write keystore: %v", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write keystore: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write keystore: %v", err)
+	}
+	return os.Rename(tmp.Name(), ks.path)
+}
+
+func (ks *Keystore) deriveKey(passphrase string) error {
+	key, err := pbkdf2.Key(sha256.New, passphrase, ks.file.Salt, ks.file.Iterations, 32)
+	if err != nil {
+		return fmt.Errorf("failed to derive keystore key: %v", err)
+	}
+	ks.key = key
+	return nil
+}
+
+func (ks *Keystore) gcm() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(ks.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (ks *Keystore) seal(name, value string) (keystoreEntry, error) {
+	aead, err := ks.gcm()
+	if err != nil {
+		return keystoreEntry{}, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return keystoreEntry{}, err
+	}
+	return keystoreEntry{
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, []byte(value), []byte(name)),
+	}, nil
+}
+
+func (ks *Keystore) open(name string, entry keystoreEntry) (string, error) {
+	aead, err := ks.gcm()
+	if err != nil {
+		return "", err
+	}
+	if len(entry.Nonce) != aead.NonceSize() {
+		return "", fmt.Errorf("malformed entry")
+	}
+	plain, err := aead.Open(nil, entry.Nonce, entry.Ciphertext, []byte(name))
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,233 @@
+package tianniu
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Kubeconfig is a kubectl configuration file: the clusters, users and
+// contexts that pair them
+type Kubeconfig struct {
+	CurrentContext string             `yaml:"current-context"`
+	Clusters       []KubeNamedCluster `yaml:"clusters"`
+	Users          []KubeNamedUser    `yaml:"users"`
+	Contexts       []KubeNamedContext `yaml:"contexts"`
+
+	// dir resolves the relative certificate and token paths of the file
+	dir string
+}
+
+// KubeNamedCluster is an entry of the clusters list
+type KubeNamedCluster struct {
+	Name    string      `yaml:"name"`
+	Cluster KubeCluster `yaml:"cluster"`
+}
+
+// KubeCluster is the API server of a cluster and how to trust it
+type KubeCluster struct {
+	Server                   string `yaml:"server"`
+	CertificateAuthority     string `yaml:"certificate-authority,omitempty"`
+	CertificateAuthorityData string `yaml:"certificate-authority-data,omitempty"`
+	InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify,omitempty"`
+	TLSServerName            string `yaml:"tls-server-name,omitempty"`
+}
+
+// KubeNamedUser is an entry of the users list
+type KubeNamedUser struct {
+	Name string   `yaml:"name"`
+	User KubeUser `yaml:"user"`
+}
+
+// KubeUser holds the credentials of a user: a client certificate, a bearer
+// token or a username and password. Exec and auth-provider plugins are not
+// supported.
+type KubeUser struct {
+	ClientCertificate     string      `yaml:"client-certificate,omitempty"`
+	ClientCertificateData string      `yaml:"client-certificate-data,omitempty"`
+	ClientKey             string      `yaml:"client-key,omitempty"`
+	ClientKeyData         string      `yaml:"client-key-data,omitempty"`
+	Token                 string      `yaml:"token,omitempty"`
+	TokenFile             string      `yaml:"tokenFile,omitempty"`
+	Username              string      `yaml:"username,omitempty"`
+	Password              string      `yaml:"password,omitempty"`
+	Exec                  interface{} `yaml:"exec,omitempty"`
+	AuthProvider          interface{} `yaml:"auth-provider,omitempty"`
+}
+
+// KubeNamedContext is an entry of the contexts list
+type KubeNamedContext struct {
+	Name    string      `yaml:"name"`
+	Context KubeContext `yaml:"context"`
+}
+
+// KubeContext pairs a cluster with a user and a default namespace
+type KubeContext struct {
+	Cluster   string `yaml:"cluster"`
+	User      string `yaml:"user"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// ClusterConfig is a resolved kubeconfig context: the API server, the
+// credentials to use and the default namespace
+type ClusterConfig struct {
+	Context   string
+	Server    string
+	Namespace string
+	TLS       *tls.Config
+	Token     string
+	Username  string
+	Password  string
+}
+
+// LoadKubeconfig loads a kubeconfig file
+func LoadKubeconfig(path string) (*Kubeconfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var k Kubeconfig
+	if err := yaml.Unmarshal(data, &k); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	k.dir = filepath.Dir(path)
+	return &k, nil
+}
+
+// KubeconfigPath returns the kubeconfig path of the environment. Relative
+// paths are resolved against the directory of the TianNiu configuration
+// file.
+func (e *Environment) KubeconfigPath(configPath string) string {
+	if e.Kubeconfig == "" || filepath.IsAbs(e.Kubeconfig) {
+		return e.Kubeconfig
+	}
+	return filepath.Join(filepath.Dir(configPath), e.Kubeconfig)
+}
+
+// ClusterConfig resolves a context, or the current context when name is
+// empty. The namespace defaults to "default".
+func (k *Kubeconfig) ClusterConfig(name string) (*ClusterConfig, error) {
+	if name == "" {
+		name = k.CurrentContext
+	}
+	if name == "" {
+		return nil, fmt.Errorf("no context given and no current-context set")
+	}
+	var context *KubeContext
+	for i := range k.Contexts {
+		if k.Contexts[i].Name == name {
+			context = &k.Contexts[i].Context
+		}
+	}
+	if context == nil {
+		return nil, fmt.Errorf("context %s not found", name)
+	}
+	var cluster *KubeCluster
+	for i := range k.Clusters {
+		if k.Clusters[i].Name == context.Cluster {
+			cluster = &k.Clusters[i].Cluster
+		}
+	}
+	if cluster == nil {
+		return nil, fmt.Errorf("context %s: cluster %s not found", name, context.Cluster)
+	}
+	if cluster.Server == "" {
+		return nil, fmt.Errorf("context %s: cluster %s has no server", name, context.Cluster)
+	}
+	var user *KubeUser
+	for i := range k.Users {
+		if k.Users[i].Name == context.User {
+			user = &k.Users[i].User
+		}
+	}
+	if user == nil && context.User != "" {
+		return nil, fmt.Errorf("context %s: user %s not found", name, context.User)
+	}
+
+	c := &ClusterConfig{
+		Context:   name,
+		Server:    strings.TrimSuffix(cluster.Server, "/"),
+		Namespace: context.Namespace,
+		TLS:       &tls.Config{ServerName: cluster.TLSServerName, InsecureSkipVerify: cluster.InsecureSkipTLSVerify},
+	}
+	if c.Namespace == "" {
+		c.Namespace = "default"
+	}
+	ca, err := k.fileOrData(cluster.CertificateAuthority, cluster.CertificateAuthorityData)
+	if err != nil {
+		return nil, fmt.Errorf("context %s: certificate-authority: %v", name, err)
+	}
+	if ca != nil {
+		c.TLS.RootCAs = x509.NewCertPool()
+		if !c.TLS.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("context %s: certificate-authority: no PEM certificates found", name)
+		}
+	}
+	if user != nil {
+		if err := k.credentials(c, user); err != nil {
+			return nil, fmt.Errorf("context %s: user %s: %v", name, context.User, err)
+		}
+	}
+	return c, nil
+}
+
+// credentials loads the client certificate, token or password of a user
+func (k *Kubeconfig) credentials(c *ClusterConfig, user *KubeUser) error {
+	if user.Exec != nil || user.AuthProvider != nil {
+		return fmt.Errorf("exec and auth-provider credentials are not supported")
+	}
+	cert, err := k.fileOrData(user.ClientCertificate, user.ClientCertificateData)
+	if err != nil {
+		return fmt.Errorf("client-certificate: %v", err)
+	}
+	key, err := k.fileOrData(user.ClientKey, user.ClientKeyData)
+	if err != nil {
+		return fmt.Errorf("client-key: %v", err)
+	}
+	if (cert == nil) != (key == nil) {
+		return fmt.Errorf("client-certificate and client-key must be set together")
+	}
+	if cert != nil {
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return fmt.Errorf("client certificate: %v", err)
+		}
+		c.TLS.Certificates = []tls.Certificate{pair}
+	}
+
+	c.Token = user.Token
+	if user.TokenFile != "" && c.Token == "" {
+		data, err := ioutil.ReadFile(k.path(user.TokenFile))
+		if err != nil {
+			return fmt.Errorf("tokenFile: %v", err)
+		}
+		c.Token = strings.TrimSpace(string(data))
+	}
+	c.Username, c.Password = user.Username, user.Password
+	return nil
+}
+
+// fileOrData returns the contents of a base64 *-data field, or of the file
+// it replaces. Both empty returns nil.
+func (k *Kubeconfig) fileOrData(file, data string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if file != "" {
+		return ioutil.ReadFile(k.path(file))
+	}
+	return nil, nil
+}
+
+func (k *Kubeconfig) path(file string) string {
+	if filepath.IsAbs(file) || k.dir == "" {
+		return file
+	}
+	return filepath.Join(k.dir, file)
+}
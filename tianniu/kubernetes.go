@@ -0,0 +1,461 @@
+package tianniu
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// Kubernetes labels and annotations set on exported objects
+const (
+	K8sNameLabel             = "app.kubernetes.io/name"
+	K8sVersionLabel          = "app.kubernetes.io/version"
+	K8sManagedByLabel        = "app.kubernetes.io/managed-by"
+	K8sEnvironmentLabel      = "tianniu.baidu.com/environment"
+	K8sDescriptionAnnotation = "tianniu.baidu.com/description"
+	K8sIDAnnotation          = "tianniu.baidu.com/deployment-id"
+	K8sPlaceholderAnnotation = "tianniu.baidu.com/placeholder"
+)
+
+// The types below are the subset of the Kubernetes API objects that TianNiu
+// deployments map to. They marshal to the JSON and YAML that kubectl reads.
+
+// K8sObjectMeta is the metadata of a Kubernetes object
+type K8sObjectMeta struct {
+	Name        string            `json:"name,omitempty"`
+	Namespace   string            `json:"namespace,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// CreationTimestamp is set by the API server
+	CreationTimestamp *time.Time `json:"creationTimestamp,omitempty"`
+}
+
+// K8sIntOrString is a value that is either a number or a string, such as a
+// named target port or a "25%" max surge
+type K8sIntOrString struct {
+	Int    int
+	String string
+}
+
+// MarshalJSON writes the string when it is set, and the number otherwise
+func (v K8sIntOrString) MarshalJSON() ([]byte, error) {
+	if v.String != "" {
+		return json.Marshal(v.String)
+	}
+	return json.Marshal(v.Int)
+}
+
+// UnmarshalJSON reads a number or a string
+func (v *K8sIntOrString) UnmarshalJSON(data []byte) error {
+	*v = K8sIntOrString{}
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &v.String)
+	}
+	return json.Unmarshal(data, &v.Int)
+}
+
+// K8sDeployment is an apps/v1 Deployment
+type K8sDeployment struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   K8sObjectMeta     `json:"metadata"`
+	Spec       K8sDeploymentSpec `json:"spec"`
+	// Status is reported by the cluster
+	Status *K8sDeploymentStatus `json:"status,omitempty"`
+}
+
+// K8sDeploymentSpec is the spec of a Kubernetes deployment
+type K8sDeploymentSpec struct {
+	Replicas int                   `json:"replicas"`
+	Selector K8sLabelSelector      `json:"selector"`
+	Strategy K8sDeploymentStrategy `json:"strategy,omitempty"`
+	Template K8sPodTemplate        `json:"template"`
+}
+
+// K8sDeploymentStatus counts the pods of a deployment by state
+type K8sDeploymentStatus struct {
+	Replicas            int `json:"replicas,omitempty"`
+	UpdatedReplicas     int `json:"updatedReplicas,omitempty"`
+	ReadyReplicas       int `json:"readyReplicas,omitempty"`
+	AvailableReplicas   int `json:"availableReplicas,omitempty"`
+	UnavailableReplicas int `json:"unavailableReplicas,omitempty"`
+}
+
+// K8sLabelSelector selects pods by label
+type K8sLabelSelector struct {
+	MatchLabels map[string]string `json:"matchLabels"`
+}
+
+// K8sDeploymentStrategy is RollingUpdate or Recreate
+type K8sDeploymentStrategy struct {
+	Type          string            `json:"type,omitempty"`
+	RollingUpdate *K8sRollingUpdate `json:"rollingUpdate,omitempty"`
+}
+
+// K8sRollingUpdate bounds the pods added and removed during a rollout
+type K8sRollingUpdate struct {
+	MaxSurge       K8sIntOrString `json:"maxSurge"`
+	MaxUnavailable K8sIntOrString `json:"maxUnavailable"`
+}
+
+// K8sPodTemplate is the pod template of a deployment
+type K8sPodTemplate struct {
+	Metadata K8sObjectMeta `json:"metadata"`
+	Spec     K8sPodSpec    `json:"spec"`
+}
+
+// K8sPodSpec lists the containers of a pod. NodeName is set by the
+// scheduler.
+type K8sPodSpec struct {
+	NodeName   string         `json:"nodeName,omitempty"`
+	Containers []K8sContainer `json:"containers"`
+}
+
+// K8sContainer is a container of a pod template
+type K8sContainer struct {
+	Name           string                  `json:"name"`
+	Image          string                  `json:"image"`
+	Ports          []K8sContainerPort      `json:"ports,omitempty"`
+	EnvFrom        []K8sEnvFromSource      `json:"envFrom,omitempty"`
+	Env            []K8sEnvVar             `json:"env,omitempty"`
+	Resources      K8sResourceRequirements `json:"resources,omitempty"`
+	LivenessProbe  *K8sProbe               `json:"livenessProbe,omitempty"`
+	ReadinessProbe *K8sProbe               `json:"readinessProbe,omitempty"`
+}
+
+// K8sContainerPort is a port a container listens on
+type K8sContainerPort struct {
+	Name          string `json:"name,omitempty"`
+	ContainerPort int    `json:"containerPort"`
+	Protocol      string `json:"protocol,omitempty"`
+}
+
+// K8sEnvFromSource loads every key of a ConfigMap or Secret as variables
+type K8sEnvFromSource struct {
+	ConfigMapRef *K8sLocalObjectReference `json:"configMapRef,omitempty"`
+	SecretRef    *K8sLocalObjectReference `json:"secretRef,omitempty"`
+}
+
+// K8sLocalObjectReference names an object of the same namespace
+type K8sLocalObjectReference struct {
+	Name string `json:"name"`
+}
+
+// K8sEnvVar is an environment variable of a container
+type K8sEnvVar struct {
+	Name      string           `json:"name"`
+	Value     string           `json:"value,omitempty"`
+	ValueFrom *K8sEnvVarSource `json:"valueFrom,omitempty"`
+}
+
+// K8sEnvVarSource takes a variable from a key of a Secret or ConfigMap
+type K8sEnvVarSource struct {
+	SecretKeyRef    *K8sKeySelector `json:"secretKeyRef,omitempty"`
+	ConfigMapKeyRef *K8sKeySelector `json:"configMapKeyRef,omitempty"`
+}
+
+// K8sKeySelector is a key of a Secret or ConfigMap
+type K8sKeySelector struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// K8sResourceRequirements are the cpu and memory limits and requests of a
+// container
+type K8sResourceRequirements struct {
+	Limits   map[string]Quantity `json:"limits,omitempty"`
+	Requests map[string]Quantity `json:"requests,omitempty"`
+}
+
+// K8sProbe is an HTTP liveness or readiness probe
+type K8sProbe struct {
+	HTTPGet             *K8sHTTPGetAction   `json:"httpGet,omitempty"`
+	TCPSocket           *K8sTCPSocketAction `json:"tcpSocket,omitempty"`
+	Exec                *K8sExecAction      `json:"exec,omitempty"`
+	InitialDelaySeconds int                 `json:"initialDelaySeconds,omitempty"`
+	PeriodSeconds       int                 `json:"periodSeconds,omitempty"`
+	TimeoutSeconds      int                 `json:"timeoutSeconds,omitempty"`
+	SuccessThreshold    int                 `json:"successThreshold,omitempty"`
+	FailureThreshold    int                 `json:"failureThreshold,omitempty"`
+}
+
+// K8sHTTPGetAction is the request of an HTTP probe
+type K8sHTTPGetAction struct {
+	Path string         `json:"path"`
+	Port K8sIntOrString `json:"port"`
+}
+
+// K8sTCPSocketAction is the port of a TCP probe
+type K8sTCPSocketAction struct {
+	Port K8sIntOrString `json:"port"`
+}
+
+// K8sExecAction is the command of an exec probe
+type K8sExecAction struct {
+	Command []string `json:"command"`
+}
+
+// K8sService is a v1 Service
+type K8sService struct {
+	APIVersion string         `json:"apiVersion"`
+	Kind       string         `json:"kind"`
+	Metadata   K8sObjectMeta  `json:"metadata"`
+	Spec       K8sServiceSpec `json:"spec"`
+}
+
+// K8sServiceSpec routes service ports to the pods of a selector
+type K8sServiceSpec struct {
+	Type      string            `json:"type,omitempty"`
+	ClusterIP string            `json:"clusterIP,omitempty"`
+	Selector  map[string]string `json:"selector"`
+	Ports     []K8sServicePort  `json:"ports"`
+}
+
+// K8sServicePort routes a service port to a target port of the pods
+type K8sServicePort struct {
+	Name       string         `json:"name,omitempty"`
+	Protocol   string         `json:"protocol,omitempty"`
+	Port       int            `json:"port"`
+	TargetPort K8sIntOrString `json:"targetPort"`
+	NodePort   int            `json:"nodePort,omitempty"`
+}
+
+// K8sConfigMap is a v1 ConfigMap
+type K8sConfigMap struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   K8sObjectMeta     `json:"metadata"`
+	Data       map[string]string `json:"data"`
+}
+
+// K8sSecret is a v1 Secret. Data values are base64 encoded; StringData
+// values are plain.
+type K8sSecret struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   K8sObjectMeta     `json:"metadata"`
+	Type       string            `json:"type,omitempty"`
+	Data       map[string]string `json:"data,omitempty"`
+	StringData map[string]string `json:"stringData,omitempty"`
+}
+
+// K8sExportOptions control ExportKubernetes
+type K8sExportOptions struct {
+	// Namespace of the objects; defaults to the deployment's environment
+	Namespace string
+}
+
+// K8sObjects are the Kubernetes objects of one deployment
+type K8sObjects struct {
+	ConfigMaps []*K8sConfigMap
+	Secrets    []*K8sSecret
+	Deployment *K8sDeployment
+	Services   []*K8sService
+}
+
+// Items returns the objects in the order to apply them: ConfigMaps and
+// Secrets before the Deployment that uses them, then the Services
+func (o *K8sObjects) Items() []interface{} {
+	var items []interface{}
+	for _, cm := range o.ConfigMaps {
+		items = append(items, cm)
+	}
+	for _, s := range o.Secrets {
+		items = append(items, s)
+	}
+	items = append(items, o.Deployment)
+	for _, svc := range o.Services {
+		items = append(items, svc)
+	}
+	return items
+}
+
+// ExportKubernetes converts a deployment to Kubernetes objects. The literal
+// environment variables of each container go to a ConfigMap named
+// "<deployment>-env", or "<deployment>-<container>-env" when there are
+// several containers. Variables taken from TianNiu secrets become
+// secretKeyRefs, and each referenced secret is exported as a placeholder
+// Secret with empty values to fill in, since the API does not return secret
+// values. Service target ports, which name a container's service_port, are
+// mapped to the matching container port.
+func ExportKubernetes(d *Deployment, opts K8sExportOptions) *K8sObjects {
+	namespace := opts.Namespace
+	if namespace == "" {
+		namespace = d.Environment
+	}
+	selector := map[string]string{K8sNameLabel: d.Name}
+	labels := map[string]string{
+		K8sNameLabel:      d.Name,
+		K8sManagedByLabel: "tianniu",
+	}
+	if d.Version != "" {
+		labels[K8sVersionLabel] = d.Version
+	}
+	if d.Environment != "" {
+		labels[K8sEnvironmentLabel] = d.Environment
+	}
+	meta := func(name string) K8sObjectMeta {
+		return K8sObjectMeta{Name: name, Namespace: namespace, Labels: copyLabels(labels)}
+	}
+
+	objects := &K8sObjects{}
+	deployment := &K8sDeployment{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Metadata:   meta(d.Name),
+		Spec: K8sDeploymentSpec{
+			Replicas: d.Replicas,
+			Selector: K8sLabelSelector{MatchLabels: selector},
+			Template: K8sPodTemplate{Metadata: K8sObjectMeta{Labels: copyLabels(labels)}},
+		},
+	}
+	annotations := map[string]string{}
+	if d.Description != "" {
+		annotations[K8sDescriptionAnnotation] = d.Description
+	}
+	if d.ID != "" {
+		annotations[K8sIDAnnotation] = d.ID
+	}
+	if len(annotations) > 0 {
+		deployment.Metadata.Annotations = annotations
+	}
+	switch d.Strategy.Type {
+	case StrategyRollingUpdate:
+		deployment.Spec.Strategy = K8sDeploymentStrategy{
+			Type: "RollingUpdate",
+			RollingUpdate: &K8sRollingUpdate{
+				MaxSurge:       K8sIntOrString{Int: d.Strategy.MaxSurge},
+				MaxUnavailable: K8sIntOrString{Int: d.Strategy.MaxUnavailable},
+			},
+		}
+	case StrategyRecreate:
+		deployment.Spec.Strategy = K8sDeploymentStrategy{Type: "Recreate"}
+	}
+
+	secrets := map[string]*K8sSecret{}
+	containerPorts := map[int]int{}
+	for _, c := range d.Containers {
+		kc := K8sContainer{Name: c.Name, Image: c.Image}
+		for _, p := range c.Ports {
+			kc.Ports = append(kc.Ports, K8sContainerPort{Name: p.Name, ContainerPort: p.ContainerPort, Protocol: "TCP"})
+			if p.ServicePort != 0 {
+				containerPorts[p.ServicePort] = p.ContainerPort
+			}
+		}
+		kc.Resources = K8sResourceRequirements{
+			Limits:   k8sResourceList(c.Resources.Limits),
+			Requests: k8sResourceList(c.Resources.Requests),
+		}
+
+		data := map[string]string{}
+		for _, env := range c.EnvironmentVariables {
+			if env.ValueFrom == nil {
+				data[env.Name] = env.Value
+				continue
+			}
+			ref := env.ValueFrom
+			kc.Env = append(kc.Env, K8sEnvVar{
+				Name:      env.Name,
+				ValueFrom: &K8sEnvVarSource{SecretKeyRef: &K8sKeySelector{Name: ref.SecretName, Key: ref.Key}},
+			})
+			secret, ok := secrets[ref.SecretName]
+			if !ok {
+				secret = &K8sSecret{
+					APIVersion: "v1",
+					Kind:       "Secret",
+					Metadata:   meta(ref.SecretName),
+					Type:       "Opaque",
+					StringData: map[string]string{},
+				}
+				secret.Metadata.Annotations = map[string]string{K8sPlaceholderAnnotation: "true"}
+				secrets[ref.SecretName] = secret
+				objects.Secrets = append(objects.Secrets, secret)
+			}
+			secret.StringData[ref.Key] = ""
+		}
+		if len(data) > 0 {
+			name := d.Name + "-env"
+			if len(d.Containers) > 1 {
+				name = d.Name + "-" + c.Name + "-env"
+			}
+			objects.ConfigMaps = append(objects.ConfigMaps, &K8sConfigMap{APIVersion: "v1", Kind: "ConfigMap", Metadata: meta(name), Data: data})
+			kc.EnvFrom = []K8sEnvFromSource{{ConfigMapRef: &K8sLocalObjectReference{Name: name}}}
+		}
+
+		if h := c.HealthCheck; h != nil {
+			probe := &K8sProbe{
+				InitialDelaySeconds: h.InitialDelaySeconds,
+				PeriodSeconds:       h.PeriodSeconds,
+				TimeoutSeconds:      h.TimeoutSeconds,
+				SuccessThreshold:    h.SuccessThreshold,
+				FailureThreshold:    h.FailureThreshold,
+			}
+			switch {
+			case h.TCPPort != 0:
+				probe.TCPSocket = &K8sTCPSocketAction{Port: K8sIntOrString{Int: h.TCPPort}}
+			case len(h.Command) > 0:
+				probe.Exec = &K8sExecAction{Command: h.Command}
+			default:
+				probe.HTTPGet = &K8sHTTPGetAction{Path: h.HTTPPath, Port: K8sIntOrString{Int: h.Port}}
+			}
+			readiness := *probe
+			kc.LivenessProbe, kc.ReadinessProbe = probe, &readiness
+			// Kubernetes requires a liveness success threshold of 1
+			kc.LivenessProbe.SuccessThreshold = 0
+		}
+		deployment.Spec.Template.Spec.Containers = append(deployment.Spec.Template.Spec.Containers, kc)
+	}
+	objects.Deployment = deployment
+
+	for _, svc := range d.Services {
+		ks := &K8sService{
+			APIVersion: "v1",
+			Kind:       "Service",
+			Metadata:   meta(svc.Name),
+			Spec:       K8sServiceSpec{Type: svc.Type, Selector: selector},
+		}
+		for _, p := range svc.Ports {
+			target, ok := containerPorts[p.TargetPort]
+			if !ok {
+				target = p.TargetPort
+			}
+			ks.Spec.Ports = append(ks.Spec.Ports, K8sServicePort{
+				Name:       p.Name,
+				Protocol:   "TCP",
+				Port:       p.Port,
+				TargetPort: K8sIntOrString{Int: target},
+			})
+		}
+		objects.Services = append(objects.Services, ks)
+	}
+
+	sort.Slice(objects.Secrets, func(i, j int) bool { return objects.Secrets[i].Metadata.Name < objects.Secrets[j].Metadata.Name })
+	return objects
+}
+
+// k8sResourceList converts CPU and memory to Kubernetes quantities, which
+// write decimal bytes as "512M" rather than "512MB"
+func k8sResourceList(r ResourceList) map[string]Quantity {
+	list := map[string]Quantity{}
+	for name, q := range map[string]Quantity{"cpu": r.CPU, "memory": r.Memory} {
+		if q.IsZero() {
+			continue
+		}
+		if q.Format() == DecimalBytes {
+			q = NewMilliQuantity(q.MilliValue(), DecimalSI)
+		}
+		list[name] = q
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	return list
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	c := make(map[string]string, len(labels))
+	for k, v := range labels {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,425 @@
+package tianniu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LogEntry is a line written by a container
+type LogEntry struct {
+	// ContainerID is set by the SDK to the container the line came from
+	ContainerID string    `json:"container_id,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+	Stream      string    `json:"stream"`
+	Message     string    `json:"message"`
+}
+
+// ContainerLogs is the log of a container as returned without follow
+type ContainerLogs struct {
+	ContainerID string     `json:"container_id"`
+	Logs        []LogEntry `json:"logs"`
+}
+
+// ContainerLogsOptions selects log lines. Zero-valued fields are not sent;
+// the server returns the last 100 lines by default.
+type ContainerLogsOptions struct {
+	Tail  int
+	Since time.Time
+	Until time.Time
+
+	// Follow keeps the stream open for new lines until the context is done
+	// or the container stops. A dropped connection is reopened from the
+	// last line received.
+	Follow bool
+
+	// Timestamps prefixes the lines read through LogStream.Read with their
+	// RFC3339 timestamp
+	Timestamps bool
+
+	// MaxReconnects bounds the reconnects in a row that receive no line.
+	// Zero means 5.
+	MaxReconnects int
+}
+
+// logReconnectDelay is the wait before the first reconnect; later attempts
+// wait longer
+var logReconnectDelay = 500 * time.Millisecond
+
+// stoppedStatuses end a followed log stream instead of reconnecting
+var stoppedStatuses = []string{"stopping", "stopped", "exited", "deleted"}
+
+// LogStream reads the log of a container line by line. Use Next and Entry
+// to iterate, or Read for the plain text. Close releases the connection.
+//
+// Without follow the server answers the documented JSON document. With
+// follow it streams one JSON LogEntry per line (application/x-ndjson).
+type LogStream struct {
+	s      *ContainersService
+	parent context.Context
+	ctx    context.Context
+	cancel context.CancelFunc
+	id     string
+	opts   ContainerLogsOptions
+
+	body     io.ReadCloser
+	dec      *json.Decoder
+	buffered []LogEntry
+
+	entry    LogEntry
+	err      error
+	attempts int
+
+	// last is the timestamp of the newest line and atLast the number of
+	// lines seen with it, skipped again after a reconnect
+	last   time.Time
+	atLast int
+	skip   int
+
+	text []byte
+}
+
+// Logs opens the log of a container
+func (s *ContainersService) Logs(ctx context.Context, id string, opts ContainerLogsOptions) (*LogStream, error) {
+	l := &LogStream{s: s, parent: ctx, id: id, opts: opts}
+	l.ctx, l.cancel = context.WithCancel(ctx)
+	if err := l.open(); err != nil {
+		l.cancel()
+		return nil, err
+	}
+	return l, nil
+}
+
+// open sends the logs request, resuming from the last line after a
+// reconnect
+func (l *LogStream) open() error {
+	query := url.Values{}
+	since := l.opts.Since
+	if l.last.IsZero() {
+		if l.opts.Tail > 0 {
+			query.Set("tail", strconv.Itoa(l.opts.Tail))
+		}
+	} else {
+		since = l.last
+		l.skip = l.atLast
+	}
+	if !since.IsZero() {
+		query.Set("since", since.UTC().Format(time.RFC3339Nano))
+	}
+	if !l.opts.Until.IsZero() {
+		query.Set("until", l.opts.Until.UTC().Format(time.RFC3339Nano))
+	}
+	if l.opts.Follow {
+		query.Set("follow", "true")
+	}
+
+	req, err := l.s.client.newRequest(l.ctx, "GET", containerPath(l.id)+"/logs", query, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/x-ndjson, application/json")
+
+	// The client timeout would cut a followed stream
+	httpClient := *l.s.client.HTTPClient
+	if l.opts.Follow {
+		httpClient.Timeout = 0
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	if err := checkResponse(resp); err != nil {
+		resp.Body.Close()
+		return err
+	}
+
+	if isStreaming(resp) {
+		l.body, l.dec = resp.Body, json.NewDecoder(resp.Body)
+		return nil
+	}
+	defer resp.Body.Close()
+	var logs ContainerLogs
+	if err := json.NewDecoder(resp.Body).Decode(&logs); err != nil {
+		return fmt.Errorf("failed to decode logs: %v", err)
+	}
+	l.buffered = logs.Logs
+	return nil
+}
+
+// read returns the next line of the current response
+func (l *LogStream) read() (LogEntry, error) {
+	var entry LogEntry
+	if l.dec != nil {
+		err := l.dec.Decode(&entry)
+		return entry, err
+	}
+	if len(l.buffered) == 0 {
+		return entry, io.EOF
+	}
+	entry, l.buffered = l.buffered[0], l.buffered[1:]
+	return entry, nil
+}
+
+// Next advances to the next line, blocking while following. It returns
+// false at the end of the log or on an error; see Err.
+func (l *LogStream) Next() bool {
+	for l.err == nil {
+		entry, err := l.read()
+		if err == nil {
+			if l.skip > 0 && entry.Timestamp.Equal(l.last) {
+				l.skip--
+				continue
+			}
+			l.skip = 0
+			if entry.Timestamp.Before(l.last) {
+				continue
+			}
+			if entry.Timestamp.Equal(l.last) {
+				l.atLast++
+			} else {
+				l.last, l.atLast = entry.Timestamp, 1
+			}
+			entry.ContainerID = l.id
+			l.entry, l.attempts = entry, 0
+			return true
+		}
+
+		l.closeBody()
+		switch {
+		case l.ctx.Err() != nil:
+			// Close ends the stream; a done parent context is an error
+			l.err = l.parent.Err()
+			if l.err == nil {
+				l.err = io.EOF
+			}
+		case !l.opts.Follow:
+			l.err = err
+		default:
+			l.err = l.reconnect(err)
+		}
+	}
+	return false
+}
+
+// reconnect reopens a followed stream that ended with cause. A clean end
+// is only reopened while the container has not stopped.
+func (l *LogStream) reconnect(cause error) error {
+	max := l.opts.MaxReconnects
+	if max <= 0 {
+		max = 5
+	}
+	for {
+		if cause == io.EOF {
+			container, err := l.s.Get(l.ctx, l.id)
+			if err != nil {
+				return err
+			}
+			if containsString(stoppedStatuses, container.Status) {
+				return io.EOF
+			}
+		}
+		if l.attempts >= max {
+			return fmt.Errorf("log stream of container %s dropped: %v", l.id, cause)
+		}
+		l.attempts++
+
+		select {
+		case <-time.After(time.Duration(l.attempts) * logReconnectDelay):
+		case <-l.ctx.Done():
+			return l.ctx.Err()
+		}
+		err := l.open()
+		if err == nil {
+			return nil
+		}
+		if _, ok := err.(*APIError); ok {
+			return err
+		}
+		cause = err
+	}
+}
+
+// Entry returns the line read by the last call to Next
+func (l *LogStream) Entry() LogEntry {
+	return l.entry
+}
+
+// Err returns the error that ended the stream, or nil at the end of the log
+func (l *LogStream) Err() error {
+	if l.err == io.EOF {
+		return nil
+	}
+	return l.err
+}
+
+// Read reads the log as text, one message per line
+func (l *LogStream) Read(p []byte) (int, error) {
+	for len(l.text) == 0 {
+		if !l.Next() {
+			if err := l.Err(); err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+		if l.opts.Timestamps {
+			l.text = append(l.text, l.entry.Timestamp.Format(time.RFC3339)+" "...)
+		}
+		l.text = append(append(l.text, l.entry.Message...), '\n')
+	}
+	n := copy(p, l.text)
+	l.text = l.text[n:]
+	return n, nil
+}
+
+// Close stops the stream. It may be called from another goroutine, and a
+// blocked Next then returns false.
+func (l *LogStream) Close() error {
+	// Canceling the request context also releases the response body
+	l.cancel()
+	return nil
+}
+
+func (l *LogStream) closeBody() {
+	if l.body != nil {
+		l.body.Close()
+		l.body, l.dec = nil, nil
+	}
+}
+
+// MultiLogStream merges the logs of several containers. Without follow
+// the lines are ordered by timestamp; with follow they are returned as
+// they arrive.
+type MultiLogStream struct {
+	streams []*LogStream
+	entry   LogEntry
+	err     error
+
+	// heads are the pending lines of each stream without follow
+	heads []*LogEntry
+
+	// lines receives the lines of all streams with follow
+	lines chan LogEntry
+	done  chan struct{}
+	errs  chan error
+	wg    sync.WaitGroup
+	once  sync.Once
+}
+
+// MergeLogStreams merges streams opened with the same options
+func MergeLogStreams(streams []*LogStream) *MultiLogStream {
+	m := &MultiLogStream{streams: streams}
+	if len(streams) == 0 || !streams[0].opts.Follow {
+		return m
+	}
+
+	m.lines = make(chan LogEntry)
+	m.done = make(chan struct{})
+	m.errs = make(chan error, len(streams))
+	for _, l := range streams {
+		m.wg.Add(1)
+		go func(l *LogStream) {
+			defer m.wg.Done()
+			for l.Next() {
+				select {
+				case m.lines <- l.Entry():
+				case <-m.done:
+					return
+				}
+			}
+			if err := l.Err(); err != nil {
+				m.errs <- fmt.Errorf("container %s: %v", l.id, err)
+			}
+		}(l)
+	}
+	go func() {
+		m.wg.Wait()
+		close(m.lines)
+	}()
+	return m
+}
+
+// Next advances to the next line of any stream. A stream that fails does
+// not end the others; the first error is returned by Err.
+func (m *MultiLogStream) Next() bool {
+	if m.lines != nil {
+		entry, ok := <-m.lines
+		if !ok {
+			select {
+			case m.err = <-m.errs:
+			default:
+			}
+			return false
+		}
+		m.entry = entry
+		return true
+	}
+
+	if m.heads == nil {
+		m.heads = make([]*LogEntry, len(m.streams))
+		for i := range m.streams {
+			m.advance(i)
+		}
+	}
+	next := -1
+	for i, head := range m.heads {
+		if head != nil && (next < 0 || head.Timestamp.Before(m.heads[next].Timestamp)) {
+			next = i
+		}
+	}
+	if next < 0 {
+		return false
+	}
+	m.entry = *m.heads[next]
+	m.advance(next)
+	return true
+}
+
+// advance reads the next line of stream i into its head
+func (m *MultiLogStream) advance(i int) {
+	l := m.streams[i]
+	if l.Next() {
+		entry := l.Entry()
+		m.heads[i] = &entry
+		return
+	}
+	m.heads[i] = nil
+	if err := l.Err(); err != nil && m.err == nil {
+		m.err = fmt.Errorf("container %s: %v", l.id, err)
+	}
+}
+
+// Entry returns the line read by the last call to Next
+func (m *MultiLogStream) Entry() LogEntry {
+	return m.entry
+}
+
+// Err returns the first error of the merged streams
+func (m *MultiLogStream) Err() error {
+	return m.err
+}
+
+// Close closes all streams
+func (m *MultiLogStream) Close() error {
+	m.once.Do(func() {
+		if m.done != nil {
+			close(m.done)
+		}
+		for _, l := range m.streams {
+			l.Close()
+		}
+	})
+	return nil
+}
+
+// isStreaming reports whether resp is a followed log stream
+func isStreaming(resp *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mediaType == "application/x-ndjson"
+}
@@ -0,0 +1,415 @@
+package tianniu
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ManifestAPIVersion is the apiVersion of the manifest format
+const ManifestAPIVersion = "v1"
+
+// Manifest kinds
+const (
+	KindDeployment    = "Deployment"
+	KindContainer     = "Container"
+	KindResourceQuota = "ResourceQuota"
+	KindPolicy        = "Policy"
+)
+
+// ObjectMeta identifies the object of a manifest
+type ObjectMeta struct {
+	Name        string            `json:"name"`
+	Environment string            `json:"environment,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+// DeploymentManifest is a deployment in the manifest format:
+//
+//	apiVersion: v1
+//	kind: Deployment
+//	metadata:
+//	  name: web-frontend
+//	  environment: production
+//	spec:
+//	  version: v2.3.1
+//	  replicas: 3
+//	  containers: [...]
+type DeploymentManifest struct {
+	APIVersion string         `json:"apiVersion"`
+	Kind       string         `json:"kind"`
+	Metadata   ObjectMeta     `json:"metadata"`
+	Spec       DeploymentSpec `json:"spec"`
+}
+
+// DeploymentSpec is the desired state of a deployment
+type DeploymentSpec struct {
+	Version    string                `json:"version"`
+	Replicas   int                   `json:"replicas"`
+	Strategy   *DeploymentStrategy   `json:"strategy,omitempty"`
+	Containers []DeploymentContainer `json:"containers,omitempty"`
+	Services   []Service             `json:"services,omitempty"`
+}
+
+// ContainerManifest is a container in the manifest format. Its metadata
+// labels become the container labels.
+type ContainerManifest struct {
+	APIVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Metadata   ObjectMeta    `json:"metadata"`
+	Spec       ContainerSpec `json:"spec"`
+}
+
+// ContainerSpec is the desired state of a container
+type ContainerSpec struct {
+	Image                string           `json:"image"`
+	Ports                []Port           `json:"ports,omitempty"`
+	Volumes              []Volume         `json:"volumes,omitempty"`
+	Network              string           `json:"network,omitempty"`
+	ResourceLimits       *ContainerLimits `json:"resource_limits,omitempty"`
+	EnvironmentVariables []EnvVar         `json:"environment_variables,omitempty"`
+	HealthCheck          *ContainerProbe  `json:"health_check,omitempty"`
+	RestartPolicy        *RestartPolicy   `json:"restart_policy,omitempty"`
+}
+
+// ContainerProbe is the health check of a container spec, without the
+// result fields of ContainerHealth
+type ContainerProbe struct {
+	Endpoint string   `json:"endpoint,omitempty"`
+	Interval string   `json:"interval,omitempty"`
+	Timeout  string   `json:"timeout,omitempty"`
+	Retries  int      `json:"retries,omitempty"`
+	Command  []string `json:"command,omitempty"`
+}
+
+// ResourceQuotaManifest sets the quotas of the namespace named by its
+// metadata:
+//
+//	apiVersion: v1
+//	kind: ResourceQuota
+//	metadata:
+//	  name: production
+//	spec:
+//	  limits:
+//	    cpu: 150
+//	    memory: 512
+type ResourceQuotaManifest struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   ObjectMeta        `json:"metadata"`
+	Spec       ResourceQuotaSpec `json:"spec"`
+}
+
+// ResourceQuotaSpec maps resource types to their limits, in the unit the
+// API reports for the type
+type ResourceQuotaSpec struct {
+	Limits map[string]float64 `json:"limits"`
+}
+
+// Manifest is one document of a manifest file. Exactly one of Deployment,
+// Container, ResourceQuota and Policy is set, according to Kind.
+type Manifest struct {
+	Kind          string
+	Deployment    *DeploymentManifest
+	Container     *ContainerManifest
+	ResourceQuota *ResourceQuotaManifest
+	Policy        *Policy
+}
+
+// Name returns the metadata name of the manifest
+func (m *Manifest) Name() string {
+	switch {
+	case m.Deployment != nil:
+		return m.Deployment.Metadata.Name
+	case m.Container != nil:
+		return m.Container.Metadata.Name
+	case m.ResourceQuota != nil:
+		return m.ResourceQuota.Metadata.Name
+	case m.Policy != nil:
+		return m.Policy.Metadata.Name
+	}
+	return ""
+}
+
+// LoadManifests reads the manifests of a YAML file
+func LoadManifests(path string) ([]Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	manifests, err := DecodeManifests(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return manifests, nil
+}
+
+// DecodeManifests decodes a multi-document YAML stream of manifests. Empty
+// documents are skipped; unknown fields, kinds and API versions are errors.
+func DecodeManifests(r io.Reader) ([]Manifest, error) {
+	dec := yaml.NewDecoder(r)
+	var manifests []Manifest
+	for doc := 1; ; doc++ {
+		var raw interface{}
+		err := dec.Decode(&raw)
+		if err == io.EOF {
+			return manifests, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %v", doc, err)
+		}
+		if raw == nil {
+			continue
+		}
+
+		m, err := decodeManifest(raw)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %v", doc, err)
+		}
+		manifests = append(manifests, m)
+	}
+}
+
+// decodeManifest strictly decodes one YAML document. The document is
+// converted to JSON so that the manifest types share the JSON field names
+// of the API types.
+func decodeManifest(raw interface{}) (Manifest, error) {
+	generic, err := jsonCompatible(raw)
+	if err != nil {
+		return Manifest{}, err
+	}
+	data, err := json.Marshal(generic)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	var header struct {
+		APIVersion string `json:"apiVersion"`
+		Kind       string `json:"kind"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return Manifest{}, fmt.Errorf("invalid manifest: %v", err)
+	}
+	if header.APIVersion != ManifestAPIVersion {
+		return Manifest{}, fmt.Errorf("unsupported apiVersion %q (want %q)", header.APIVersion, ManifestAPIVersion)
+	}
+
+	m := Manifest{Kind: header.Kind}
+	var target interface{}
+	var meta *ObjectMeta
+	switch header.Kind {
+	case KindDeployment:
+		m.Deployment = &DeploymentManifest{}
+		target, meta = m.Deployment, &m.Deployment.Metadata
+	case KindContainer:
+		m.Container = &ContainerManifest{}
+		target, meta = m.Container, &m.Container.Metadata
+	case KindResourceQuota:
+		m.ResourceQuota = &ResourceQuotaManifest{}
+		target, meta = m.ResourceQuota, &m.ResourceQuota.Metadata
+	case KindPolicy:
+		m.Policy = &Policy{}
+		target, meta = m.Policy, &m.Policy.Metadata
+	default:
+		return Manifest{}, fmt.Errorf("unsupported kind %q", header.Kind)
+	}
+
+	jsonDec := json.NewDecoder(bytes.NewReader(data))
+	jsonDec.DisallowUnknownFields()
+	if err := jsonDec.Decode(target); err != nil {
+		return Manifest{}, fmt.Errorf("invalid %s manifest: %v", header.Kind, err)
+	}
+	if meta.Name == "" {
+		return Manifest{}, fmt.Errorf("%s manifest has no metadata.name", header.Kind)
+	}
+	if header.Kind != KindContainer && len(meta.Labels) > 0 {
+		return Manifest{}, fmt.Errorf("%s %s: metadata.labels is only supported for containers", header.Kind, meta.Name)
+	}
+	if m.Policy != nil {
+		if err := m.Policy.validate(); err != nil {
+			return Manifest{}, fmt.Errorf("%s %s: %v", header.Kind, meta.Name, err)
+		}
+	}
+	return m, nil
+}
+
+// jsonCompatible converts the map[interface{}]interface{} values decoded by
+// yaml.v2 to map[string]interface{}
+func jsonCompatible(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("non-string key %v", k)
+			}
+			converted, err := jsonCompatible(e)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = converted
+		}
+		return m, nil
+	case []interface{}:
+		for i, e := range v {
+			converted, err := jsonCompatible(e)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = converted
+		}
+	}
+	return v, nil
+}
+
+// EncodeManifests writes manifests as a multi-document YAML stream, with
+// fields in the order of the manifest types
+func EncodeManifests(w io.Writer, manifests ...interface{}) error {
+	for i, m := range manifests {
+		if i > 0 {
+			if _, err := io.WriteString(w, "---\n"); err != nil {
+				return err
+			}
+		}
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		var ordered yaml.MapSlice
+		if err := yaml.Unmarshal(data, &ordered); err != nil {
+			return err
+		}
+		out, err := yaml.Marshal(ordered)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deployment converts the manifest to the API type
+func (m *DeploymentManifest) Deployment() *Deployment {
+	d := &Deployment{
+		Name:        m.Metadata.Name,
+		Description: m.Metadata.Description,
+		Environment: m.Metadata.Environment,
+		Version:     m.Spec.Version,
+		Replicas:    m.Spec.Replicas,
+		Containers:  m.Spec.Containers,
+		Services:    m.Spec.Services,
+	}
+	if m.Spec.Strategy != nil {
+		d.Strategy = *m.Spec.Strategy
+	}
+	return d
+}
+
+// NewDeploymentManifest converts a deployment to a manifest, dropping the
+// fields managed by the server
+func NewDeploymentManifest(d *Deployment) *DeploymentManifest {
+	m := &DeploymentManifest{
+		APIVersion: ManifestAPIVersion,
+		Kind:       KindDeployment,
+		Metadata:   ObjectMeta{Name: d.Name, Environment: d.Environment, Description: d.Description},
+		Spec: DeploymentSpec{
+			Version:    d.Version,
+			Replicas:   d.Replicas,
+			Containers: d.Containers,
+		},
+	}
+	if d.Strategy != (DeploymentStrategy{}) {
+		strategy := d.Strategy
+		m.Spec.Strategy = &strategy
+	}
+	for _, svc := range d.Services {
+		svc.ExternalEndpoints = nil
+		m.Spec.Services = append(m.Spec.Services, svc)
+	}
+	return m
+}
+
+// CreateOptions converts the manifest to a container create request
+func (m *ContainerManifest) CreateOptions() ContainerCreateOptions {
+	opts := ContainerCreateOptions{
+		Name:                 m.Metadata.Name,
+		Image:                m.Spec.Image,
+		Labels:               m.Metadata.Labels,
+		Ports:                m.Spec.Ports,
+		Volumes:              m.Spec.Volumes,
+		Network:              m.Spec.Network,
+		ResourceLimits:       m.Spec.ResourceLimits,
+		EnvironmentVariables: m.Spec.EnvironmentVariables,
+		RestartPolicy:        m.Spec.RestartPolicy,
+	}
+	if probe := m.Spec.HealthCheck; probe != nil {
+		opts.HealthCheck = &ContainerHealth{Endpoint: probe.Endpoint, Interval: probe.Interval, Timeout: probe.Timeout, Retries: probe.Retries, Command: probe.Command}
+	}
+	return opts
+}
+
+// NewContainerManifest converts a container to a manifest, dropping its
+// status and usage
+func NewContainerManifest(c *Container) *ContainerManifest {
+	m := &ContainerManifest{
+		APIVersion: ManifestAPIVersion,
+		Kind:       KindContainer,
+		Metadata:   ObjectMeta{Name: c.Name, Labels: c.Labels},
+		Spec: ContainerSpec{
+			Image:                c.Image,
+			Ports:                c.Ports,
+			Volumes:              c.Volumes,
+			Network:              c.Network.Name,
+			EnvironmentVariables: c.EnvironmentVariables,
+		},
+	}
+	if c.ResourceLimits != (ContainerLimits{}) {
+		limits := c.ResourceLimits
+		m.Spec.ResourceLimits = &limits
+	}
+	if h := c.HealthCheck; h != nil {
+		m.Spec.HealthCheck = &ContainerProbe{Endpoint: h.Endpoint, Interval: h.Interval, Timeout: h.Timeout, Retries: h.Retries, Command: h.Command}
+	}
+	return m
+}
+
+// Quotas converts the manifest to the quotas of its namespace, sorted by
+// resource type
+func (m *ResourceQuotaManifest) Quotas() *NamespaceQuotas {
+	types := make([]string, 0, len(m.Spec.Limits))
+	for t := range m.Spec.Limits {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	q := &NamespaceQuotas{Namespace: m.Metadata.Name, Quotas: make([]ResourceQuota, 0, len(types))}
+	for _, t := range types {
+		q.Quotas = append(q.Quotas, ResourceQuota{ResourceType: t, Limit: m.Spec.Limits[t]})
+	}
+	return q
+}
+
+// NewResourceQuotaManifest converts the quotas of a namespace to a manifest
+func NewResourceQuotaManifest(q *NamespaceQuotas) *ResourceQuotaManifest {
+	m := &ResourceQuotaManifest{
+		APIVersion: ManifestAPIVersion,
+		Kind:       KindResourceQuota,
+		Metadata:   ObjectMeta{Name: q.Namespace},
+		Spec:       ResourceQuotaSpec{Limits: make(map[string]float64, len(q.Quotas))},
+	}
+	for _, quota := range q.Quotas {
+		m.Spec.Limits[quota.ResourceType] = quota.Limit
+	}
+	return m
+}
@@ -0,0 +1,434 @@
+package tianniu
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"gopkg.in/yaml.v2"
+)
+
+// MySQLConfig represents the MySQL configuration
+type MySQLConfig struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name    string `yaml:"name"`
+		Version string `yaml:"version"`
+	} `yaml:"metadata"`
+	Environments []MySQLEnvironment `yaml:"environments"`
+	Defaults     struct {
+		Charset   string `yaml:"charset"`
+		Collation string `yaml:"collation"`
+		Timezone  string `yaml:"timezone"`
+	} `yaml:"defaults"`
+	Tables []struct {
+		Name    string `yaml:"name"`
+		Columns []struct {
+			Name       string `yaml:"name"`
+			Type       string `yaml:"type"`
+			PrimaryKey bool   `yaml:"primary_key,omitempty"`
+			Nullable   bool   `yaml:"nullable"`
+			Default    string `yaml:"default,omitempty"`
+			Index      bool   `yaml:"index,omitempty"`
+			Unique     bool   `yaml:"unique,omitempty"`
+			OnUpdate   string `yaml:"on_update,omitempty"`
+			ForeignKey struct {
+				Table    string `yaml:"table"`
+				Column   string `yaml:"column"`
+				OnDelete string `yaml:"on_delete"`
+			} `yaml:"foreign_key,omitempty"`
+		} `yaml:"columns"`
+	} `yaml:"tables"`
+}
+
+// MySQLEnvironment is one entry of the environments list in the MySQL
+// configuration. Credentials are secret references such as
+// file:///run/secrets/db-pass; username_env and password_env are the legacy
+// form and name an environment variable.
+type MySQLEnvironment struct {
+	Name              string `yaml:"name"`
+	Host              string `yaml:"host"`
+	Port              int    `yaml:"port"`
+	Database          string `yaml:"database"`
+	Username          string `yaml:"username,omitempty"`
+	Password          string `yaml:"password,omitempty"`
+	UsernameEnv       string `yaml:"username_env,omitempty"`
+	PasswordEnv       string `yaml:"password_env,omitempty"`
+	MaxConnections    int    `yaml:"max_connections"`
+	ConnectionTimeout string `yaml:"connection_timeout"`
+	ReadTimeout       string `yaml:"read_timeout"`
+	WriteTimeout      string `yaml:"write_timeout"`
+	MaxIdleConns      int    `yaml:"max_idle_connections"`
+	MaxOpenConns      int    `yaml:"max_open_connections"`
+	ConnMaxLifetime   string `yaml:"connection_max_lifetime"`
+	SSLMode           string `yaml:"ssl_mode"`
+	SSLCA             string `yaml:"ssl_ca,omitempty"`
+	SSLCert           string `yaml:"ssl_cert,omitempty"`
+	SSLKey            string `yaml:"ssl_key,omitempty"`
+}
+
+// LoadMySQLConfig loads the MySQL configuration from a YAML file
+func LoadMySQLConfig(configPath string) (*MySQLConfig, error) {
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var config MySQLConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// ConfigErrors lists every problem found while validating a configuration
+type ConfigErrors []string
+
+func (e ConfigErrors) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e, "\n  - ")
+}
+
+// Environment returns the environment with the given name, or nil
+func (c *MySQLConfig) Environment(name string) *MySQLEnvironment {
+	for i := range c.Environments {
+		if c.Environments[i].Name == name {
+			return &c.Environments[i]
+		}
+	}
+	return nil
+}
+
+// Validate checks every environment and the defaults. When env is not empty
+// it also checks that env exists and that its credentials are available. All
+// problems are returned together as ConfigErrors.
+func (c *MySQLConfig) Validate(env string) error {
+	var problems ConfigErrors
+
+	if c.Defaults.Charset == "" {
+		problems = append(problems, "defaults.charset is required")
+	}
+	if c.Defaults.Timezone != "" {
+		if _, err := time.LoadLocation(c.Defaults.Timezone); err != nil {
+			problems = append(problems, fmt.Sprintf("defaults.timezone %q: %v", c.Defaults.Timezone, err))
+		}
+	}
+
+	seen := map[string]bool{}
+	for i := range c.Environments {
+		e := &c.Environments[i]
+		prefix := fmt.Sprintf("environments[%d]", i)
+		if e.Name == "" {
+			problems = append(problems, prefix+": name is required")
+		} else {
+			prefix = fmt.Sprintf("environment %s", e.Name)
+			if seen[e.Name] {
+				problems = append(problems, prefix+": defined more than once")
+			}
+			seen[e.Name] = true
+		}
+		problems = append(problems, validateEnvironment(prefix, e)...)
+	}
+
+	if env != "" {
+		e := c.Environment(env)
+		if e == nil {
+			names := make([]string, 0, len(c.Environments))
+			for _, e := range c.Environments {
+				names = append(names, e.Name)
+			}
+			problems = append(problems, fmt.Sprintf("environment %s not found in configuration (available: %s)", env, strings.Join(names, ", ")))
+		} else {
+			for _, v := range []struct{ field, ref string }{
+				{"username", credentialRef(e.Username, e.UsernameEnv)},
+				{"password", credentialRef(e.Password, e.PasswordEnv)},
+			} {
+				u, err := ParseSecretRef(v.ref)
+				if err != nil || u.Scheme != "env" {
+					continue
+				}
+				name := u.Opaque
+				if name == "" {
+					name = u.Host + u.Path
+				}
+				if name != "" && os.Getenv(name) == "" {
+					problems = append(problems, fmt.Sprintf("environment %s: %s variable %s is not set", env, v.field, name))
+				}
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// validateEnvironment checks one environment entry without looking at the
+// process environment
+func validateEnvironment(prefix string, e *MySQLEnvironment) ConfigErrors {
+	var problems ConfigErrors
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, prefix+": "+fmt.Sprintf(format, args...))
+	}
+
+	if e.Host == "" {
+		add("host is required")
+	}
+	if e.Port < 1 || e.Port > 65535 {
+		add("port %d is out of range", e.Port)
+	}
+	if e.Database == "" {
+		add("database is required")
+	}
+	for _, c := range []struct{ field, ref, legacy string }{
+		{"username", e.Username, e.UsernameEnv},
+		{"password", e.Password, e.PasswordEnv},
+	} {
+		switch {
+		case c.ref != "" && c.legacy != "":
+			add("%s and %s_env are mutually exclusive", c.field, c.field)
+		case c.ref == "" && c.legacy == "":
+			add("%s (secret reference) or %s_env is required", c.field, c.field)
+		case c.ref != "":
+			if _, err := ParseSecretRef(c.ref); err != nil {
+				add("%s: %v", c.field, err)
+			}
+		}
+	}
+
+	for _, d := range []struct{ field, value string }{
+		{"connection_timeout", e.ConnectionTimeout},
+		{"read_timeout", e.ReadTimeout},
+		{"write_timeout", e.WriteTimeout},
+		{"connection_max_lifetime", e.ConnMaxLifetime},
+	} {
+		if _, err := parseOptionalDuration(d.value); err != nil {
+			add("%s: %v", d.field, err)
+		}
+	}
+
+	if e.MaxConnections < 0 {
+		add("max_connections must not be negative")
+	}
+	if e.MaxOpenConns < 0 {
+		add("max_open_connections must not be negative")
+	}
+	if e.MaxIdleConns < 0 {
+		add("max_idle_connections must not be negative")
+	}
+	if e.MaxConnections > 0 && e.MaxOpenConns > e.MaxConnections {
+		add("max_open_connections (%d) exceeds max_connections (%d)", e.MaxOpenConns, e.MaxConnections)
+	}
+	maxOpen := e.MaxOpenConns
+	if maxOpen == 0 {
+		maxOpen = e.MaxConnections
+	}
+	if maxOpen > 0 && e.MaxIdleConns > maxOpen {
+		add("max_idle_connections (%d) exceeds the open connection limit (%d)", e.MaxIdleConns, maxOpen)
+	}
+
+	switch e.SSLMode {
+	case "", "disable", "prefer", "require":
+	case "verify-ca", "verify-full":
+		if e.SSLCA == "" {
+			add("ssl_mode %s requires ssl_ca", e.SSLMode)
+		}
+	default:
+		add("unsupported ssl_mode %q", e.SSLMode)
+	}
+	if (e.SSLCert == "") != (e.SSLKey == "") {
+		add("ssl_cert and ssl_key must be set together")
+	}
+	if (e.SSLMode == "" || e.SSLMode == "disable") && (e.SSLCA != "" || e.SSLCert != "") {
+		add("ssl_ca/ssl_cert are set but ssl_mode disables TLS")
+	}
+
+	return problems
+}
+
+// credentialRef returns the secret reference for a credential, translating
+// the legacy *_env variable name into an env: reference
+func credentialRef(ref, envName string) string {
+	if ref == "" && envName != "" {
+		return "env:" + envName
+	}
+	return ref
+}
+
+// parseOptionalDuration parses a duration field, treating an empty value as
+// unset
+func parseOptionalDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("duration %s must not be negative", value)
+	}
+	return d, nil
+}
+
+// FormatDSN builds the driver DSN for a validated environment with the
+// resolved credentials and the name of a registered TLS config, "" for none.
+// Every field is applied and escaped by the driver's own formatter.
+func (c *MySQLConfig) FormatDSN(envConfig *MySQLEnvironment, username, password, tlsName string) (string, error) {
+	dsnConfig := mysql.NewConfig()
+	dsnConfig.User = username
+	dsnConfig.Passwd = password
+	dsnConfig.Net = "tcp"
+	dsnConfig.Addr = net.JoinHostPort(envConfig.Host, strconv.Itoa(envConfig.Port))
+	dsnConfig.DBName = envConfig.Database
+	dsnConfig.ParseTime = true
+	dsnConfig.Collation = c.Defaults.Collation
+	if c.Defaults.Charset != "" {
+		dsnConfig.Params = map[string]string{"charset": c.Defaults.Charset}
+	}
+
+	if c.Defaults.Timezone != "" {
+		loc, err := time.LoadLocation(c.Defaults.Timezone)
+		if err != nil {
+			return "", fmt.Errorf("invalid timezone: %v", err)
+		}
+		dsnConfig.Loc = loc
+	}
+
+	var err error
+	if dsnConfig.Timeout, err = parseOptionalDuration(envConfig.ConnectionTimeout); err != nil {
+		return "", fmt.Errorf("invalid connection timeout: %v", err)
+	}
+	if dsnConfig.ReadTimeout, err = parseOptionalDuration(envConfig.ReadTimeout); err != nil {
+		return "", fmt.Errorf("invalid read timeout: %v", err)
+	}
+	if dsnConfig.WriteTimeout, err = parseOptionalDuration(envConfig.WriteTimeout); err != nil {
+		return "", fmt.Errorf("invalid write timeout: %v", err)
+	}
+
+	dsnConfig.TLSConfig = tlsName
+	dsnConfig.AllowFallbackToPlaintext = envConfig.SSLMode == "prefer"
+
+	return dsnConfig.FormatDSN(), nil
+}
+
+// registerTLSConfig registers a TLS configuration for the environment with the
+// MySQL driver and returns the value to use for the DSN tls parameter. An
+// empty name means the connection is not encrypted.
+//
+// The modes follow the libpq conventions:
+//   - disable: no TLS
+//   - prefer: TLS without verification, plaintext if the server has no TLS
+//   - require: TLS without certificate verification
+//   - verify-ca: TLS, server certificate must chain to ssl_ca
+//   - verify-full: as verify-ca, and the certificate must match host
+func registerTLSConfig(envConfig *MySQLEnvironment) (string, error) {
+	tlsConfig, err := envConfig.TLSConfig()
+	if err != nil || tlsConfig == nil {
+		return "", err
+	}
+
+	name := "tianniu-" + envConfig.Name
+	if err := mysql.RegisterTLSConfig(name, tlsConfig); err != nil {
+		return "", fmt.Errorf("failed to register TLS config: %v", err)
+	}
+	return name, nil
+}
+
+// TLSConfig builds the tls.Config for the environment's ssl_mode, loading
+// ssl_ca and the client certificate. It is nil when ssl_mode disables TLS.
+func (e *MySQLEnvironment) TLSConfig() (*tls.Config, error) {
+	switch e.SSLMode {
+	case "", "disable":
+		return nil, nil
+	case "prefer", "require", "verify-ca", "verify-full":
+	default:
+		return nil, fmt.Errorf("unsupported ssl_mode %q", e.SSLMode)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: e.Host,
+	}
+
+	if (e.SSLCert == "") != (e.SSLKey == "") {
+		return nil, fmt.Errorf("ssl_cert and ssl_key must be set together")
+	}
+	if e.SSLCert != "" {
+		cert, err := tls.LoadX509KeyPair(e.SSLCert, e.SSLKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	var roots *x509.CertPool
+	if e.SSLCA != "" {
+		pem, err := ioutil.ReadFile(e.SSLCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ssl_ca: %v", err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ssl_ca %s", e.SSLCA)
+		}
+	}
+
+	switch e.SSLMode {
+	case "prefer", "require":
+		// Encrypted but unauthenticated, as with libpq
+		tlsConfig.InsecureSkipVerify = true
+	case "verify-ca":
+		if roots == nil {
+			return nil, fmt.Errorf("ssl_mode verify-ca requires ssl_ca")
+		}
+		// Chain verification only; the host name is deliberately not checked
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyCertChain(rawCerts, roots)
+		}
+	case "verify-full":
+		if roots == nil {
+			return nil, fmt.Errorf("ssl_mode verify-full requires ssl_ca")
+		}
+		tlsConfig.RootCAs = roots
+	}
+
+	return tlsConfig, nil
+}
+
+// verifyCertChain checks that the peer certificate chains to one of roots
+func verifyCertChain(rawCerts [][]byte, roots *x509.CertPool) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("server presented no certificate")
+	}
+
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("failed to parse server certificate: %v", err)
+		}
+		certs[i] = cert
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	return err
+}
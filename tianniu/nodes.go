@@ -0,0 +1,305 @@
+package tianniu
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Node is a node of the cluster. The list endpoint omits SystemInfo, Taints
+// and Pods.
+type Node struct {
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Status     string            `json:"status"`
+	Role       string            `json:"role,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+	IPAddress  string            `json:"ip_address,omitempty"`
+	Resources  NodeResources     `json:"resources"`
+	Conditions []NodeCondition   `json:"conditions,omitempty"`
+	SystemInfo *NodeSystemInfo   `json:"system_info,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Taints     []NodeTaint       `json:"taints,omitempty"`
+	Pods       []NodePod         `json:"pods,omitempty"`
+	Message    string            `json:"message,omitempty"`
+}
+
+// Region returns the region label of the node, e.g. beijing
+func (n *Node) Region() string {
+	return n.Labels["region"]
+}
+
+// Zone returns the zone label of the node, e.g. zone-a
+func (n *Node) Zone() string {
+	return n.Labels["zone"]
+}
+
+// InstanceType returns the instance-type label of the node, e.g.
+// high-memory
+func (n *Node) InstanceType() string {
+	return n.Labels["instance-type"]
+}
+
+// Condition returns the condition of type conditionType, e.g. Ready, or nil
+// if the node does not report it
+func (n *Node) Condition(conditionType string) *NodeCondition {
+	for i := range n.Conditions {
+		if n.Conditions[i].Type == conditionType {
+			return &n.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// NodeResources are the CPU, memory and pod capacity of a node
+type NodeResources struct {
+	CPU    NodeResource `json:"cpu"`
+	Memory NodeResource `json:"memory"`
+	Pods   NodeResource `json:"pods"`
+}
+
+// NodeResource is the capacity of one resource of a node, in Unit: cores
+// for CPU, GB for memory and a count for pods
+type NodeResource struct {
+	Capacity    float64 `json:"capacity"`
+	Allocatable float64 `json:"allocatable"`
+	Allocated   float64 `json:"allocated"`
+	Available   float64 `json:"available"`
+	Unit        string  `json:"unit,omitempty"`
+}
+
+// AllocatedPercent is the share of the allocatable amount in use
+func (r NodeResource) AllocatedPercent() float64 {
+	if r.Allocatable <= 0 {
+		return 0
+	}
+	return r.Allocated / r.Allocatable * 100
+}
+
+// NodeCondition is a condition of a node, such as Ready or DiskPressure
+type NodeCondition struct {
+	Type               string    `json:"type"`
+	Status             string    `json:"status"`
+	LastTransitionTime time.Time `json:"last_transition_time"`
+	Reason             string    `json:"reason,omitempty"`
+	Message            string    `json:"message,omitempty"`
+}
+
+// NodeSystemInfo describes the software of a node
+type NodeSystemInfo struct {
+	KernelVersion           string `json:"kernel_version,omitempty"`
+	OSImage                 string `json:"os_image,omitempty"`
+	ContainerRuntimeVersion string `json:"container_runtime_version,omitempty"`
+	KubeletVersion          string `json:"kubelet_version,omitempty"`
+	Architecture            string `json:"architecture,omitempty"`
+}
+
+// NodeTaint keeps pods that do not tolerate it off a node
+type NodeTaint struct {
+	Key    string `json:"key"`
+	Value  string `json:"value,omitempty"`
+	Effect string `json:"effect"`
+}
+
+// NodePod is a pod running on a node
+type NodePod struct {
+	Name          string   `json:"name"`
+	Namespace     string   `json:"namespace"`
+	Status        string   `json:"status,omitempty"`
+	CPURequest    Quantity `json:"cpu_request,omitzero"`
+	CPULimit      Quantity `json:"cpu_limit,omitzero"`
+	MemoryRequest Quantity `json:"memory_request,omitzero"`
+	MemoryLimit   Quantity `json:"memory_limit,omitzero"`
+}
+
+// NodeList represents a list of nodes
+type NodeList struct {
+	Total  int    `json:"total"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+	Nodes  []Node `json:"nodes"`
+}
+
+// NodeListOptions narrows a node list. Zero-valued fields are not sent.
+type NodeListOptions struct {
+	Status string
+	Role   string
+	Limit  int
+	Offset int
+}
+
+// DrainOptions controls how a node is drained
+type DrainOptions struct {
+	// GracePeriod is the time the pods are given to terminate. Zero uses
+	// the server default of 30 seconds.
+	GracePeriod time.Duration
+
+	// Force evicts pods that would otherwise block the drain
+	Force bool
+
+	// Timeout bounds the wait for the pods to be evicted. Zero means 10
+	// minutes.
+	Timeout time.Duration
+
+	// PollInterval is the time between checks of the pods left on the
+	// node. Zero means 2 seconds.
+	PollInterval time.Duration
+
+	// Progress, if set, is called whenever pods have been evicted
+	Progress func(DrainProgress)
+}
+
+// DrainProgress reports the pods evicted since the last report and those
+// still on the node
+type DrainProgress struct {
+	Evicted   []NodePod
+	Remaining []NodePod
+}
+
+// DrainResult is the outcome of a drain: the node as last seen, all the pods
+// evicted from it and those the server left in place, such as DaemonSet and
+// static pods
+type DrainResult struct {
+	Node      *Node     `json:"node"`
+	Evicted   []NodePod `json:"evicted"`
+	Remaining []NodePod `json:"remaining,omitempty"`
+}
+
+// NodesService talks to the /resources/nodes endpoints
+type NodesService struct {
+	client *Client
+}
+
+// List lists the nodes of the cluster
+func (s *NodesService) List(ctx context.Context, opts NodeListOptions) (*NodeList, error) {
+	query := url.Values{}
+	if opts.Status != "" {
+		query.Set("status", opts.Status)
+	}
+	if opts.Role != "" {
+		query.Set("role", opts.Role)
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Offset > 0 {
+		query.Set("offset", strconv.Itoa(opts.Offset))
+	}
+
+	var list NodeList
+	if err := s.client.call(ctx, "GET", "/resources/nodes", query, nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// Get gets a node by ID, with its conditions, system info and pods
+func (s *NodesService) Get(ctx context.Context, id string) (*Node, error) {
+	var node Node
+	if err := s.client.call(ctx, "GET", nodePath(id), nil, nil, &node); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// Cordon marks a node unschedulable; its pods keep running
+func (s *NodesService) Cordon(ctx context.Context, id string) (*Node, error) {
+	return s.action(ctx, id, "cordon", nil)
+}
+
+// Uncordon marks a cordoned node schedulable again
+func (s *NodesService) Uncordon(ctx context.Context, id string) (*Node, error) {
+	return s.action(ctx, id, "uncordon", nil)
+}
+
+// Drain evicts the pods of a node and waits until none is left or the node
+// is no longer draining, reporting the evicted pods to opts.Progress. The
+// server finishes a drain without evicting pods such as DaemonSet and static
+// pods; they are returned as Remaining. When the wait times out the result
+// so far is returned with the error.
+func (s *NodesService) Drain(ctx context.Context, id string, opts DrainOptions) (*DrainResult, error) {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+
+	node, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	if opts.GracePeriod > 0 {
+		query.Set("grace_period", strconv.Itoa(timeoutSeconds(opts.GracePeriod)))
+	}
+	if opts.Force {
+		query.Set("force", "true")
+	}
+	started, err := s.action(ctx, id, "drain", query)
+	if err != nil {
+		return nil, err
+	}
+	node.Status, node.Message = started.Status, started.Message
+
+	result := &DrainResult{Node: node}
+	remaining := node.Pods
+	for len(remaining) > 0 {
+		select {
+		case <-ctx.Done():
+			return result, fmt.Errorf("node %s still has %d pods: %v", id, len(remaining), ctx.Err())
+		case <-time.After(interval):
+		}
+		current, err := s.Get(ctx, id)
+		if err != nil {
+			if ctx.Err() != nil {
+				return result, fmt.Errorf("node %s still has %d pods: %v", id, len(remaining), ctx.Err())
+			}
+			return result, err
+		}
+		result.Node = current
+
+		left := make(map[string]bool, len(current.Pods))
+		for _, pod := range current.Pods {
+			left[pod.Namespace+"/"+pod.Name] = true
+		}
+		var evicted []NodePod
+		for _, pod := range remaining {
+			if !left[pod.Namespace+"/"+pod.Name] {
+				evicted = append(evicted, pod)
+			}
+		}
+		remaining = current.Pods
+		if len(evicted) > 0 {
+			result.Evicted = append(result.Evicted, evicted...)
+			if opts.Progress != nil {
+				opts.Progress(DrainProgress{Evicted: evicted, Remaining: remaining})
+			}
+		}
+		if current.Status != "draining" {
+			break
+		}
+	}
+	result.Remaining = remaining
+	return result, nil
+}
+
+// action posts a node operation and returns the node's new status
+func (s *NodesService) action(ctx context.Context, id, name string, query url.Values) (*Node, error) {
+	var node Node
+	if err := s.client.call(ctx, "POST", nodePath(id)+"/"+name, query, nil, &node); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+func nodePath(id string) string {
+	return "/resources/nodes/" + url.PathEscape(id)
+}
@@ -0,0 +1,509 @@
+package tianniu
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// PolicyAction is what a matching rule does to a spec
+type PolicyAction string
+
+const (
+	// PolicyDeny rejects the spec
+	PolicyDeny PolicyAction = "deny"
+	// PolicyWarn lets the spec through with a warning
+	PolicyWarn PolicyAction = "warn"
+)
+
+// Policy is a set of admission rules for deployment and container specs,
+// written as a manifest:
+//
+//	apiVersion: v1
+//	kind: Policy
+//	metadata:
+//	  name: production-guardrails
+//	spec:
+//	  rules:
+//	  - name: pinned-images
+//	    environments: [production]
+//	    images:
+//	      allowed_registries: [registry.baidu.com]
+//	      disallowed_tags: [latest]
+//	  - name: no-debug-logging
+//	    action: warn
+//	    env:
+//	      forbidden:
+//	        LOG_LEVEL: [debug]
+type Policy struct {
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Metadata   ObjectMeta `json:"metadata"`
+	Spec       PolicySpec `json:"spec"`
+}
+
+// PolicySpec lists the rules of a policy
+type PolicySpec struct {
+	Rules []PolicyRule `json:"rules"`
+}
+
+// PolicyRule is one guardrail. A rule applies to the listed environments and
+// kinds, or to all of them when the lists are empty, and reports every
+// field that breaks one of its checks.
+type PolicyRule struct {
+	Name         string       `json:"name"`
+	Description  string       `json:"description,omitempty"`
+	Action       PolicyAction `json:"action,omitempty"`
+	Message      string       `json:"message,omitempty"`
+	Environments []string     `json:"environments,omitempty"`
+	Kinds        []string     `json:"kinds,omitempty"`
+
+	Images    *ImagePolicy    `json:"images,omitempty"`
+	Resources *ResourcePolicy `json:"resources,omitempty"`
+	Env       *EnvPolicy      `json:"env,omitempty"`
+	Replicas  *ReplicaPolicy  `json:"replicas,omitempty"`
+	Labels    *LabelPolicy    `json:"labels,omitempty"`
+}
+
+// ImagePolicy restricts container images. AllowedRegistries are prefixes
+// such as "registry.baidu.com" or "registry.baidu.com/infra"; an image
+// without a tag counts as "latest".
+type ImagePolicy struct {
+	AllowedRegistries []string `json:"allowed_registries,omitempty"`
+	DisallowedTags    []string `json:"disallowed_tags,omitempty"`
+	RequireTag        bool     `json:"require_tag,omitempty"`
+}
+
+// ResourcePolicy requires CPU and memory limits and requests and caps them.
+// Container specs have no requests, so RequireRequests only applies to
+// deployments.
+type ResourcePolicy struct {
+	RequireLimits   bool     `json:"require_limits,omitempty"`
+	RequireRequests bool     `json:"require_requests,omitempty"`
+	MaxCPU          Quantity `json:"max_cpu,omitzero"`
+	MaxMemory       Quantity `json:"max_memory,omitzero"`
+}
+
+// EnvPolicy restricts environment variables. Forbidden maps a variable to
+// its forbidden values; an empty list forbids the variable altogether.
+type EnvPolicy struct {
+	Forbidden map[string][]string `json:"forbidden,omitempty"`
+	Required  []string            `json:"required,omitempty"`
+}
+
+// ReplicaPolicy bounds the replicas of a deployment. A zero Max is no bound.
+type ReplicaPolicy struct {
+	Min int `json:"min,omitempty"`
+	Max int `json:"max,omitempty"`
+}
+
+// LabelPolicy requires container labels
+type LabelPolicy struct {
+	Required []string `json:"required,omitempty"`
+}
+
+// PolicyResult is one violation of a rule
+type PolicyResult struct {
+	Policy  string       `json:"policy"`
+	Rule    string       `json:"rule"`
+	Action  PolicyAction `json:"action"`
+	Field   string       `json:"field"`
+	Message string       `json:"message"`
+}
+
+func (r PolicyResult) String() string {
+	return r.Rule + ": " + r.Field + ": " + r.Message
+}
+
+// PolicyResults are the violations found in one spec
+type PolicyResults []PolicyResult
+
+// Denials returns the results of deny rules
+func (r PolicyResults) Denials() PolicyResults {
+	return r.filter(PolicyDeny)
+}
+
+// Warnings returns the results of warn rules
+func (r PolicyResults) Warnings() PolicyResults {
+	return r.filter(PolicyWarn)
+}
+
+func (r PolicyResults) filter(action PolicyAction) PolicyResults {
+	var matched PolicyResults
+	for _, result := range r {
+		if result.Action == action {
+			matched = append(matched, result)
+		}
+	}
+	return matched
+}
+
+// Err returns a *PolicyError when a deny rule matched, and nil otherwise
+func (r PolicyResults) Err() error {
+	if denials := r.Denials(); len(denials) > 0 {
+		return &PolicyError{Denials: denials}
+	}
+	return nil
+}
+
+// PolicyError rejects a spec that breaks deny rules
+type PolicyError struct {
+	Denials PolicyResults
+}
+
+func (e *PolicyError) Error() string {
+	problems := make([]string, len(e.Denials))
+	for i, r := range e.Denials {
+		problems[i] = r.String()
+	}
+	return "denied by policy:\n  - " + strings.Join(problems, "\n  - ")
+}
+
+// Policies are the policies enforced together
+type Policies []*Policy
+
+// LoadPolicies reads the Policy manifests of a YAML file
+func LoadPolicies(path string) (Policies, error) {
+	manifests, err := LoadManifests(path)
+	if err != nil {
+		return nil, err
+	}
+	policies := make(Policies, 0, len(manifests))
+	for _, m := range manifests {
+		if m.Policy == nil {
+			return nil, fmt.Errorf("%s: %s %s is not a Policy", path, m.Kind, m.Name())
+		}
+		policies = append(policies, m.Policy)
+	}
+	return policies, nil
+}
+
+// CheckDeployment evaluates the rules that apply to the environment of a
+// deployment
+func (p Policies) CheckDeployment(d *Deployment) PolicyResults {
+	var results PolicyResults
+	for _, policy := range p {
+		for i := range policy.Spec.Rules {
+			rule := &policy.Spec.Rules[i]
+			if !rule.appliesTo(KindDeployment, d.Environment) {
+				continue
+			}
+			c := &ruleChecker{policy: policy.Metadata.Name, rule: rule}
+			c.checkDeployment(d)
+			results = append(results, c.results...)
+		}
+	}
+	return results
+}
+
+// CheckScale evaluates the replicas rules that apply to the deployments of
+// environment for a deployment scaled to replicas. Scaling changes nothing
+// else, so the other rules are not evaluated.
+func (p Policies) CheckScale(environment string, replicas int) PolicyResults {
+	var results PolicyResults
+	for _, policy := range p {
+		for i := range policy.Spec.Rules {
+			rule := &policy.Spec.Rules[i]
+			if rule.Replicas == nil || !rule.appliesTo(KindDeployment, environment) {
+				continue
+			}
+			c := &ruleChecker{policy: policy.Metadata.Name, rule: rule}
+			c.checkReplicas(replicas)
+			results = append(results, c.results...)
+		}
+	}
+	return results
+}
+
+// CheckContainer evaluates the rules that apply to a container created in
+// environment
+func (p Policies) CheckContainer(environment string, opts *ContainerCreateOptions) PolicyResults {
+	var results PolicyResults
+	for _, policy := range p {
+		for i := range policy.Spec.Rules {
+			rule := &policy.Spec.Rules[i]
+			if !rule.appliesTo(KindContainer, environment) {
+				continue
+			}
+			c := &ruleChecker{policy: policy.Metadata.Name, rule: rule}
+			c.checkContainer(opts)
+			results = append(results, c.results...)
+		}
+	}
+	return results
+}
+
+// Middleware returns a handler that checks the bodies of deployment create,
+// update and scale requests and of container create requests before passing
+// them to next. Denied requests get a 403 response in the API error format
+// with code POLICY_DENIED; warnings are sent as Warning headers. Containers
+// and scale requests name no environment, so they are checked as part of
+// environment.
+func (p Policies) Middleware(environment string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		last := segments[len(segments)-1]
+		parent := ""
+		if len(segments) > 1 {
+			parent = segments[len(segments)-2]
+		}
+
+		var check func([]byte) (PolicyResults, error)
+		switch {
+		case (r.Method == http.MethodPost && last == "deployments") || (r.Method == http.MethodPut && parent == "deployments"):
+			check = func(body []byte) (PolicyResults, error) {
+				var d Deployment
+				if err := json.Unmarshal(body, &d); err != nil {
+					return nil, err
+				}
+				return p.CheckDeployment(&d), nil
+			}
+		case r.Method == http.MethodPost && last == "scale" && len(segments) > 2 && segments[len(segments)-3] == "deployments":
+			check = func(body []byte) (PolicyResults, error) {
+				var scale struct {
+					Replicas int `json:"replicas"`
+				}
+				if err := json.Unmarshal(body, &scale); err != nil {
+					return nil, err
+				}
+				return p.CheckScale(environment, scale.Replicas), nil
+			}
+		case r.Method == http.MethodPost && last == "containers":
+			check = func(body []byte) (PolicyResults, error) {
+				var opts ContainerCreateOptions
+				if err := json.Unmarshal(body, &opts); err != nil {
+					return nil, err
+				}
+				return p.CheckContainer(environment, &opts), nil
+			}
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		// Malformed bodies are left for the API to reject
+		results, err := check(body)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, warning := range results.Warnings() {
+			w.Header().Add("Warning", fmt.Sprintf("299 - %q", warning.String()))
+		}
+		if err := results.Err(); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]*APIError{
+				"error": {Code: "POLICY_DENIED", Message: err.Error(), Details: results.Denials()},
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validate checks a decoded policy
+func (p *Policy) validate() error {
+	v := &validator{}
+	names := map[string]bool{}
+	for i, rule := range p.Spec.Rules {
+		path := fmt.Sprintf("spec.rules[%d]", i)
+		if rule.Name == "" {
+			v.add(path+".name", "is required")
+		} else if names[rule.Name] {
+			v.add(path+".name", "duplicate rule name %q", rule.Name)
+		}
+		names[rule.Name] = true
+		switch rule.Action {
+		case "", PolicyDeny, PolicyWarn:
+		default:
+			v.add(path+".action", "unsupported action %q (use %s or %s)", rule.Action, PolicyDeny, PolicyWarn)
+		}
+		for j, kind := range rule.Kinds {
+			if kind != KindDeployment && kind != KindContainer {
+				v.add(fmt.Sprintf("%s.kinds[%d]", path, j), "unsupported kind %q (use %s or %s)", kind, KindDeployment, KindContainer)
+			}
+		}
+		if rule.Images == nil && rule.Resources == nil && rule.Env == nil && rule.Replicas == nil && rule.Labels == nil {
+			v.add(path, "has no checks (images, resources, env, replicas or labels)")
+		}
+		if r := rule.Replicas; r != nil && (r.Min < 0 || r.Max < 0 || (r.Max > 0 && r.Min > r.Max)) {
+			v.add(path+".replicas", "min %d and max %d are not a valid range", r.Min, r.Max)
+		}
+		if r := rule.Resources; r != nil && (r.MaxCPU.MilliValue() < 0 || r.MaxMemory.MilliValue() < 0) {
+			v.add(path+".resources", "maximums must not be negative")
+		}
+	}
+	return v.err()
+}
+
+func (r *PolicyRule) appliesTo(kind, environment string) bool {
+	return (len(r.Kinds) == 0 || containsString(r.Kinds, kind)) &&
+		(len(r.Environments) == 0 || containsString(r.Environments, environment))
+}
+
+// ruleChecker collects the violations of one rule
+type ruleChecker struct {
+	policy  string
+	rule    *PolicyRule
+	results PolicyResults
+}
+
+func (c *ruleChecker) checkReplicas(replicas int) {
+	r := c.rule.Replicas
+	if r == nil {
+		return
+	}
+	if replicas < r.Min {
+		c.add("replicas", "%d is fewer than the minimum of %d", replicas, r.Min)
+	}
+	if r.Max > 0 && replicas > r.Max {
+		c.add("replicas", "%d is more than the maximum of %d", replicas, r.Max)
+	}
+}
+
+func (c *ruleChecker) add(field, format string, args ...interface{}) {
+	action := c.rule.Action
+	if action == "" {
+		action = PolicyDeny
+	}
+	message := c.rule.Message
+	if message == "" {
+		message = fmt.Sprintf(format, args...)
+	}
+	c.results = append(c.results, PolicyResult{Policy: c.policy, Rule: c.rule.Name, Action: action, Field: field, Message: message})
+}
+
+func (c *ruleChecker) checkDeployment(d *Deployment) {
+	c.checkReplicas(d.Replicas)
+	for i := range d.Containers {
+		container := &d.Containers[i]
+		path := fmt.Sprintf("containers[%d]", i)
+		c.checkImage(path+".image", container.Image)
+		if r := c.rule.Resources; r != nil {
+			limits, requests := container.Resources.Limits, container.Resources.Requests
+			c.checkResources(path+".resources.limits", limits, r.RequireLimits)
+			c.checkResources(path+".resources.requests", requests, r.RequireRequests)
+		}
+		c.checkEnv(path+".environment_variables", container.EnvironmentVariables)
+	}
+}
+
+func (c *ruleChecker) checkContainer(opts *ContainerCreateOptions) {
+	c.checkImage("image", opts.Image)
+	if r := c.rule.Resources; r != nil {
+		var limits ResourceList
+		if opts.ResourceLimits != nil {
+			limits = ResourceList{CPU: opts.ResourceLimits.CPU, Memory: opts.ResourceLimits.Memory}
+		}
+		c.checkResources("resource_limits", limits, r.RequireLimits)
+	}
+	c.checkEnv("environment_variables", opts.EnvironmentVariables)
+	if l := c.rule.Labels; l != nil {
+		for _, key := range l.Required {
+			if _, ok := opts.Labels[key]; !ok {
+				c.add("labels", "label %q is required", key)
+			}
+		}
+	}
+}
+
+func (c *ruleChecker) checkImage(field, image string) {
+	p := c.rule.Images
+	if p == nil {
+		return
+	}
+	if len(p.AllowedRegistries) > 0 {
+		allowed := false
+		for _, registry := range p.AllowedRegistries {
+			if strings.HasPrefix(image, strings.TrimSuffix(registry, "/")+"/") {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			c.add(field, "image %q is not from an allowed registry (%s)", image, strings.Join(p.AllowedRegistries, ", "))
+		}
+	}
+
+	tag, digest := imageTag(image)
+	if p.RequireTag && tag == "" && !digest {
+		c.add(field, "image %q has no tag or digest", image)
+	}
+	if tag == "" && !digest {
+		tag = "latest"
+	}
+	if tag != "" && containsString(p.DisallowedTags, tag) {
+		c.add(field, "image tag %q is not allowed", tag)
+	}
+}
+
+// imageTag returns the tag of an image reference, and whether it is pinned
+// by digest
+func imageTag(image string) (tag string, digest bool) {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image, digest = image[:i], true
+	}
+	name := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		tag = name[i+1:]
+	}
+	return tag, digest
+}
+
+func (c *ruleChecker) checkResources(field string, list ResourceList, required bool) {
+	p := c.rule.Resources
+	for _, q := range []struct {
+		name     string
+		quantity Quantity
+		max      Quantity
+	}{
+		{"cpu", list.CPU, p.MaxCPU},
+		{"memory", list.Memory, p.MaxMemory},
+	} {
+		if q.quantity.IsZero() {
+			if required {
+				c.add(field+"."+q.name, "is required")
+			}
+			continue
+		}
+		if !q.max.IsZero() && q.quantity.Cmp(q.max) > 0 {
+			c.add(field+"."+q.name, "%s is more than the maximum of %s", q.quantity, q.max)
+		}
+	}
+}
+
+func (c *ruleChecker) checkEnv(field string, vars []EnvVar) {
+	p := c.rule.Env
+	if p == nil {
+		return
+	}
+	set := map[string]bool{}
+	for i, env := range vars {
+		set[env.Name] = true
+		forbidden, ok := p.Forbidden[env.Name]
+		switch {
+		case !ok:
+		case len(forbidden) == 0:
+			c.add(fmt.Sprintf("%s[%d]", field, i), "variable %s is not allowed", env.Name)
+		case env.ValueFrom == nil && containsString(forbidden, env.Value):
+			c.add(fmt.Sprintf("%s[%d]", field, i), "%s=%s is not allowed", env.Name, env.Value)
+		}
+	}
+	for _, name := range p.Required {
+		if !set[name] {
+			c.add(field, "variable %s is required", name)
+		}
+	}
+}
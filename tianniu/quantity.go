@@ -0,0 +1,269 @@
+package tianniu
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// QuantityFormat is the unit family a Quantity is written in
+type QuantityFormat int
+
+const (
+	// DecimalSI is a plain or milli number with an optional k, M, G, T or
+	// P suffix, e.g. "500m", "1.5" or "2k"; used for CPU
+	DecimalSI QuantityFormat = iota
+	// BinarySI uses powers of 1024, e.g. "512Mi" or "1Gi"
+	BinarySI
+	// DecimalBytes uses powers of 1000 with a B, e.g. "512MB" or "8GB", as
+	// in container resource limits
+	DecimalBytes
+)
+
+// Quantity is an amount of CPU or memory, such as "500m", "0.5", "512Mi",
+// "1Gi" or "512MB". It is stored exactly in thousandths of a unit (cores or
+// bytes), so quantities written in different units can be added and
+// compared. Its zero value is the unset quantity.
+type Quantity struct {
+	milli  int64
+	format QuantityFormat
+}
+
+var quantityPattern = regexp.MustCompile(`^([+-]?)([0-9]+(?:\.[0-9]*)?|\.[0-9]+)([a-zA-Z]*)$`)
+
+// quantitySuffixes maps suffixes to their format and multiplier
+var quantitySuffixes = map[string]struct {
+	format QuantityFormat
+	scale  int64
+}{
+	"":   {DecimalSI, 1},
+	"k":  {DecimalSI, 1e3},
+	"K":  {DecimalSI, 1e3},
+	"M":  {DecimalSI, 1e6},
+	"G":  {DecimalSI, 1e9},
+	"T":  {DecimalSI, 1e12},
+	"P":  {DecimalSI, 1e15},
+	"Ki": {BinarySI, 1 << 10},
+	"Mi": {BinarySI, 1 << 20},
+	"Gi": {BinarySI, 1 << 30},
+	"Ti": {BinarySI, 1 << 40},
+	"Pi": {BinarySI, 1 << 50},
+	"B":  {DecimalBytes, 1},
+	"KB": {DecimalBytes, 1e3},
+	"MB": {DecimalBytes, 1e6},
+	"GB": {DecimalBytes, 1e9},
+	"TB": {DecimalBytes, 1e12},
+	"PB": {DecimalBytes, 1e15},
+}
+
+// canonicalSuffixes are tried from the largest when formatting a quantity
+var canonicalSuffixes = map[QuantityFormat][]string{
+	DecimalSI:    {"P", "T", "G", "M", "k"},
+	BinarySI:     {"Pi", "Ti", "Gi", "Mi", "Ki"},
+	DecimalBytes: {"PB", "TB", "GB", "MB", "KB"},
+}
+
+// ParseQuantity parses a quantity. Fractions finer than a thousandth of a
+// unit are rounded up.
+func ParseQuantity(s string) (Quantity, error) {
+	match := quantityPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil {
+		return Quantity{}, fmt.Errorf("malformed quantity %q", s)
+	}
+	sign, number, suffix := match[1], match[2], match[3]
+
+	var format QuantityFormat
+	milliScale := big.NewInt(1)
+	if suffix == "m" {
+		format = DecimalSI
+	} else {
+		unit, ok := quantitySuffixes[suffix]
+		if !ok {
+			return Quantity{}, fmt.Errorf("unknown unit %q in quantity %q", suffix, s)
+		}
+		format = unit.format
+		milliScale.SetInt64(unit.scale * 1000)
+	}
+
+	value, ok := new(big.Rat).SetString(number)
+	if !ok {
+		return Quantity{}, fmt.Errorf("malformed quantity %q", s)
+	}
+	value.Mul(value, new(big.Rat).SetInt(milliScale))
+
+	// Round up to a whole thousandth
+	milli := new(big.Int).Quo(value.Num(), value.Denom())
+	if new(big.Rat).SetInt(milli).Cmp(value) < 0 {
+		milli.Add(milli, big.NewInt(1))
+	}
+	if !milli.IsInt64() {
+		return Quantity{}, fmt.Errorf("quantity %q is out of range", s)
+	}
+
+	q := Quantity{milli: milli.Int64(), format: format}
+	if sign == "-" {
+		q.milli = -q.milli
+	}
+	return q, nil
+}
+
+// MustParseQuantity is like ParseQuantity but panics on malformed input. It
+// is meant for constants.
+func MustParseQuantity(s string) Quantity {
+	q, err := ParseQuantity(s)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// NewQuantity returns value whole units written in format
+func NewQuantity(value int64, format QuantityFormat) Quantity {
+	return Quantity{milli: value * 1000, format: format}
+}
+
+// NewMilliQuantity returns value thousandths of a unit written in format
+func NewMilliQuantity(milli int64, format QuantityFormat) Quantity {
+	return Quantity{milli: milli, format: format}
+}
+
+// Format returns the unit family of q
+func (q Quantity) Format() QuantityFormat {
+	return q.format
+}
+
+// IsZero reports whether q is zero or unset
+func (q Quantity) IsZero() bool {
+	return q.milli == 0
+}
+
+// MilliValue returns q in thousandths of a unit, e.g. millicores
+func (q Quantity) MilliValue() int64 {
+	return q.milli
+}
+
+// Value returns q in whole units, rounded up, e.g. bytes
+func (q Quantity) Value() int64 {
+	v := q.milli / 1000
+	if q.milli%1000 > 0 {
+		v++
+	}
+	return v
+}
+
+// Float64 returns q in units as a float, e.g. 0.5 cores
+func (q Quantity) Float64() float64 {
+	return float64(q.milli) / 1000
+}
+
+// Cmp returns -1, 0 or 1 as q is less than, equal to or greater than other,
+// whatever units they are written in
+func (q Quantity) Cmp(other Quantity) int {
+	switch {
+	case q.milli < other.milli:
+		return -1
+	case q.milli > other.milli:
+		return 1
+	}
+	return 0
+}
+
+// Add returns q + other in the format of q, or of other when q is unset
+func (q Quantity) Add(other Quantity) Quantity {
+	format := q.format
+	if q.IsZero() {
+		format = other.format
+	}
+	return Quantity{milli: q.milli + other.milli, format: format}
+}
+
+// Sub returns q - other in the format of q
+func (q Quantity) Sub(other Quantity) Quantity {
+	return Quantity{milli: q.milli - other.milli, format: q.format}
+}
+
+// Scale returns q multiplied by factor, rounded up to a thousandth of a unit
+func (q Quantity) Scale(factor float64) Quantity {
+	return Quantity{milli: int64(math.Ceil(float64(q.milli) * factor)), format: q.format}
+}
+
+// String returns the canonical form of q: the largest suffix of its format
+// that keeps the number whole, e.g. "1536Mi", "1.5" as "1500m", "8GB"
+func (q Quantity) String() string {
+	milli := q.milli
+	sign := ""
+	if milli < 0 {
+		sign, milli = "-", -milli
+	}
+	if milli%1000 != 0 {
+		return sign + strconv.FormatInt(milli, 10) + "m"
+	}
+	value := milli / 1000
+	if value == 0 {
+		return "0"
+	}
+	for _, suffix := range canonicalSuffixes[q.format] {
+		scale := quantitySuffixes[suffix].scale
+		if value%scale == 0 {
+			return sign + strconv.FormatInt(value/scale, 10) + suffix
+		}
+	}
+	return sign + strconv.FormatInt(value, 10)
+}
+
+// decimal returns q as a number of units with at least one fractional
+// digit, e.g. "0.5", "0.05" or "2.0"
+func (q Quantity) decimal() string {
+	milli := q.milli
+	sign := ""
+	if milli < 0 {
+		sign, milli = "-", -milli
+	}
+	fraction := strings.TrimRight(fmt.Sprintf("%03d", milli%1000), "0")
+	if fraction == "" {
+		fraction = "0"
+	}
+	return sign + strconv.FormatInt(milli/1000, 10) + "." + fraction
+}
+
+// MarshalJSON writes q as the API does: DecimalSI quantities without a
+// k, M, G, T or P suffix, such as CPU, as decimal cores like "0.5" or
+// "1.0", and other quantities as their canonical string
+func (q Quantity) MarshalJSON() ([]byte, error) {
+	s := q.String()
+	if last := s[len(s)-1]; q.format == DecimalSI && (last == 'm' || last >= '0' && last <= '9') {
+		s = q.decimal()
+	}
+	return json.Marshal(s)
+}
+
+// UnmarshalJSON reads a quantity string, or a bare JSON number. An empty
+// string and null are the unset quantity.
+func (q *Quantity) UnmarshalJSON(data []byte) error {
+	var s string
+	if string(data) == "null" {
+		*q = Quantity{}
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		if s == "" {
+			*q = Quantity{}
+			return nil
+		}
+	} else {
+		s = string(data)
+	}
+	parsed, err := ParseQuantity(s)
+	if err != nil {
+		return err
+	}
+	*q = parsed
+	return nil
+}
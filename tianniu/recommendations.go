@@ -0,0 +1,346 @@
+package tianniu
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Recommendation is a proposed resource optimization, such as resizing the
+// CPU of a deployment or consolidating nodes
+type Recommendation struct {
+	ID                 string               `json:"id"`
+	ResourceType       string               `json:"resource_type"`
+	RecommendationType string               `json:"recommendation_type"`
+	Target             RecommendationTarget `json:"target"`
+	CurrentValue       RecommendationValue  `json:"current_value"`
+	RecommendedValue   RecommendationValue  `json:"recommended_value"`
+	PotentialSavings   RecommendationValue  `json:"potential_savings,omitempty"`
+	Confidence         string               `json:"confidence"`
+	Reason             string               `json:"reason,omitempty"`
+	ObservationPeriod  *ObservationPeriod   `json:"observation_period,omitempty"`
+}
+
+// RecommendationTarget is the object a recommendation changes, e.g. a
+// deployment or a node_group. Container names the container of a deployment
+// a resize is for; the API leaves it out for single-container deployments.
+type RecommendationTarget struct {
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	Container string `json:"container,omitempty"`
+}
+
+func (t RecommendationTarget) String() string {
+	if t.Namespace == "" {
+		return t.Type + "/" + t.Name
+	}
+	return t.Type + "/" + t.Namespace + "/" + t.Name
+}
+
+// ObservationPeriod is the time range a recommendation is based on
+type ObservationPeriod struct {
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+}
+
+// RecommendationValue holds the values of a recommendation, whose keys
+// depend on its type: request and limit for a resize, nodes and total_cpu
+// for a consolidation, cost for the savings
+type RecommendationValue map[string]interface{}
+
+// String returns the value of key as text, or "" if it is not set
+func (v RecommendationValue) String(key string) string {
+	switch value := v[key].(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case string:
+		return value
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// Quantity returns the value of key, a number or a string such as "512Mi",
+// as a Quantity. ok is false if the key is not set.
+func (v RecommendationValue) Quantity(key string) (q Quantity, ok bool, err error) {
+	s := v.String(key)
+	if s == "" {
+		return Quantity{}, false, nil
+	}
+	q, err = ParseQuantity(s)
+	if err != nil {
+		return Quantity{}, true, fmt.Errorf("%s: %v", key, err)
+	}
+	return q, true, nil
+}
+
+// MonthlySavings parses the estimated cost saving of the recommendation,
+// e.g. "¥200/month" is 200 and "¥". ok is false without a cost or when it
+// is not per month.
+func (r *Recommendation) MonthlySavings() (amount float64, currency string, ok bool) {
+	cost := strings.TrimSpace(r.PotentialSavings.String("cost"))
+	if !strings.HasSuffix(cost, "/month") {
+		return 0, "", false
+	}
+	cost = strings.TrimSuffix(cost, "/month")
+	i := strings.IndexFunc(cost, unicode.IsDigit)
+	if i < 0 {
+		return 0, "", false
+	}
+	amount, err := strconv.ParseFloat(strings.ReplaceAll(cost[i:], ",", ""), 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return amount, strings.TrimSpace(cost[:i]), true
+}
+
+// confidenceLevels rank the confidence of recommendations
+var confidenceLevels = map[string]int{"low": 1, "medium": 2, "high": 3}
+
+// RecommendationList is the recommendations of a namespace
+type RecommendationList struct {
+	Namespace       string           `json:"namespace,omitempty"`
+	Recommendations []Recommendation `json:"recommendations"`
+}
+
+// RecommendationListOptions narrows the recommendations returned by
+// Recommendations. Zero-valued fields are not sent.
+type RecommendationListOptions struct {
+	Namespace          string
+	ResourceType       string
+	RecommendationType string
+}
+
+// RecommendationApplyResult is the answer of the API to an applied
+// recommendation
+type RecommendationApplyResult struct {
+	ID                      string    `json:"id"`
+	Status                  string    `json:"status"`
+	Message                 string    `json:"message,omitempty"`
+	EstimatedCompletionTime time.Time `json:"estimated_completion_time"`
+}
+
+// Recommendations lists resource optimization recommendations
+func (s *ResourcesService) Recommendations(ctx context.Context, opts RecommendationListOptions) (*RecommendationList, error) {
+	query := url.Values{}
+	if opts.Namespace != "" {
+		query.Set("namespace", opts.Namespace)
+	}
+	if opts.ResourceType != "" {
+		query.Set("resource_type", opts.ResourceType)
+	}
+	if opts.RecommendationType != "" {
+		query.Set("recommendation_type", opts.RecommendationType)
+	}
+
+	var list RecommendationList
+	if err := s.client.call(ctx, "GET", "/resources/recommendations", query, nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// ApplyRecommendation asks the API to carry out a recommendation
+func (s *ResourcesService) ApplyRecommendation(ctx context.Context, id string) (*RecommendationApplyResult, error) {
+	var result RecommendationApplyResult
+	if err := s.client.call(ctx, "POST", "/resources/recommendations/"+url.PathEscape(id)+"/apply", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ResourceChange is the change of one resource of a deployment container
+// proposed by a recommendation. Stale is set when the deployment no longer
+// has the value the recommendation was computed from.
+type ResourceChange struct {
+	Container   string   `json:"container"`
+	Field       string   `json:"field"`
+	Current     Quantity `json:"current"`
+	Recommended Quantity `json:"recommended"`
+	Stale       bool     `json:"stale,omitempty"`
+}
+
+func (c ResourceChange) String() string {
+	return fmt.Sprintf("container %s: %s %s -> %s", c.Container, c.Field, c.Current, c.Recommended)
+}
+
+// ChangesDeployment reports whether the recommendation resizes the CPU or
+// memory of a deployment, the kind ApplyTo handles
+func (r *Recommendation) ChangesDeployment() bool {
+	return r.Target.Type == "deployment" && r.RecommendationType == "resize" &&
+		(r.ResourceType == "cpu" || r.ResourceType == "memory")
+}
+
+// ApplyTo returns a copy of d with the resources the recommendation
+// proposes for its container, and the changes it made. A recommendation that
+// names no container only applies to a deployment with a single container.
+func (r *Recommendation) ApplyTo(d *Deployment) (*Deployment, []ResourceChange, error) {
+	if !r.ChangesDeployment() {
+		return nil, nil, fmt.Errorf("recommendation %s is a %s of %s %s, not a resize of a deployment", r.ID, r.RecommendationType, r.ResourceType, r.Target)
+	}
+	if d.Name != r.Target.Name {
+		return nil, nil, fmt.Errorf("recommendation %s targets deployment %s, not %s", r.ID, r.Target.Name, d.Name)
+	}
+
+	proposed := *d
+	proposed.Containers = append([]DeploymentContainer(nil), d.Containers...)
+	var c *DeploymentContainer
+	switch {
+	case r.Target.Container != "":
+		for i := range proposed.Containers {
+			if proposed.Containers[i].Name == r.Target.Container {
+				c = &proposed.Containers[i]
+				break
+			}
+		}
+		if c == nil {
+			return nil, nil, fmt.Errorf("recommendation %s targets container %s, which deployment %s does not have", r.ID, r.Target.Container, d.Name)
+		}
+	case len(proposed.Containers) == 1:
+		c = &proposed.Containers[0]
+	default:
+		return nil, nil, fmt.Errorf("recommendation %s does not name which of the %d containers of deployment %s it is for", r.ID, len(d.Containers), d.Name)
+	}
+
+	var changes []ResourceChange
+	for _, kind := range []string{"request", "limit"} {
+		recommended, ok, err := r.RecommendedValue.Quantity(kind)
+		if err != nil {
+			return nil, nil, fmt.Errorf("recommendation %s: recommended %v", r.ID, err)
+		}
+		if !ok {
+			continue
+		}
+		expected, hasExpected, err := r.CurrentValue.Quantity(kind)
+		if err != nil {
+			return nil, nil, fmt.Errorf("recommendation %s: current %v", r.ID, err)
+		}
+		list := &c.Resources.Requests
+		if kind == "limit" {
+			list = &c.Resources.Limits
+		}
+		value := &list.CPU
+		if r.ResourceType == "memory" {
+			value = &list.Memory
+		}
+		if value.Cmp(recommended) == 0 {
+			continue
+		}
+		changes = append(changes, ResourceChange{
+			Container:   c.Name,
+			Field:       "resources." + kind + "s." + r.ResourceType,
+			Current:     *value,
+			Recommended: recommended,
+			Stale:       hasExpected && value.Cmp(expected) != 0,
+		})
+		*value = recommended
+	}
+	return &proposed, changes, nil
+}
+
+// RecommendationReview is a recommendation with the deployment it targets,
+// for review before it is applied. Deployment and Changes are only set for
+// recommendations that resize a deployment.
+type RecommendationReview struct {
+	Recommendation *Recommendation  `json:"recommendation"`
+	Deployment     *Deployment      `json:"deployment,omitempty"`
+	Proposed       *Deployment      `json:"proposed,omitempty"`
+	Changes        []ResourceChange `json:"changes,omitempty"`
+}
+
+// Review finds the live deployment a recommendation targets, by name in the
+// environment of its namespace, and computes the proposed changes
+func (s *ResourcesService) Review(ctx context.Context, r *Recommendation) (*RecommendationReview, error) {
+	review := &RecommendationReview{Recommendation: r}
+	if !r.ChangesDeployment() {
+		return review, nil
+	}
+	deployments, err := s.client.Deployments.ListAll(ctx, r.Target.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments of %s: %v", r.Target.Namespace, err)
+	}
+	// The list has no containers, so it only gives the ID to get
+	id := ""
+	for _, d := range deployments {
+		if d.Name == r.Target.Name {
+			id = d.ID
+			break
+		}
+	}
+	if id == "" {
+		return nil, fmt.Errorf("deployment %s not found in %s", r.Target.Name, r.Target.Namespace)
+	}
+	review.Deployment, err = s.client.Deployments.Get(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment %s: %v", r.Target.Name, err)
+	}
+	review.Proposed, review.Changes, err = r.ApplyTo(review.Deployment)
+	if err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
+// RecommendationPolicy selects the recommendations applied in bulk. Empty
+// lists match every value.
+type RecommendationPolicy struct {
+	RecommendationTypes []string `json:"recommendation_types,omitempty"`
+	ResourceTypes       []string `json:"resource_types,omitempty"`
+	Namespaces          []string `json:"namespaces,omitempty"`
+	// MinConfidence is low, medium or high
+	MinConfidence string `json:"min_confidence,omitempty"`
+	// MinMonthlySavings skips recommendations saving less per month, and
+	// those without a monthly cost estimate
+	MinMonthlySavings float64 `json:"min_monthly_savings,omitempty"`
+}
+
+// Validate checks the confidence level and savings of the policy
+func (p *RecommendationPolicy) Validate() error {
+	if _, ok := confidenceLevels[p.MinConfidence]; p.MinConfidence != "" && !ok {
+		return fmt.Errorf("min_confidence: %q is not low, medium or high", p.MinConfidence)
+	}
+	if p.MinMonthlySavings < 0 {
+		return fmt.Errorf("min_monthly_savings: must not be negative")
+	}
+	return nil
+}
+
+// Matches reports whether the policy selects r
+func (p *RecommendationPolicy) Matches(r *Recommendation) bool {
+	if len(p.RecommendationTypes) > 0 && !containsString(p.RecommendationTypes, r.RecommendationType) {
+		return false
+	}
+	if len(p.ResourceTypes) > 0 && !containsString(p.ResourceTypes, r.ResourceType) {
+		return false
+	}
+	if len(p.Namespaces) > 0 && !containsString(p.Namespaces, r.Target.Namespace) {
+		return false
+	}
+	if p.MinConfidence != "" && confidenceLevels[r.Confidence] < confidenceLevels[p.MinConfidence] {
+		return false
+	}
+	if p.MinMonthlySavings > 0 {
+		if amount, _, ok := r.MonthlySavings(); !ok || amount < p.MinMonthlySavings {
+			return false
+		}
+	}
+	return true
+}
+
+// Select returns the recommendations the policy matches, in order
+func (p *RecommendationPolicy) Select(recommendations []Recommendation) []Recommendation {
+	var selected []Recommendation
+	for _, r := range recommendations {
+		if p.Matches(&r) {
+			selected = append(selected, r)
+		}
+	}
+	return selected
+}
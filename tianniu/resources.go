@@ -0,0 +1,137 @@
+package tianniu
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// ResourceQuota is the quota of one resource type in a namespace, e.g. 100
+// "cores" of cpu
+type ResourceQuota struct {
+	ResourceType string  `json:"resource_type"`
+	Limit        float64 `json:"limit"`
+	Used         float64 `json:"used,omitempty"`
+	Available    float64 `json:"available,omitempty"`
+	Unit         string  `json:"unit,omitempty"`
+}
+
+// UsagePercent is the share of the limit in use, e.g. 45 for 45 of 100
+// cores. It is 0 without a limit.
+func (q ResourceQuota) UsagePercent() float64 {
+	if q.Limit <= 0 {
+		return 0
+	}
+	return q.Used / q.Limit * 100
+}
+
+// NamespaceQuotas are the resource quotas of a namespace
+type NamespaceQuotas struct {
+	Namespace string          `json:"namespace"`
+	Quotas    []ResourceQuota `json:"quotas"`
+}
+
+// Quota returns the quota of resourceType, or nil if the namespace has none
+func (q *NamespaceQuotas) Quota(resourceType string) *ResourceQuota {
+	for i := range q.Quotas {
+		if q.Quotas[i].ResourceType == resourceType {
+			return &q.Quotas[i]
+		}
+	}
+	return nil
+}
+
+// QuotaOptions narrows the quotas returned by Quotas. Zero-valued fields
+// are not sent.
+type QuotaOptions struct {
+	Namespace    string
+	ResourceType string
+}
+
+// ResourcesService talks to the /resources endpoints
+type ResourcesService struct {
+	client *Client
+}
+
+// Quotas gets the resource quotas of a namespace, with their usage
+func (s *ResourcesService) Quotas(ctx context.Context, opts QuotaOptions) (*NamespaceQuotas, error) {
+	query := url.Values{}
+	if opts.Namespace != "" {
+		query.Set("namespace", opts.Namespace)
+	}
+	if opts.ResourceType != "" {
+		query.Set("resource_type", opts.ResourceType)
+	}
+
+	var quotas NamespaceQuotas
+	if err := s.client.call(ctx, "GET", "/resources/quotas", query, nil, &quotas); err != nil {
+		return nil, err
+	}
+	return &quotas, nil
+}
+
+// UpdateQuotas sets the limits of the quotas of a namespace. Only the
+// resource types in q change; the updated quotas are returned with their
+// usage.
+func (s *ResourcesService) UpdateQuotas(ctx context.Context, q *NamespaceQuotas) (*NamespaceQuotas, error) {
+	if q.Namespace == "" {
+		return nil, fmt.Errorf("namespace is required")
+	}
+	if len(q.Quotas) == 0 {
+		return nil, fmt.Errorf("no quotas to update")
+	}
+	type limit struct {
+		ResourceType string  `json:"resource_type"`
+		Limit        float64 `json:"limit"`
+	}
+	body := struct {
+		Quotas []limit `json:"quotas"`
+	}{Quotas: make([]limit, 0, len(q.Quotas))}
+	for _, quota := range q.Quotas {
+		if quota.ResourceType == "" {
+			return nil, fmt.Errorf("quota without resource_type")
+		}
+		if quota.Limit < 0 {
+			return nil, fmt.Errorf("negative limit %v for %s", quota.Limit, quota.ResourceType)
+		}
+		body.Quotas = append(body.Quotas, limit{quota.ResourceType, quota.Limit})
+	}
+
+	var resp struct {
+		Namespace     string          `json:"namespace"`
+		UpdatedQuotas []ResourceQuota `json:"updated_quotas"`
+	}
+	if err := s.client.call(ctx, "PUT", "/resources/quotas/"+url.PathEscape(q.Namespace), nil, body, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Namespace == "" {
+		resp.Namespace = q.Namespace
+	}
+	return &NamespaceQuotas{Namespace: resp.Namespace, Quotas: resp.UpdatedQuotas}, nil
+}
+
+// quotaUnits maps the quota units of CPU and memory to quantity suffixes
+var quotaUnits = map[string]string{
+	"":      "",
+	"cores": "",
+	"KB":    "KB",
+	"MB":    "MB",
+	"GB":    "GB",
+	"TB":    "TB",
+	"KiB":   "Ki",
+	"MiB":   "Mi",
+	"GiB":   "Gi",
+	"TiB":   "Ti",
+}
+
+// Quantity converts an amount of the quota in its unit, such as its Limit or
+// Used, to a Quantity, e.g. 512 GB to "512GB". Units other than cores and
+// bytes, such as Mbps, have no Quantity.
+func (q ResourceQuota) Quantity(amount float64) (Quantity, error) {
+	suffix, ok := quotaUnits[q.Unit]
+	if !ok {
+		return Quantity{}, fmt.Errorf("quota unit %q of %s is not a CPU or memory unit", q.Unit, q.ResourceType)
+	}
+	return ParseQuantity(strconv.FormatFloat(amount, 'f', -1, 64) + suffix)
+}
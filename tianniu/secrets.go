@@ -0,0 +1,285 @@
+package tianniu
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SecretProvider resolves secret references for one URI scheme
+type SecretProvider interface {
+	Resolve(ctx context.Context, ref *url.URL) (string, error)
+}
+
+// SecretProviderFunc adapts a function to the SecretProvider interface
+type SecretProviderFunc func(ctx context.Context, ref *url.URL) (string, error)
+
+// Resolve calls f(ctx, ref)
+func (f SecretProviderFunc) Resolve(ctx context.Context, ref *url.URL) (string, error) {
+	return f(ctx, ref)
+}
+
+// SecretResolver dispatches secret references to providers by URI scheme.
+// References look like:
+//
+//	env:MYSQL_PROD_PASSWORD
+//	file:///run/secrets/db-pass
+//	keystore:mysql-prod-password
+//	exec:///usr/local/bin/vault-secret?arg=secret/data/db&arg=password
+type SecretResolver struct {
+	mu        sync.RWMutex
+	providers map[string]SecretProvider
+}
+
+// NewSecretResolver returns a resolver with the env, file, keystore and exec
+// providers registered
+func NewSecretResolver() *SecretResolver {
+	r := &SecretResolver{providers: map[string]SecretProvider{}}
+	r.Register("env", EnvSecretProvider{})
+	r.Register("file", FileSecretProvider{})
+	r.Register("keystore", &KeystoreSecretProvider{})
+	r.Register("exec", ExecSecretProvider{})
+	return r
+}
+
+// DefaultSecretResolver is used by ResolveSecret
+var DefaultSecretResolver = NewSecretResolver()
+
+// ResolveSecret resolves a reference with DefaultSecretResolver
+func ResolveSecret(ctx context.Context, ref string) (string, error) {
+	return DefaultSecretResolver.Resolve(ctx, ref)
+}
+
+// Register installs the provider for a scheme, replacing any existing one
+func (r *SecretResolver) Register(scheme string, provider SecretProvider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[strings.ToLower(scheme)] = provider
+}
+
+// Resolve parses ref and asks the provider for its scheme
+func (r *SecretResolver) Resolve(ctx context.Context, ref string) (string, error) {
+	u, provider, err := r.provider(ref)
+	if err != nil {
+		return "", err
+	}
+
+	value, err := provider.Resolve(ctx, u)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve secret %s: %v", RedactSecretRef(ref), err)
+	}
+	return value, nil
+}
+
+// Check parses ref and checks that a provider is registered for its scheme,
+// without resolving the secret
+func (r *SecretResolver) Check(ref string) error {
+	_, _, err := r.provider(ref)
+	return err
+}
+
+func (r *SecretResolver) provider(ref string) (*url.URL, SecretProvider, error) {
+	u, err := ParseSecretRef(ref)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r.mu.RLock()
+	provider, ok := r.providers[u.Scheme]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, nil, fmt.Errorf("no secret provider for scheme %q", u.Scheme)
+	}
+	return u, provider, nil
+}
+
+// ParseSecretRef parses a secret reference. References must carry a scheme so
+// that literal secrets are never accepted by accident.
+func ParseSecretRef(ref string) (*url.URL, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret reference: %v", err)
+	}
+	if u.Scheme == "" {
+		return nil, fmt.Errorf("secret reference %q has no scheme (expected env:, file:, keystore: or exec:)", RedactSecretRef(ref))
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	return u, nil
+}
+
+// RedactSecretRef strips anything after the path of a reference so it can be
+// logged
+func RedactSecretRef(ref string) string {
+	if i := strings.IndexAny(ref, "?#"); i >= 0 {
+		return ref[:i] + "?..."
+	}
+	return ref
+}
+
+// refName returns the name part of opaque ("env:NAME") and host-style
+// ("env://NAME") references
+func refName(ref *url.URL) string {
+	if ref.Opaque != "" {
+		return ref.Opaque
+	}
+	return ref.Host + ref.Path
+}
+
+// EnvSecretProvider reads secrets from environment variables: env:NAME
+type EnvSecretProvider struct{}
+
+// Resolve returns the value of the named environment variable
+func (EnvSecretProvider) Resolve(_ context.Context, ref *url.URL) (string, error) {
+	name := refName(ref)
+	if name == "" {
+		return "", fmt.Errorf("missing variable name")
+	}
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return "", fmt.Errorf("environment variable %s not set", name)
+	}
+	return value, nil
+}
+
+// FileSecretProvider reads secrets from files such as mounted Kubernetes or
+// Docker secrets: file:///run/secrets/db-pass. A single trailing newline is
+// removed.
+type FileSecretProvider struct{}
+
+// Resolve returns the contents of the referenced file
+func (FileSecretProvider) Resolve(_ context.Context, ref *url.URL) (string, error) {
+	if ref.Opaque != "" || (ref.Host != "" && ref.Host != "localhost") {
+		return "", fmt.Errorf("file references must be absolute, e.g. file:///run/secrets/name")
+	}
+	if ref.Path == "" {
+		return "", fmt.Errorf("missing file path")
+	}
+
+	data, err := ioutil.ReadFile(ref.Path)
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r")
+	if value == "" {
+		return "", fmt.Errorf("file %s is empty", ref.Path)
+	}
+	return value, nil
+}
+
+// KeystoreSecretProvider reads secrets from an encrypted local keystore:
+// keystore:name or keystore:name?path=/etc/tianniu/keystore. The passphrase
+// is taken from Passphrase, or from TIANNIU_KEYSTORE_PASSPHRASE_FILE or
+// TIANNIU_KEYSTORE_PASSPHRASE when empty.
+type KeystoreSecretProvider struct {
+	Path       string
+	Passphrase string
+}
+
+// Resolve decrypts the named entry of the keystore
+func (p *KeystoreSecretProvider) Resolve(_ context.Context, ref *url.URL) (string, error) {
+	name := refName(ref)
+	if name == "" {
+		return "", fmt.Errorf("missing keystore entry name")
+	}
+
+	path := ref.Query().Get("path")
+	if path == "" {
+		path = p.Path
+	}
+	if path == "" {
+		path = DefaultKeystorePath()
+	}
+
+	passphrase, err := p.passphrase()
+	if err != nil {
+		return "", err
+	}
+
+	ks, err := OpenKeystore(path, passphrase)
+	if err != nil {
+		return "", err
+	}
+	return ks.Get(name)
+}
+
+func (p *KeystoreSecretProvider) passphrase() (string, error) {
+	if p.Passphrase != "" {
+		return p.Passphrase, nil
+	}
+	return KeystorePassphrase()
+}
+
+// KeystorePassphrase reads the keystore passphrase from the file named by
+// TIANNIU_KEYSTORE_PASSPHRASE_FILE, or from TIANNIU_KEYSTORE_PASSPHRASE
+func KeystorePassphrase() (string, error) {
+	if file := os.Getenv("TIANNIU_KEYSTORE_PASSPHRASE_FILE"); file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read keystore passphrase: %v", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	if pass := os.Getenv("TIANNIU_KEYSTORE_PASSPHRASE"); pass != "" {
+		return pass, nil
+	}
+	return "", fmt.Errorf("keystore passphrase not configured (set TIANNIU_KEYSTORE_PASSPHRASE_FILE)")
+}
+
+// ExecSecretProvider runs a plugin executable and uses its standard output as
+// the secret: exec:///path/to/plugin?arg=a&arg=b, or exec://name to run
+// tianniu-secret-name from PATH. Plugins run with a timeout and their stderr
+// is included in errors.
+type ExecSecretProvider struct {
+	Timeout time.Duration
+}
+
+// Resolve runs the plugin and returns its trimmed output
+func (p ExecSecretProvider) Resolve(ctx context.Context, ref *url.URL) (string, error) {
+	var command string
+	switch {
+	case ref.Opaque != "":
+		return "", fmt.Errorf("exec references must be exec:///absolute/path or exec://plugin-name")
+	case ref.Host != "":
+		path, err := exec.LookPath("tianniu-secret-" + ref.Host)
+		if err != nil {
+			return "", err
+		}
+		command = path
+	case filepath.IsAbs(ref.Path):
+		command = ref.Path
+	default:
+		return "", fmt.Errorf("missing plugin path")
+	}
+
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command, ref.Query()["arg"]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("plugin %s failed: %v: %s", command, err, msg)
+		}
+		return "", fmt.Errorf("plugin %s failed: %v", command, err)
+	}
+
+	value := strings.TrimRight(stdout.String(), "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("plugin %s returned an empty secret", command)
+	}
+	return value, nil
+}
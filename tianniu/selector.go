@@ -0,0 +1,387 @@
+// Package tianniu is the Go client for the TianNiu platform API.
+package tianniu
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Operator is the comparison a selector requirement applies to a label
+type Operator string
+
+const (
+	OpEquals       Operator = "="
+	OpNotEquals    Operator = "!="
+	OpIn           Operator = "in"
+	OpNotIn        Operator = "notin"
+	OpExists       Operator = "exists"
+	OpDoesNotExist Operator = "!"
+)
+
+var (
+	labelNamePattern   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?$`)
+	labelPrefixPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9.-]*[a-z0-9])?$`)
+	labelValuePattern  = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?)?$`)
+	sqlColumnPattern   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+)
+
+// Requirement is a single clause of a label selector
+type Requirement struct {
+	Key      string
+	Operator Operator
+	Values   []string
+}
+
+// Selector is a conjunction of label requirements. The zero value matches
+// everything.
+type Selector struct {
+	requirements []Requirement
+}
+
+// ParseSelector parses a Kubernetes-style label selector such as
+// "app=web,team in (backend,data),!canary"
+func ParseSelector(s string) (Selector, error) {
+	p := &selectorParser{input: s}
+	reqs, err := p.parse()
+	if err != nil {
+		return Selector{}, fmt.Errorf("invalid label selector %q: %v", s, err)
+	}
+	return Selector{requirements: reqs}, nil
+}
+
+// SelectorFromSet returns a selector that requires every key to equal its
+// value in the map
+func SelectorFromSet(labels map[string]string) (Selector, error) {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sel Selector
+	for _, k := range keys {
+		var err error
+		sel, err = sel.Add(k, OpEquals, labels[k])
+		if err != nil {
+			return Selector{}, err
+		}
+	}
+	return sel, nil
+}
+
+// Add returns a copy of the selector with one more requirement
+func (s Selector) Add(key string, op Operator, values ...string) (Selector, error) {
+	req := Requirement{Key: key, Operator: op, Values: values}
+	if err := req.validate(); err != nil {
+		return Selector{}, err
+	}
+
+	reqs := make([]Requirement, len(s.requirements), len(s.requirements)+1)
+	copy(reqs, s.requirements)
+	return Selector{requirements: append(reqs, req)}, nil
+}
+
+// Requirements returns the requirements of the selector
+func (s Selector) Requirements() []Requirement {
+	reqs := make([]Requirement, len(s.requirements))
+	copy(reqs, s.requirements)
+	return reqs
+}
+
+// Empty reports whether the selector has no requirements
+func (s Selector) Empty() bool {
+	return len(s.requirements) == 0
+}
+
+// Matches reports whether the labels satisfy every requirement
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s.requirements {
+		if !r.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the selector in the syntax accepted by ParseSelector
+func (s Selector) String() string {
+	parts := make([]string, len(s.requirements))
+	for i, r := range s.requirements {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// MySQLCondition compiles the selector into a MySQL boolean expression over a
+// JSON object column, together with its placeholder arguments. An empty
+// selector compiles to "TRUE".
+func (s Selector) MySQLCondition(column string) (string, []interface{}, error) {
+	if !sqlColumnPattern.MatchString(column) {
+		return "", nil, fmt.Errorf("invalid column name %q", column)
+	}
+	if s.Empty() {
+		return "TRUE", nil, nil
+	}
+
+	conds := make([]string, 0, len(s.requirements))
+	var args []interface{}
+	for _, r := range s.requirements {
+		cond, rargs := r.mysqlCondition(column)
+		conds = append(conds, cond)
+		args = append(args, rargs...)
+	}
+	return strings.Join(conds, " AND "), args, nil
+}
+
+// Matches reports whether the labels satisfy the requirement
+func (r Requirement) Matches(labels map[string]string) bool {
+	value, ok := labels[r.Key]
+	switch r.Operator {
+	case OpEquals:
+		return ok && value == r.Values[0]
+	case OpNotEquals:
+		return !ok || value != r.Values[0]
+	case OpIn:
+		return ok && containsString(r.Values, value)
+	case OpNotIn:
+		return !ok || !containsString(r.Values, value)
+	case OpExists:
+		return ok
+	case OpDoesNotExist:
+		return !ok
+	}
+	return false
+}
+
+// String returns the requirement in selector syntax
+func (r Requirement) String() string {
+	switch r.Operator {
+	case OpEquals, OpNotEquals:
+		return r.Key + string(r.Operator) + r.Values[0]
+	case OpIn, OpNotIn:
+		return r.Key + " " + string(r.Operator) + " (" + strings.Join(r.Values, ",") + ")"
+	case OpExists:
+		return r.Key
+	case OpDoesNotExist:
+		return "!" + r.Key
+	}
+	return ""
+}
+
+func (r Requirement) validate() error {
+	if err := validateLabelKey(r.Key); err != nil {
+		return err
+	}
+
+	switch r.Operator {
+	case OpEquals, OpNotEquals:
+		if len(r.Values) != 1 {
+			return fmt.Errorf("operator %s on %s requires exactly one value", r.Operator, r.Key)
+		}
+	case OpIn, OpNotIn:
+		if len(r.Values) == 0 {
+			return fmt.Errorf("operator %s on %s requires at least one value", r.Operator, r.Key)
+		}
+	case OpExists, OpDoesNotExist:
+		if len(r.Values) != 0 {
+			return fmt.Errorf("operator %s on %s takes no values", r.Operator, r.Key)
+		}
+	default:
+		return fmt.Errorf("unknown operator %q", r.Operator)
+	}
+
+	for _, v := range r.Values {
+		if err := validateLabelValue(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r Requirement) mysqlCondition(column string) (string, []interface{}) {
+	path := `$."` + r.Key + `"`
+	value := "JSON_UNQUOTE(JSON_EXTRACT(" + column + ", ?))"
+	missing := "JSON_EXTRACT(" + column + ", ?) IS NULL"
+
+	switch r.Operator {
+	case OpEquals:
+		return value + " = ?", []interface{}{path, r.Values[0]}
+	case OpNotEquals:
+		return "(" + missing + " OR " + value + " <> ?)", []interface{}{path, path, r.Values[0]}
+	case OpIn, OpNotIn:
+		args := []interface{}{path}
+		if r.Operator == OpNotIn {
+			args = append(args, path)
+		}
+		marks := make([]string, len(r.Values))
+		for i, v := range r.Values {
+			marks[i] = "?"
+			args = append(args, v)
+		}
+		if r.Operator == OpIn {
+			return value + " IN (" + strings.Join(marks, ", ") + ")", args
+		}
+		return "(" + missing + " OR " + value + " NOT IN (" + strings.Join(marks, ", ") + "))", args
+	case OpExists:
+		return "JSON_CONTAINS_PATH(" + column + ", 'one', ?)", []interface{}{path}
+	case OpDoesNotExist:
+		return "(" + column + " IS NULL OR NOT JSON_CONTAINS_PATH(" + column + ", 'one', ?))", []interface{}{path}
+	}
+	return "FALSE", nil
+}
+
+// validateLabelKey checks a key of the form [prefix/]name
+func validateLabelKey(key string) error {
+	name := key
+	if i := strings.LastIndex(key, "/"); i >= 0 {
+		prefix := key[:i]
+		name = key[i+1:]
+		if len(prefix) == 0 || len(prefix) > 253 || !labelPrefixPattern.MatchString(prefix) {
+			return fmt.Errorf("invalid label key prefix in %q", key)
+		}
+	}
+	if len(name) == 0 || len(name) > 63 || !labelNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid label key %q", key)
+	}
+	return nil
+}
+
+func validateLabelValue(value string) error {
+	if len(value) > 63 || !labelValuePattern.MatchString(value) {
+		return fmt.Errorf("invalid label value %q", value)
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// selectorParser is a small recursive-descent parser for selector strings
+type selectorParser struct {
+	input string
+	pos   int
+}
+
+func (p *selectorParser) parse() ([]Requirement, error) {
+	var reqs []Requirement
+	p.skipSpace()
+	if p.pos == len(p.input) {
+		return nil, nil
+	}
+
+	for {
+		req, err := p.requirement()
+		if err != nil {
+			return nil, err
+		}
+		if err := req.validate(); err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, req)
+
+		p.skipSpace()
+		if p.pos == len(p.input) {
+			return reqs, nil
+		}
+		if p.input[p.pos] != ',' {
+			return nil, fmt.Errorf("expected ',' at position %d", p.pos)
+		}
+		p.pos++
+	}
+}
+
+func (p *selectorParser) requirement() (Requirement, error) {
+	p.skipSpace()
+	if p.consume("!") {
+		p.skipSpace()
+		key := p.word()
+		if key == "" {
+			return Requirement{}, fmt.Errorf("expected label key after '!' at position %d", p.pos)
+		}
+		return Requirement{Key: key, Operator: OpDoesNotExist}, nil
+	}
+
+	key := p.word()
+	if key == "" {
+		return Requirement{}, fmt.Errorf("expected label key at position %d", p.pos)
+	}
+
+	p.skipSpace()
+	switch {
+	case p.pos == len(p.input) || p.input[p.pos] == ',':
+		return Requirement{Key: key, Operator: OpExists}, nil
+	case p.consume("!="):
+		return Requirement{Key: key, Operator: OpNotEquals, Values: []string{p.value()}}, nil
+	case p.consume("=="), p.consume("="):
+		return Requirement{Key: key, Operator: OpEquals, Values: []string{p.value()}}, nil
+	}
+
+	op := Operator(p.word())
+	if op != OpIn && op != OpNotIn {
+		return Requirement{}, fmt.Errorf("unknown operator %q after %s", op, key)
+	}
+	values, err := p.valueSet()
+	if err != nil {
+		return Requirement{}, err
+	}
+	return Requirement{Key: key, Operator: op, Values: values}, nil
+}
+
+func (p *selectorParser) valueSet() ([]string, error) {
+	p.skipSpace()
+	if !p.consume("(") {
+		return nil, fmt.Errorf("expected '(' at position %d", p.pos)
+	}
+
+	var values []string
+	for {
+		values = append(values, p.value())
+		p.skipSpace()
+		if p.consume(")") {
+			return values, nil
+		}
+		if !p.consume(",") {
+			return nil, fmt.Errorf("expected ',' or ')' at position %d", p.pos)
+		}
+	}
+}
+
+func (p *selectorParser) value() string {
+	p.skipSpace()
+	return p.word()
+}
+
+// word reads the longest run of characters allowed in keys and values
+func (p *selectorParser) word() string {
+	start := p.pos
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		if c == ',' || c == '=' || c == '!' || c == '(' || c == ')' || c == ' ' || c == '\t' {
+			break
+		}
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+func (p *selectorParser) consume(token string) bool {
+	if strings.HasPrefix(p.input[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *selectorParser) skipSpace() {
+	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t') {
+		p.pos++
+	}
+}
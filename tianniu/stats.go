@@ -0,0 +1,363 @@
+package tianniu
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatsSample is the resource usage of a container at one point in time,
+// parsed into numbers. Rates are in bytes per second; counters are zero
+// when the sample comes from the resource usage of the container list.
+type StatsSample struct {
+	ContainerID string    `json:"container_id"`
+	Name        string    `json:"name,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+
+	// Source is "stats" for the stats endpoint or "usage" for the
+	// resource_usage field of the container
+	Source string `json:"source"`
+
+	// CPUPercent is the CPU usage, 100 being one full core
+	CPUPercent       float64 `json:"cpu_percent"`
+	MemoryBytes      int64   `json:"memory_bytes"`
+	MemoryLimitBytes int64   `json:"memory_limit_bytes,omitempty"`
+	MemoryPercent    float64 `json:"memory_percent,omitempty"`
+
+	NetworkRxRate   float64 `json:"network_rx_rate"`
+	NetworkTxRate   float64 `json:"network_tx_rate"`
+	NetworkRxBytes  int64   `json:"network_rx_bytes,omitempty"`
+	NetworkTxBytes  int64   `json:"network_tx_bytes,omitempty"`
+	BlockReadBytes  int64   `json:"block_read_bytes,omitempty"`
+	BlockWriteBytes int64   `json:"block_write_bytes,omitempty"`
+}
+
+// SampleFromStats converts the response of the stats endpoint
+func SampleFromStats(stats *ContainerStats) StatsSample {
+	timestamp := stats.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	return StatsSample{
+		ContainerID:      stats.ContainerID,
+		Timestamp:        timestamp,
+		Source:           "stats",
+		CPUPercent:       stats.CPU.UsagePercent,
+		MemoryBytes:      stats.Memory.Usage,
+		MemoryLimitBytes: stats.Memory.Limit,
+		MemoryPercent:    stats.Memory.UsagePercent,
+		NetworkRxBytes:   stats.Network.RxBytes,
+		NetworkTxBytes:   stats.Network.TxBytes,
+		BlockReadBytes:   stats.IO.ReadBytes,
+		BlockWriteBytes:  stats.IO.WriteBytes,
+	}
+}
+
+// SampleFromUsage converts the resource usage strings of a container, such
+// as "0.75" cores, "128MB" and "1.2MB/s"
+func SampleFromUsage(c *Container) (StatsSample, error) {
+	sample := StatsSample{
+		ContainerID: c.ID,
+		Name:        c.Name,
+		Timestamp:   time.Now(),
+		Source:      "usage",
+		CPUPercent:  c.ResourceUsage.CPU.Float64() * 100,
+		MemoryBytes: c.ResourceUsage.Memory.Value(),
+	}
+	if limit := c.ResourceLimits.Memory.Value(); limit > 0 {
+		sample.MemoryLimitBytes = limit
+		sample.MemoryPercent = float64(sample.MemoryBytes) / float64(limit) * 100
+	}
+	var err error
+	if sample.NetworkRxRate, err = ParseRate(c.ResourceUsage.NetworkRX); err != nil {
+		return sample, fmt.Errorf("network_rx: %v", err)
+	}
+	if sample.NetworkTxRate, err = ParseRate(c.ResourceUsage.NetworkTX); err != nil {
+		return sample, fmt.Errorf("network_tx: %v", err)
+	}
+	return sample, nil
+}
+
+// ParseRate parses a rate such as "1.2MB/s" or "512Ki/s" into bytes per
+// second. An empty rate is zero.
+func ParseRate(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	q, err := ParseQuantity(strings.TrimSuffix(s, "/s"))
+	if err != nil {
+		return 0, fmt.Errorf("malformed rate %q", s)
+	}
+	return q.Float64(), nil
+}
+
+// StatsCollectorOptions selects the containers a collector samples. Without
+// IDs or a selector all running containers are sampled.
+type StatsCollectorOptions struct {
+	IDs           []string
+	LabelSelector string
+
+	// Interval is the time between samples of Run. Zero means 10s.
+	Interval time.Duration
+
+	// Concurrency bounds the stats requests in flight. Zero means
+	// DefaultBatchConcurrency.
+	Concurrency int
+}
+
+// StatsCollector polls the resource usage of containers. It serves the
+// latest samples as Prometheus metrics through ServeHTTP.
+type StatsCollector struct {
+	containers *ContainersService
+	opts       StatsCollectorOptions
+
+	mu     sync.Mutex
+	latest map[string]StatsSample
+}
+
+// NewStatsCollector returns a collector sampling through client
+func NewStatsCollector(client *Client, opts StatsCollectorOptions) *StatsCollector {
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultBatchConcurrency
+	}
+	return &StatsCollector{containers: client.Containers, opts: opts, latest: make(map[string]StatsSample)}
+}
+
+// Collect takes one sample of each container, ordered by container ID. The
+// stats endpoint is used where it answers; otherwise the resource usage of
+// the container list is. Containers that could be sampled neither way are
+// left out and reported in the error, which is then returned along with
+// the other samples.
+func (c *StatsCollector) Collect(ctx context.Context) ([]StatsSample, error) {
+	var containers []Container
+	for _, id := range c.opts.IDs {
+		containers = append(containers, Container{ID: id})
+	}
+	explicit := len(containers)
+	if c.opts.LabelSelector != "" || len(c.opts.IDs) == 0 {
+		list := ContainerListOptions{LabelSelector: c.opts.LabelSelector}
+		if c.opts.LabelSelector == "" {
+			list.Status = "running"
+		}
+		listed, err := c.containers.listAll(ctx, list)
+		if err != nil {
+			return nil, err
+		}
+		containers = append(containers, listed...)
+	}
+
+	samples := make([]*StatsSample, len(containers))
+	errs := make([]error, len(containers))
+	forEachLimit(len(containers), c.opts.Concurrency, func(i int) {
+		samples[i], errs[i] = c.sample(ctx, &containers[i], i >= explicit)
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	byID := make(map[string]StatsSample, len(samples))
+	var failed []string
+	var firstErr error
+	for i, sample := range samples {
+		if sample == nil {
+			failed = append(failed, containers[i].ID)
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+			continue
+		}
+		if _, ok := byID[sample.ContainerID]; ok {
+			continue
+		}
+		if prev, ok := c.latest[sample.ContainerID]; ok && sample.Source == "stats" {
+			setRates(sample, &prev)
+		}
+		byID[sample.ContainerID] = *sample
+	}
+	c.latest = byID
+
+	result := make([]StatsSample, 0, len(byID))
+	for _, sample := range byID {
+		result = append(result, sample)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ContainerID < result[j].ContainerID })
+	if firstErr != nil {
+		return result, fmt.Errorf("failed to sample %d containers (%s): %v", len(failed), strings.Join(failed, ", "), firstErr)
+	}
+	return result, nil
+}
+
+// sample samples one container. A container from the list falls back on
+// its resource usage when the stats endpoint fails.
+func (c *StatsCollector) sample(ctx context.Context, container *Container, listed bool) (*StatsSample, error) {
+	stats, err := c.containers.Stats(ctx, container.ID)
+	if err == nil {
+		sample := SampleFromStats(stats)
+		sample.ContainerID, sample.Name = container.ID, container.Name
+		return &sample, nil
+	}
+	if !listed || ctx.Err() != nil {
+		return nil, err
+	}
+	sample, err := SampleFromUsage(container)
+	if err != nil {
+		return nil, fmt.Errorf("container %s: %v", container.ID, err)
+	}
+	return &sample, nil
+}
+
+// setRates computes the network rates of sample from the counters of the
+// previous sample of the same container
+func setRates(sample, prev *StatsSample) {
+	elapsed := sample.Timestamp.Sub(prev.Timestamp).Seconds()
+	if elapsed <= 0 || prev.Source != "stats" {
+		return
+	}
+	if delta := sample.NetworkRxBytes - prev.NetworkRxBytes; delta >= 0 {
+		sample.NetworkRxRate = float64(delta) / elapsed
+	}
+	if delta := sample.NetworkTxBytes - prev.NetworkTxBytes; delta >= 0 {
+		sample.NetworkTxRate = float64(delta) / elapsed
+	}
+}
+
+// Run collects samples every interval until ctx is done, passing each round
+// to fn, which may be nil. Sampling errors are passed to fn along with the
+// samples and do not stop the collector.
+func (c *StatsCollector) Run(ctx context.Context, fn func([]StatsSample, error)) error {
+	ticker := time.NewTicker(c.opts.Interval)
+	defer ticker.Stop()
+	for {
+		samples, err := c.Collect(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if fn != nil {
+			fn(samples, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Latest returns the samples of the last round, ordered by container ID
+func (c *StatsCollector) Latest() []StatsSample {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	samples := make([]StatsSample, 0, len(c.latest))
+	for _, sample := range c.latest {
+		samples = append(samples, sample)
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].ContainerID < samples[j].ContainerID })
+	return samples
+}
+
+// ServeHTTP serves the latest samples in the Prometheus text format
+func (c *StatsCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	WritePrometheus(w, c.Latest())
+}
+
+// promMetric is a metric of the Prometheus output
+type promMetric struct {
+	name  string
+	kind  string
+	help  string
+	value func(s *StatsSample) (float64, bool)
+}
+
+var promMetrics = []promMetric{
+	{"tianniu_container_cpu_usage_percent", "gauge", "CPU usage of the container, 100 being one core.",
+		func(s *StatsSample) (float64, bool) { return s.CPUPercent, true }},
+	{"tianniu_container_memory_usage_bytes", "gauge", "Memory used by the container.",
+		func(s *StatsSample) (float64, bool) { return float64(s.MemoryBytes), true }},
+	{"tianniu_container_memory_limit_bytes", "gauge", "Memory limit of the container.",
+		func(s *StatsSample) (float64, bool) { return float64(s.MemoryLimitBytes), s.MemoryLimitBytes > 0 }},
+	{"tianniu_container_network_receive_bytes_per_second", "gauge", "Network receive rate of the container.",
+		func(s *StatsSample) (float64, bool) { return s.NetworkRxRate, true }},
+	{"tianniu_container_network_transmit_bytes_per_second", "gauge", "Network transmit rate of the container.",
+		func(s *StatsSample) (float64, bool) { return s.NetworkTxRate, true }},
+	{"tianniu_container_network_receive_bytes_total", "counter", "Bytes received by the container.",
+		func(s *StatsSample) (float64, bool) { return float64(s.NetworkRxBytes), s.Source == "stats" }},
+	{"tianniu_container_network_transmit_bytes_total", "counter", "Bytes transmitted by the container.",
+		func(s *StatsSample) (float64, bool) { return float64(s.NetworkTxBytes), s.Source == "stats" }},
+	{"tianniu_container_block_read_bytes_total", "counter", "Bytes read from disk by the container.",
+		func(s *StatsSample) (float64, bool) { return float64(s.BlockReadBytes), s.Source == "stats" }},
+	{"tianniu_container_block_write_bytes_total", "counter", "Bytes written to disk by the container.",
+		func(s *StatsSample) (float64, bool) { return float64(s.BlockWriteBytes), s.Source == "stats" }},
+	{"tianniu_container_last_sample_timestamp_seconds", "gauge", "Time of the last sample of the container.",
+		func(s *StatsSample) (float64, bool) { return float64(s.Timestamp.UnixNano()) / 1e9, true }},
+}
+
+// WritePrometheus writes samples in the Prometheus text exposition format
+func WritePrometheus(w io.Writer, samples []StatsSample) error {
+	bw := bufio.NewWriter(w)
+	for _, metric := range promMetrics {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", metric.name, metric.help, metric.name, metric.kind)
+		for i := range samples {
+			value, ok := metric.value(&samples[i])
+			if !ok {
+				continue
+			}
+			fmt.Fprintf(bw, "%s{id=%s,name=%s} %s\n", metric.name,
+				promLabel(samples[i].ContainerID), promLabel(samples[i].Name), strconv.FormatFloat(value, 'g', -1, 64))
+		}
+	}
+	return bw.Flush()
+}
+
+// promLabel quotes a label value
+func promLabel(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+	return `"` + value + `"`
+}
+
+// WriteSamples appends samples to a time-series file, one JSON object per
+// line
+func WriteSamples(w io.Writer, samples []StatsSample) error {
+	enc := json.NewEncoder(w)
+	for i := range samples {
+		if err := enc.Encode(&samples[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadSamples reads a time-series file written by WriteSamples, keeping
+// the samples for which keep returns true. keep may be nil.
+func ReadSamples(r io.Reader, keep func(*StatsSample) bool) ([]StatsSample, error) {
+	var samples []StatsSample
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var sample StatsSample
+		if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if keep == nil || keep(&sample) {
+			samples = append(samples, sample)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
@@ -0,0 +1,248 @@
+package tianniu
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// Usage periods of the API. A period is the window one request covers; the
+// API picks the interval between data points, e.g. 1h for a day.
+const (
+	UsagePeriodHour  = "hour"
+	UsagePeriodDay   = "day"
+	UsagePeriodWeek  = "week"
+	UsagePeriodMonth = "month"
+)
+
+// usagePeriods are the periods from the shortest, with the window each
+// covers
+var usagePeriods = []struct {
+	name   string
+	window time.Duration
+}{
+	{UsagePeriodHour, time.Hour},
+	{UsagePeriodDay, 24 * time.Hour},
+	{UsagePeriodWeek, 7 * 24 * time.Hour},
+	{UsagePeriodMonth, 30 * 24 * time.Hour},
+}
+
+// UsageReport is the resource usage of the cluster, or of a namespace, over
+// a time range
+type UsageReport struct {
+	Namespace string                 `json:"namespace,omitempty"`
+	Period    string                 `json:"period"`
+	StartTime time.Time              `json:"start_time"`
+	EndTime   time.Time              `json:"end_time"`
+	Interval  string                 `json:"interval"`
+	Resources map[string]UsageSeries `json:"resources"`
+}
+
+// UsageSeries are the data points of one resource type. Capacity is set in
+// cluster reports and Quota in namespace reports.
+type UsageSeries struct {
+	Capacity   float64      `json:"capacity,omitempty"`
+	Quota      float64      `json:"quota,omitempty"`
+	Unit       string       `json:"unit,omitempty"`
+	DataPoints []UsagePoint `json:"data_points"`
+}
+
+// Limit returns the capacity or quota the usage is measured against
+func (s UsageSeries) Limit() float64 {
+	if s.Capacity > 0 {
+		return s.Capacity
+	}
+	return s.Quota
+}
+
+// UsagePoint is the usage at one time. Network points report Ingress,
+// Egress and their Total instead of Usage.
+type UsagePoint struct {
+	Timestamp    time.Time `json:"timestamp"`
+	Usage        float64   `json:"usage,omitempty"`
+	UsagePercent float64   `json:"usage_percent"`
+	Ingress      float64   `json:"ingress,omitempty"`
+	Egress       float64   `json:"egress,omitempty"`
+	Total        float64   `json:"total,omitempty"`
+}
+
+// Value returns the usage of the point, which is Total for network points
+func (p UsagePoint) Value() float64 {
+	if p.Usage == 0 {
+		return p.Total
+	}
+	return p.Usage
+}
+
+// UsageOptions selects the usage returned by Usage. Zero-valued fields are
+// not sent; the API defaults to the last hour of the cluster.
+type UsageOptions struct {
+	Namespace string
+	Period    string
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+// Usage gets the resource usage of the cluster, or of opts.Namespace, in
+// one request
+func (s *ResourcesService) Usage(ctx context.Context, opts UsageOptions) (*UsageReport, error) {
+	path := "/resources/usage"
+	if opts.Namespace != "" {
+		path += "/" + url.PathEscape(opts.Namespace)
+	}
+	query := url.Values{}
+	if opts.Period != "" {
+		query.Set("period", opts.Period)
+	}
+	if !opts.StartTime.IsZero() {
+		query.Set("start_time", opts.StartTime.UTC().Format(time.RFC3339))
+	}
+	if !opts.EndTime.IsZero() {
+		query.Set("end_time", opts.EndTime.UTC().Format(time.RFC3339))
+	}
+
+	var report UsageReport
+	if err := s.client.call(ctx, "GET", path, query, nil, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// UsageRange gets the resource usage between start and end, which may span
+// any length of time. It uses the shortest period covering the range, and
+// ranges longer than a month are fetched a month at a time and merged.
+func (s *ResourcesService) UsageRange(ctx context.Context, namespace string, start, end time.Time) (*UsageReport, error) {
+	if !start.Before(end) {
+		return nil, fmt.Errorf("start time %s is not before end time %s", start.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+	period := usagePeriods[len(usagePeriods)-1]
+	for _, p := range usagePeriods {
+		if end.Sub(start) <= p.window {
+			period = p
+			break
+		}
+	}
+
+	merged := &UsageReport{Namespace: namespace, Period: period.name, StartTime: start, EndTime: end, Resources: make(map[string]UsageSeries)}
+	for from := start; from.Before(end); from = from.Add(period.window) {
+		to := from.Add(period.window)
+		if to.After(end) {
+			to = end
+		}
+		report, err := s.Usage(ctx, UsageOptions{Namespace: namespace, Period: period.name, StartTime: from, EndTime: to})
+		if err != nil {
+			return nil, err
+		}
+		if merged.Interval == "" {
+			merged.Interval = report.Interval
+		}
+		merged.merge(report)
+	}
+	return merged, nil
+}
+
+// merge appends the data points of report within the range of r, skipping
+// those not after the last point already merged
+func (r *UsageReport) merge(report *UsageReport) {
+	for name, series := range report.Resources {
+		into, ok := r.Resources[name]
+		if !ok {
+			into = UsageSeries{Capacity: series.Capacity, Quota: series.Quota, Unit: series.Unit}
+		}
+		for _, p := range series.DataPoints {
+			if p.Timestamp.Before(r.StartTime) || !p.Timestamp.Before(r.EndTime) {
+				continue
+			}
+			if n := len(into.DataPoints); n > 0 && !p.Timestamp.After(into.DataPoints[n-1].Timestamp) {
+				continue
+			}
+			into.DataPoints = append(into.DataPoints, p)
+		}
+		r.Resources[name] = into
+	}
+}
+
+// UsageSummary aggregates the data points of one resource type
+type UsageSummary struct {
+	ResourceType   string    `json:"resource_type"`
+	Unit           string    `json:"unit,omitempty"`
+	Limit          float64   `json:"limit,omitempty"`
+	Samples        int       `json:"samples"`
+	Peak           float64   `json:"peak"`
+	PeakTime       time.Time `json:"peak_time"`
+	PeakPercent    float64   `json:"peak_percent"`
+	Average        float64   `json:"average"`
+	AveragePercent float64   `json:"average_percent"`
+	P95            float64   `json:"p95"`
+	P95Percent     float64   `json:"p95_percent"`
+}
+
+// Summaries computes the peak, average and 95th percentile of each resource
+// type of the report, sorted by resource type. Types without data points
+// are left out.
+func (r *UsageReport) Summaries() []UsageSummary {
+	names := make([]string, 0, len(r.Resources))
+	for name := range r.Resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	summaries := make([]UsageSummary, 0, len(names))
+	for _, name := range names {
+		series := r.Resources[name]
+		if len(series.DataPoints) == 0 {
+			continue
+		}
+		summary := UsageSummary{ResourceType: name, Unit: series.Unit, Limit: series.Limit(), Samples: len(series.DataPoints)}
+		values := make([]float64, len(series.DataPoints))
+		percents := make([]float64, len(series.DataPoints))
+		for i, p := range series.DataPoints {
+			values[i], percents[i] = p.Value(), series.percent(p)
+			if i == 0 || values[i] > summary.Peak {
+				summary.Peak, summary.PeakTime, summary.PeakPercent = values[i], p.Timestamp, percents[i]
+			}
+			summary.Average += values[i]
+			summary.AveragePercent += percents[i]
+		}
+		summary.Average /= float64(len(values))
+		summary.AveragePercent /= float64(len(values))
+		summary.P95 = percentile(values, 95)
+		summary.P95Percent = percentile(percents, 95)
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+// Percents returns the usage percentage of each data point
+func (s UsageSeries) Percents() []float64 {
+	percents := make([]float64, len(s.DataPoints))
+	for i, p := range s.DataPoints {
+		percents[i] = s.percent(p)
+	}
+	return percents
+}
+
+// percent is the usage percentage of p, computed from the limit when the
+// API leaves it out
+func (s UsageSeries) percent(p UsagePoint) float64 {
+	if p.UsagePercent == 0 && s.Limit() > 0 {
+		return p.Value() / s.Limit() * 100
+	}
+	return p.UsagePercent
+}
+
+// percentile returns the nearest-rank percentile of values, which it sorts
+func percentile(values []float64, pct float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	rank := int(math.Ceil(pct / 100 * float64(len(values))))
+	if rank < 1 {
+		rank = 1
+	}
+	return values[rank-1]
+}
@@ -0,0 +1,302 @@
+package tianniu
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// FieldError is a problem with one field of a spec. Field is the JSON path
+// of the field, e.g. "containers[0].health_check.port".
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationErrors lists every problem found while validating a spec
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	problems := make([]string, len(e))
+	for i, fe := range e {
+		problems[i] = fe.Error()
+	}
+	return "invalid spec:\n  - " + strings.Join(problems, "\n  - ")
+}
+
+// Deployment strategy types
+const (
+	StrategyRollingUpdate = "rolling-update"
+	StrategyRecreate      = "recreate"
+)
+
+var (
+	dnsLabelPattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	envNamePattern  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	serviceTypes    = []string{"ClusterIP", "NodePort", "LoadBalancer"}
+)
+
+// validator collects field errors
+type validator struct {
+	errs ValidationErrors
+}
+
+func (v *validator) add(field, format string, args ...interface{}) {
+	v.errs = append(v.errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// Validate checks a deployment spec before it is submitted. All problems are
+// returned together as ValidationErrors. Fields set by the server, such as
+// the ID and status, are not checked.
+func (d *Deployment) Validate() error {
+	v := &validator{}
+
+	if d.Name == "" {
+		v.add("name", "is required")
+	} else if len(d.Name) > 63 || !dnsLabelPattern.MatchString(d.Name) {
+		v.add("name", "%q must be lowercase letters, digits and '-', at most 63 characters", d.Name)
+	}
+	if d.Environment == "" {
+		v.add("environment", "is required")
+	}
+	if d.Version == "" {
+		v.add("version", "is required")
+	}
+	if d.Replicas < 0 {
+		v.add("replicas", "must not be negative")
+	}
+
+	s := d.Strategy
+	switch s.Type {
+	case "", StrategyRollingUpdate, StrategyRecreate:
+	default:
+		v.add("strategy.type", "unsupported strategy %q (use %s or %s)", s.Type, StrategyRollingUpdate, StrategyRecreate)
+	}
+	if s.MaxSurge < 0 {
+		v.add("strategy.max_surge", "must not be negative")
+	}
+	if s.MaxUnavailable < 0 {
+		v.add("strategy.max_unavailable", "must not be negative")
+	}
+	if s.MaxUnavailable > d.Replicas {
+		v.add("strategy.max_unavailable", "%d is greater than replicas (%d)", s.MaxUnavailable, d.Replicas)
+	}
+	if s.Type == StrategyRecreate && (s.MaxSurge != 0 || s.MaxUnavailable != 0) {
+		v.add("strategy", "max_surge and max_unavailable only apply to %s", StrategyRollingUpdate)
+	}
+
+	if len(d.Containers) == 0 {
+		v.add("containers", "at least one container is required")
+	}
+	containerNames := map[string]bool{}
+	servicePorts := map[int]string{}
+	for i := range d.Containers {
+		c := &d.Containers[i]
+		path := fmt.Sprintf("containers[%d]", i)
+		if c.Name == "" {
+			v.add(path+".name", "is required")
+		} else if containerNames[c.Name] {
+			v.add(path+".name", "duplicate container name %q", c.Name)
+		}
+		containerNames[c.Name] = true
+		validateDeploymentContainer(v, path, c, servicePorts)
+	}
+
+	serviceNames := map[string]bool{}
+	for i, svc := range d.Services {
+		path := fmt.Sprintf("services[%d]", i)
+		if svc.Name == "" {
+			v.add(path+".name", "is required")
+		} else if serviceNames[svc.Name] {
+			v.add(path+".name", "duplicate service name %q", svc.Name)
+		}
+		serviceNames[svc.Name] = true
+		if svc.Type != "" && !containsString(serviceTypes, svc.Type) {
+			v.add(path+".type", "unsupported service type %q (use %s)", svc.Type, strings.Join(serviceTypes, ", "))
+		}
+		if len(svc.Ports) == 0 {
+			v.add(path+".ports", "at least one port is required")
+		}
+		ports := map[int]bool{}
+		for j, p := range svc.Ports {
+			portPath := fmt.Sprintf("%s.ports[%d]", path, j)
+			if !validPort(p.Port) {
+				v.add(portPath+".port", "%d is not a valid port", p.Port)
+			} else if ports[p.Port] {
+				v.add(portPath+".port", "port %d is used twice", p.Port)
+			}
+			ports[p.Port] = true
+			if _, ok := servicePorts[p.TargetPort]; !ok {
+				v.add(portPath+".target_port", "%d matches no service_port of the containers", p.TargetPort)
+			}
+		}
+	}
+
+	return v.err()
+}
+
+// validateDeploymentContainer checks one container of a deployment.
+// servicePorts maps the service ports seen so far to their field path, to
+// detect collisions between containers.
+func validateDeploymentContainer(v *validator, path string, c *DeploymentContainer, servicePorts map[int]string) {
+	if c.Image == "" {
+		v.add(path+".image", "is required")
+	}
+
+	containerPorts := map[int]bool{}
+	portNames := map[string]bool{}
+	for j, p := range c.Ports {
+		portPath := fmt.Sprintf("%s.ports[%d]", path, j)
+		if p.Name != "" {
+			if portNames[p.Name] {
+				v.add(portPath+".name", "duplicate port name %q", p.Name)
+			}
+			portNames[p.Name] = true
+		}
+		if !validPort(p.ContainerPort) {
+			v.add(portPath+".container_port", "%d is not a valid port", p.ContainerPort)
+		} else if containerPorts[p.ContainerPort] {
+			v.add(portPath+".container_port", "port %d is used twice", p.ContainerPort)
+		}
+		containerPorts[p.ContainerPort] = true
+
+		if p.ServicePort == 0 {
+			continue
+		}
+		if !validPort(p.ServicePort) {
+			v.add(portPath+".service_port", "%d is not a valid port", p.ServicePort)
+		} else if other, ok := servicePorts[p.ServicePort]; ok {
+			v.add(portPath+".service_port", "%d collides with %s", p.ServicePort, other)
+		} else {
+			servicePorts[p.ServicePort] = portPath + ".service_port"
+		}
+	}
+
+	validateResources(v, path+".resources", c.Resources)
+
+	names := map[string]bool{}
+	for j, env := range c.EnvironmentVariables {
+		envPath := fmt.Sprintf("%s.environment_variables[%d]", path, j)
+		if !envNamePattern.MatchString(env.Name) {
+			v.add(envPath+".name", "%q is not a valid variable name", env.Name)
+		} else if names[env.Name] {
+			v.add(envPath+".name", "duplicate variable %q", env.Name)
+		}
+		names[env.Name] = true
+		if env.ValueFrom != nil {
+			if env.Value != "" {
+				v.add(envPath, "value and value_from are mutually exclusive")
+			}
+			if env.ValueFrom.SecretName == "" || env.ValueFrom.Key == "" {
+				v.add(envPath+".value_from", "secret_name and key are required")
+			}
+		}
+	}
+
+	if h := c.HealthCheck; h != nil {
+		hcPath := path + ".health_check"
+		kinds := 0
+		for _, set := range []bool{h.HTTPPath != "" || h.Port != 0, h.TCPPort != 0, len(h.Command) > 0} {
+			if set {
+				kinds++
+			}
+		}
+		switch {
+		case kinds == 0:
+			v.add(hcPath, "one of http_path, tcp_port and command is required")
+		case kinds > 1:
+			v.add(hcPath, "http_path, tcp_port and command are mutually exclusive")
+		case h.TCPPort != 0:
+			if !containerPorts[h.TCPPort] {
+				v.add(hcPath+".tcp_port", "%d matches no container_port of %s", h.TCPPort, path)
+			}
+		case len(h.Command) > 0:
+		default:
+			if !strings.HasPrefix(h.HTTPPath, "/") {
+				v.add(hcPath+".http_path", "%q must start with /", h.HTTPPath)
+			}
+			if !containerPorts[h.Port] {
+				v.add(hcPath+".port", "%d matches no container_port of %s", h.Port, path)
+			}
+		}
+		for _, f := range []struct {
+			name  string
+			value int
+		}{
+			{"initial_delay_seconds", h.InitialDelaySeconds},
+			{"period_seconds", h.PeriodSeconds},
+			{"timeout_seconds", h.TimeoutSeconds},
+			{"success_threshold", h.SuccessThreshold},
+			{"failure_threshold", h.FailureThreshold},
+		} {
+			if f.value < 0 {
+				v.add(hcPath+"."+f.name, "must not be negative")
+			}
+		}
+		if h.PeriodSeconds > 0 && h.TimeoutSeconds > h.PeriodSeconds {
+			v.add(hcPath+".timeout_seconds", "%d is longer than period_seconds (%d)", h.TimeoutSeconds, h.PeriodSeconds)
+		}
+	}
+}
+
+// validateResources checks that the requests are set, that CPU and memory
+// are written in units that suit them, and that no request exceeds its limit
+func validateResources(v *validator, path string, r ResourceRequirements) {
+	for _, q := range []struct {
+		field   string
+		request Quantity
+		limit   Quantity
+	}{
+		{"cpu", r.Requests.CPU, r.Limits.CPU},
+		{"memory", r.Requests.Memory, r.Limits.Memory},
+	} {
+		requestPath := path + ".requests." + q.field
+		limitPath := path + ".limits." + q.field
+
+		if q.request.IsZero() {
+			v.add(requestPath, "is required")
+		}
+		valid := true
+		for _, f := range []struct {
+			path     string
+			quantity Quantity
+		}{{requestPath, q.request}, {limitPath, q.limit}} {
+			if msg := checkQuantity(q.field, f.quantity); msg != "" {
+				v.add(f.path, "%s", msg)
+				valid = false
+			}
+		}
+		if valid && !q.request.IsZero() && !q.limit.IsZero() && q.request.Cmp(q.limit) > 0 {
+			v.add(requestPath, "%s is greater than the limit %s", q.request, q.limit)
+		}
+	}
+}
+
+// checkQuantity returns what is wrong with a CPU or memory quantity, if
+// anything
+func checkQuantity(resource string, q Quantity) string {
+	switch {
+	case q.MilliValue() < 0:
+		return fmt.Sprintf("%s must not be negative", q)
+	case resource == "cpu" && q.Format() != DecimalSI:
+		return fmt.Sprintf("%s is not a CPU quantity (use cores or millicores, e.g. 0.5 or 500m)", q)
+	case resource == "memory" && q.MilliValue()%1000 != 0:
+		return fmt.Sprintf("%s is not a whole number of bytes", q)
+	}
+	return ""
+}
+
+func validPort(port int) bool {
+	return port >= 1 && port <= 65535
+}
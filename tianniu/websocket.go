@@ -0,0 +1,230 @@
+package tianniu
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// This file holds the small subset of RFC 6455 used by exec sessions:
+// binary messages, ping/pong and close. Text messages and extensions are
+// not used.
+
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+
+	wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	// wsMaxMessage bounds a message read from the peer
+	wsMaxMessage = 16 << 20
+)
+
+// wsConn is a WebSocket connection. Reads must come from one goroutine;
+// writes may come from several.
+type wsConn struct {
+	rw     io.ReadWriteCloser
+	r      *bufio.Reader
+	client bool
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func newWSConn(rw io.ReadWriteCloser, r *bufio.Reader, client bool) *wsConn {
+	if r == nil {
+		r = bufio.NewReader(rw)
+	}
+	return &wsConn{rw: rw, r: r, client: client}
+}
+
+// wsAccept is the Sec-WebSocket-Accept value of a handshake key
+func wsAccept(key string) string {
+	sum := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// wsKey returns a random Sec-WebSocket-Key
+func wsKey() (string, error) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// wsUpgrade answers a WebSocket handshake with the given subprotocol and
+// takes over the connection
+func wsUpgrade(w http.ResponseWriter, r *http.Request, protocol string) (*wsConn, error) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || r.Header.Get("Sec-WebSocket-Key") == "" {
+		http.Error(w, "WebSocket upgrade required", http.StatusBadRequest)
+		return nil, fmt.Errorf("not a WebSocket handshake")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return nil, fmt.Errorf("response writer cannot be hijacked")
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(buf, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n", wsAccept(r.Header.Get("Sec-WebSocket-Key")))
+	if protocol != "" {
+		fmt.Fprintf(buf, "Sec-WebSocket-Protocol: %s\r\n", protocol)
+	}
+	buf.WriteString("\r\n")
+	if err := buf.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return newWSConn(conn, buf.Reader, false), nil
+}
+
+// WriteMessage sends a binary message
+func (c *wsConn) WriteMessage(data []byte) error {
+	return c.writeFrame(wsBinary, data)
+}
+
+// writeFrame sends one final frame. Client frames are masked as the
+// protocol requires.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	header := make([]byte, 2, 14)
+	header[0] = 0x80 | opcode
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	frame := payload
+	if c.client {
+		header[1] |= 0x80
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		header = append(header, mask[:]...)
+		frame = make([]byte, len(payload))
+		for i, b := range payload {
+			frame[i] = b ^ mask[i%4]
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return io.ErrClosedPipe
+	}
+	if _, err := c.rw.Write(append(header, frame...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReadMessage returns the next data message, answering pings on the way.
+// A close from the peer returns io.EOF.
+func (c *wsConn) ReadMessage() ([]byte, error) {
+	var message []byte
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case wsPing:
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			c.writeFrame(wsClose, payload)
+			return nil, io.EOF
+		case wsText, wsBinary, wsContinuation:
+			message = append(message, payload...)
+			if len(message) > wsMaxMessage {
+				return nil, fmt.Errorf("websocket message exceeds %d bytes", wsMaxMessage)
+			}
+			if fin {
+				return message, nil
+			}
+		default:
+			return nil, fmt.Errorf("unknown websocket opcode %d", opcode)
+		}
+	}
+}
+
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(c.r, header[:]); err != nil {
+		return
+	}
+	fin, opcode = header[0]&0x80 != 0, header[0]&0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > wsMaxMessage {
+		err = fmt.Errorf("websocket frame exceeds %d bytes", wsMaxMessage)
+		return
+	}
+	if masked == c.client {
+		err = errors.New("websocket frame masking violates the protocol")
+		return
+	}
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(c.r, mask[:]); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.r, payload); err != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return
+}
+
+// Close sends a normal close frame and closes the connection
+func (c *wsConn) Close() error {
+	c.writeFrame(wsClose, []byte{0x03, 0xE8})
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	return c.rw.Close()
+}